@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Merge combines the fields of metrics that share the same measurement name,
+// tags and timestamp into a single metric.
+type Merge struct {
+	cache map[mergeKey]*mergedMetric
+}
+
+type mergeKey struct {
+	id   uint64
+	nsec int64
+}
+
+type mergedMetric struct {
+	name   string
+	tags   map[string]string
+	fields map[string]interface{}
+	t      time.Time
+}
+
+func NewMerge() Aggregator {
+	m := &Merge{}
+	m.Reset()
+	return m
+}
+
+var mergeSampleConfig = `
+  ## General Aggregator Arguments:
+  ## The period on which to flush & clear the aggregator.
+  period = "30s"
+  ## If true, periods are aligned to wall-clock boundaries, ie, with a "1m"
+  ## period every aggregate covers :00 to :59.
+  # align_period = false
+  ## If true, the original metric will be dropped by the
+  ## aggregator and will not get sent to the output plugins.
+  drop_original = true
+`
+
+func (_ *Merge) SampleConfig() string {
+	return mergeSampleConfig
+}
+
+func (_ *Merge) Description() string {
+	return "Merge metrics with the same series and timestamp into one metric"
+}
+
+func (m *Merge) Add(in Metric) {
+	key := mergeKey{id: in.HashID(), nsec: in.UnixNano()}
+	merged, ok := m.cache[key]
+	if !ok {
+		merged = &mergedMetric{
+			name:   in.Name(),
+			tags:   in.Tags(),
+			fields: make(map[string]interface{}),
+			t:      in.Time(),
+		}
+		m.cache[key] = merged
+	}
+
+	for k, v := range in.Fields() {
+		if old, ok := merged.fields[k]; ok && old != v {
+			log.Printf("W! Merging [%s]: field [%s] is set more than once, "+
+				"keeping the last value", merged.name, k)
+		}
+		merged.fields[k] = v
+	}
+}
+
+func (m *Merge) Push(acc Accumulator) {
+	for _, merged := range m.cache {
+		acc.AddFields(merged.name, merged.fields, merged.tags, merged.t)
+	}
+}
+
+func (m *Merge) Reset() {
+	m.cache = make(map[mergeKey]*mergedMetric)
+}
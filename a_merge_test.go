@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeTwoPartialMetrics(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	tags := map[string]string{"host": "web01"}
+	m1, _ := New("system", tags, map[string]interface{}{"load1": 0.5}, now)
+	m2, _ := New("system", tags, map[string]interface{}{"n_cpus": int64(4)}, now)
+	// a later conflicting value wins
+	m3, _ := New("system", tags, map[string]interface{}{"load1": 0.6}, now)
+	other, _ := New("system", tags, map[string]interface{}{"load1": 0.7},
+		now.Add(time.Second))
+
+	mg := NewMerge()
+	mg.Add(m1)
+	mg.Add(m2)
+	mg.Add(m3)
+	mg.Add(other)
+
+	metricC := make(chan Metric, 10)
+	ra := NewRunningAggregator(mg, &AggregatorConfig{Name: "merge"})
+	mg.Push(NewAccumulator(ra, metricC))
+	close(metricC)
+
+	var merged []Metric
+	for m := range metricC {
+		if m.Time().Equal(now) {
+			merged = append(merged, m)
+		}
+	}
+	if len(merged) != 1 {
+		t.Fatalf("expected 1 merged metric, got %d", len(merged))
+	}
+	want := map[string]interface{}{"load1": 0.6, "n_cpus": int64(4)}
+	if fields := merged[0].Fields(); !reflect.DeepEqual(fields, want) {
+		t.Errorf("expected the fields %v, got %v", want, fields)
+	}
+	if tags := merged[0].Tags(); tags["host"] != "web01" {
+		t.Errorf("expected the tags to be kept, got %v", tags)
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"log"
+	"sync/atomic"
 	"time"
 )
 
@@ -9,6 +9,10 @@ var (
 	NErrors Stat
 )
 
+// metricSequence numbers the metrics of all the accumulators in the order
+// they are added, accessed atomically.
+var metricSequence uint64
+
 type MetricMaker interface {
 	Name() string
 	MakeMetric(
@@ -28,6 +32,8 @@ func NewAccumulator(
 		maker:     maker,
 		metrics:   metrics,
 		precision: time.Nanosecond,
+		clock:     RealClock,
+		errors:    &errorThrottle{},
 	}
 	return &acc
 }
@@ -38,6 +44,33 @@ type accumulator struct {
 	maker MetricMaker
 
 	precision time.Duration
+
+	// clock timestamps the metrics that are added without a time
+	clock Clock
+
+	// errors throttles the logging of repeated errors
+	errors *errorThrottle
+
+	// limiter, when set, caps the metrics added in a single gather
+	limiter *metricLimiter
+
+	// sequenced numbers the metrics as they are added, see preserve_order
+	sequenced bool
+}
+
+// add sends a metric made by the maker to the agent, unless it is nil or
+// over the limit of the gather.
+func (ac *accumulator) add(m Metric) {
+	if m == nil {
+		return
+	}
+	if ac.limiter != nil && !ac.limiter.allow() {
+		return
+	}
+	if ac.sequenced {
+		m.SetSequence(atomic.AddUint64(&metricSequence, 1))
+	}
+	ac.metrics <- m
 }
 
 func (ac *accumulator) AddFields(
@@ -46,9 +79,7 @@ func (ac *accumulator) AddFields(
 	tags map[string]string,
 	t ...time.Time,
 ) {
-	if m := ac.maker.MakeMetric(measurement, fields, tags, Untyped, ac.getTime(t)); m != nil {
-		ac.metrics <- m
-	}
+	ac.add(ac.maker.MakeMetric(measurement, fields, tags, Untyped, ac.getTime(t)))
 }
 
 func (ac *accumulator) AddGauge(
@@ -57,9 +88,7 @@ func (ac *accumulator) AddGauge(
 	tags map[string]string,
 	t ...time.Time,
 ) {
-	if m := ac.maker.MakeMetric(measurement, fields, tags, Gauge, ac.getTime(t)); m != nil {
-		ac.metrics <- m
-	}
+	ac.add(ac.maker.MakeMetric(measurement, fields, tags, Gauge, ac.getTime(t)))
 }
 
 func (ac *accumulator) AddCounter(
@@ -68,9 +97,7 @@ func (ac *accumulator) AddCounter(
 	tags map[string]string,
 	t ...time.Time,
 ) {
-	if m := ac.maker.MakeMetric(measurement, fields, tags, Counter, ac.getTime(t)); m != nil {
-		ac.metrics <- m
-	}
+	ac.add(ac.maker.MakeMetric(measurement, fields, tags, Counter, ac.getTime(t)))
 }
 
 func (ac *accumulator) AddSummary(
@@ -79,9 +106,7 @@ func (ac *accumulator) AddSummary(
 	tags map[string]string,
 	t ...time.Time,
 ) {
-	if m := ac.maker.MakeMetric(measurement, fields, tags, Summary, ac.getTime(t)); m != nil {
-		ac.metrics <- m
-	}
+	ac.add(ac.maker.MakeMetric(measurement, fields, tags, Summary, ac.getTime(t)))
 }
 
 func (ac *accumulator) AddHistogram(
@@ -90,20 +115,18 @@ func (ac *accumulator) AddHistogram(
 	tags map[string]string,
 	t ...time.Time,
 ) {
-	if m := ac.maker.MakeMetric(measurement, fields, tags, Histogram, ac.getTime(t)); m != nil {
-		ac.metrics <- m
-	}
+	ac.add(ac.maker.MakeMetric(measurement, fields, tags, Histogram, ac.getTime(t)))
 }
 
 // AddError passes a runtime error to the accumulator.
-// The error will be tagged with the plugin name and written to the log.
+// The error will be tagged with the plugin name and written to the log,
+// consecutive duplicates are summarized rather than logged each time.
 func (ac *accumulator) AddError(err error) {
 	if err == nil {
 		return
 	}
 	NErrors.Incr(1)
-	//TODO suppress/throttle consecutive duplicate errors?
-	log.Printf("E! Error in plugin [%s]: %s", ac.maker.Name(), err)
+	ac.errors.report(ac.maker.Name(), err, ac.clock.Now())
 }
 
 // SetPrecision takes two time.Duration objects. If the first is non-zero,
@@ -132,7 +155,7 @@ func (ac accumulator) getTime(t []time.Time) time.Time {
 	if len(t) > 0 {
 		timestamp = t[0]
 	} else {
-		timestamp = time.Now()
+		timestamp = ac.clock.Now()
 	}
 	return timestamp.Round(ac.precision)
 }
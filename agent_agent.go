@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"runtime"
@@ -9,39 +10,143 @@ import (
 	"fmt"
 )
 
+// HostnameResolver returns the hostname used for the host tag when the config
+// sets none. It can be replaced, ie, in tests or when embedding the agent in
+// a container where os.Hostname is not the name to report.
+var HostnameResolver = os.Hostname
+
 // Agent runs telegraf and collects data based on the given config
 type Agent struct {
 	Config *Config
+
+	tagLimiter   *tagValueLimiter
+	lowercaser   *tagLowercaser
+	fieldLimiter *fieldLimiter
+	monotonic    *monotonicClock
+	futureSkew   *futureSkew
+	health       *health
+
+	// clock is the source of time of the gather and flush schedules and of
+	// the metric timestamps.
+	clock Clock
 }
 
 // NewAgent returns an Agent struct based off the given Config
 func NewAgent(config *Config) (*Agent, error) {
 	a := &Agent{
 		Config: config,
+		clock:  RealClock,
 	}
 
-	if !a.Config.Agent.OmitHostname {
-		if a.Config.Agent.Hostname == "" {
-			hostname, err := os.Hostname()
-			if err != nil {
-				return nil, err
-			}
+	if err := a.setHostnameDefault(); err != nil {
+		return nil, err
+	}
 
-			a.Config.Agent.Hostname = hostname
+	if a.Config.Agent.JitterSeed != 0 {
+		SetJitterSeed(a.Config.Agent.JitterSeed)
+	}
+
+	if a.Config.Agent.MaxTagValues > 0 {
+		a.tagLimiter = newTagValueLimiter(a.Config.Agent.MaxTagValues)
+	}
+
+	if a.Config.Agent.LowercaseTagKeys || a.Config.Agent.LowercaseTagValues {
+		a.lowercaser = &tagLowercaser{
+			keys:   a.Config.Agent.LowercaseTagKeys,
+			values: a.Config.Agent.LowercaseTagValues,
 		}
+	}
 
-		config.Tags["host"] = a.Config.Agent.Hostname
+	if a.Config.Agent.MaxFieldsPerMetric > 0 {
+		switch action := a.Config.Agent.MaxFieldsAction; action {
+		case "", FieldLimitSplit, FieldLimitDrop:
+			a.fieldLimiter = newFieldLimiter(a.Config.Agent.MaxFieldsPerMetric,
+				action)
+		default:
+			return nil, fmt.Errorf("invalid max_fields_action %q", action)
+		}
+	}
+
+	if a.Config.Agent.MaxMetricsPerInterval > 0 {
+		switch action := a.Config.Agent.MaxMetricsAction; action {
+		case "", MetricLimitDrop, MetricLimitSample:
+		default:
+			return nil, fmt.Errorf("invalid max_metrics_action %q", action)
+		}
+	}
+
+	if a.Config.Agent.MonotonicTime {
+		a.monotonic = newMonotonicClock(a.clock.Now)
+	}
+
+	if max := a.Config.Agent.MaxFutureSkew.Duration; max != 0 {
+		if max < 0 {
+			return nil, fmt.Errorf("invalid max_future_skew %s, cannot be negative", max)
+		}
+		switch action := a.Config.Agent.MaxFutureSkewAction; action {
+		case "", FutureSkewDrop, FutureSkewClamp:
+			a.futureSkew = newFutureSkew(max, action, a.clock)
+		default:
+			return nil, fmt.Errorf("invalid max_future_skew_action %q", action)
+		}
+	}
+
+	if n := a.Config.Agent.MaxStringFieldLength; n < 0 {
+		return nil, fmt.Errorf("invalid max_string_field_length %d, cannot be negative", n)
+	}
+
+	if n := a.Config.Agent.MaxExecProcesses; n < 0 {
+		return nil, fmt.Errorf("invalid max_exec_processes %d, cannot be negative", n)
+	}
+	SetMaxExecProcesses(a.Config.Agent.MaxExecProcesses)
+
+	if n := a.Config.Agent.MaxProcs; n < 0 {
+		return nil, fmt.Errorf("invalid max_procs %d, cannot be negative", n)
 	}
 
 	return a, nil
 }
 
+// newAccumulator returns an accumulator that timestamps the metrics with the
+// clock of the agent, and numbers them when preserve_order is set.
+func (a *Agent) newAccumulator(maker MetricMaker, metricC chan Metric) *accumulator {
+	acc := NewAccumulator(maker, metricC)
+	acc.clock = a.clock
+	acc.sequenced = a.Config.Agent.PreserveOrder
+	return acc
+}
+
+// setHostnameDefault sets the host tag, to the configured hostname or the one
+// given by HostnameResolver, unless omit_hostname is set.
+func (a *Agent) setHostnameDefault() error {
+	if a.Config.Agent.OmitHostname {
+		return nil
+	}
+	if a.Config.Agent.Hostname == "" {
+		hostname, err := HostnameResolver()
+		if err != nil {
+			return err
+		}
+
+		a.Config.Agent.Hostname = hostname
+	}
+
+	a.Config.Tags["host"] = a.Config.Agent.Hostname
+	return nil
+}
+
 // Connect connects to all configured outputs
 func (a *Agent) Connect() error {
 	for _, o := range a.Config.Outputs {
 
 		log.Printf("D! Attempting connection to output: %s\n", o.Name)
 		err := o.Output.Connect()
+		if err != nil && a.Config.Agent.BufferBeforeConnect {
+			log.Printf("W! Failed to connect to output %s, buffering its "+
+				"metrics and retrying on each write, error was '%s'", o.Name, err)
+			o.SetDisconnected()
+			continue
+		}
 		if err != nil {
 			log.Printf("E! Failed to connect to output %s, retrying in 15s, "+
 				"error was '%s' \n", o.Name, err)
@@ -92,45 +197,61 @@ func (a *Agent) gatherer(
 		map[string]string{"input": input.Config.Name},
 	)
 
-	acc := NewAccumulator(input, metricC)
+	acc := a.newAccumulator(input, metricC)
 	acc.SetPrecision(a.Config.Agent.Precision.Duration,
 		a.Config.Agent.Interval.Duration)
+	if max := a.Config.Agent.MaxMetricsPerInterval; max > 0 {
+		acc.limiter = newMetricLimiter(input.Config.Name, max,
+			a.Config.Agent.MaxMetricsAction)
+	}
 
-	ticker := time.NewTicker(interval)
+	ticker := a.clock.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
-		RandomSleep(a.Config.Agent.CollectionJitter.Duration, shutdown)
+		randomSleep(a.clock, a.Config.Agent.CollectionJitter.Duration, shutdown)
 
-		start := time.Now()
-		gatherWithTimeout(shutdown, input, acc, interval)
-		elapsed := time.Since(start)
+		start := a.clock.Now()
+		a.gatherWithTimeout(shutdown, input, acc, interval)
+		elapsed := a.clock.Now().Sub(start)
+		a.health.gathered()
 
 		GatherTime.Incr(elapsed.Nanoseconds())
 
 		select {
 		case <-shutdown:
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			continue
 		}
 	}
 }
 
-// gatherWithTimeout gathers from the given input, with the given timeout.
+// gatherWithTimeout gathers from the given input, with the given timeout,
+// unless the input is outside of its collection window.
 //   when the given timeout is reached, gatherWithTimeout logs an error message
 //   but continues waiting for it to return. This is to avoid leaving behind
 //   hung processes, and to prevent re-calling the same hung process over and
 //   over.
-func gatherWithTimeout(
+func (a *Agent) gatherWithTimeout(
 	shutdown chan struct{},
 	input *RunningInput,
 	acc *accumulator,
 	timeout time.Duration,
 ) {
-	ticker := time.NewTicker(timeout)
+	if !input.InWindow(a.clock.Now()) {
+		log.Printf("D! Input [%s] is outside of its collection window, skipping",
+			input.Config.Name)
+		return
+	}
+
+	ticker := a.clock.NewTicker(timeout)
 	defer ticker.Stop()
 	done := make(chan error)
+	acc.errors.startGather()
+	if acc.limiter != nil {
+		acc.limiter.startGather()
+	}
 	go func() {
 		done <- input.Input.Gather(acc)
 	}()
@@ -141,8 +262,18 @@ func gatherWithTimeout(
 			if err != nil {
 				acc.AddError(err)
 			}
+			acc.errors.endGather(acc.maker.Name(), a.clock.Now())
+			if input.cache != nil {
+				// the held series are not gathered, and are not counted
+				for _, m := range input.cache.endGather(a.clock.Now(), acc.getTime(nil)) {
+					acc.add(m)
+				}
+			}
+			if acc.limiter != nil {
+				acc.limiter.endGather(acc.maker.Name())
+			}
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			err := fmt.Errorf("took longer to collect than collection interval (%s)",
 				timeout)
 			acc.AddError(err)
@@ -152,43 +283,406 @@ func gatherWithTimeout(
 		}
 	}
 }
-// flush writes a list of metrics to all configured outputs
-func (a *Agent) flush() {
-	var wg sync.WaitGroup
 
-	wg.Add(len(a.Config.Outputs))
-	for _, o := range a.Config.Outputs {
-		go func(output *RunningOutput) {
+// process runs a gathered metric through the agent-wide metric handling and
+// then through the processors, returning the metrics to send to the outputs.
+func (a *Agent) process(metric Metric) []Metric {
+	seq := metric.Sequence()
+	if len(a.Config.Agent.StaticFields) > 0 {
+		addStaticFields(metric, a.Config.Agent.StaticFields)
+	}
+	if max := a.Config.Agent.MaxStringFieldLength; max > 0 {
+		metric = truncateStringFields(metric, max)
+	}
+	if a.tagLimiter != nil {
+		a.tagLimiter.Apply(metric)
+	}
+
+	mS := []Metric{metric}
+	if a.fieldLimiter != nil {
+		mS = a.fieldLimiter.Apply(metric)
+	}
+	for _, processor := range a.Config.Processors {
+		mS = processor.Apply(mS...)
+	}
+	if a.lowercaser != nil {
+		for i, m := range mS {
+			mS[i] = a.lowercaser.Apply(m)
+		}
+	}
+	if a.futureSkew != nil {
+		kept := mS[:0]
+		for _, m := range mS {
+			if m = a.futureSkew.Apply(m); m != nil {
+				kept = append(kept, m)
+			}
+		}
+		mS = kept
+	}
+	if a.monotonic != nil {
+		for i, m := range mS {
+			mS[i] = a.monotonic.Apply(m)
+		}
+	}
+	inheritSequence(mS, seq)
+	return mS
+}
+
+// inheritSequence gives seq to the metrics that were made from a numbered
+// one, since processors and the agent-wide handling rebuild metrics without
+// their gather order.
+func inheritSequence(metrics []Metric, seq uint64) {
+	if seq == 0 {
+		return
+	}
+	for _, m := range metrics {
+		if m != nil && m.Sequence() == 0 {
+			m.SetSequence(seq)
+		}
+	}
+}
+
+// flush writes a list of metrics to all configured outputs. Outputs are
+// written in order, those sharing the same order concurrently, each in its
+// own goroutine, so that a slow or failing output does not hold back the
+// others of its order; the write timeout of each output bounds how long the
+// next order waits. It returns the error of each output, by index.
+func (a *Agent) flush() []error {
+	errs := make([]error, len(a.Config.Outputs))
+	outputs := a.Config.Outputs
+	start := 0
+	for len(outputs) > 0 {
+		n := 1
+		for n < len(outputs) && outputs[n].Config.Order == outputs[0].Config.Order {
+			n++
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(n)
+		for i, o := range outputs[:n] {
+			go func(i int, output *RunningOutput) {
+				defer wg.Done()
+				err := output.Write()
+				if isBreakerOpen(err) {
+					log.Printf("D! Output [%s] not written: %s", output.Name, err)
+				} else if err != nil {
+					log.Printf("E! Error writing to output [%s]: %s\n",
+						output.Name, err.Error())
+				}
+				errs[i] = err
+			}(start+i, o)
+		}
+		wg.Wait()
+
+		outputs = outputs[n:]
+		start += n
+	}
+	return errs
+}
+
+// addToOutputs hands a metric to every output, copying it for all but the
+// last one.
+func (a *Agent) addToOutputs(m Metric) {
+	for i, o := range a.Config.Outputs {
+		if i == len(a.Config.Outputs)-1 {
+			o.AddMetric(m)
+		} else {
+			o.AddMetric(m.Copy())
+		}
+	}
+}
+
+// RunOnce starts the service inputs, gathers metrics from every input a
+// single time, stops the service inputs, writes the metrics to all of the
+// configured outputs and then closes the outputs. Unlike Run it does not
+// loop, which makes it suitable for cron-driven collection. Cancelling ctx
+// stops waiting for the inputs that are still gathering and for the outputs
+// blocked on a full buffer.
+func (a *Agent) RunOnce(ctx context.Context) error {
+	defer a.setMaxProcs()()
+
+	shutdown := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(shutdown)
+			for _, o := range a.Config.Outputs {
+				o.Stop()
+			}
+		case <-done:
+		}
+	}()
+
+	err := a.gatherOnce(shutdown, true, a.addToOutputs)
+	if err != nil {
+		a.Close()
+		return err
+	}
+	for _, werr := range a.flush() {
+		if werr != nil && err == nil {
+			err = werr
+		}
+	}
+
+	if cerr := a.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// RunOnce connects the outputs of c, gathers every input a single time and
+// writes the metrics to the outputs before closing them, see Agent.RunOnce.
+// It is what the -once flag runs, for cron-driven collection.
+func (c *Config) RunOnce(ctx context.Context) error {
+	a, err := NewAgent(c)
+	if err != nil {
+		return err
+	}
+	if err := a.Connect(); err != nil {
+		return err
+	}
+	return a.RunOnce(ctx)
+}
+
+// RunTest gathers metrics from every input a single time and prints them as
+// they were gathered, before any processing, without writing them anywhere.
+func (a *Agent) RunTest() error {
+	metricC := make(chan Metric, 100)
+	for _, input := range a.Config.Inputs {
+		input.SetTrace(true)
+	}
+	done := a.gatherInputsOnce(make(chan struct{}), metricC, nil)
+	receiveUntil(metricC, done, func(Metric) {})
+	return nil
+}
+
+// RunTestFull is the same as RunTest, but prints the metrics that would be
+// written to the outputs, after the agent-wide metric handling, the
+// processors and the aggregators, which are pushed right away.
+func (a *Agent) RunTestFull() error {
+	for _, input := range a.Config.Inputs {
+		input.SetTrace(false)
+	}
+	return a.gatherOnce(make(chan struct{}), false, func(m Metric) {
+		fmt.Print("> " + m.SerializeLineProtocol())
+	})
+}
+
+// startServices starts the service inputs, which add their metrics to
+// metricC, and returns a func that stops them. When one fails to start, the
+// ones already started are stopped.
+func (a *Agent) startServices(metricC chan Metric) (func(), error) {
+	var started []ServiceInput
+	stop := func() {
+		for _, p := range started {
+			p.Stop()
+		}
+	}
+	for _, input := range a.Config.Inputs {
+		input.SetDefaultTags(a.Config.Tags)
+		switch p := input.Input.(type) {
+		case ServiceInput:
+			acc := a.newAccumulator(input, metricC)
+			// Service input plugins should set their own precision of their
+			// metrics.
+			acc.SetPrecision(time.Nanosecond, 0)
+			if err := p.Start(acc); err != nil {
+				log.Printf("E! Service for input %s failed to start, exiting\n%s\n",
+					input.Name(), err.Error())
+				stop()
+				return nil, err
+			}
+			started = append(started, p)
+		}
+	}
+	return stop, nil
+}
+
+// gatherInputsOnce gathers every input a single time into metricC, giving up
+// on those still gathering once shutdown is closed. The returned channel is
+// closed once they are all done, after calling stop, when not nil, for the
+// service inputs to stop adding to metricC. metricC is left open, since an
+// input that was given up on may still add to it.
+func (a *Agent) gatherInputsOnce(shutdown chan struct{}, metricC chan Metric, stop func()) chan struct{} {
+	var wg sync.WaitGroup
+	wg.Add(len(a.Config.Inputs))
+	for _, input := range a.Config.Inputs {
+		input.SetDefaultTags(a.Config.Tags)
+		interval := a.Config.Agent.Interval.Duration
+		// overwrite global interval if this plugin has it's own.
+		if input.Config.Interval != 0 {
+			interval = input.Config.Interval
+		}
+		go func(in *RunningInput, interv time.Duration) {
 			defer wg.Done()
-			err := output.Write()
-			if err != nil {
-				log.Printf("E! Error writing to output [%s]: %s\n",
-					output.Name, err.Error())
+			defer panicRecover(in)
+
+			acc := a.newAccumulator(in, metricC)
+			acc.SetPrecision(a.Config.Agent.Precision.Duration,
+				a.Config.Agent.Interval.Duration)
+			a.gatherWithTimeout(shutdown, in, acc, interv)
+		}(input, interval)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		if stop != nil {
+			stop()
+		}
+		close(done)
+	}()
+	return done
+}
+
+// receiveUntil hands the metrics of metricC to f until done is closed, and
+// then those left in metricC.
+func receiveUntil(metricC chan Metric, done chan struct{}, f func(Metric)) {
+	for {
+		select {
+		case m := <-metricC:
+			f(m)
+		case <-done:
+			for {
+				select {
+				case m := <-metricC:
+					f(m)
+				default:
+					return
+				}
 			}
-		}(o)
+		}
 	}
+}
 
-	wg.Wait()
+// gatherOnce gathers every input a single time, with the service inputs
+// running meanwhile when services is set, and runs the metrics through the
+// processors and aggregators, pushing the aggregates right away since there
+// is no next period to wait for. Every metric that is bound for the outputs
+// is handed to emit.
+func (a *Agent) gatherOnce(shutdown chan struct{}, services bool, emit func(Metric)) error {
+	metricC := make(chan Metric, 100)
+	var stop func()
+	if services {
+		var err error
+		if stop, err = a.startServices(metricC); err != nil {
+			return err
+		}
+	}
+	done := a.gatherInputsOnce(shutdown, metricC, stop)
+
+	receiveUntil(metricC, done, func(metric Metric) {
+		for _, m := range a.process(metric) {
+			var dropOriginal bool
+			for _, agg := range a.Config.Aggregators {
+				agg.add(m.Copy())
+				if agg.Config.DropOriginal {
+					dropOriginal = true
+				}
+			}
+			if !dropOriginal {
+				emit(m)
+			}
+		}
+	})
+
+	for _, agg := range a.Config.Aggregators {
+		aggC := make(chan Metric, 100)
+		go func(agg *RunningAggregator) {
+			acc := a.newAccumulator(agg, aggC)
+			acc.SetPrecision(a.Config.Agent.Precision.Duration,
+				a.Config.Agent.Interval.Duration)
+			agg.push(acc)
+			agg.reset()
+			close(aggC)
+		}(agg)
+
+		for metric := range aggC {
+			metrics := []Metric{metric}
+			for _, processor := range a.Config.Processors {
+				metrics = processor.Apply(metrics...)
+			}
+			for _, m := range metrics {
+				emit(m)
+			}
+		}
+	}
+	return nil
+}
+
+// setMaxProcs sets GOMAXPROCS to max_procs, when it is set, for the agent
+// to run with, and returns a func that restores the previous value, so that
+// it does not outlive the agent, ie, one reloaded without max_procs.
+func (a *Agent) setMaxProcs() func() {
+	n := a.Config.Agent.MaxProcs
+	if n <= 0 {
+		return func() {}
+	}
+	prev := runtime.GOMAXPROCS(n)
+	log.Printf("D! Set GOMAXPROCS to %d, was %d", n, prev)
+	return func() {
+		runtime.GOMAXPROCS(prev)
+	}
 }
 
 // Run runs the agent daemon, gathering every Interval
 func (a *Agent) Run(shutdown chan struct{}) error {
 	var wg sync.WaitGroup
+	defer a.setMaxProcs()()
 
 	log.Printf("I! Agent Config: Interval:%s, Hostname:%#v, \n",
 		a.Config.Agent.Interval.Duration,
 		a.Config.Agent.Hostname)
 
+	// the loops are unhealthy once they miss two of their runs
+	var gatherTimeout time.Duration
+	for _, input := range a.Config.Inputs {
+		interval := a.Config.Agent.Interval.Duration
+		if input.Config.Interval != 0 {
+			interval = input.Config.Interval
+		}
+		if t := 2*interval + a.Config.Agent.CollectionJitter.Duration; t > gatherTimeout {
+			gatherTimeout = t
+		}
+	}
+	a.health = newHealth(a.clock.Now, gatherTimeout,
+		2*a.Config.Agent.FlushInterval.Duration+a.Config.Agent.FlushJitter.Duration)
+	if a.Config.Agent.HealthListen != "" {
+		l, err := a.serveHealth(a.Config.Agent.HealthListen)
+		if err != nil {
+			return err
+		}
+		// closed before returning, so that a reload can listen again
+		defer l.Close()
+	}
+
 	// channel shared between all input threads for accumulating metrics
 	metricC := make(chan Metric, 100)
 	aggC := make(chan Metric, 100)
 
+	// Start all ServicePlugins
+	stopServices, err := a.startServices(metricC)
+	if err != nil {
+		return err
+	}
+	defer stopServices()
+
 	// Round collection to nearest interval by sleeping
 	if a.Config.Agent.RoundInterval {
 		i := int64(a.Config.Agent.Interval.Duration)
-		time.Sleep(time.Duration(i - (time.Now().UnixNano() % i)))
+		<-a.clock.After(time.Duration(i - (a.clock.Now().UnixNano() % i)))
 	}
 
+	// the outputs blocking on a full buffer let the flusher finish
+	go func() {
+		<-shutdown
+		for _, o := range a.Config.Outputs {
+			o.Stop()
+		}
+	}()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -212,6 +706,26 @@ func (a *Agent) Run(shutdown chan struct{}) error {
 		}(input, interval)
 	}
 
+	if a.Config.Agent.Heartbeat {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.heartbeat(shutdown, a.Config.Agent.Interval.Duration, metricC)
+		}()
+	}
+
+	wg.Add(len(a.Config.Aggregators))
+	for _, aggregator := range a.Config.Aggregators {
+		aggregator.clock = a.clock
+		go func(agg *RunningAggregator) {
+			defer wg.Done()
+			acc := a.newAccumulator(agg, aggC)
+			acc.SetPrecision(a.Config.Agent.Precision.Duration,
+				a.Config.Agent.Interval.Duration)
+			agg.Run(acc, shutdown)
+		}(aggregator)
+	}
+
 	wg.Wait()
 	a.Close()
 	return nil
@@ -242,6 +756,13 @@ func (a *Agent) flusher(shutdown chan struct{}, metricC chan Metric, aggC chan M
 				// if dropOriginal is set to true, then we will only send this
 				// metric to the aggregators, not the outputs.
 				var dropOriginal bool
+				if !m.IsAggregate() {
+					for _, agg := range a.Config.Aggregators {
+						if ok := agg.Add(m.Copy()); ok {
+							dropOriginal = true
+						}
+					}
+				}
 				if !dropOriginal {
 					for i, o := range a.Config.Outputs {
 						if i == len(a.Config.Outputs)-1 {
@@ -268,6 +789,10 @@ func (a *Agent) flusher(shutdown chan struct{}, metricC chan Metric, aggC chan M
 				return
 			case metric := <-aggC:
 				metrics := []Metric{metric}
+				for _, processor := range a.Config.Processors {
+					metrics = processor.Apply(metrics...)
+				}
+				inheritSequence(metrics, metric.Sequence())
 				for _, m := range metrics {
 					for i, o := range a.Config.Outputs {
 						if i == len(a.Config.Outputs)-1 {
@@ -281,22 +806,29 @@ func (a *Agent) flusher(shutdown chan struct{}, metricC chan Metric, aggC chan M
 		}
 	}()
 
-	ticker := time.NewTicker(a.Config.Agent.FlushInterval.Duration)
+	ticker := a.clock.NewTicker(a.Config.Agent.FlushInterval.Duration)
+	defer ticker.Stop()
 	semaphore := make(chan struct{}, 1)
 	for {
 		select {
 		case <-shutdown:
+			if !a.Config.Agent.FlushOnShutdown {
+				log.Println("I! Not flushing cached metrics before shutdown, " +
+					"flush_on_shutdown is false")
+				return nil
+			}
 			log.Println("I! Hang on, flushing any cached metrics before shutdown")
 			// wait for outMetricC to get flushed before flushing outputs
 			wg.Wait()
 			a.flush()
 			return nil
-		case <-ticker.C:
+		case <-ticker.C():
 			go func() {
 				select {
 				case semaphore <- struct{}{}:
-					RandomSleep(a.Config.Agent.FlushJitter.Duration, shutdown)
+					randomSleep(a.clock, a.Config.Agent.FlushJitter.Duration, shutdown)
 					a.flush()
+					a.health.flushed()
 					<-semaphore
 				default:
 					// skipping this flush because one is already happening
@@ -307,8 +839,7 @@ func (a *Agent) flusher(shutdown chan struct{}, metricC chan Metric, aggC chan M
 		case metric := <-metricC:
 			// NOTE potential bottleneck here as we put each metric through the
 			// processors serially.
-			mS := []Metric{metric}
-			for _, m := range mS {
+			for _, m := range a.process(metric) {
 				outMetricC <- m
 			}
 		}
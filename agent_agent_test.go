@@ -0,0 +1,557 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serviceInput adds a metric when it is started and one when gathered, and
+// records when it is stopped.
+type serviceInput struct {
+	acc     Accumulator
+	stopped bool
+	// block, when set, makes Gather wait for it to be closed.
+	block chan struct{}
+}
+
+func (_ *serviceInput) SampleConfig() string { return "" }
+func (_ *serviceInput) Description() string  { return "" }
+
+func (s *serviceInput) Start(acc Accumulator) error {
+	s.acc = acc
+	acc.AddFields("started", map[string]interface{}{"value": 1}, nil)
+	return nil
+}
+
+func (s *serviceInput) Stop() {
+	s.stopped = true
+}
+
+func (s *serviceInput) Gather(acc Accumulator) error {
+	if s.block != nil {
+		<-s.block
+	}
+	acc.AddFields("gathered", map[string]interface{}{"value": 1}, nil)
+	return nil
+}
+
+func newOnceAgent(t *testing.T, in *serviceInput, out *mockOutput) *Agent {
+	c := NewConfig()
+	c.Agent.OmitHostname = true
+	c.Inputs = append(c.Inputs, NewRunningInput(in, &InputConfig{Name: "service"}))
+	c.Outputs = append(c.Outputs,
+		NewRunningOutput("mock", out, &OutputConfig{Name: "mock"}, 10, 100))
+	a, err := NewAgent(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestRunOnceStartsServiceInputs(t *testing.T) {
+	in := &serviceInput{}
+	out := &mockOutput{}
+	a := newOnceAgent(t, in, out)
+	if err := a.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !in.stopped {
+		t.Error("expected the service input to be stopped")
+	}
+	names := map[string]bool{}
+	for _, m := range out.metrics {
+		names[m.Name()] = true
+	}
+	if len(out.metrics) != 2 || !names["started"] || !names["gathered"] {
+		t.Errorf("expected the started and gathered metrics, got %v", out.metrics)
+	}
+}
+
+func TestRunOnceCancel(t *testing.T) {
+	in := &serviceInput{block: make(chan struct{})}
+	defer close(in.block)
+	out := &mockOutput{}
+	a := newOnceAgent(t, in, out)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- a.RunOnce(ctx)
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected RunOnce to return once cancelled")
+	}
+	if !in.stopped {
+		t.Error("expected the service input to be stopped")
+	}
+	if n := out.written(); n != 1 {
+		t.Errorf("expected the metric of the service to be written, got %d", n)
+	}
+}
+
+// procsInput records the GOMAXPROCS it is gathered with.
+type procsInput struct {
+	procs int
+}
+
+func (_ *procsInput) SampleConfig() string { return "" }
+func (_ *procsInput) Description() string  { return "" }
+
+func (p *procsInput) Gather(acc Accumulator) error {
+	p.procs = runtime.GOMAXPROCS(0)
+	return nil
+}
+
+func TestMaxProcsRestored(t *testing.T) {
+	prev := runtime.GOMAXPROCS(0)
+	want := 1
+	if prev == 1 {
+		want = 2
+	}
+
+	in := &procsInput{}
+	c := NewConfig()
+	c.Agent.OmitHostname = true
+	c.Agent.MaxProcs = want
+	c.Inputs = append(c.Inputs, NewRunningInput(in, &InputConfig{Name: "procs"}))
+	c.Outputs = append(c.Outputs,
+		NewRunningOutput("mock", &mockOutput{}, &OutputConfig{Name: "mock"}, 10, 100))
+	a, err := NewAgent(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := runtime.GOMAXPROCS(0); n != prev {
+		t.Fatalf("expected NewAgent to leave GOMAXPROCS at %d, got %d", prev, n)
+	}
+	if err := a.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if in.procs != want {
+		t.Errorf("expected the agent to run with GOMAXPROCS %d, got %d", want, in.procs)
+	}
+	if n := runtime.GOMAXPROCS(0); n != prev {
+		t.Errorf("expected GOMAXPROCS to be restored to %d, got %d", prev, n)
+	}
+}
+
+// orderInput adds n metrics, numbered from 0, tagged with its id.
+type orderInput struct {
+	id string
+	n  int
+}
+
+func (_ *orderInput) SampleConfig() string { return "" }
+func (_ *orderInput) Description() string  { return "" }
+
+func (o *orderInput) Gather(acc Accumulator) error {
+	for i := 0; i < o.n; i++ {
+		acc.AddFields("order", map[string]interface{}{"n": int64(i)},
+			map[string]string{"input": o.id})
+		runtime.Gosched()
+	}
+	return nil
+}
+
+func TestPreserveOrderUnderConcurrentGather(t *testing.T) {
+	const inputs, perInput = 8, 50
+	c := NewConfig()
+	c.Agent.OmitHostname = true
+	c.Agent.PreserveOrder = true
+	for i := 0; i < inputs; i++ {
+		in := &orderInput{id: strconv.Itoa(i), n: perInput}
+		c.Inputs = append(c.Inputs, NewRunningInput(in, &InputConfig{Name: "order"}))
+	}
+	out := &mockOutput{}
+	ro := NewRunningOutput("mock", out, &OutputConfig{Name: "mock"}, 1000, 1000)
+	ro.PreserveOrder = true
+	c.Outputs = append(c.Outputs, ro)
+	a, err := NewAgent(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.metrics) != inputs*perInput {
+		t.Fatalf("expected %d metrics, got %d", inputs*perInput, len(out.metrics))
+	}
+	var last uint64
+	next := map[string]int64{}
+	for i, m := range out.metrics {
+		seq := m.Sequence()
+		if seq <= last {
+			t.Fatalf("metric %d: sequence %d after %d", i, seq, last)
+		}
+		last = seq
+		id := m.Tags()["input"]
+		if n := m.Fields()["n"].(int64); n != next[id] {
+			t.Fatalf("metric %d: expected %d of input %s, got %d", i, next[id], id, n)
+		}
+		next[id]++
+	}
+}
+
+// closeOutput discards the metrics written to it, counting the writes and
+// whether it was closed.
+type closeOutput struct {
+	mockOutput
+	closed bool
+}
+
+func (c *closeOutput) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestConfigRunOnce(t *testing.T) {
+	out := &closeOutput{}
+	c := NewConfig()
+	c.Agent.OmitHostname = true
+	c.Inputs = append(c.Inputs,
+		NewRunningInput(&orderInput{id: "a", n: 3}, &InputConfig{Name: "order"}))
+	c.Outputs = append(c.Outputs,
+		NewRunningOutput("discard", out, &OutputConfig{Name: "discard"}, 10, 100))
+	if err := c.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if out.writes != 1 || len(out.metrics) != 3 {
+		t.Errorf("expected one write of 3 metrics, got %d writes of %d metrics",
+			out.writes, len(out.metrics))
+	}
+	if !out.closed {
+		t.Error("expected the output to be closed")
+	}
+}
+
+func TestCollectionWindow(t *testing.T) {
+	tests := []struct {
+		window   string
+		at       time.Duration
+		gathered bool
+	}{
+		{"09:00-17:00", 12 * time.Hour, true},
+		{"09:00-17:00", 9 * time.Hour, true},
+		{"09:00-17:00", 17 * time.Hour, false},
+		{"09:00-17:00", 3 * time.Hour, false},
+		// wraps past midnight
+		{"22:00-06:00", 23*time.Hour + 30*time.Minute, true},
+		{"22:00-06:00", 3 * time.Hour, true},
+		{"22:00-06:00", 12 * time.Hour, false},
+		{"22:00-06:00", 6 * time.Hour, false},
+	}
+	midnight := time.Date(2017, 7, 14, 0, 0, 0, 0, time.Local)
+	for _, tt := range tests {
+		window, err := parseTimeWindow(tt.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := NewConfig()
+		c.Agent.OmitHostname = true
+		in := &orderInput{id: "window", n: 1}
+		ri := NewRunningInput(in, &InputConfig{Name: "order", Window: window})
+		c.Inputs = append(c.Inputs, ri)
+		a, err := NewAgent(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.clock = NewMockClock(midnight.Add(tt.at))
+
+		metricC := make(chan Metric, 10)
+		a.gatherWithTimeout(make(chan struct{}), ri, a.newAccumulator(ri, metricC),
+			time.Second)
+		if gathered := len(metricC) > 0; gathered != tt.gathered {
+			t.Errorf("%s at %s: expected gathered %v, got %v", tt.window, tt.at,
+				tt.gathered, gathered)
+		}
+	}
+
+	for _, s := range []string{"22:00", "22:00-25:00", "night"} {
+		if _, err := parseTimeWindow(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+// renameProcessor renames the measurement of every metric to name.
+type renameProcessor struct {
+	name string
+}
+
+func (_ *renameProcessor) SampleConfig() string { return "" }
+func (_ *renameProcessor) Description() string  { return "" }
+
+func (r *renameProcessor) Apply(in ...Metric) []Metric {
+	for _, m := range in {
+		m.SetName(r.name)
+	}
+	return in
+}
+
+// captureStdout returns what f prints to the standard output.
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	out := make(chan string)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		out <- string(b)
+	}()
+	f()
+	os.Stdout = stdout
+	w.Close()
+	return <-out
+}
+
+func TestRunTestFullAppliesProcessors(t *testing.T) {
+	c := NewConfig()
+	c.Agent.OmitHostname = true
+	in := &orderInput{id: "a", n: 2}
+	c.Inputs = append(c.Inputs, NewRunningInput(in, &InputConfig{Name: "order"}))
+	c.Processors = append(c.Processors, &RunningProcessor{
+		Name:      "rename",
+		Processor: &renameProcessor{name: "renamed"},
+		Config:    &ProcessorConfig{Name: "rename"},
+	})
+	a, err := NewAgent(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureStdout(t, func() {
+		if err := a.RunTestFull(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", out)
+	}
+	for i, line := range lines {
+		prefix := fmt.Sprintf("> renamed,input=a n=%di ", i)
+		if !strings.HasPrefix(line, prefix) {
+			t.Errorf("expected the renamed metric %q, got %q", prefix, line)
+		}
+	}
+}
+
+func TestHostnameResolver(t *testing.T) {
+	defer func(resolver func() (string, error)) {
+		HostnameResolver = resolver
+	}(HostnameResolver)
+	HostnameResolver = func() (string, error) { return "zone01", nil }
+
+	tests := []struct {
+		hostname string
+		omit     bool
+		host     string
+	}{
+		{host: "zone01"},
+		{hostname: "web01", host: "web01"},
+		{omit: true},
+	}
+	for _, tt := range tests {
+		c := NewConfig()
+		c.Agent.Hostname = tt.hostname
+		c.Agent.OmitHostname = tt.omit
+		if _, err := NewAgent(c); err != nil {
+			t.Fatal(err)
+		}
+		if host := c.Tags["host"]; host != tt.host {
+			t.Errorf("hostname %q, omit %v: expected the host tag %q, got %q",
+				tt.hostname, tt.omit, tt.host, host)
+		}
+	}
+
+	HostnameResolver = func() (string, error) { return "", errors.New("no name") }
+	if _, err := NewAgent(NewConfig()); err == nil {
+		t.Error("expected the error of the resolver")
+	}
+}
+
+// downOutput is a mockOutput that fails to connect while down is set.
+type downOutput struct {
+	mockOutput
+	down     bool
+	connects int
+}
+
+func (d *downOutput) Connect() error {
+	d.Lock()
+	defer d.Unlock()
+	d.connects++
+	if d.down {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (d *downOutput) setDown(down bool) {
+	d.Lock()
+	d.down = down
+	d.Unlock()
+}
+
+func TestBufferBeforeConnect(t *testing.T) {
+	c := NewConfig()
+	c.Agent.OmitHostname = true
+	c.Agent.BufferBeforeConnect = true
+	in := &orderInput{id: "early", n: 5}
+	c.Inputs = append(c.Inputs, NewRunningInput(in, &InputConfig{Name: "order"}))
+	out := &downOutput{down: true}
+	ro := NewRunningOutput("down", out, &OutputConfig{Name: "down"}, 100, 1000)
+	c.Outputs = append(c.Outputs, ro)
+	a, err := NewAgent(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Connect(); err != nil {
+		t.Fatalf("expected the agent to start with the output down, got %s", err)
+	}
+	if err := a.gatherOnce(make(chan struct{}), false, a.addToOutputs); err != nil {
+		t.Fatal(err)
+	}
+	if err := ro.Write(); err == nil {
+		t.Fatal("expected the write to fail while the output is down")
+	}
+	if n := out.written(); n != 0 {
+		t.Fatalf("expected nothing written while down, got %d", n)
+	}
+
+	out.setDown(false)
+	if err := ro.Write(); err != nil {
+		t.Fatalf("expected the write to connect and succeed, got %s", err)
+	}
+	if n := out.written(); n != 5 {
+		t.Errorf("expected the 5 early metrics to be written, got %d", n)
+	}
+	// once connected, the output is not connected again
+	if err := ro.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if out.connects != 3 {
+		t.Errorf("expected 3 connection attempts, got %d", out.connects)
+	}
+}
+
+func TestFlushOnShutdown(t *testing.T) {
+	for _, flush := range []bool{true, false} {
+		c := NewConfig()
+		c.Agent.OmitHostname = true
+		c.Agent.FlushOnShutdown = flush
+		out := &mockOutput{}
+		c.Outputs = append(c.Outputs,
+			NewRunningOutput("mock", out, &OutputConfig{Name: "mock"}, 100, 1000))
+		a, err := NewAgent(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// no scheduled flush, only the one on shutdown
+		a.clock = NewMockClock(time.Unix(1500000000, 0))
+
+		metricC := make(chan Metric, 10)
+		for i := 0; i < 3; i++ {
+			m, _ := New("cpu", nil, map[string]interface{}{"n": int64(i)},
+				time.Unix(1500000000, 0))
+			metricC <- m
+		}
+		shutdown := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			done <- a.flusher(shutdown, metricC, make(chan Metric))
+		}()
+		for len(metricC) > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(shutdown)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the flusher did not return on shutdown")
+		}
+
+		want := 0
+		if flush {
+			want = 3
+		}
+		if n := out.written(); n != want {
+			t.Errorf("flush_on_shutdown=%t: expected %d metrics written, got %d",
+				flush, want, n)
+		}
+	}
+}
+
+func TestFlushSlowOutputDoesNotBlockOthers(t *testing.T) {
+	c := NewConfig()
+	c.Agent.OmitHostname = true
+	slow := &slowOutput{release: make(chan struct{})}
+	fast := &mockOutput{}
+	failing := &mockOutput{fail: true}
+	for _, o := range []struct {
+		name   string
+		output Output
+	}{{"slow", slow}, {"fast", fast}, {"failing", failing}} {
+		ro := NewRunningOutput(o.name, o.output, &OutputConfig{Name: o.name}, 10, 100)
+		m, _ := New("cpu", nil, map[string]interface{}{"usage": 1.0}, time.Now())
+		ro.AddMetric(m)
+		c.Outputs = append(c.Outputs, ro)
+	}
+	a, err := NewAgent(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan []error)
+	go func() {
+		done <- a.flush()
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for fast.written() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the fast output was not written while the slow one was blocked")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatal("expected the flush to wait for the slow output")
+	default:
+	}
+
+	close(slow.release)
+	var errs []error
+	select {
+	case errs = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the flush did not return")
+	}
+	if len(errs) != 3 || errs[0] != nil || errs[1] != nil || errs[2] == nil {
+		t.Errorf("expected only the failing output to report an error, got %v", errs)
+	}
+	if slow.written() != 1 {
+		t.Errorf("expected the slow output to be written, got %d", slow.written())
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// overflowTagValue replaces tag values once a tag key has reached its limit
+// of distinct values.
+const overflowTagValue = "overflow"
+
+// tagValueLimiter caps the number of distinct values seen for each tag key,
+// to protect the outputs from runaway series cardinality.
+type tagValueLimiter struct {
+	limit int
+
+	mu     sync.Mutex
+	seen   map[string]map[string]bool
+	warned map[string]bool
+}
+
+func newTagValueLimiter(limit int) *tagValueLimiter {
+	return &tagValueLimiter{
+		limit:  limit,
+		seen:   make(map[string]map[string]bool),
+		warned: make(map[string]bool),
+	}
+}
+
+// Apply replaces the value of every tag of m whose key already has the
+// maximum number of distinct values with overflowTagValue.
+func (l *tagValueLimiter) Apply(m Metric) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, v := range m.Tags() {
+		values, ok := l.seen[k]
+		if !ok {
+			values = make(map[string]bool)
+			l.seen[k] = values
+		}
+		if values[v] {
+			continue
+		}
+		if len(values) < l.limit {
+			values[v] = true
+			continue
+		}
+
+		if !l.warned[k] {
+			log.Printf("W! Tag [%s] has more than %d distinct values, new "+
+				"values are replaced with %q", k, l.limit, overflowTagValue)
+			l.warned[k] = true
+		}
+		m.AddTag(k, overflowTagValue)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTagValueLimiterOverflow(t *testing.T) {
+	c := NewConfig()
+	c.Agent.MaxTagValues = 10
+	a, err := NewAgent(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]int{}
+	for i := 0; i < 100; i++ {
+		// the request ids are unbounded, the hosts stay under the limit
+		m, err := New("http", map[string]string{
+			"request": fmt.Sprintf("req%d", i),
+			"host":    fmt.Sprintf("web%d", i%5),
+		}, map[string]interface{}{"value": int64(i)}, time.Unix(int64(i), 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range a.process(m) {
+			values[m.Tags()["request"]]++
+			if host := m.Tags()["host"]; host != fmt.Sprintf("web%d", i%5) {
+				t.Errorf("metric %d: expected the host to be kept, got %s", i, host)
+			}
+		}
+	}
+
+	if n := values[overflowTagValue]; n != 90 {
+		t.Errorf("expected 90 overflowed request values, got %d", n)
+	}
+	if len(values) != 11 {
+		t.Errorf("expected 10 request values and the overflow, got %d", len(values))
+	}
+	for i := 0; i < 10; i++ {
+		if values[fmt.Sprintf("req%d", i)] != 1 {
+			t.Errorf("expected the value req%d to be kept", i)
+		}
+	}
+
+	// a value seen before the limit was reached is still kept
+	m, _ := New("http", map[string]string{"request": "req3"},
+		map[string]interface{}{"value": int64(1)}, time.Unix(0, 0))
+	if got := a.process(m)[0].Tags()["request"]; got != "req3" {
+		t.Errorf("expected req3 to be kept, got %s", got)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// errorSummaryMin is the wait before the first summary of a repeated
+	// error, it doubles with each summary up to errorSummaryMax.
+	errorSummaryMin = time.Minute
+	errorSummaryMax = time.Hour
+)
+
+// errorThrottle keeps an input that fails every interval from flooding the
+// log. The first occurrence of an error is logged, the identical ones that
+// follow are counted and summarized with an exponential backoff, until the
+// input gathers without error or fails differently.
+type errorThrottle struct {
+	mu sync.Mutex
+
+	last string
+	// since is the time of the last logged line about the last error
+	since time.Time
+	// suppressed counts the occurrences of last not logged since then
+	suppressed int64
+	backoff    time.Duration
+	// failed is set when an error is reported during the current gather
+	failed bool
+}
+
+// report logs err unless it repeats the last error, in which case it is only
+// counted, and summarized once the backoff has elapsed.
+func (e *errorThrottle) report(name string, err error, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failed = true
+
+	msg := err.Error()
+	if msg != e.last {
+		e.flush(name, now)
+		log.Printf("E! Error in plugin [%s]: %s", name, msg)
+		e.last = msg
+		e.since = now
+		e.backoff = errorSummaryMin
+		return
+	}
+
+	e.suppressed++
+	if now.Sub(e.since) >= e.backoff {
+		e.flush(name, now)
+		e.backoff *= 2
+		if e.backoff > errorSummaryMax {
+			e.backoff = errorSummaryMax
+		}
+	}
+}
+
+// flush logs the summary of the suppressed occurrences of the last error.
+func (e *errorThrottle) flush(name string, now time.Time) {
+	if e.suppressed == 0 {
+		return
+	}
+	log.Printf("E! Error in plugin [%s]: failed %d more times in last %s: %s",
+		name, e.suppressed, now.Sub(e.since)/time.Second*time.Second, e.last)
+	e.suppressed = 0
+	e.since = now
+}
+
+// startGather marks the beginning of a gather.
+func (e *errorThrottle) startGather() {
+	e.mu.Lock()
+	e.failed = false
+	e.mu.Unlock()
+}
+
+// endGather resets the throttle if the gather reported no error, logging the
+// summary of the errors that were still suppressed.
+func (e *errorThrottle) endGather(name string, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.failed || e.last == "" {
+		return
+	}
+	e.flush(name, now)
+	log.Printf("I! Plugin [%s] gathered without error again", name)
+	e.last = ""
+	e.backoff = errorSummaryMin
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLog returns the lines that f logs.
+func captureLog(f func()) []string {
+	var buf bytes.Buffer
+	flags := log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	}()
+	f()
+	out := strings.TrimSpace(buf.String())
+	if out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+func TestErrorThrottleSummary(t *testing.T) {
+	e := &errorThrottle{}
+	start := time.Unix(1500000000, 0)
+	errDown := errors.New("kstat: connection refused")
+
+	// an error every 10s for 3 minutes
+	lines := captureLog(func() {
+		for i := 0; i <= 18; i++ {
+			now := start.Add(time.Duration(i) * 10 * time.Second)
+			e.startGather()
+			e.report("inputs.cpu", errDown, now)
+			e.endGather("inputs.cpu", now)
+		}
+	})
+	// the first error, a summary after a minute, then after 2 more minutes
+	want := []string{
+		"E! Error in plugin [inputs.cpu]: kstat: connection refused",
+		"E! Error in plugin [inputs.cpu]: failed 6 more times in last 1m0s: " +
+			"kstat: connection refused",
+		"E! Error in plugin [inputs.cpu]: failed 12 more times in last 2m0s: " +
+			"kstat: connection refused",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected the log\n%s\ngot\n%s", strings.Join(want, "\n"),
+			strings.Join(lines, "\n"))
+	}
+
+	// a different error is logged right away, and a successful gather
+	// resets the throttle
+	lines = captureLog(func() {
+		now := start.Add(200 * time.Second)
+		e.startGather()
+		e.report("inputs.cpu", errDown, now)
+		e.endGather("inputs.cpu", now)
+		e.startGather()
+		e.report("inputs.cpu", errors.New("kstat: timeout"), now)
+		e.endGather("inputs.cpu", now)
+		e.startGather()
+		e.endGather("inputs.cpu", now)
+		e.startGather()
+		e.report("inputs.cpu", errors.New("kstat: timeout"), now)
+		e.endGather("inputs.cpu", now)
+	})
+	want = []string{
+		"E! Error in plugin [inputs.cpu]: failed 1 more times in last 20s: " +
+			"kstat: connection refused",
+		"E! Error in plugin [inputs.cpu]: kstat: timeout",
+		"I! Plugin [inputs.cpu] gathered without error again",
+		"E! Error in plugin [inputs.cpu]: kstat: timeout",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected the log\n%s\ngot\n%s", strings.Join(want, "\n"),
+			strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// FieldLimitSplit splits a metric with too many fields into several
+	// metrics.
+	FieldLimitSplit = "split"
+	// FieldLimitDrop drops the fields over the limit.
+	FieldLimitDrop = "drop"
+)
+
+// fieldLimiter caps the number of fields of a metric, for outputs that
+// reject points with too many fields.
+type fieldLimiter struct {
+	limit int
+	drop  bool
+
+	mu     sync.Mutex
+	warned map[string]bool
+}
+
+func newFieldLimiter(limit int, action string) *fieldLimiter {
+	return &fieldLimiter{
+		limit:  limit,
+		drop:   action == FieldLimitDrop,
+		warned: make(map[string]bool),
+	}
+}
+
+// Apply returns m if it is within the limit. Otherwise its fields, sorted by
+// key, are either split into metrics with the same name, tags and time, or
+// cut down to the first limit fields.
+func (l *fieldLimiter) Apply(m Metric) []Metric {
+	fields := m.Fields()
+	if len(fields) <= l.limit {
+		return []Metric{m}
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if l.drop {
+		l.mu.Lock()
+		if !l.warned[m.Name()] {
+			log.Printf("W! Metric [%s] has more than %d fields, dropping "+
+				"the extra fields", m.Name(), l.limit)
+			l.warned[m.Name()] = true
+		}
+		l.mu.Unlock()
+		keys = keys[:l.limit]
+	}
+
+	var out []Metric
+	for len(keys) > 0 {
+		n := l.limit
+		if n > len(keys) {
+			n = len(keys)
+		}
+		part := make(map[string]interface{}, n)
+		for _, k := range keys[:n] {
+			part[k] = fields[k]
+		}
+		keys = keys[n:]
+
+		pm, err := New(m.Name(), m.Tags(), part, m.Time(), m.Type())
+		if err != nil {
+			log.Printf("E! Unable to limit the fields of metric [%s]: %s",
+				m.Name(), err)
+			continue
+		}
+		out = append(out, pm)
+	}
+	return out
+}
+
+// addStaticFields adds the static_fields of the agent to m, ie, a
+// collector_version for provenance. A field that m already has is kept.
+func addStaticFields(m Metric, static map[string]interface{}) {
+	fields := m.Fields()
+	keys := make([]string, 0, len(static))
+	for k := range static {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, ok := fields[k]; ok {
+			continue
+		}
+		m.AddField(k, static[k])
+	}
+}
+
+// truncateStringFields returns m with its string fields longer than max bytes
+// cut to max bytes, on a character boundary, and followed by "...", so that a
+// runaway value, ie, a whole log captured by accident, cannot blow up the
+// writes.
+func truncateStringFields(m Metric, max int) Metric {
+	fields := m.Fields()
+	truncated := false
+	for k, v := range fields {
+		s, ok := v.(string)
+		if !ok || len(s) <= max {
+			continue
+		}
+		n := max
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		log.Printf("D! Metric [%s] field %s of %d bytes truncated to "+
+			"max_string_field_length %d", m.Name(), k, len(s), max)
+		fields[k] = s[:n] + "..."
+		truncated = true
+	}
+	if !truncated {
+		return m
+	}
+
+	out, err := New(m.Name(), m.Tags(), fields, m.Time(), m.Type())
+	if err != nil {
+		log.Printf("E! Unable to truncate the fields of metric [%s]: %s",
+			m.Name(), err)
+		return m
+	}
+	out.SetAggregate(m.IsAggregate())
+	return out
+}
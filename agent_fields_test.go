@@ -0,0 +1,151 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMaxFieldsPerMetric(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	fields := map[string]interface{}{
+		"a": int64(1), "b": int64(2), "c": int64(3), "d": int64(4), "e": int64(5),
+	}
+	tests := []struct {
+		action string
+		want   []map[string]interface{}
+	}{
+		{FieldLimitSplit, []map[string]interface{}{
+			{"a": int64(1), "b": int64(2)},
+			{"c": int64(3), "d": int64(4)},
+			{"e": int64(5)},
+		}},
+		{FieldLimitDrop, []map[string]interface{}{
+			{"a": int64(1), "b": int64(2)},
+		}},
+	}
+	for _, tt := range tests {
+		c := NewConfig()
+		c.Agent.MaxFieldsPerMetric = 2
+		c.Agent.MaxFieldsAction = tt.action
+		a, err := NewAgent(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, _ := New("wide", map[string]string{"host": "web01"}, fields, now)
+		var got []map[string]interface{}
+		for _, m := range a.process(m) {
+			if m.Name() != "wide" || m.Tags()["host"] != "web01" || !m.Time().Equal(now) {
+				t.Errorf("%s: expected the name, tags and time to be kept, got %s",
+					tt.action, m)
+			}
+			got = append(got, m.Fields())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.action, tt.want, got)
+		}
+
+		// a metric within the limit is untouched
+		m, _ = New("narrow", nil, map[string]interface{}{"a": int64(1)}, now)
+		if out := a.process(m); len(out) != 1 || len(out[0].Fields()) != 1 {
+			t.Errorf("%s: expected the metric to be kept, got %v", tt.action, out)
+		}
+	}
+
+	c := NewConfig()
+	c.Agent.MaxFieldsPerMetric = 2
+	c.Agent.MaxFieldsAction = "truncate"
+	if _, err := NewAgent(c); err == nil {
+		t.Error("expected an error for an invalid max_fields_action")
+	}
+}
+
+func TestStaticFields(t *testing.T) {
+	c := loadTestConfig(t, `
+[agent]
+  omit_hostname = true
+  [agent.static_fields]
+    collector_version = "1.2.0"
+    site_id = 7
+`)
+	a, err := NewAgent(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, _ := New("cpu", nil, map[string]interface{}{"usage": 0.5},
+		time.Unix(0, 0))
+	want := map[string]interface{}{
+		"usage":             0.5,
+		"collector_version": "1.2.0",
+		"site_id":           int64(7),
+	}
+	if out := a.process(m); len(out) != 1 || !reflect.DeepEqual(out[0].Fields(), want) {
+		t.Errorf("expected %v, got %v", want, out)
+	}
+
+	// the field of the plugin wins over the static one
+	m, _ = New("exec", nil, map[string]interface{}{"site_id": int64(3)},
+		time.Unix(0, 0))
+	want = map[string]interface{}{
+		"site_id":           int64(3),
+		"collector_version": "1.2.0",
+	}
+	if out := a.process(m); len(out) != 1 || !reflect.DeepEqual(out[0].Fields(), want) {
+		t.Errorf("expected %v, got %v", want, out)
+	}
+}
+
+func TestTruncateStringFields(t *testing.T) {
+	now := time.Unix(0, 0)
+	m, _ := New("log", map[string]string{"path": "/var/adm/messages"},
+		map[string]interface{}{
+			"message": "abcdefghijkl",
+			"short":   "abc",
+			"utf8":    "ééééé",
+			"count":   int64(1),
+		}, now)
+	out := truncateStringFields(m, 5)
+	want := map[string]interface{}{
+		"message": "abcde...",
+		"short":   "abc",
+		// é is 2 bytes, the cut does not split one
+		"utf8":  "éé...",
+		"count": int64(1),
+	}
+	if !reflect.DeepEqual(out.Fields(), want) {
+		t.Errorf("expected %v, got %v", want, out.Fields())
+	}
+	if out.Name() != "log" || out.Tags()["path"] != "/var/adm/messages" ||
+		!out.Time().Equal(now) {
+		t.Errorf("expected the name, tags and time to be kept, got %s", out)
+	}
+
+	m, _ = New("log", nil, map[string]interface{}{"message": "abc"}, now)
+	if out := truncateStringFields(m, 5); out != m {
+		t.Error("expected a metric within the limit to be returned as is")
+	}
+}
+
+func TestMaxStringFieldLength(t *testing.T) {
+	c := NewConfig()
+	c.Agent.OmitHostname = true
+	c.Agent.MaxStringFieldLength = 4
+	a, err := NewAgent(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := New("log", nil, map[string]interface{}{"message": "truncated"},
+		time.Unix(0, 0))
+	out := a.process(m)
+	if len(out) != 1 || out[0].Fields()["message"] != "trun..." {
+		t.Errorf("expected the message to be truncated, got %v", out)
+	}
+
+	c = NewConfig()
+	c.Agent.MaxStringFieldLength = -1
+	if _, err := NewAgent(c); err == nil {
+		t.Error("expected an error for a negative max_string_field_length")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// health tracks when the gather and flush loops of the agent last completed,
+// for the health_listen endpoint.
+type health struct {
+	// lastGather and lastFlush are unix nanoseconds, accessed atomically.
+	lastGather int64
+	lastFlush  int64
+
+	// gatherTimeout and flushTimeout are how long a loop may go without
+	// completing before the agent is reported unhealthy. A zero
+	// gatherTimeout disables the gather check, ie, when there are only
+	// service inputs.
+	gatherTimeout time.Duration
+	flushTimeout  time.Duration
+
+	// now returns the current time, from the clock of the agent
+	now func() time.Time
+}
+
+func newHealth(now func() time.Time, gatherTimeout, flushTimeout time.Duration) *health {
+	h := &health{
+		gatherTimeout: gatherTimeout,
+		flushTimeout:  flushTimeout,
+		now:           now,
+	}
+	// the loops are considered alive until they first miss their timeout
+	h.gathered()
+	h.flushed()
+	return h
+}
+
+func (h *health) gathered() {
+	atomic.StoreInt64(&h.lastGather, h.now().UnixNano())
+}
+
+func (h *health) flushed() {
+	atomic.StoreInt64(&h.lastFlush, h.now().UnixNano())
+}
+
+// check returns an error describing the first loop that is not alive.
+func (h *health) check() error {
+	now := h.now()
+	if h.gatherTimeout > 0 {
+		last := time.Unix(0, atomic.LoadInt64(&h.lastGather))
+		if now.Sub(last) > h.gatherTimeout {
+			return fmt.Errorf("no input gathered since %s", last.Format(time.RFC3339))
+		}
+	}
+	last := time.Unix(0, atomic.LoadInt64(&h.lastFlush))
+	if now.Sub(last) > h.flushTimeout {
+		return fmt.Errorf("no flush since %s", last.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// ServeHTTP serves /healthz, which is 200 while the gather and flush loops
+// are alive and 503 otherwise, and /metrics-count, which reports the agent
+// metric counters.
+func (h *health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	switch r.URL.Path {
+	case "/healthz":
+		if err := h.check(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "unhealthy: %s\n", err)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	case "/metrics-count":
+		fmt.Fprintf(w, "metrics_gathered %d\n", GlobalMetricsGathered.Get())
+		fmt.Fprintf(w, "metrics_written %d\n", MetricsWritten.Get())
+		fmt.Fprintf(w, "metrics_dropped %d\n", MetricsDropped.Get())
+		fmt.Fprintf(w, "gather_errors %d\n", NErrors.Get())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveHealth serves the health endpoints on address until the returned
+// listener is closed.
+func (a *Agent) serveHealth(address string) (net.Listener, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("health_listen %s: %s", address, err)
+	}
+	log.Printf("I! Serving health checks on %s", l.Addr())
+
+	go func() {
+		err := http.Serve(l, a.health)
+		log.Printf("D! Health check server stopped: %s", err)
+	}()
+	return l, nil
+}
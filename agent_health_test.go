@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getHealth(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestHealthEndpoint(t *testing.T) {
+	clock := NewMockClock(time.Unix(1500000000, 0))
+	h := newHealth(clock.Now, 30*time.Second, time.Minute)
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	if code, body := getHealth(t, ts.URL+"/healthz"); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("expected a healthy agent, got %d %q", code, body)
+	}
+
+	// the flushes keep going, the gathers stopped
+	clock.Add(20 * time.Second)
+	h.flushed()
+	clock.Add(20 * time.Second)
+	code, body := getHealth(t, ts.URL+"/healthz")
+	if code != http.StatusServiceUnavailable || !strings.Contains(body, "no input gathered") {
+		t.Errorf("expected the gather loop to be reported, got %d %q", code, body)
+	}
+
+	h.gathered()
+	if code, _ := getHealth(t, ts.URL+"/healthz"); code != http.StatusOK {
+		t.Errorf("expected the agent to recover, got %d", code)
+	}
+
+	clock.Add(time.Minute)
+	h.gathered()
+	code, body = getHealth(t, ts.URL+"/healthz")
+	if code != http.StatusServiceUnavailable || !strings.Contains(body, "no flush") {
+		t.Errorf("expected the flush loop to be reported, got %d %q", code, body)
+	}
+
+	code, body = getHealth(t, ts.URL+"/metrics-count")
+	if code != http.StatusOK || !strings.Contains(body, "metrics_gathered ") ||
+		!strings.Contains(body, "metrics_written ") {
+		t.Errorf("expected the metric counters, got %d %q", code, body)
+	}
+
+	if code, _ := getHealth(t, ts.URL+"/other"); code != http.StatusNotFound {
+		t.Errorf("expected other paths to be not found, got %d", code)
+	}
+}
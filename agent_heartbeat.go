@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// defaultHeartbeatMeasurement is the name of the heartbeat metric when the
+// config sets none.
+const defaultHeartbeatMeasurement = "telegraf_heartbeat"
+
+// heartbeat sends a metric with the uptime of the agent into metricC every
+// interval, whether or not any input gathers, so that the absence of the
+// metric downstream means the agent is dead rather than idle.
+func (a *Agent) heartbeat(
+	shutdown chan struct{},
+	interval time.Duration,
+	metricC chan Metric,
+) {
+	start := a.clock.Now()
+	ticker := a.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m, err := a.heartbeatMetric(start, a.clock.Now())
+		if err != nil {
+			log.Printf("E! Unable to create heartbeat metric: %s", err)
+		} else {
+			select {
+			case metricC <- m:
+			case <-shutdown:
+				return
+			}
+		}
+
+		select {
+		case <-shutdown:
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// heartbeatMetric returns the heartbeat metric at now, of an agent started
+// at start. It carries the global tags and the heartbeat_tags.
+func (a *Agent) heartbeatMetric(start, now time.Time) (Metric, error) {
+	name := a.Config.Agent.HeartbeatMeasurement
+	if name == "" {
+		name = defaultHeartbeatMeasurement
+	}
+
+	tags := mergeTags(nil, a.Config.Agent.HeartbeatTags, a.Config.Tags)
+
+	fields := map[string]interface{}{
+		"uptime": int64(now.Sub(start) / time.Second),
+	}
+	return New(name, tags, fields, now, Gauge)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	c := NewConfig()
+	c.Tags = map[string]string{"host": "web1"}
+	c.Agent.HeartbeatTags = map[string]string{"role": "db"}
+	clock := NewMockClock(time.Unix(1500000000, 0))
+	a := &Agent{Config: c, clock: clock}
+
+	shutdown := make(chan struct{})
+	done := make(chan struct{})
+	metricC := make(chan Metric)
+	go func() {
+		a.heartbeat(shutdown, 10*time.Second, metricC)
+		close(done)
+	}()
+
+	wantTags := map[string]string{"host": "web1", "role": "db"}
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			clock.Add(10 * time.Second)
+		}
+		var m Metric
+		select {
+		case m = <-metricC:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no heartbeat after %d intervals", i)
+		}
+		if m.Name() != defaultHeartbeatMeasurement {
+			t.Errorf("expected measurement %s, got %s", defaultHeartbeatMeasurement, m.Name())
+		}
+		if !reflect.DeepEqual(m.Tags(), wantTags) {
+			t.Errorf("expected tags %v, got %v", wantTags, m.Tags())
+		}
+		if uptime := m.Fields()["uptime"]; uptime != int64(10*i) {
+			t.Errorf("expected uptime %d, got %v", 10*i, uptime)
+		}
+		if !m.Time().Equal(clock.Now()) {
+			t.Errorf("expected time %s, got %s", clock.Now(), m.Time())
+		}
+	}
+
+	// no heartbeat before the interval has passed
+	clock.Add(5 * time.Second)
+	select {
+	case m := <-metricC:
+		t.Errorf("unexpected heartbeat before the interval: %s", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(shutdown)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("heartbeat did not stop on shutdown")
+	}
+}
+
+func TestHeartbeatMeasurement(t *testing.T) {
+	c := NewConfig()
+	c.Agent.HeartbeatMeasurement = "alive"
+	a := &Agent{Config: c, clock: RealClock}
+	m, err := a.heartbeatMetric(time.Unix(0, 0), time.Unix(90, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name() != "alive" || m.Fields()["uptime"] != int64(90) {
+		t.Errorf("expected alive uptime=90i, got %s", m)
+	}
+}
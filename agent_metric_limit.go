@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+const (
+	// MetricLimitDrop drops every metric past the limit of a gather.
+	MetricLimitDrop = "drop"
+	// MetricLimitSample keeps one in metricLimitSampleEvery of the metrics
+	// past the limit of a gather.
+	MetricLimitSample = "sample"
+
+	metricLimitSampleEvery = 10
+)
+
+// metricLimiter caps the number of metrics an input adds in a single gather,
+// a safety valve against a runaway input, ie, an exec command that suddenly
+// prints a metric per process. It is distinct from the output buffer limit,
+// which protects against slow outputs rather than noisy inputs.
+type metricLimiter struct {
+	mu sync.Mutex
+
+	max    int
+	action string
+
+	// count is the number of metrics added during the current gather, and
+	// excess the number of them past max.
+	count  int
+	excess int
+	// dropped counts the metrics dropped, across gathers
+	dropped Stat
+}
+
+func newMetricLimiter(input string, max int, action string) *metricLimiter {
+	if action == "" {
+		action = MetricLimitDrop
+	}
+	return &metricLimiter{
+		max:    max,
+		action: action,
+		dropped: Register("gather", "metrics_dropped",
+			map[string]string{"input": input}),
+	}
+}
+
+// allow counts a metric added during the current gather and returns whether
+// it is kept.
+func (l *metricLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	if l.count <= l.max {
+		return true
+	}
+	l.excess++
+	if l.action == MetricLimitSample && l.excess%metricLimitSampleEvery == 0 {
+		return true
+	}
+	l.dropped.Incr(1)
+	return false
+}
+
+// startGather marks the beginning of a gather.
+func (l *metricLimiter) startGather() {
+	l.mu.Lock()
+	l.count = 0
+	l.excess = 0
+	l.mu.Unlock()
+}
+
+// endGather warns about the metrics dropped during the gather, if any.
+func (l *metricLimiter) endGather(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.excess == 0 {
+		return
+	}
+	kept := 0
+	if l.action == MetricLimitSample {
+		kept = l.excess / metricLimitSampleEvery
+	}
+	log.Printf("W! Input [%s] added %d metrics, over max_metrics_per_interval "+
+		"%d: dropped %d", name, l.count, l.max, l.excess-kept)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxMetricsPerInterval(t *testing.T) {
+	tests := []struct {
+		action string
+		kept   int
+	}{
+		{MetricLimitDrop, 10},
+		// one in ten of the 15 metrics over the limit
+		{MetricLimitSample, 11},
+	}
+	for _, tt := range tests {
+		c := NewConfig()
+		c.Agent.OmitHostname = true
+		a := &Agent{Config: c, clock: RealClock}
+
+		name := "limited_" + tt.action
+		ri := NewRunningInput(&orderInput{id: "a", n: 25}, &InputConfig{Name: name})
+		metricC := make(chan Metric, 100)
+		acc := a.newAccumulator(ri, metricC)
+		acc.limiter = newMetricLimiter(name, 10, tt.action)
+		dropped := acc.limiter.dropped.Get()
+
+		shutdown := make(chan struct{})
+		// the count starts over with every gather
+		for gather := 0; gather < 2; gather++ {
+			lines := captureLog(func() {
+				a.gatherWithTimeout(shutdown, ri, acc, time.Minute)
+			})
+			if n := len(metricC); n != tt.kept {
+				t.Errorf("%s: expected %d metrics in gather %d, got %d",
+					tt.action, tt.kept, gather, n)
+			}
+			for len(metricC) > 0 {
+				<-metricC
+			}
+			if len(lines) != 1 || !strings.Contains(lines[0], "added 25 metrics") ||
+				!strings.Contains(lines[0], "max_metrics_per_interval 10") {
+				t.Errorf("%s: expected a warning about the limit, got %q",
+					tt.action, lines)
+			}
+		}
+		if n := acc.limiter.dropped.Get() - dropped; n != int64(2*(25-tt.kept)) {
+			t.Errorf("%s: expected %d metrics counted as dropped, got %d",
+				tt.action, 2*(25-tt.kept), n)
+		}
+	}
+}
+
+func TestMaxMetricsPerIntervalUnderLimit(t *testing.T) {
+	c := NewConfig()
+	c.Agent.OmitHostname = true
+	a := &Agent{Config: c, clock: RealClock}
+
+	ri := NewRunningInput(&orderInput{id: "a", n: 10}, &InputConfig{Name: "unlimited"})
+	metricC := make(chan Metric, 100)
+	acc := a.newAccumulator(ri, metricC)
+	acc.limiter = newMetricLimiter("unlimited", 10, "")
+
+	lines := captureLog(func() {
+		a.gatherWithTimeout(make(chan struct{}), ri, acc, time.Minute)
+	})
+	if len(metricC) != 10 {
+		t.Errorf("expected all 10 metrics, got %d", len(metricC))
+	}
+	if len(lines) != 0 {
+		t.Errorf("expected no warning, got %q", lines)
+	}
+}
+
+func TestInvalidMaxMetricsAction(t *testing.T) {
+	c := NewConfig()
+	c.Agent.OmitHostname = true
+	c.Agent.MaxMetricsPerInterval = 10
+	c.Agent.MaxMetricsAction = "truncate"
+	if _, err := NewAgent(c); err == nil {
+		t.Error("expected an error with an invalid max_metrics_action")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// tagLowercaser normalizes the tag keys and/or values of metrics to
+// lowercase, ie, for Solaris commands reporting mixed-case device names.
+type tagLowercaser struct {
+	keys   bool
+	values bool
+}
+
+// Apply returns m with its tags lowercased. When lowercasing the keys makes
+// two of them equal, ie, Host and host, the one that already was lowercase
+// is kept.
+func (l *tagLowercaser) Apply(m Metric) Metric {
+	tags := m.Tags()
+	lowered := make(map[string]string, len(tags))
+	changed := false
+	for k, v := range tags {
+		if l.keys {
+			if lk := strings.ToLower(k); lk != k {
+				changed = true
+				if _, ok := tags[lk]; ok {
+					continue
+				}
+				k = lk
+			}
+		}
+		if l.values {
+			if lv := strings.ToLower(v); lv != v {
+				changed = true
+				v = lv
+			}
+		}
+		lowered[k] = v
+	}
+	if !changed {
+		return m
+	}
+
+	out, err := New(m.Name(), lowered, m.Fields(), m.Time(), m.Type())
+	if err != nil {
+		log.Printf("E! Unable to lowercase the tags of metric [%s]: %s",
+			m.Name(), err)
+		return m
+	}
+	out.SetAggregate(m.IsAggregate())
+	return out
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTagLowercaser(t *testing.T) {
+	tags := map[string]string{"Device": "SD0", "pool": "RPool", "host": "web1"}
+	tests := []struct {
+		keys, values bool
+		want         map[string]string
+	}{
+		{true, false, map[string]string{"device": "SD0", "pool": "RPool", "host": "web1"}},
+		{false, true, map[string]string{"Device": "sd0", "pool": "rpool", "host": "web1"}},
+		{true, true, map[string]string{"device": "sd0", "pool": "rpool", "host": "web1"}},
+		{false, false, tags},
+	}
+	for _, tt := range tests {
+		m, _ := New("disk", tags, map[string]interface{}{"value": int64(1)},
+			time.Unix(0, 0))
+		l := &tagLowercaser{keys: tt.keys, values: tt.values}
+		out := l.Apply(m)
+		if !reflect.DeepEqual(out.Tags(), tt.want) {
+			t.Errorf("keys=%t values=%t: expected %v, got %v",
+				tt.keys, tt.values, tt.want, out.Tags())
+		}
+		if !reflect.DeepEqual(out.Fields(), m.Fields()) {
+			t.Errorf("keys=%t values=%t: expected the fields to be kept, got %v",
+				tt.keys, tt.values, out.Fields())
+		}
+	}
+}
+
+func TestTagLowercaserKeyConflict(t *testing.T) {
+	m, _ := New("disk", map[string]string{"Host": "A", "host": "b"},
+		map[string]interface{}{"value": int64(1)}, time.Unix(0, 0))
+	out := (&tagLowercaser{keys: true}).Apply(m)
+	if want := map[string]string{"host": "b"}; !reflect.DeepEqual(out.Tags(), want) {
+		t.Errorf("expected the lowercase key to be kept, got %v", out.Tags())
+	}
+}
+
+func TestTagLowercaserUnchanged(t *testing.T) {
+	m, _ := New("disk", map[string]string{"device": "sd0"},
+		map[string]interface{}{"value": int64(1)}, time.Unix(0, 0))
+	if out := (&tagLowercaser{keys: true, values: true}).Apply(m); out != m {
+		t.Error("expected a metric with lowercase tags to be returned as is")
+	}
+}
+
+func TestLowercaseTagOptions(t *testing.T) {
+	tests := []struct {
+		config string
+		want   map[string]string
+	}{
+		{"lowercase_tag_keys = true", map[string]string{"device": "SD0"}},
+		{"lowercase_tag_values = true", map[string]string{"Device": "sd0"}},
+		{"lowercase_tag_keys = true\n  lowercase_tag_values = true",
+			map[string]string{"device": "sd0"}},
+		{"", map[string]string{"Device": "SD0"}},
+	}
+	for _, tt := range tests {
+		c := loadTestConfig(t, "[agent]\n  omit_hostname = true\n  "+tt.config+"\n")
+		a, err := NewAgent(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, _ := New("disk", map[string]string{"Device": "SD0"},
+			map[string]interface{}{"value": int64(1)}, time.Unix(0, 0))
+		out := a.process(m)
+		if len(out) != 1 || !reflect.DeepEqual(out[0].Tags(), tt.want) {
+			t.Errorf("%q: expected tags %v, got %v", tt.config, tt.want, out)
+		}
+	}
+}
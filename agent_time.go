@@ -0,0 +1,158 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// monotonicSeriesExpiry is how long the last time of a series is kept once
+// no metric of it is seen, so that the series that come and go, ie, of
+// short-lived processes, do not grow the monotonicClock forever.
+const monotonicSeriesExpiry = time.Hour
+
+// monotonicClock keeps the timestamps of every series from going backwards,
+// ie, after the system clock is stepped back by an NTP correction.
+type monotonicClock struct {
+	mu   sync.Mutex
+	last map[uint64]monotonicSeries
+	// swept is when the expired series were last removed.
+	swept time.Time
+
+	// now is the source of time, a seam for tests.
+	now func() time.Time
+}
+
+// monotonicSeries holds the latest time of a series, and when a metric of
+// it was last seen.
+type monotonicSeries struct {
+	ts   int64
+	seen time.Time
+}
+
+func newMonotonicClock(now func() time.Time) *monotonicClock {
+	return &monotonicClock{
+		last:  make(map[uint64]monotonicSeries),
+		swept: now(),
+		now:   now,
+	}
+}
+
+// Apply returns m, or a copy of it with the timestamp of the previous metric
+// of the same series if m is older than that.
+func (c *monotonicClock) Apply(m Metric) Metric {
+	id := m.HashID()
+	ts := m.UnixNano()
+
+	c.mu.Lock()
+	now := c.now()
+	series, ok := c.last[id]
+	last := series.ts
+	if !ok || ts > last {
+		series.ts = ts
+	}
+	series.seen = now
+	c.last[id] = series
+	if now.Sub(c.swept) >= monotonicSeriesExpiry {
+		c.expire(now)
+	}
+	c.mu.Unlock()
+
+	if !ok || ts >= last {
+		return m
+	}
+
+	clamped, err := New(m.Name(), m.Tags(), m.Fields(), time.Unix(0, last), m.Type())
+	if err != nil {
+		log.Printf("E! Unable to clamp the time of metric [%s]: %s", m.Name(), err)
+		return m
+	}
+	clamped.SetAggregate(m.IsAggregate())
+	log.Printf("D! Metric [%s] time went back by %s, using the previous time",
+		m.Name(), time.Duration(last-ts))
+	return clamped
+}
+
+// expire removes the series that have not been seen for
+// monotonicSeriesExpiry. c.mu must be held.
+func (c *monotonicClock) expire(now time.Time) {
+	for id, series := range c.last {
+		if now.Sub(series.seen) >= monotonicSeriesExpiry {
+			delete(c.last, id)
+		}
+	}
+	c.swept = now
+}
+
+const (
+	// FutureSkewDrop drops the metrics timestamped too far in the future.
+	FutureSkewDrop = "drop"
+	// FutureSkewClamp sets the time of such metrics to the current time.
+	FutureSkewClamp = "clamp"
+)
+
+// futureSkew handles the metrics timestamped more than max ahead of the
+// current time, ie, from a source with a skewed clock, which would otherwise
+// outlive the retention policy in InfluxDB.
+type futureSkew struct {
+	max    time.Duration
+	action string
+	clock  Clock
+
+	mu sync.Mutex
+	// warned holds the measurements already warned about, the following
+	// metrics of a measurement are only logged in debug
+	warned map[string]bool
+	// skewed counts the metrics dropped or clamped
+	skewed Stat
+}
+
+func newFutureSkew(max time.Duration, action string, clock Clock) *futureSkew {
+	if action == "" {
+		action = FutureSkewDrop
+	}
+	return &futureSkew{
+		max:    max,
+		action: action,
+		clock:  clock,
+		warned: make(map[string]bool),
+		skewed: Register("agent", "metrics_future_skewed", map[string]string{}),
+	}
+}
+
+// Apply returns m, a copy of it with the current time when it is too far in
+// the future and the action is clamp, or nil when the action is drop.
+func (s *futureSkew) Apply(m Metric) Metric {
+	now := s.clock.Now()
+	skew := m.Time().Sub(now)
+	if skew <= s.max {
+		return m
+	}
+	s.skewed.Incr(1)
+	// whole seconds are precise enough for the logs
+	skew -= skew % time.Second
+
+	s.mu.Lock()
+	level := "D!"
+	if !s.warned[m.Name()] {
+		s.warned[m.Name()] = true
+		level = "W!"
+	}
+	s.mu.Unlock()
+
+	if s.action == FutureSkewDrop {
+		log.Printf("%s Metric [%s] is %s in the future, over max_future_skew %s: "+
+			"dropped", level, m.Name(), skew, s.max)
+		return nil
+	}
+
+	clamped, err := New(m.Name(), m.Tags(), m.Fields(), now, m.Type())
+	if err != nil {
+		log.Printf("E! Unable to clamp the time of metric [%s]: %s", m.Name(), err)
+		return nil
+	}
+	clamped.SetAggregate(m.IsAggregate())
+	log.Printf("%s Metric [%s] is %s in the future, over max_future_skew %s: "+
+		"using the current time", level, m.Name(), skew, s.max)
+	return clamped
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonotonicClockExpiresSeries(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	c := newMonotonicClock(func() time.Time { return now })
+	metric := func(name string, ts time.Time) Metric {
+		m, err := New(name, nil, map[string]interface{}{"value": 1.0}, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	c.Apply(metric("a", now))
+	c.Apply(metric("b", now))
+	// the clock steps back, the time of a is kept
+	if m := c.Apply(metric("a", now.Add(-time.Minute))); !m.Time().Equal(now) {
+		t.Errorf("expected the previous time %s, got %s", now, m.Time())
+	}
+
+	// b is not seen again, a is
+	now = now.Add(monotonicSeriesExpiry / 2)
+	c.Apply(metric("a", now))
+	now = now.Add(monotonicSeriesExpiry / 2)
+	c.Apply(metric("a", now))
+	if len(c.last) != 1 {
+		t.Errorf("expected the series b to expire, %d series left", len(c.last))
+	}
+}
+
+func TestFutureSkew(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	metric := func(name string, ts time.Time) Metric {
+		m, err := New(name, map[string]string{"host": "h1"},
+			map[string]interface{}{"value": 1.0}, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	for _, action := range []string{"", FutureSkewDrop, FutureSkewClamp} {
+		s := newFutureSkew(time.Hour, action, NewMockClock(now))
+		skewed := s.skewed.Get()
+
+		// up to max_future_skew ahead, a metric is left alone
+		for _, ts := range []time.Time{now.Add(-time.Hour), now, now.Add(time.Hour)} {
+			if m := s.Apply(metric("cpu", ts)); m == nil || !m.Time().Equal(ts) {
+				t.Errorf("%q: expected the metric at %s to be kept, got %v", action, ts, m)
+			}
+		}
+
+		var m Metric
+		logs := captureLog(func() {
+			m = s.Apply(metric("cpu", now.Add(2*time.Hour+time.Second/2)))
+			s.Apply(metric("cpu", now.Add(3*time.Hour)))
+		})
+		if action == FutureSkewClamp {
+			if m == nil || !m.Time().Equal(now) {
+				t.Errorf("%q: expected the metric to be clamped to %s, got %v", action, now, m)
+			} else if m.Tags()["host"] != "h1" || m.Fields()["value"] != 1.0 {
+				t.Errorf("%q: expected the clamped metric to keep its tags and "+
+					"fields, got %v", action, m)
+			}
+		} else if m != nil {
+			t.Errorf("%q: expected the metric to be dropped, got %v", action, m)
+		}
+		if n := s.skewed.Get() - skewed; n != 2 {
+			t.Errorf("%q: expected 2 skewed metrics, got %d", action, n)
+		}
+		// the first metric of a measurement is warned about, the next ones
+		// only logged in debug
+		if len(logs) != 2 || !strings.HasPrefix(logs[0], "W! Metric [cpu] is 2h0m0s in the future") ||
+			!strings.HasPrefix(logs[1], "D! ") {
+			t.Errorf("%q: expected a warning then a debug message, got %q", action, logs)
+		}
+	}
+}
+
+func TestFutureSkewConfig(t *testing.T) {
+	for _, tt := range []struct {
+		agent string
+		kept  bool
+	}{
+		{`max_future_skew = "1h"`, false},
+		{`max_future_skew = "1h"
+  max_future_skew_action = "clamp"`, true},
+	} {
+		c := loadTestConfig(t, "[agent]\n  omit_hostname = true\n  "+tt.agent+"\n")
+		a, err := NewAgent(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := New("cpu", nil, map[string]interface{}{"value": 1.0},
+			time.Now().Add(2*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []Metric
+		captureLog(func() { got = a.process(m) })
+		if tt.kept {
+			if len(got) != 1 || got[0].Time().After(time.Now()) {
+				t.Errorf("%s: expected the metric to be clamped, got %v", tt.agent, got)
+			}
+		} else if len(got) != 0 {
+			t.Errorf("%s: expected the metric to be dropped, got %v", tt.agent, got)
+		}
+	}
+
+	for _, agent := range []string{`max_future_skew = "-1h"`,
+		"max_future_skew = \"1h\"\n  max_future_skew_action = \"keep\""} {
+		c := loadTestConfig(t, "[agent]\n  omit_hostname = true\n  "+agent+"\n")
+		if _, err := NewAgent(c); err == nil {
+			t.Errorf("%s: expected an error", agent)
+		}
+	}
+}
@@ -21,6 +21,10 @@ func InitAllInputs() {
 		return &DiskStats{ps: nil}
 	})
 
+	AddInput("filestat", func() Input {
+		return NewFileStat()
+	})
+
 	AddInput("http_response", func() Input {
 		return &HTTPResponse{}
 	})
@@ -29,6 +33,10 @@ func InitAllInputs() {
 		return &Apache{}
 	})
 
+	AddInput("internal", func() Input {
+		return NewInternal()
+	})
+
 	AddInput("ping", func() Input {
 		return &Ping{
 			pingHost:     hostPinger,
@@ -38,10 +46,26 @@ func InitAllInputs() {
 		}
 	})
 
+	AddInput("exec", func() Input {
+		return NewExec()
+	})
+
 	AddInput("net_response", func() Input {
 		return &NetResponse{}
 	})
 
+	AddInput("syslog", func() Input {
+		return NewSyslog()
+	})
+
+	AddInput("socket_listener", func() Input {
+		return NewSocketListener()
+	})
+
+	AddInput("tail", func() Input {
+		return NewTail()
+	})
+
 	AddInput("tomcat", func() Input {
 		return &Tomcat{
 			URL:      "http://127.0.0.1:8080/manager/status/all?XML=true",
@@ -67,6 +91,10 @@ func InitAllInputs() {
 		return &SystemStats{}
 	})
 
+	AddInput("netstat", func() Input {
+		return &NetStat{}
+	})
+
 	AddInput("netstat_connections", func() Input {
 		return &NetStatConnections{}
 	})
@@ -75,6 +103,10 @@ func InitAllInputs() {
 		return &Processes{}
 	})
 
+	AddInput("procstat", func() Input {
+		return &Procstat{}
+	})
+
 	AddInput("diskio", func() Input {
 		return &DiskIOStats{}
 	})
@@ -83,11 +115,72 @@ func InitAllInputs() {
 		return &NetIOStats{}
 	})
 
+	AddInput("smf", func() Input {
+		return &SMF{}
+	})
+
+	AddInput("svm", func() Input {
+		return &SVM{}
+	})
+
 	AddInput("swap", func() Input {
 		return &SwapStats{}
 	})
+
+	AddInput("kernel", func() Input {
+		return &Kernel{}
+	})
+
+	AddInput("temp", func() Input {
+		return &Temp{}
+	})
 }
 
 func InitAllOutputs() {
+	AddOutput("amqp", func() Output { return NewAMQP() })
+	AddOutput("file", func() Output { return &FileOutput{} })
+	AddOutput("fluentd", func() Output { return NewFluentd() })
+	AddOutput("http", func() Output { return NewHTTPOutput() })
 	AddOutput("influxdb", func() Output { return newInflux() })
+	AddOutput("kafka", func() Output { return NewKafka() })
+	AddOutput("opentsdb", func() Output { return NewOpenTSDB() })
+	AddOutput("prometheus_client", func() Output { return NewPrometheusClient() })
+	AddOutput("socket_writer", func() Output { return NewSocketWriter() })
+	AddOutput("syslog", func() Output { return NewSyslogOutput() })
+}
+
+func InitAllProcessors() {
+	AddProcessor("field_template", func() Processor {
+		return &FieldTemplate{}
+	})
+
+	AddProcessor("rate", func() Processor {
+		return &Rate{}
+	})
+
+	AddProcessor("sample", func() Processor {
+		return &Sample{Rate: 1.0}
+	})
+
+	AddProcessor("scale", func() Processor {
+		return &Scale{}
+	})
+
+	AddProcessor("split", func() Processor {
+		return &Split{}
+	})
+
+	AddProcessor("threshold", func() Processor {
+		return &Threshold{}
+	})
+
+	AddProcessor("timestamp", func() Processor {
+		return &Timestamp{}
+	})
+}
+
+func InitAllAggregators() {
+	AddAggregator("merge", func() Aggregator {
+		return NewMerge()
+	})
 }
@@ -3,10 +3,14 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
 	"sort"
@@ -23,8 +27,10 @@ var (
 	inputDefaults = []string{"cpu", "mem", "swap", "system", "kernel",
 							 "processes", "disk", "diskio"}
 
-	// Default output plugins
-	outputDefaults = []string{"influxdb"}
+	// Default output plugins, none unless set with SetOutputDefaults: a
+	// config without outputs is an error rather than silently writing to a
+	// local InfluxDB
+	outputDefaults []string
 
 	// envVarRe is a regex to find environment variables in the config file
 	envVarRe = regexp.MustCompile(`\$\w+`)
@@ -35,6 +41,15 @@ var (
 	)
 )
 
+const (
+	// configURLTimeout is the timeout for fetching a config over http(s).
+	configURLTimeout = 10 * time.Second
+
+	// configURLMaxSize is the largest config, in bytes, that will be fetched
+	// over http(s).
+	configURLMaxSize = 4 * 1024 * 1024
+)
+
 // Config specifies the URL/user/password for the database that telegraf
 // will be logging to, as well as all the plugins that the user has
 // specified
@@ -43,9 +58,34 @@ type Config struct {
 	InputFilters  []string
 	OutputFilters []string
 
-	Agent   *AgentConfig
-	Inputs  []*RunningInput
-	Outputs []*RunningOutput
+	// secrets holds the [secrets] table, referenced from plugin settings
+	// as "@secret:NAME".
+	secrets map[string]string
+
+	// StrictTOML rejects the config files that define a table twice,
+	// which are otherwise merged, ie, to catch a plugin pasted twice. Set it
+	// before loading the config.
+	StrictTOML bool
+
+	Agent      *AgentConfig
+	Inputs     []*RunningInput
+	Outputs    []*RunningOutput
+	Processors  RunningProcessors
+	Aggregators []*RunningAggregator
+}
+
+// SetInputDefaults replaces the inputs that AddDefaultPlugins adds to a config
+// that has none, ie, for a distribution shipping its own defaults. It must be
+// called before the config is loaded.
+func SetInputDefaults(names []string) {
+	inputDefaults = append([]string(nil), names...)
+}
+
+// SetOutputDefaults sets the outputs that AddDefaultPlugins adds to a config
+// that has none, which is otherwise an error. It must be called before the
+// config is loaded.
+func SetOutputDefaults(names []string) {
+	outputDefaults = append([]string(nil), names...)
 }
 
 func NewConfig() *Config {
@@ -55,11 +95,16 @@ func NewConfig() *Config {
 			Interval:      Duration{Duration: 10 * time.Second},
 			RoundInterval: true,
 			FlushInterval: Duration{Duration: 10 * time.Second},
+
+			FlushOnShutdown: true,
 		},
 
 		Tags:          make(map[string]string),
+		secrets:       make(map[string]string),
 		Inputs:        make([]*RunningInput, 0),
 		Outputs:       make([]*RunningOutput, 0),
+		Processors:    make([]*RunningProcessor, 0),
+		Aggregators:   make([]*RunningAggregator, 0),
 		InputFilters:  make([]string, 0),
 		OutputFilters: make([]string, 0),
 	}
@@ -84,6 +129,109 @@ type AgentConfig struct {
 	Quiet               bool
 	Hostname            string
 	OmitHostname        bool
+
+	// GlobalTagsFromEnv adds global tags from environment variables, each
+	// entry mapping a tag to a variable as "tag=ENV_VAR".
+	GlobalTagsFromEnv []string
+
+	// EnvFile is a file of KEY=value lines set in the environment before
+	// the config reads from it, see loadEnvFile.
+	EnvFile string
+
+	// HealthListen, when set, is the address of the /healthz and
+	// /metrics-count HTTP endpoints.
+	HealthListen string
+
+	// AddPluginTag tags every metric with the name of the input that
+	// gathered it, ie, input=cpu.
+	AddPluginTag bool
+
+	// AddConfigFileTag tags every metric with the base name of the config
+	// file that declared its input, ie, config_file=cpu.conf.
+	AddConfigFileTag bool
+
+	// MaxTagValues is the maximum number of distinct values kept for any
+	// single tag key, 0 means unlimited.
+	MaxTagValues int
+
+	// MaxFieldsPerMetric is the maximum number of fields of a metric, 0
+	// means unlimited. MaxFieldsAction decides whether larger metrics are
+	// split (default) or have their extra fields dropped.
+	MaxFieldsPerMetric int
+	MaxFieldsAction    string
+
+	// JitterSeed seeds the random collection and flush jitter, making it
+	// reproducible. 0 keeps the jitter unpredictable.
+	JitterSeed int64
+
+	// BufferOverflowPolicy decides what happens when an output buffer is
+	// full: drop_oldest (default), drop_newest or block.
+	BufferOverflowPolicy string
+
+	// SkipUnknownPlugins logs a warning for a plugin that is not compiled
+	// in, instead of failing to load the config.
+	SkipUnknownPlugins bool
+
+	// MonotonicTime keeps the timestamps of each series from going
+	// backwards, ie, when the system clock is stepped back.
+	MonotonicTime bool
+
+	// MaxFutureSkew, when set, is how far ahead of the current time a metric
+	// may be timestamped. MaxFutureSkewAction decides whether later metrics
+	// are dropped (default) or clamped to the current time.
+	MaxFutureSkew       Duration
+	MaxFutureSkewAction string
+
+	// BufferBeforeConnect starts the agent even when outputs fail to
+	// connect, buffering their metrics until a connection succeeds.
+	BufferBeforeConnect bool
+
+	// StrictProcessorOrder fails to load a config in which processors set
+	// the same order, rather than logging a warning.
+	StrictProcessorOrder bool
+
+	// MaxProcs, when positive, is the GOMAXPROCS of the agent while it
+	// runs, the number of CPUs that run Go code at once. 0 leaves the
+	// runtime default.
+	MaxProcs int
+
+	// Heartbeat emits a metric every interval, named HeartbeatMeasurement
+	// and tagged with HeartbeatTags, so that a dead agent can be told from
+	// an idle one.
+	Heartbeat            bool
+	HeartbeatMeasurement string
+	HeartbeatTags        map[string]string
+
+	// MaxMetricsPerInterval is the maximum number of metrics an input may
+	// add in a single gather, 0 means unlimited. MaxMetricsAction decides
+	// whether the excess is dropped (default) or sampled.
+	MaxMetricsPerInterval int
+	MaxMetricsAction      string
+
+	// LowercaseTagKeys and LowercaseTagValues lowercase the tag keys and
+	// values of every metric, after the processors.
+	LowercaseTagKeys   bool
+	LowercaseTagValues bool
+
+	// StaticFields are added to every metric that does not already have a
+	// field of the same name.
+	StaticFields map[string]interface{}
+
+	// FlushOnShutdown writes the metrics still buffered by the outputs
+	// before the agent exits, true by default.
+	FlushOnShutdown bool
+
+	// MaxExecProcesses is the maximum number of commands that the exec
+	// inputs run at once, across all of them, 0 means unlimited.
+	MaxExecProcesses int
+
+	// MaxStringFieldLength is the length in bytes past which string field
+	// values are truncated, 0 means unlimited.
+	MaxStringFieldLength int
+
+	// PreserveOrder numbers the metrics as they are gathered, and each
+	// output sorts its batches back into that order before writing them.
+	PreserveOrder bool
 }
 
 // ListTags returns a string of tags specified in the config,
@@ -106,7 +254,10 @@ var header = `# Telegraf Configuration
 # declared inputs, and sent to the declared outputs.
 #
 # Plugins must be declared in here to be active.
-# To deactivate a plugin, comment out the name and any variables.
+# To deactivate a plugin, comment out the name and any variables, or set
+# enabled = false in the plugin's section. enabled can also be taken from the
+# environment, ie, enabled = "$ENABLE_FILE_OUTPUT"; a plugin whose variable is
+# not set is disabled.
 #
 # Use 'telegraf -config telegraf.conf -test' to see what metrics a config
 # file would generate.
@@ -121,7 +272,30 @@ var header = `# Telegraf Configuration
   # dc = "us-east-1" # will tag all metrics with dc=us-east-1
   # rack = "1a"
   ## Environment variables can be used as tags, and throughout the config file
+  ## A tag referencing a variable that is not set is skipped.
   # user = "$USER"
+  ## Tags can also be taken from environment variables at load time with the
+  ## global_tags_from_env agent option, see below.
+  ##
+  ## The tags of a metric are set in this order: those of the input itself,
+  ## then those of its [inputs.*.tags] table, then the global tags, each only
+  ## where the tag is not set yet. The tagpass and tagdrop tables of the input
+  ## are evaluated after all of them, so they can match on a global tag:
+  ## [[inputs.cpu]]
+  ##   [inputs.cpu.tagpass]
+  ##     dc = ["us-east-*"]
+
+# Secrets can be kept out of the plugin tables, ie, in a separate config
+# file, and referenced from any plugin setting as "@secret:<name>". A secret
+# must be declared in the same file or in one loaded before it.
+# [secrets]
+#   influx_password = "s3cret"
+
+# The options of a large plugin block can be kept in a separate fragment, a
+# file of plain key/values, merged into the block with an "@include path"
+# line. Relative paths are resolved from the directory of the including file.
+# [[inputs.exec]]
+#   @include "exec/commands.conf"
 
 
 # Configuration for telegraf agent
@@ -131,6 +305,13 @@ var header = `# Telegraf Configuration
   ## Rounds collection interval to 'interval'
   ## ie, if interval="10s" then always collect on :00, :10, :20, etc.
   round_interval = true
+  ## Inputs can also be restricted to a daily time window, in local time, with
+  ## collection_window = "22:00-06:00" in their [[inputs.*]] block. Windows
+  ## may wrap past midnight.
+  ## An input with cache_last = true emits the last metric of a series again,
+  ## with the current time, when a gather leaves the series out, rather than
+  ## leaving a gap. cache_ttl = "5m" stops holding a series 5 minutes after it
+  ## was last gathered; by default a series is held until the agent restarts.
 
   ## Telegraf will send metrics to outputs in batches of at most
   ## metric_batch_size metrics.
@@ -142,6 +323,9 @@ var header = `# Telegraf Configuration
   ## are dropped first when this buffer fills.
   ## This buffer only fills when writes fail to output plugin(s).
   metric_buffer_limit = 10000
+  ## What to do when the buffer is full: "drop_oldest" (default),
+  ## "drop_newest", or "block" to stop gathering until writes succeed again.
+  # buffer_overflow_policy = "drop_oldest"
 
   ## Collection jitter is used to jitter the collection by a random amount.
   ## Each plugin will sleep for a random time within jitter before collecting.
@@ -165,6 +349,30 @@ var header = `# Telegraf Configuration
   ## service input to set the timestamp at the appropriate precision.
   ## Valid time units are "ns", "us" (or "µs"), "ms", "s".
   precision = ""
+  ## Each output may also set its own precision, ie, precision = "1s" in an
+  ## [[outputs.*]] block, to truncate the timestamps written to that output
+  ## only.
+  ## Likewise an output can keep the metrics that overflow its buffer on disk
+  ## instead of dropping them, and replay them once writes succeed again:
+  ##   buffer_spill_dir = "/var/spool/telegraf/influxdb"  # one per output
+  ##   buffer_spill_max_size = 104857600                  # bytes
+  ## and set its own metric_buffer_limit, ie, a larger one for a remote
+  ## output that is often unreachable.
+  ## A write to an output that takes longer than its timeout, ie,
+  ## timeout = "5s" (the default), fails and is retried on the next flush.
+  ## "0s" disables it.
+  ## An output that keeps failing can be paused, to spare the retries of a
+  ## broken one: after breaker_threshold consecutive failed writes, its
+  ## circuit breaker opens and the output is not written for
+  ## breaker_backoff, then twice as long after each failed try, up to
+  ## breaker_max_backoff. Its metrics stay in its buffer meanwhile. The
+  ## write/breaker_state stat is 0 when closed, 1 open and 2 half-open.
+  ##   breaker_threshold = 5          # 0, the default, disables it
+  ##   breaker_backoff = "30s"
+  ##   breaker_max_backoff = "10m"
+  ## Outputs are flushed in ascending order = <n>, outputs with the same
+  ## order (0 by default) concurrently, ie, order = 1 on a file output and
+  ## order = 2 on influxdb writes the file first.
 
   ## Logging configuration:
   ## Run telegraf with debug log messages.
@@ -176,8 +384,141 @@ var header = `# Telegraf Configuration
 
   ## Override default hostname, if empty use os.Hostname()
   hostname = ""
+  ## Global tags set from environment variables, as "tag=ENV_VAR". Variables
+  ## that are not set are skipped with a warning.
+  # global_tags_from_env = ["node=NODE_NAME"]
+  ## File of KEY=value lines to set in the environment before the rest of
+  ## the config reads from it, relative to the directory of this file. The
+  ## variables of the real environment take precedence over it.
+  # env_file = "telegraf.env"
   ## If set to true, do no set the "host" tag in the telegraf agent.
   omit_hostname = false
+  ## If set to true, tag every metric with the input that gathered it, ie,
+  ## input=cpu, to trace where metrics come from.
+  # add_plugin_tag = false
+
+  ## If set to true, tag every metric with the base name of the config file
+  ## that declared its input, ie, config_file=cpu.conf, to trace the
+  ## fragments of a config directory. As add_plugin_tag, it applies to the
+  ## inputs loaded after it, so set it in the main config file.
+  # add_config_file_tag = false
+
+  ## Maximum number of distinct values kept for any single tag key. Once the
+  ## limit is reached, new values of that tag are replaced with "overflow".
+  ## 0 means unlimited.
+  # max_tag_values = 0
+
+  ## Maximum number of fields of a single metric, for outputs that limit the
+  ## fields of a point. Larger metrics are either split into several metrics
+  ## with the same name, tags and time ("split"), or have the fields past
+  ## the limit, in key order, dropped ("drop"). 0 means unlimited.
+  # max_fields_per_metric = 0
+  # max_fields_action = "split"
+
+  ## Maximum number of metrics an input may add in a single gather, 0 means
+  ## unlimited. This is a safety valve against a runaway input, ie, an exec
+  ## command printing far more than usual; the metrics past the limit are
+  ## dropped ("drop", the default) or only one in 10 is kept ("sample"), with
+  ## a warning, and counted in gather metrics_dropped.
+  # max_metrics_per_interval = 0
+  # max_metrics_action = "drop"
+
+  ## Lowercase the tag keys and/or the tag values of every metric, ie, so
+  ## that a device reported as "C0T0D0" by one command and "c0t0d0" by
+  ## another ends up in the same series. Applied after the input filters
+  ## and the processors; when two keys only differ by case, the lowercase
+  ## one is kept.
+  # lowercase_tag_keys = false
+  # lowercase_tag_values = false
+
+  ## Fields added to every metric, ie, to record the build of the collector.
+  ## Unlike global tags they can be numbers. A field of the same name set by
+  ## the plugin is kept. They go in an [agent.static_fields] table, after the
+  ## other agent options.
+  # [agent.static_fields]
+  #   collector_version = 3
+
+  ## Maximum number of commands the exec inputs run at once, all of them
+  ## together, 0 means unlimited. The other commands wait for a free slot,
+  ## so that many commands gathered at once do not exhaust the processes of
+  ## a small zone.
+  # max_exec_processes = 0
+
+  ## Maximum length in bytes of string field values, 0 means unlimited.
+  ## Longer values, ie, a whole log message captured by accident, are cut to
+  ## this length and end with "...".
+  # max_string_field_length = 0
+
+  ## Write the metrics to each output in the order they were gathered in.
+  ## Inputs gather concurrently and metrics from aggregators and processors
+  ## reach the outputs on a path of their own, so without it a batch may
+  ## interleave them out of order. Each metric is numbered when gathered and
+  ## every batch is sorted by that number before it is written; metrics of
+  ## different batches are not reordered.
+  # preserve_order = false
+
+  ## Seed for the collection_jitter and flush_jitter random durations. Setting
+  ## it makes the jitter reproducible, which is mostly useful for testing.
+  ## 0 means a random seed.
+  # jitter_seed = 0
+
+  ## Address to serve health checks on, for liveness and readiness probes.
+  ## /healthz returns 200 while inputs are gathered and outputs flushed on
+  ## schedule, 503 otherwise, and /metrics-count the agent metric counters.
+  # health_listen = ":8090"
+
+  ## By default a config naming a plugin that does not exist fails to load.
+  ## When true, such plugins are skipped with a warning instead.
+  # skip_unknown_plugins = false
+
+  ## By default the agent exits when an output still cannot connect after a
+  ## retry. When true, it starts anyway; the metrics of such an output are
+  ## kept in its buffer, up to metric_buffer_limit, and the connection is
+  ## retried on each flush until it succeeds.
+  # buffer_before_connect = false
+
+  ## On shutdown, the metrics still buffered by the outputs are written
+  ## before exiting. When false the agent exits at once, closing the outputs
+  ## and dropping those metrics, ie, for a fast emergency shutdown.
+  # flush_on_shutdown = true
+
+  ## Processors that set the same order are applied in declaration order,
+  ## with a warning. When true, such a config fails to load instead.
+  # strict_processor_order = false
+  ## A processor that panics on a metric passes it on, as the processor left
+  ## it, logging the first panic with its stack. Set on_panic = "drop" in
+  ## the [[processors.*]] block to drop such metrics instead, or
+  ## "pass_original" to pass them on as they were before the processor,
+  ## which copies every metric the processor is given.
+
+  ## When the system clock steps backward, ie, on an NTP correction, give
+  ## each metric at least the time of the previous metric of its series, so
+  ## that timestamps never decrease. Such a metric then overwrites the
+  ## previous point in InfluxDB. A series not seen for an hour is forgotten.
+  # monotonic_time = false
+
+  ## Metrics timestamped more than max_future_skew ahead of the current time,
+  ## ie, from a source with a skewed clock, are dropped ("drop", the default)
+  ## or given the current time ("clamp"), with a warning. They are checked
+  ## after the processors, and counted in agent metrics_future_skewed. Unset
+  ## by default, which lets every timestamp through.
+  # max_future_skew = "1h"
+  # max_future_skew_action = "drop"
+
+  ## Maximum number of CPUs running the agent at once (GOMAXPROCS), 0 leaves
+  ## the Go runtime default. In a zone with a capped-cpu resource control the
+  ## runtime still sees every CPU of the host, or of its pool, so set this to
+  ## the cap to avoid being throttled; a dedicated-cpu zone only sees its own.
+  # max_procs = 0
+
+  ## Emit a heartbeat metric every interval, even when no input gathers
+  ## anything, ie, "telegraf_heartbeat,host=web1 uptime=3600i", where uptime
+  ## is in seconds. Alert on its absence to detect a dead agent. Extra tags
+  ## go in an [agent.heartbeat_tags] table, after the other agent options.
+  # heartbeat = false
+  # heartbeat_measurement = "telegraf_heartbeat"
+  # [agent.heartbeat_tags]
+  #   role = "collector"
 
 
 ###############################################################################
@@ -231,6 +572,102 @@ func (c *Config) OutputNames() []string {
 	return name
 }
 
+// FlushOutput writes all the buffered metrics of the outputs named name
+// right away, outside of the flush interval, ie, before a planned
+// maintenance of the output's backend. A flush of the agent that is running
+// is waited for. Every output of that name is flushed, even when one of
+// them fails; the first error is returned.
+func (c *Config) FlushOutput(name string) error {
+	var firstErr error
+	found := false
+	for _, output := range c.Outputs {
+		if output.Name != name {
+			continue
+		}
+		found = true
+		log.Printf("I! Output [%s] flushing on demand", name)
+		if err := output.Flush(); err != nil {
+			log.Printf("E! Error writing to output [%s]: %s", name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("no output named %s", name)
+	}
+	return firstErr
+}
+
+// TestInput gathers the inputs named name, ie, "cpu" or "inputs.cpu", a
+// single time with their configured options and prints their metrics to w,
+// before any processing. It is narrower than RunTest, to isolate a
+// misbehaving input. Service inputs cannot be tested this way.
+func (c *Config) TestInput(name string, w io.Writer) error {
+	var inputs []*RunningInput
+	for _, input := range c.Inputs {
+		if input.Config.Name == name || input.Name() == name {
+			inputs = append(inputs, input)
+		}
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("no input named %s is configured, the inputs are: %s",
+			name, strings.Join(c.InputNames(), ", "))
+	}
+
+	for _, input := range inputs {
+		if _, ok := input.Input.(ServiceInput); ok {
+			return fmt.Errorf("input %s is a service input and cannot be tested",
+				name)
+		}
+		input.SetDefaultTags(c.Tags)
+		metricC := make(chan Metric, 100)
+		acc := NewAccumulator(input, metricC)
+		acc.SetPrecision(c.Agent.Precision.Duration, c.Agent.Interval.Duration)
+
+		done := make(chan error, 1)
+		go func(input *RunningInput) {
+			done <- input.Input.Gather(acc)
+			close(metricC)
+		}(input)
+		// keep draining after a write error, so that the gather can finish
+		var werr error
+		for m := range metricC {
+			if werr == nil {
+				_, werr = io.WriteString(w, "> "+m.SerializeLineProtocol())
+			}
+		}
+		if werr != nil {
+			return werr
+		}
+		if err := <-done; err != nil {
+			return fmt.Errorf("input %s: %s", input.Name(), err)
+		}
+	}
+	return nil
+}
+
+// ProcessorNames returns a list of strings of the configured processors.
+func (c *Config) ProcessorNames() []string {
+	var name []string
+	for _, processor := range c.Processors {
+		name = append(name, processor.Name)
+	}
+	return name
+}
+
+// AggregatorNames returns a list of strings of the configured aggregators.
+func (c *Config) AggregatorNames() []string {
+	var name []string
+	for _, aggregator := range c.Aggregators {
+		name = append(name, aggregator.Config.Name)
+	}
+	return name
+}
+
+// LoadDirectory loads the .conf files under path, in lexical order. The
+// [agent] tables of the files merge: a file overrides only the agent options
+// it sets, and the static_fields and heartbeat_tags key by key.
 func (c *Config) LoadDirectory(path string) error {
 	walkfn := func(thispath string, info os.FileInfo, _ error) error {
 		if info == nil {
@@ -253,6 +690,28 @@ func (c *Config) LoadDirectory(path string) error {
 	return filepath.Walk(path, walkfn)
 }
 
+// LoadAll loads the main config file, then the .conf files of the config
+// directory dir, in lexical order, ie, a base telegraf.conf and its
+// telegraf.d fragments. Either may be empty, but not both. Each file is
+// applied in turn as by LoadConfig: plugins accumulate, and a later file
+// setting an agent option overrides the earlier ones.
+func (c *Config) LoadAll(main, dir string) error {
+	if main == "" && dir == "" {
+		return fmt.Errorf("no config file or directory to load")
+	}
+	if main != "" {
+		if err := c.LoadConfig(main); err != nil {
+			return err
+		}
+	}
+	if dir != "" {
+		if err := c.LoadDirectory(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Try to find a default config file at these locations (in order):
 //   1. $TELEGRAF_CONFIG_PATH
 //   2. $HOME/.telegraf/telegraf.conf
@@ -285,10 +744,91 @@ func (c *Config) LoadConfig(path string) error {
 			return err
 		}
 	}
-	tbl, err := parseFile(path)
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return c.LoadConfigURL(path)
+	}
+	tbl, err := parseFile(path, c.StrictTOML)
+	if err != nil {
+		return fmt.Errorf("Error parsing %s, %s", path, err)
+	}
+	// an empty or comments-only file, ie, one left in the config directory
+	// with everything commented out, parses to an empty table
+	if len(tbl.Fields) == 0 {
+		log.Printf("D! Config file %s has no settings, skipping", path)
+		return nil
+	}
+	return c.loadTable(path, tbl)
+}
+
+// AddDefaultPlugins adds the default inputs, with their default settings, to
+// a loaded config that has no input, and likewise the default outputs, if
+// any were set with SetOutputDefaults, to one that has no output. Explicitly
+// configured plugins are left alone.
+func (c *Config) AddDefaultPlugins() error {
+	if len(c.Inputs) == 0 {
+		for _, name := range inputDefaults {
+			log.Printf("D! No inputs configured, adding default input [%s]", name)
+			if err := c.addInput(name, "", &Table{Fields: map[string]interface{}{}}); err != nil {
+				return err
+			}
+		}
+	}
+	if len(c.Outputs) == 0 {
+		for _, name := range outputDefaults {
+			log.Printf("D! No outputs configured, adding default output [%s]", name)
+			if err := c.addOutput(name, &Table{Fields: map[string]interface{}{}}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadConfigURL fetches the config at the given http(s) URL and applies it
+// to c, the same way LoadConfig does for a local file.
+func (c *Config) LoadConfigURL(u string) error {
+	tbl, err := parseURL(u, c.StrictTOML)
+	if err != nil {
+		return fmt.Errorf("Error parsing %s, %s", u, err)
+	}
+	return c.loadTable(u, tbl)
+}
+
+// loadTable applies a parsed config to c. path is used for error messages
+// and for the config_file tag of the inputs, see add_config_file_tag.
+func (c *Config) loadTable(path string, tbl *Table) error {
+	var err error
+	firstOutput := len(c.Outputs)
+	firstProcessor := len(c.Processors)
+
+	// The env file goes first, the tags and the plugins read from the
+	// environment:
+	envFile, err := envFilePath(tbl)
 	if err != nil {
 		return fmt.Errorf("Error parsing %s, %s", path, err)
 	}
+	if envFile != "" {
+		if err = loadEnvFile(resolveEnvFile(envFile, path)); err != nil {
+			return fmt.Errorf("Error parsing %s, env_file: %s", path, err)
+		}
+	}
+
+	// Parse the secrets, which the plugin tables may reference:
+	if val, ok := tbl.Fields["secrets"]; ok {
+		subTable, ok := val.(*Table)
+		if !ok {
+			return fmt.Errorf("%s: invalid configuration", path)
+		}
+		secrets := make(map[string]string)
+		if err = UnmarshalTable(subTable, secrets); err != nil {
+			log.Printf("E! Could not parse [secrets] config\n")
+			return fmt.Errorf("Error parsing %s, %s", path, err)
+		}
+		for k, v := range secrets {
+			c.secrets[k] = v
+			addSecretValue(v)
+		}
+	}
 
 	// Parse tags tables first:
 	for _, tableName := range []string{"tags", "global_tags"} {
@@ -297,10 +837,14 @@ func (c *Config) LoadConfig(path string) error {
 			if !ok {
 				return fmt.Errorf("%s: invalid configuration", path)
 			}
-			if err = UnmarshalTable(subTable, c.Tags); err != nil {
+			tags := make(map[string]string)
+			if err = UnmarshalTable(subTable, tags); err != nil {
 				log.Printf("E! Could not parse [global_tags] config\n")
 				return fmt.Errorf("Error parsing %s, %s", path, err)
 			}
+			for k, v := range expandTagEnv(tags) {
+				c.Tags[k] = v
+			}
 		}
 	}
 
@@ -310,10 +854,22 @@ func (c *Config) LoadConfig(path string) error {
 		if !ok {
 			return fmt.Errorf("%s: invalid configuration", path)
 		}
+		// the keys that this table does not set keep their value, from the
+		// defaults or an earlier file, but its map subtables replace the
+		// earlier ones, so merge these back key by key
+		heartbeatTags, staticFields := c.Agent.HeartbeatTags, c.Agent.StaticFields
 		if err = UnmarshalTable(subTable, c.Agent); err != nil {
 			log.Printf("E! Could not parse [agent] config\n")
 			return fmt.Errorf("Error parsing %s, %s", path, err)
 		}
+		c.Agent.HeartbeatTags = mergeStringMaps(heartbeatTags, c.Agent.HeartbeatTags)
+		c.Agent.StaticFields = mergeFieldMaps(staticFields, c.Agent.StaticFields)
+		if err = c.setAgentPrecision(subTable); err != nil {
+			return fmt.Errorf("Error parsing %s, %s", path, err)
+		}
+		if err = c.addEnvTags(); err != nil {
+			return fmt.Errorf("Error parsing %s, %s", path, err)
+		}
 	}
 
 	// Parse all the rest of the plugins:
@@ -324,7 +880,7 @@ func (c *Config) LoadConfig(path string) error {
 		}
 
 		switch name {
-		case "agent", "global_tags", "tags":
+		case "agent", "global_tags", "tags", "secrets":
 		case "outputs":
 			for pluginName, pluginVal := range subTable.Fields {
 				switch pluginSubTable := pluginVal.(type) {
@@ -344,17 +900,45 @@ func (c *Config) LoadConfig(path string) error {
 						pluginName, path)
 				}
 			}
+		case "processors":
+			for pluginName, pluginVal := range subTable.Fields {
+				switch pluginSubTable := pluginVal.(type) {
+				case []*Table:
+					for _, t := range pluginSubTable {
+						if err = c.addProcessor(pluginName, t); err != nil {
+							return fmt.Errorf("Error parsing %s, %s", path, err)
+						}
+					}
+				default:
+					return fmt.Errorf("Unsupported config format: %s, file %s",
+						pluginName, path)
+				}
+			}
+		case "aggregators":
+			for pluginName, pluginVal := range subTable.Fields {
+				switch pluginSubTable := pluginVal.(type) {
+				case []*Table:
+					for _, t := range pluginSubTable {
+						if err = c.addAggregator(pluginName, t); err != nil {
+							return fmt.Errorf("Error parsing %s, %s", path, err)
+						}
+					}
+				default:
+					return fmt.Errorf("Unsupported config format: %s, file %s",
+						pluginName, path)
+				}
+			}
 		case "inputs", "plugins":
 			for pluginName, pluginVal := range subTable.Fields {
 				switch pluginSubTable := pluginVal.(type) {
 				// legacy [inputs.cpu] support
 				case *Table:
-					if err = c.addInput(pluginName, pluginSubTable); err != nil {
+					if err = c.addInput(pluginName, path, pluginSubTable); err != nil {
 						return fmt.Errorf("Error parsing %s, %s", path, err)
 					}
 				case []*Table:
 					for _, t := range pluginSubTable {
-						if err = c.addInput(pluginName, t); err != nil {
+						if err = c.addInput(pluginName, path, t); err != nil {
 							return fmt.Errorf("Error parsing %s, %s", path, err)
 						}
 					}
@@ -364,11 +948,62 @@ func (c *Config) LoadConfig(path string) error {
 				}
 			}
 		default:
-			if err = c.addInput(name, subTable); err != nil {
+			if err = c.addInput(name, path, subTable); err != nil {
 				return fmt.Errorf("Error parsing %s, %s", path, err)
 			}
 		}
 	}
+
+	// with or without an [agent] table, so that the intervals of the inputs
+	// are checked in every file
+	if err = c.validateIntervals(); err != nil {
+		return fmt.Errorf("Error parsing %s, %s", path, err)
+	}
+
+	if len(c.Processors) > 1 {
+		added := make(map[*RunningProcessor]bool)
+		for _, p := range c.Processors[firstProcessor:] {
+			added[p] = true
+		}
+		// as for the outputs, processors with the same order are applied
+		// in declaration order
+		sort.Sort(processorsByLine(c.Processors[firstProcessor:]))
+		sort.Stable(c.Processors)
+		if err = c.checkProcessorOrder(added); err != nil {
+			return fmt.Errorf("Error parsing %s, %s", path, err)
+		}
+	}
+	if len(c.Outputs) > 1 {
+		// the tables are read from a map, restore the declaration order of
+		// this file before sorting all of the outputs by their order
+		sort.Sort(outputsByLine(c.Outputs[firstOutput:]))
+		sort.Stable(RunningOutputs(c.Outputs))
+	}
+	return nil
+}
+
+// checkProcessorOrder warns about the added processors that set the same
+// order as a processor before them, or fails with strict_processor_order.
+// Processors without an order are left alone, they keep declaration order.
+func (c *Config) checkProcessorOrder(added map[*RunningProcessor]bool) error {
+	for i, p := range c.Processors {
+		if !added[p] || !p.Config.orderSet {
+			continue
+		}
+		for _, prev := range c.Processors[:i] {
+			if !prev.Config.orderSet || prev.Config.Order != p.Config.Order {
+				continue
+			}
+			if c.Agent.StrictProcessorOrder {
+				return fmt.Errorf("processors %s and %s have the same order %d",
+					prev.Name, p.Name, p.Config.Order)
+			}
+			log.Printf("W! Processors [%s] and [%s] have the same order %d, "+
+				"applying them in declaration order", prev.Name, p.Name,
+				p.Config.Order)
+			break
+		}
+	}
 	return nil
 }
 
@@ -376,11 +1011,29 @@ func (c *Config) addOutput(name string, table *Table) error {
 	if len(c.OutputFilters) > 0 && !sliceContains(name, c.OutputFilters) {
 		return nil
 	}
+	enabled, err := pluginEnabled(table)
+	if err != nil {
+		return fmt.Errorf("output %s: %s", name, err)
+	}
+	if !enabled {
+		log.Printf("D! Output [%s] is disabled, skipping", name)
+		return nil
+	}
 	creator, ok := Outputs[name]
 	if !ok {
+		if c.Agent.SkipUnknownPlugins {
+			log.Printf("W! Output [%s] is not a known plugin, skipping", name)
+			return nil
+		}
 		return fmt.Errorf("Undefined but requested output: %s", name)
 	}
 	output := creator()
+	warnDeprecated("outputs", name, output)
+	if err := c.resolveSecrets(table); err != nil {
+		return fmt.Errorf("output %s: %s", name, err)
+	}
+	// hashed before the agent-level settings are removed from the table
+	hash := tableHash(table)
 
 	// If the output has a SetSerializer function, then this means it can write
 	// arbitrary types of output, so build the serializer and set it.
@@ -393,22 +1046,123 @@ func (c *Config) addOutput(name string, table *Table) error {
 		t.SetSerializer(serializer)
 	}
 
+	_, timeoutSet := table.Fields["timeout"]
 	outputConfig, err := buildOutput(name, table)
 	if err != nil {
 		return err
 	}
+	outputConfig.hash = hash
 
 	if err := UnmarshalTable(table, output); err != nil {
 		return err
 	}
+	if timeoutSet {
+		setPluginTimeout(output, outputConfig.Timeout)
+	}
 
+	bufferLimit := c.Agent.MetricBufferLimit
+	if outputConfig.MetricBufferLimit > 0 {
+		bufferLimit = outputConfig.MetricBufferLimit
+	}
 	ro := NewRunningOutput(name, output, outputConfig,
-		c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+		c.Agent.MetricBatchSize, bufferLimit)
+	if policy := c.Agent.BufferOverflowPolicy; policy != "" {
+		if !ValidOverflowPolicy(policy) {
+			return fmt.Errorf("invalid buffer_overflow_policy %q", policy)
+		}
+		ro.SetOverflowPolicy(policy)
+	}
+	ro.PreserveOrder = c.Agent.PreserveOrder
+	if outputConfig.SpillDir != "" {
+		if err := ro.EnableSpill(outputConfig.SpillDir,
+			outputConfig.SpillMaxSize); err != nil {
+			return fmt.Errorf("output %s: %s", name, err)
+		}
+	}
 	c.Outputs = append(c.Outputs, ro)
 	return nil
 }
 
-func (c *Config) addInput(name string, table *Table) error {
+func (c *Config) addProcessor(name string, table *Table) error {
+	enabled, err := pluginEnabled(table)
+	if err != nil {
+		return fmt.Errorf("processor %s: %s", name, err)
+	}
+	if !enabled {
+		log.Printf("D! Processor [%s] is disabled, skipping", name)
+		return nil
+	}
+	creator, ok := Processors[name]
+	if !ok {
+		if c.Agent.SkipUnknownPlugins {
+			log.Printf("W! Processor [%s] is not a known plugin, skipping", name)
+			return nil
+		}
+		return fmt.Errorf("Undefined but requested processor: %s", name)
+	}
+	processor := creator()
+	warnDeprecated("processors", name, processor)
+
+	processorConfig, err := buildProcessor(name, table)
+	if err != nil {
+		return err
+	}
+
+	if err := UnmarshalTable(table, processor); err != nil {
+		return err
+	}
+	if fc, ok := processor.(filterCompiler); ok {
+		if err := fc.compileFilters(); err != nil {
+			return fmt.Errorf("processor %s: %s", name, err)
+		}
+	}
+
+	rf := &RunningProcessor{
+		Name:      name,
+		Processor: processor,
+		Config:    processorConfig,
+	}
+
+	c.Processors = append(c.Processors, rf)
+	return nil
+}
+
+func (c *Config) addAggregator(name string, table *Table) error {
+	enabled, err := pluginEnabled(table)
+	if err != nil {
+		return fmt.Errorf("aggregator %s: %s", name, err)
+	}
+	if !enabled {
+		log.Printf("D! Aggregator [%s] is disabled, skipping", name)
+		return nil
+	}
+	creator, ok := Aggregators[name]
+	if !ok {
+		if c.Agent.SkipUnknownPlugins {
+			log.Printf("W! Aggregator [%s] is not a known plugin, skipping", name)
+			return nil
+		}
+		return fmt.Errorf("Undefined but requested aggregator: %s", name)
+	}
+	aggregator := creator()
+	warnDeprecated("aggregators", name, aggregator)
+
+	conf, err := buildAggregator(name, table)
+	if err != nil {
+		return err
+	}
+
+	if err := UnmarshalTable(table, aggregator); err != nil {
+		return err
+	}
+
+	c.Aggregators = append(c.Aggregators, NewRunningAggregator(aggregator, conf))
+	return nil
+}
+
+// addInput adds the input declared by table in the config file at path, or
+// by no file for a default input.
+func (c *Config) addInput(name, path string, table *Table) error {
 	if len(c.InputFilters) > 0 && !sliceContains(name, c.InputFilters) {
 		return nil
 	}
@@ -416,12 +1170,30 @@ func (c *Config) addInput(name string, table *Table) error {
 	if name == "io" {
 		name = "diskio"
 	}
+	enabled, err := pluginEnabled(table)
+	if err != nil {
+		return fmt.Errorf("input %s: %s", name, err)
+	}
+	if !enabled {
+		log.Printf("D! Input [%s] is disabled, skipping", name)
+		return nil
+	}
 
 	creator, ok := Inputs[name]
 	if !ok {
+		if c.Agent.SkipUnknownPlugins {
+			log.Printf("W! Input [%s] is not a known plugin, skipping", name)
+			return nil
+		}
 		return fmt.Errorf("Undefined but requested input: %s", name)
 	}
 	input := creator()
+	warnDeprecated("inputs", name, input)
+	if err := c.resolveSecrets(table); err != nil {
+		return fmt.Errorf("input %s: %s", name, err)
+	}
+	// hashed before the agent-level settings are removed from the table
+	hash := tableHash(table)
 
 	// If the input has a SetParser function, then this means it can accept
 	// arbitrary types of input, so build the parser and set it.
@@ -438,66 +1210,454 @@ func (c *Config) addInput(name string, table *Table) error {
 	if err != nil {
 		return err
 	}
+	// the tags the agent adds are hashed too, so that a reload that changes
+	// them restarts the input
+	added := make(map[string]string)
+	if c.Agent.AddPluginTag {
+		// a tag set on the input itself takes precedence
+		if _, ok := pluginConfig.Tags["input"]; !ok {
+			pluginConfig.Tags["input"] = name
+			added["input"] = name
+		}
+	}
+	if c.Agent.AddConfigFileTag && path != "" {
+		if _, ok := pluginConfig.Tags["config_file"]; !ok {
+			pluginConfig.Tags["config_file"] = filepath.Base(path)
+			added["config_file"] = filepath.Base(path)
+		}
+	}
+	pluginConfig.hash = tagsHash(hash, added)
 
 	if err := UnmarshalTable(table, input); err != nil {
 		return err
 	}
+	if fc, ok := input.(filterCompiler); ok {
+		if err := fc.compileFilters(); err != nil {
+			return fmt.Errorf("input %s: %s", name, err)
+		}
+	}
 
 	rp := NewRunningInput(input, pluginConfig)
 	c.Inputs = append(c.Inputs, rp)
 	return nil
 }
 
-// trimBOM trims the Byte-Order-Marks from the beginning of the file.
-// this is for Windows compatibility only.
-// see https://github.com/influxdata/telegraf/issues/1378
-func trimBOM(f []byte) []byte {
-	return bytes.TrimPrefix(f, []byte("\xef\xbb\xbf"))
-}
+// pluginEnabled reports whether the plugin table should be loaded. A plugin
+// is enabled unless it sets "enabled = false". The value can also be a
+// string naming environment variables, ie, enabled = "$ENABLE_FILE_OUTPUT",
+// that expands to a boolean; a variable that is not set disables the plugin.
+// The key is removed from the table so that it is not passed on to the plugin
+// itself.
+func pluginEnabled(tbl *Table) (bool, error) {
+	enabled := true
+	if node, ok := tbl.Fields["enabled"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			var err error
+			switch v := kv.Value.(type) {
+			case *Boolean:
+				enabled, err = v.Boolean()
+			case *String:
+				enabled, err = envEnabled(v.Value)
+			default:
+				err = fmt.Errorf("enabled must be a boolean")
+			}
+			if err != nil {
+				return false, fmt.Errorf("line %d: %s", kv.Line, err)
+			}
+		}
+	}
 
-// escapeEnv escapes a value for inserting into a TOML string.
-func escapeEnv(value string) string {
-	return envVarEscaper.Replace(value)
+	delete(tbl.Fields, "enabled")
+	return enabled, nil
 }
 
-// parseFile loads a TOML configuration from a provided path and
-// returns the AST produced from the TOML parser. When loading the file, it
-// will find environment variables and replace them.
-func parseFile(fpath string) (*Table, error) {
-	contents, err := ioutil.ReadFile(fpath)
-	if err != nil {
-		return nil, err
+// envEnabled expands the environment variables of an "enabled" string and
+// parses the result as a boolean.
+func envEnabled(value string) (bool, error) {
+	expanded, missing := expandEnv(value, nil)
+	if missing != "" {
+		log.Printf("I! Environment variable %s is not set, disabling plugin",
+			missing)
+		return false, nil
 	}
-	// ugh windows why
-	contents = trimBOM(contents)
-
-	// commenting below code for skipping env variables
-	/*	env_vars := envVarRe.FindAll(contents, -1)
-		for _, env_var := range env_vars {
-			env_val, ok := os.LookupEnv(strings.TrimPrefix(string(env_var), "$"))
-			if ok {
-				env_val = escapeEnv(env_val)
-				contents = bytes.Replace(contents, env_var, []byte(env_val), 1)
-			}
-		}*/
 
-	return Parse(contents)
+	enabled, err := strconv.ParseBool(strings.TrimSpace(expanded))
+	if err != nil {
+		return false, fmt.Errorf("enabled %q is not a boolean", expanded)
+	}
+	return enabled, nil
 }
 
-type InputCreator func() Input
-
-var Inputs = map[string]InputCreator{}
-
-func AddInput(name string, creator InputCreator) {
-	Inputs[name] = creator
+// trimBOM trims the Byte-Order-Marks from the beginning of the file.
+// this is for Windows compatibility only.
+// see https://github.com/influxdata/telegraf/issues/1378
+func trimBOM(f []byte) []byte {
+	return bytes.TrimPrefix(f, []byte("\xef\xbb\xbf"))
 }
 
-type OutputCreator func() Output
-
-var Outputs = map[string]OutputCreator{}
+// warnDeprecated logs a warning if plugin, configured as [[kind.name]], is
+// deprecated.
+func warnDeprecated(kind, name string, plugin interface{}) {
+	d, ok := plugin.(DeprecatedPlugin)
+	if !ok {
+		return
+	}
+	deprecated, replacement := d.Deprecated()
+	if !deprecated {
+		return
+	}
+	if replacement == "" {
+		log.Printf("W! Plugin [%s.%s] is deprecated and will be removed", kind, name)
+		return
+	}
+	log.Printf("W! Plugin [%s.%s] is deprecated and will be removed, use [%s.%s] instead",
+		kind, name, kind, replacement)
+}
 
-func AddOutput(name string, creator OutputCreator) {
-	Outputs[name] = creator
+// normalizeNewlines turns the CRLF line endings of a file edited on Windows
+// into LF. The parser counts \r and \n as a line each, which doubled the
+// line numbers of errors and of processor ordering, and multi-line strings
+// kept the \r.
+func normalizeNewlines(f []byte) []byte {
+	return bytes.Replace(f, []byte("\r\n"), []byte("\n"), -1)
+}
+
+// setAgentPrecision validates the precision of the [agent] table, which is
+// either a unit ("ns", "us", "µs", "ms" or "s") or a duration of one of
+// them ("1ms"). Duration itself silently ignores invalid values.
+func (c *Config) setAgentPrecision(tbl *Table) error {
+	node, ok := tbl.Fields["precision"]
+	if !ok {
+		return nil
+	}
+	kv, ok := node.(*KeyValue)
+	if !ok {
+		return nil
+	}
+	str, ok := kv.Value.(*String)
+	if !ok {
+		return fmt.Errorf("invalid precision %s, must be a string", kv.Value.Source())
+	}
+
+	switch str.Value {
+	case "", "0s":
+		c.Agent.Precision.Duration = 0
+		return nil
+	case "ns":
+		c.Agent.Precision.Duration = time.Nanosecond
+		return nil
+	case "us", "µs":
+		c.Agent.Precision.Duration = time.Microsecond
+		return nil
+	case "ms":
+		c.Agent.Precision.Duration = time.Millisecond
+		return nil
+	case "s":
+		c.Agent.Precision.Duration = time.Second
+		return nil
+	}
+
+	d, err := time.ParseDuration(str.Value)
+	if err == nil {
+		switch d {
+		case time.Nanosecond, time.Microsecond, time.Millisecond, time.Second:
+			c.Agent.Precision.Duration = d
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid precision %q, valid units are \"ns\", \"us\" "+
+		"(or \"µs\"), \"ms\" and \"s\"", str.Value)
+}
+
+// validateIntervals rejects an interval or flush_interval of the [agent]
+// table that is zero or negative, or a negative interval of an input, with
+// which the gather or flush ticker would fire in a tight loop. An input
+// interval of zero is one that is not set, the input gathers at the agent
+// interval; buildInput rejects an interval set to zero.
+func (c *Config) validateIntervals() error {
+	if d := c.Agent.Interval.Duration; d <= 0 {
+		return fmt.Errorf("invalid interval %s, must be greater than 0", d)
+	}
+	if d := c.Agent.FlushInterval.Duration; d <= 0 {
+		return fmt.Errorf("invalid flush_interval %s, must be greater than 0", d)
+	}
+	for _, input := range c.Inputs {
+		if d := input.Config.Interval; d < 0 {
+			return fmt.Errorf("input %s: invalid interval %s, must be "+
+				"greater than 0", input.Config.Name, d)
+		}
+	}
+	return nil
+}
+
+// mergeStringMaps returns the keys of prev and next, those of next winning.
+// It returns next itself when there is nothing to merge.
+func mergeStringMaps(prev, next map[string]string) map[string]string {
+	if len(prev) == 0 {
+		return next
+	}
+	out := make(map[string]string, len(prev)+len(next))
+	for k, v := range prev {
+		out[k] = v
+	}
+	for k, v := range next {
+		out[k] = v
+	}
+	return out
+}
+
+// mergeFieldMaps is mergeStringMaps for the static_fields.
+func mergeFieldMaps(prev, next map[string]interface{}) map[string]interface{} {
+	if len(prev) == 0 {
+		return next
+	}
+	out := make(map[string]interface{}, len(prev)+len(next))
+	for k, v := range prev {
+		out[k] = v
+	}
+	for k, v := range next {
+		out[k] = v
+	}
+	return out
+}
+
+// addEnvTags adds the global tags of the global_tags_from_env agent option,
+// given as "tag=ENV_VAR". Variables that are not set are skipped.
+func (c *Config) addEnvTags() error {
+	for _, mapping := range c.Agent.GlobalTagsFromEnv {
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid global_tags_from_env entry %q, "+
+				"expected tag=ENV_VAR", mapping)
+		}
+		tag, name := parts[0], parts[1]
+
+		value, ok := lookupEnv(name)
+		if !ok || value == "" {
+			log.Printf("W! Environment variable %s is not set, skipping "+
+				"global tag %s", name, tag)
+			continue
+		}
+		c.Tags[tag] = value
+	}
+	return nil
+}
+
+// expandTagEnv replaces the environment variables in the tag values, ie,
+// user = "$USER". A tag referencing a variable that is not set is dropped
+// rather than set to the literal variable name.
+func expandTagEnv(tags map[string]string) map[string]string {
+	for k, v := range tags {
+		expanded, missing := expandEnv(v, nil)
+		if missing != "" {
+			log.Printf("W! Environment variable %s is not set, skipping "+
+				"global tag %s", missing, k)
+			delete(tags, k)
+			continue
+		}
+		tags[k] = expanded
+	}
+	return tags
+}
+
+// secretPrefix marks a string setting that refers to an entry of the
+// [secrets] table, ie, password = "@secret:influx_password".
+const secretPrefix = "@secret:"
+
+// resolveSecrets replaces the "@secret:NAME" strings of a plugin table,
+// including those in arrays and sub-tables, with the NAME secret. The values
+// of the secret settings, ie, a password set inline, are registered to be
+// redacted from the logs.
+func (c *Config) resolveSecrets(tbl *Table) error {
+	for _, node := range tbl.Fields {
+		switch node := node.(type) {
+		case *KeyValue:
+			if err := c.resolveSecret(node.Value); err != nil {
+				return fmt.Errorf("%s: %s", node.Key, err)
+			}
+			if str, ok := node.Value.(*String); ok && isSecretSetting(node.Key) {
+				addSecretValue(str.Value)
+			}
+		case *Table:
+			if err := c.resolveSecrets(node); err != nil {
+				return err
+			}
+		case []*Table:
+			for _, t := range node {
+				if err := c.resolveSecrets(t); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) resolveSecret(v Value) error {
+	switch v := v.(type) {
+	case *String:
+		if !strings.HasPrefix(v.Value, secretPrefix) {
+			return nil
+		}
+		name := strings.TrimPrefix(v.Value, secretPrefix)
+		secret, ok := c.secrets[name]
+		if !ok {
+			return fmt.Errorf("undefined secret %q", name)
+		}
+		v.Value = secret
+		// the source is what plugins with their own TOML unmarshaler read
+		v.Data = []rune(strconv.Quote(secret))
+	case *Array:
+		for _, item := range v.Value {
+			if err := c.resolveSecret(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookupEnv returns the value of the environment variable key and whether it
+// is set.
+func lookupEnv(key string) (string, bool) {
+	prefix := key + "="
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, prefix) {
+			return kv[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+// expandEnv replaces the $VAR environment variables of value with their
+// values, passed through escape unless it is nil, and returns the name of
+// the first one that is not set, if any.
+func expandEnv(value string, escape func(string) string) (string, string) {
+	missing := ""
+	expanded := envVarRe.ReplaceAllStringFunc(value, func(name string) string {
+		v, ok := lookupEnv(name[1:])
+		if !ok && missing == "" {
+			missing = name[1:]
+		}
+		if escape != nil {
+			return escape(v)
+		}
+		return v
+	})
+	return expanded, missing
+}
+
+// escapeEnv escapes a value for inserting into a TOML string.
+func escapeEnv(value string) string {
+	return envVarEscaper.Replace(value)
+}
+
+// parseFile loads a TOML configuration from a provided path and
+// returns the AST produced from the TOML parser. When loading the file, it
+// will find environment variables and replace them, and merge the fragments
+// of its "@include path" directives into the tables that include them. With
+// strict, a table defined twice is an error rather than merged.
+func parseFile(fpath string, strict bool) (*Table, error) {
+	return parseIncludeFile(fpath, 0, strict)
+}
+
+// parseURL fetches a TOML configuration over http(s) and returns the AST
+// produced from the TOML parser, see parseFile. A config served to many
+// hosts cannot hold their own values, so the $VAR environment variables of
+// the body are replaced with those of this host before it is parsed; the
+// variables that are not set are left for the global tags and "enabled"
+// settings to handle, as in a local file.
+func parseURL(u string, strict bool) (*Table, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("config URL scheme must be http(s), got %s",
+			parsed.Scheme)
+	}
+
+	client := &http.Client{Timeout: configURLTimeout}
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received status code %d (%s)",
+			resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	// read one byte past the limit so an oversized config can be detected
+	contents, err := ioutil.ReadAll(io.LimitReader(resp.Body, configURLMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(contents) > configURLMaxSize {
+		return nil, fmt.Errorf("config is larger than %d bytes", configURLMaxSize)
+	}
+	contents = envVarRe.ReplaceAllFunc(contents, func(name []byte) []byte {
+		if v, ok := lookupEnv(string(name[1:])); ok {
+			return []byte(escapeEnv(v))
+		}
+		return name
+	})
+	return parseContents(contents, strict)
+}
+
+// parseContents returns the AST of a TOML configuration. It will find
+// environment variables in the contents and replace them.
+func parseContents(contents []byte, strict bool) (*Table, error) {
+	// ugh windows why
+	contents = trimBOM(contents)
+	contents = normalizeNewlines(contents)
+
+	// commenting below code for skipping env variables
+	/*	env_vars := envVarRe.FindAll(contents, -1)
+		for _, env_var := range env_vars {
+			env_val, ok := os.LookupEnv(strings.TrimPrefix(string(env_var), "$"))
+			if ok {
+				env_val = escapeEnv(env_val)
+				contents = bytes.Replace(contents, env_var, []byte(env_val), 1)
+			}
+		}*/
+
+	if strict {
+		return ParseStrict(contents)
+	}
+	return Parse(contents)
+}
+
+type InputCreator func() Input
+
+var Inputs = map[string]InputCreator{}
+
+func AddInput(name string, creator InputCreator) {
+	Inputs[name] = creator
+}
+
+type ProcessorCreator func() Processor
+
+var Processors = map[string]ProcessorCreator{}
+
+func AddProcessor(name string, creator ProcessorCreator) {
+	Processors[name] = creator
+}
+
+type AggregatorCreator func() Aggregator
+
+var Aggregators = map[string]AggregatorCreator{}
+
+func AddAggregator(name string, creator AggregatorCreator) {
+	Aggregators[name] = creator
+}
+
+type OutputCreator func() Output
+
+var Outputs = map[string]OutputCreator{}
+
+func AddOutput(name string, creator OutputCreator) {
+	Outputs[name] = creator
 }
 
 // PrintInputConfig prints the config usage of a single input.
@@ -520,11 +1680,80 @@ func PrintOutputConfig(name string) error {
 	return nil
 }
 
+// PrintProcessorConfig prints the config usage of a single processor.
+func PrintProcessorConfig(name string) error {
+	if creator, ok := Processors[name]; ok {
+		printConfig(name, creator(), "processors", false)
+	} else {
+		return errors.New(fmt.Sprintf("Processor %s not found", name))
+	}
+	return nil
+}
+
+// PrintAggregatorConfig prints the config usage of a single aggregator.
+func PrintAggregatorConfig(name string) error {
+	if creator, ok := Aggregators[name]; ok {
+		printConfig(name, creator(), "aggregators", false)
+	} else {
+		return errors.New(fmt.Sprintf("Aggregator %s not found", name))
+	}
+	return nil
+}
+
 type printer interface {
 	Description() string
 	SampleConfig() string
 }
 
+// ValidateRegistry checks every registered plugin for a non-empty description
+// and a sample config that is either empty or valid TOML. It is meant to be
+// called from tests, so that half-finished plugins are caught before they
+// ship.
+func ValidateRegistry() error {
+	var errs []string
+	for name, creator := range Inputs {
+		if err := validatePlugin(name, creator(), "inputs"); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for name, creator := range Outputs {
+		if err := validatePlugin(name, creator(), "outputs"); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for name, creator := range Processors {
+		if err := validatePlugin(name, creator(), "processors"); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for name, creator := range Aggregators {
+		if err := validatePlugin(name, creator(), "aggregators"); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func validatePlugin(name string, p printer, op string) error {
+	if strings.TrimSpace(p.Description()) == "" {
+		return fmt.Errorf("%s.%s: empty description", op, name)
+	}
+
+	config := p.SampleConfig()
+	if strings.TrimSpace(config) == "" {
+		return nil
+	}
+	if _, err := Parse([]byte(fmt.Sprintf("[[%s.%s]]\n%s", op, name, config))); err != nil {
+		return fmt.Errorf("%s.%s: invalid sample config: %s", op, name, err)
+	}
+	return nil
+}
+
 func printConfig(name string, p printer, op string, commented bool) {
 	comment := ""
 	if commented {
@@ -543,7 +1772,9 @@ func printConfig(name string, p printer, op string, commented bool) {
 				fmt.Print("\n")
 				continue
 			}
-			fmt.Print(strings.TrimRight(comment+line, " ") + "\n")
+			// a sample indented with tabs is commented out the same way,
+			// without leaving trailing whitespace on its blank lines
+			fmt.Print(strings.TrimRight(comment+line, " \t") + "\n")
 		}
 	}
 }
@@ -555,37 +1786,87 @@ type Duration struct {
 
 // UnmarshalTOML parses the duration from the TOML config file
 func (d *Duration) UnmarshalTOML(b []byte) error {
+	d.Duration, _ = parseDuration(string(b))
+	return nil
+}
+
+// Size is a number of bytes, read from the config file as an integer or as a
+// string with a unit, ie, "512KiB" or "1MB".
+type Size struct {
+	Size int64
+}
+
+// UnmarshalTOML parses the size from the TOML config file
+func (s *Size) UnmarshalTOML(b []byte) error {
 	var err error
-	b = bytes.Trim(b, `'`)
+	s.Size, err = parseSize(string(b))
+	return err
+}
 
-	// see if we can directly convert it
-	d.Duration, err = time.ParseDuration(string(b))
-	if err == nil {
-		return nil
+// sizeUnits are the units of sizes, decimal (KB) and binary (KiB), longest
+// first so that the suffix matched is the whole unit.
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// parseSize parses a size string, optionally quoted, as a plain integer
+// number of bytes or an integer followed by a unit.
+func parseSize(s string) (int64, error) {
+	s = strings.Trim(s, `'`)
+	if uq, err := strconv.Unquote(s); err == nil {
+		s = uq
+	}
+	s = strings.TrimSpace(s)
+
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			unit = u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
 	}
+	return n * unit, nil
+}
+
+// parseDuration parses a duration string the same way durations are read from
+// the config file: a Go duration ("1h23m", optionally quoted), or a plain
+// integer or float number of seconds.
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.Trim(s, `'`)
 
 	// Parse string duration, ie, "1s"
-	if uq, err := strconv.Unquote(string(b)); err == nil && len(uq) > 0 {
-		d.Duration, err = time.ParseDuration(uq)
-		if err == nil {
-			return nil
-		}
+	if uq, err := strconv.Unquote(s); err == nil && len(uq) > 0 {
+		s = uq
+	}
+
+	// see if we can directly convert it, fractions included, ie, 1.5m
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
 	}
 
 	// First try parsing as integer seconds
-	sI, err := strconv.ParseInt(string(b), 10, 64)
+	sI, err := strconv.ParseInt(s, 10, 64)
 	if err == nil {
-		d.Duration = time.Second * time.Duration(sI)
-		return nil
+		return time.Second * time.Duration(sI), nil
 	}
-	// Second try parsing as float seconds
-	sF, err := strconv.ParseFloat(string(b), 64)
+	// Second try parsing as float seconds, converting before truncating so
+	// that 1.5 is 1.5s rather than 1s
+	sF, err := strconv.ParseFloat(s, 64)
 	if err == nil {
-		d.Duration = time.Second * time.Duration(sF)
-		return nil
+		return time.Duration(sF * float64(time.Second)), nil
 	}
 
-	return nil
+	return 0, fmt.Errorf("invalid duration: %s", s)
 }
 
 func sliceContains(name string, list []string) bool {
@@ -603,66 +1884,409 @@ func sliceContains(name string, list []string) bool {
 func buildSerializer(name string, tbl *Table) (Serializer, error) {
 	c := &SerializerConfig{TimestampUnits: time.Duration(1 * time.Second)}
 
-	if node, ok := tbl.Fields["data_format"]; ok {
+	if node, ok := tbl.Fields["data_format"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.DataFormat = str.Value
+			}
+		}
+	}
+
+	if c.DataFormat == "" {
+		c.DataFormat = "influx"
+	}
+
+	if node, ok := tbl.Fields["prefix"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.Prefix = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["template"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.Template = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["graphite_separator"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.GraphiteSeparator = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["graphite_replacement"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.GraphiteReplacement = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["json_timestamp_units"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				timestampVal, err := time.ParseDuration(str.Value)
+				if err != nil {
+					return nil, fmt.Errorf("Unable to parse json_timestamp_units as a duration, %s", err)
+				}
+				// now that we have a duration, truncate it to the nearest
+				// power of ten (just in case)
+				nearest_exponent := int64(math.Log10(float64(timestampVal.Nanoseconds())))
+				new_nanoseconds := int64(math.Pow(10.0, float64(nearest_exponent)))
+				c.TimestampUnits = time.Duration(new_nanoseconds)
+			}
+		}
+	}
+
+	delete(tbl.Fields, "data_format")
+	delete(tbl.Fields, "prefix")
+	delete(tbl.Fields, "template")
+	delete(tbl.Fields, "graphite_separator")
+	delete(tbl.Fields, "graphite_replacement")
+	delete(tbl.Fields, "json_timestamp_units")
+	return NewSerializer(c)
+}
+
+// buildOutput parses output specific items from the ast.Table,
+// builds the filter and returns an
+// models.OutputConfig to be inserted into models.RunningInput
+// Note: error exists in the return for future calls that might require error
+func buildOutput(name string, tbl *Table) (*OutputConfig, error) {
+	oc := &OutputConfig{
+		Name:    name,
+		Timeout: DEFAULT_WRITE_TIMEOUT,
+		line:    tbl.Line,
+	}
+
+	// the timeout is removed from the table, addOutput passes it on to the
+	// outputs with a timeout of their own, ie, the influxdb client.
+	if node, ok := tbl.Fields["timeout"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			str, ok := kv.Value.(*String)
+			if !ok {
+				return nil, fmt.Errorf("output %s: timeout must be a duration "+
+					"string, ie, \"5s\"", name)
+			}
+			timeout, err := time.ParseDuration(str.Value)
+			if err != nil || timeout < 0 {
+				return nil, fmt.Errorf("output %s: invalid timeout %q", name, str.Value)
+			}
+			oc.Timeout = timeout
+		}
+	}
+
+	if node, ok := tbl.Fields["order"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if b, ok := kv.Value.(*Integer); ok {
+				var err error
+				oc.Order, err = b.Int()
+				if err != nil {
+					return nil, fmt.Errorf("output %s: invalid order: %s", name, err)
+				}
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["precision"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				precision, err := parsePrecision(str.Value)
+				if err != nil {
+					return nil, fmt.Errorf("output %s: %s", name, err)
+				}
+				oc.Precision = precision
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["buffer_spill_dir"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				oc.SpillDir = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["buffer_spill_max_size"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if integer, ok := kv.Value.(*Integer); ok {
+				v, err := integer.Int()
+				if err != nil {
+					return nil, err
+				}
+				oc.SpillMaxSize = v
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["metric_buffer_limit"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if integer, ok := kv.Value.(*Integer); ok {
+				v, err := integer.Int()
+				if err != nil || v < 0 {
+					return nil, fmt.Errorf("output %s: invalid metric_buffer_limit %s",
+						name, integer.Value)
+				}
+				oc.MetricBufferLimit = int(v)
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["breaker_threshold"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			integer, ok := kv.Value.(*Integer)
+			if !ok {
+				return nil, fmt.Errorf("output %s: breaker_threshold must be an "+
+					"integer, ie, breaker_threshold = 5", name)
+			}
+			v, err := integer.Int()
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("output %s: invalid breaker_threshold %s",
+					name, integer.Value)
+			}
+			oc.BreakerThreshold = int(v)
+		}
+	}
+
+	for key, d := range map[string]*time.Duration{
+		"breaker_backoff":     &oc.BreakerBackoff,
+		"breaker_max_backoff": &oc.BreakerMaxBackoff,
+	} {
+		if node, ok := tbl.Fields[key]; ok {
+			if kv, ok := node.(*KeyValue); ok {
+				str, ok := kv.Value.(*String)
+				if !ok {
+					return nil, fmt.Errorf("output %s: %s must be a duration "+
+						"string, ie, %s = \"30s\"", name, key, key)
+				}
+				v, err := time.ParseDuration(str.Value)
+				if err != nil || v <= 0 {
+					return nil, fmt.Errorf("output %s: invalid %s %q",
+						name, key, str.Value)
+				}
+				*d = v
+			}
+		}
+	}
+	if oc.BreakerMaxBackoff > 0 && oc.BreakerMaxBackoff < oc.BreakerBackoff {
+		return nil, fmt.Errorf("output %s: breaker_max_backoff must not be less "+
+			"than breaker_backoff", name)
+	}
+
+	delete(tbl.Fields, "timeout")
+	delete(tbl.Fields, "order")
+	delete(tbl.Fields, "precision")
+	delete(tbl.Fields, "buffer_spill_dir")
+	delete(tbl.Fields, "buffer_spill_max_size")
+	delete(tbl.Fields, "metric_buffer_limit")
+	delete(tbl.Fields, "breaker_threshold")
+	delete(tbl.Fields, "breaker_backoff")
+	delete(tbl.Fields, "breaker_max_backoff")
+	return oc, nil
+}
+
+// setPluginTimeout sets the Timeout setting of a plugin, if it has one, to
+// d.
+func setPluginTimeout(plugin interface{}, d time.Duration) {
+	v := reflect.ValueOf(plugin)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	field := v.Elem().FieldByName("Timeout")
+	if !field.IsValid() || !field.CanSet() {
+		return
+	}
+	switch field.Type() {
+	case durationType:
+		field.Set(reflect.ValueOf(Duration{Duration: d}))
+	case timeDurationType:
+		field.Set(reflect.ValueOf(d))
+	}
+}
+
+// parsePrecision parses an output precision, either as a duration ("1s") or
+// as one of the legacy InfluxDB precision units ("s").
+func parsePrecision(s string) (time.Duration, error) {
+	switch s {
+	case "", "n", "ns":
+		return 0, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid precision %q", s)
+	}
+	if d <= time.Nanosecond {
+		return 0, nil
+	}
+	return d, nil
+}
+
+// buildProcessor parses processor specific items from the ast.Table,
+// builds the filter and returns a
+// models.ProcessorConfig to be inserted into models.RunningProcessor
+func buildProcessor(name string, tbl *Table) (*ProcessorConfig, error) {
+	conf := &ProcessorConfig{Name: name, OnPanic: ProcessorPanicPass, line: tbl.Line}
+
+	if node, ok := tbl.Fields["order"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if b, ok := kv.Value.(*Integer); ok {
+				var err error
+				conf.Order, err = b.Int()
+				if err != nil {
+					log.Printf("Error parsing int value for %s: %s\n", name, err)
+				}
+				conf.orderSet = true
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["on_panic"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				switch str.Value {
+				case ProcessorPanicPass, ProcessorPanicPassOriginal, ProcessorPanicDrop:
+					conf.OnPanic = str.Value
+				default:
+					return nil, fmt.Errorf("processor %s: invalid on_panic %q, "+
+						"must be %q, %q or %q", name, str.Value, ProcessorPanicPass,
+						ProcessorPanicPassOriginal, ProcessorPanicDrop)
+				}
+			}
+		}
+	}
+
+	delete(tbl.Fields, "order")
+	delete(tbl.Fields, "on_panic")
+	return conf, nil
+}
+
+// buildAggregator parses aggregator specific items from the ast.Table,
+// builds the filter and returns a
+// models.AggregatorConfig to be inserted into models.RunningAggregator
+func buildAggregator(name string, tbl *Table) (*AggregatorConfig, error) {
+	unsupportedFields := []string{"tagexclude", "taginclude"}
+	for _, field := range unsupportedFields {
+		if _, ok := tbl.Fields[field]; ok {
+			return nil, fmt.Errorf("%s is not supported for aggregator plugins (%s).",
+				field, name)
+		}
+	}
+
+	conf := &AggregatorConfig{
+		Name:   name,
+		Delay:  time.Millisecond * 100,
+		Period: time.Second * 30,
+	}
+
+	if node, ok := tbl.Fields["period"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				dur, err := time.ParseDuration(str.Value)
+				if err != nil {
+					return nil, err
+				}
+
+				conf.Period = dur
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["delay"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				dur, err := time.ParseDuration(str.Value)
+				if err != nil {
+					return nil, err
+				}
+
+				conf.Delay = dur
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["align_period"]; ok {
 		if kv, ok := node.(*KeyValue); ok {
-			if str, ok := kv.Value.(*String); ok {
-				c.DataFormat = str.Value
+			if b, ok := kv.Value.(*Boolean); ok {
+				var err error
+				conf.AlignPeriod, err = strconv.ParseBool(b.Value)
+				if err != nil {
+					log.Printf("Error parsing boolean value for %s: %s\n", name, err)
+				}
 			}
 		}
 	}
 
-	if c.DataFormat == "" {
-		c.DataFormat = "influx"
+	if node, ok := tbl.Fields["drop_original"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if b, ok := kv.Value.(*Boolean); ok {
+				var err error
+				conf.DropOriginal, err = strconv.ParseBool(b.Value)
+				if err != nil {
+					log.Printf("Error parsing boolean value for %s: %s\n", name, err)
+				}
+			}
+		}
 	}
 
-	if node, ok := tbl.Fields["prefix"]; ok {
+	if node, ok := tbl.Fields["name_prefix"]; ok {
 		if kv, ok := node.(*KeyValue); ok {
 			if str, ok := kv.Value.(*String); ok {
-				c.Prefix = str.Value
+				conf.MeasurementPrefix = str.Value
 			}
 		}
 	}
 
-	if node, ok := tbl.Fields["template"]; ok {
+	if node, ok := tbl.Fields["name_suffix"]; ok {
 		if kv, ok := node.(*KeyValue); ok {
 			if str, ok := kv.Value.(*String); ok {
-				c.Template = str.Value
+				conf.MeasurementSuffix = str.Value
 			}
 		}
 	}
 
-	if node, ok := tbl.Fields["json_timestamp_units"]; ok {
+	if node, ok := tbl.Fields["name_override"]; ok {
 		if kv, ok := node.(*KeyValue); ok {
 			if str, ok := kv.Value.(*String); ok {
-				timestampVal, err := time.ParseDuration(str.Value)
-				if err != nil {
-					return nil, fmt.Errorf("Unable to parse json_timestamp_units as a duration, %s", err)
-				}
-				// now that we have a duration, truncate it to the nearest
-				// power of ten (just in case)
-				nearest_exponent := int64(math.Log10(float64(timestampVal.Nanoseconds())))
-				new_nanoseconds := int64(math.Pow(10.0, float64(nearest_exponent)))
-				c.TimestampUnits = time.Duration(new_nanoseconds)
+				conf.NameOverride = str.Value
 			}
 		}
 	}
 
-	delete(tbl.Fields, "data_format")
-	delete(tbl.Fields, "prefix")
-	delete(tbl.Fields, "template")
-	delete(tbl.Fields, "json_timestamp_units")
-	return NewSerializer(c)
-}
-
-// buildOutput parses output specific items from the ast.Table,
-// builds the filter and returns an
-// models.OutputConfig to be inserted into models.RunningInput
-// Note: error exists in the return for future calls that might require error
-func buildOutput(name string, tbl *Table) (*OutputConfig, error) {
-	oc := &OutputConfig{
-		Name: name,
+	conf.Tags = make(map[string]string)
+	if node, ok := tbl.Fields["tags"]; ok {
+		if subtbl, ok := node.(*Table); ok {
+			if err := UnmarshalTable(subtbl, conf.Tags); err != nil {
+				log.Printf("Could not parse tags for input %s\n", name)
+			}
+		}
 	}
-	return oc, nil
+
+	delete(tbl.Fields, "period")
+	delete(tbl.Fields, "delay")
+	delete(tbl.Fields, "drop_original")
+	delete(tbl.Fields, "align_period")
+	delete(tbl.Fields, "name_prefix")
+	delete(tbl.Fields, "name_suffix")
+	delete(tbl.Fields, "name_override")
+	delete(tbl.Fields, "tags")
+	return conf, nil
 }
 
 // buildParser grabs the necessary entries from the ast.Table for creating
@@ -686,6 +2310,30 @@ func buildParser(name string, tbl *Table) (Parser, error) {
 		c.DataFormat = "influx"
 	}
 
+	if node, ok := tbl.Fields["data_formats"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if ary, ok := kv.Value.(*Array); ok {
+				for _, elem := range ary.Value {
+					if str, ok := elem.(*String); ok {
+						c.DataFormats = append(c.DataFormats, str.Value)
+					}
+				}
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["multi_strict"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if b, ok := kv.Value.(*Boolean); ok {
+				var err error
+				c.MultiStrict, err = b.Boolean()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
 	if node, ok := tbl.Fields["separator"]; ok {
 		if kv, ok := node.(*KeyValue); ok {
 			if str, ok := kv.Value.(*String); ok {
@@ -706,6 +2354,22 @@ func buildParser(name string, tbl *Table) (Parser, error) {
 		}
 	}
 
+	if node, ok := tbl.Fields["keyvalue_pair_delimiter"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.KeyValuePairDelimiter = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["keyvalue_separator"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.KeyValueSeparator = str.Value
+			}
+		}
+	}
+
 	if node, ok := tbl.Fields["tag_keys"]; ok {
 		if kv, ok := node.(*KeyValue); ok {
 			if ary, ok := kv.Value.(*Array); ok {
@@ -726,6 +2390,178 @@ func buildParser(name string, tbl *Table) (Parser, error) {
 		}
 	}
 
+	if node, ok := tbl.Fields["json_timestamp_units"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				units, err := time.ParseDuration(str.Value)
+				if err != nil || units <= 0 {
+					return nil, fmt.Errorf("Unable to parse json_timestamp_units as a duration, %s", str.Value)
+				}
+				c.TimestampUnits = units
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["duration_unit"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				unit, err := time.ParseDuration(str.Value)
+				if err != nil {
+					return nil, fmt.Errorf("Unable to parse duration_unit as a duration, %s", err)
+				}
+				c.DurationUnit = unit
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["decimal_separator"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.DecimalSeparator = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["thousands_separator"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.ThousandsSeparator = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["field_separator"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.FieldSeparator = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["string_field_regex"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.StringFieldRegex = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["value_field_name"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.ValueFieldName = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["strict_single_value"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if b, ok := kv.Value.(*Boolean); ok {
+				var err error
+				c.StrictSingleValue, err = b.Boolean()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["unique_timestamps"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if b, ok := kv.Value.(*Boolean); ok {
+				var err error
+				c.UniqueTimestamps, err = b.Boolean()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["keep_raw"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if b, ok := kv.Value.(*Boolean); ok {
+				var err error
+				c.KeepRaw, err = b.Boolean()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["raw_field"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.RawField = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["max_line_size"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if integer, ok := kv.Value.(*Integer); ok {
+				v, err := integer.Int()
+				if err != nil {
+					return nil, err
+				}
+				if v < 0 {
+					return nil, fmt.Errorf("max_line_size cannot be negative: %d", v)
+				}
+				c.MaxLineSize = int(v)
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["skip_lines"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if integer, ok := kv.Value.(*Integer); ok {
+				v, err := integer.Int()
+				if err != nil {
+					return nil, err
+				}
+				if v < 0 {
+					return nil, fmt.Errorf("skip_lines cannot be negative: %d", v)
+				}
+				c.SkipLines = int(v)
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["name_case"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				c.NameCase = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["default_tags_by_metric"]; ok {
+		subTable, ok := node.(*Table)
+		if !ok {
+			return nil, fmt.Errorf("default_tags_by_metric must be a table")
+		}
+		c.DefaultTagsByMetric = make(map[string]map[string]string)
+		for metricName, val := range subTable.Fields {
+			tagTable, ok := val.(*Table)
+			if !ok {
+				return nil, fmt.Errorf("default_tags_by_metric.%s must be a table",
+					metricName)
+			}
+			tags := make(map[string]string)
+			if err := UnmarshalTable(tagTable, tags); err != nil {
+				return nil, fmt.Errorf("default_tags_by_metric.%s: %s",
+					metricName, err)
+			}
+			c.DefaultTagsByMetric[metricName] = tags
+		}
+	}
+
+	if c.DecimalSeparator != "" && c.DecimalSeparator == c.ThousandsSeparator {
+		return nil, fmt.Errorf("decimal_separator and thousands_separator cannot both be %q",
+			c.DecimalSeparator)
+	}
+
 	if node, ok := tbl.Fields["collectd_auth_file"]; ok {
 		if kv, ok := node.(*KeyValue); ok {
 			if str, ok := kv.Value.(*String); ok {
@@ -757,10 +2593,29 @@ func buildParser(name string, tbl *Table) (Parser, error) {
 	c.MetricName = name
 
 	delete(tbl.Fields, "data_format")
+	delete(tbl.Fields, "data_formats")
+	delete(tbl.Fields, "multi_strict")
 	delete(tbl.Fields, "separator")
 	delete(tbl.Fields, "templates")
 	delete(tbl.Fields, "tag_keys")
+	delete(tbl.Fields, "json_timestamp_units")
+	delete(tbl.Fields, "keyvalue_pair_delimiter")
+	delete(tbl.Fields, "keyvalue_separator")
 	delete(tbl.Fields, "data_type")
+	delete(tbl.Fields, "duration_unit")
+	delete(tbl.Fields, "decimal_separator")
+	delete(tbl.Fields, "thousands_separator")
+	delete(tbl.Fields, "string_field_regex")
+	delete(tbl.Fields, "field_separator")
+	delete(tbl.Fields, "value_field_name")
+	delete(tbl.Fields, "keep_raw")
+	delete(tbl.Fields, "strict_single_value")
+	delete(tbl.Fields, "unique_timestamps")
+	delete(tbl.Fields, "raw_field")
+	delete(tbl.Fields, "max_line_size")
+	delete(tbl.Fields, "skip_lines")
+	delete(tbl.Fields, "name_case")
+	delete(tbl.Fields, "default_tags_by_metric")
 	delete(tbl.Fields, "collectd_auth_file")
 	delete(tbl.Fields, "collectd_security_level")
 	delete(tbl.Fields, "collectd_typesdb")
@@ -775,14 +2630,26 @@ func buildInput(name string, tbl *Table) (*InputConfig, error) {
 	cp := &InputConfig{Name: name}
 	if node, ok := tbl.Fields["interval"]; ok {
 		if kv, ok := node.(*KeyValue); ok {
-			if str, ok := kv.Value.(*String); ok {
-				dur, err := time.ParseDuration(str.Value)
+			switch v := kv.Value.(type) {
+			case *String:
+				dur, err := parseDuration(v.Value)
+				if err != nil {
+					return nil, err
+				}
+				cp.Interval = dur
+			case *Integer, *Float:
+				// a plain number of seconds, as for the agent interval
+				dur, err := parseDuration(v.Source())
 				if err != nil {
 					return nil, err
 				}
-
 				cp.Interval = dur
 			}
+			// leaving interval out is what gathers at the agent interval
+			if cp.Interval <= 0 {
+				return nil, fmt.Errorf("input %s: invalid interval %s, must be "+
+					"greater than 0", name, cp.Interval)
+			}
 		}
 	}
 
@@ -810,6 +2677,18 @@ func buildInput(name string, tbl *Table) (*InputConfig, error) {
 		}
 	}
 
+	if node, ok := tbl.Fields["collection_window"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			if str, ok := kv.Value.(*String); ok {
+				window, err := parseTimeWindow(str.Value)
+				if err != nil {
+					return nil, fmt.Errorf("input %s: %s", name, err)
+				}
+				cp.Window = window
+			}
+		}
+	}
+
 	cp.Tags = make(map[string]string)
 	if node, ok := tbl.Fields["tags"]; ok {
 		if subtbl, ok := node.(*Table); ok {
@@ -819,10 +2698,116 @@ func buildInput(name string, tbl *Table) (*InputConfig, error) {
 		}
 	}
 
+	if node, ok := tbl.Fields["cache_last"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			b, ok := kv.Value.(*Boolean)
+			if !ok {
+				return nil, fmt.Errorf("input %s: invalid cache_last %s, must be "+
+					"a boolean", name, kv.Value.Source())
+			}
+			cp.CacheLast, _ = b.Boolean()
+		}
+	}
+
+	if node, ok := tbl.Fields["cache_ttl"]; ok {
+		if kv, ok := node.(*KeyValue); ok {
+			str, ok := kv.Value.(*String)
+			if !ok {
+				return nil, fmt.Errorf("input %s: invalid cache_ttl %s, must be "+
+					"a duration string", name, kv.Value.Source())
+			}
+			dur, err := parseDuration(str.Value)
+			if err != nil {
+				return nil, fmt.Errorf("input %s: invalid cache_ttl: %s", name, err)
+			}
+			if dur < 0 {
+				return nil, fmt.Errorf("input %s: invalid cache_ttl %s, cannot be "+
+					"negative", name, dur)
+			}
+			cp.CacheTTL = dur
+		}
+	}
+
+	var err error
+	if cp.TagPass, err = buildTagFilters(tbl, "tagpass"); err != nil {
+		return nil, fmt.Errorf("input %s: %s", name, err)
+	}
+	if cp.TagDrop, err = buildTagFilters(tbl, "tagdrop"); err != nil {
+		return nil, fmt.Errorf("input %s: %s", name, err)
+	}
+
 	delete(tbl.Fields, "name_prefix")
 	delete(tbl.Fields, "name_suffix")
 	delete(tbl.Fields, "name_override")
 	delete(tbl.Fields, "interval")
+	delete(tbl.Fields, "collection_window")
+	delete(tbl.Fields, "cache_last")
+	delete(tbl.Fields, "cache_ttl")
 	delete(tbl.Fields, "tags")
+	delete(tbl.Fields, "tagpass")
+	delete(tbl.Fields, "tagdrop")
 	return cp, nil
 }
+
+// buildTagFilters parses the tagpass or tagdrop subtable of a plugin, a list
+// of value patterns for each tag, ie:
+//
+//     [inputs.cpu.tagpass]
+//       cpu = ["cpu0", "cpu1*"]
+func buildTagFilters(tbl *Table, key string) ([]TagFilter, error) {
+	node, ok := tbl.Fields[key]
+	if !ok {
+		return nil, nil
+	}
+	subtbl, ok := node.(*Table)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a table", key)
+	}
+
+	var filters []TagFilter
+	for name, val := range subtbl.Fields {
+		kv, ok := val.(*KeyValue)
+		if !ok {
+			return nil, fmt.Errorf("%s %s must be a list of patterns", key, name)
+		}
+		ary, ok := kv.Value.(*Array)
+		if !ok {
+			return nil, fmt.Errorf("%s %s must be a list of patterns", key, name)
+		}
+		var patterns []string
+		for _, elem := range ary.Value {
+			if str, ok := elem.(*String); ok {
+				patterns = append(patterns, str.Value)
+			}
+		}
+		filter, err := CompileFilter(patterns)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %s", key, name, err)
+		}
+		if filter == nil {
+			continue
+		}
+		filters = append(filters, TagFilter{Name: name, Filter: filter})
+	}
+	return filters, nil
+}
+
+// parseTimeWindow parses a collection window of the form "HH:MM-HH:MM", ie,
+// "22:00-06:00" for the night.
+func parseTimeWindow(s string) (*TimeWindow, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid collection_window %q, expected HH:MM-HH:MM", s)
+	}
+
+	var offsets [2]time.Duration
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid collection_window %q, expected HH:MM-HH:MM", s)
+		}
+		offsets[i] = time.Duration(t.Hour())*time.Hour +
+			time.Duration(t.Minute())*time.Minute
+	}
+	return &TimeWindow{Start: offsets[0], End: offsets[1]}, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// EstimateCardinality gathers every input samples times, an agent interval
+// apart, and returns the number of distinct series, by HashID, of each
+// measurement the outputs would get: after the agent-wide metric handling,
+// the processors and the aggregators. Nothing is written to the outputs.
+//
+// A series seen in any of the samples counts, so more samples give a closer
+// estimate for inputs whose series come and go, ie, procstat, and for those
+// that need two gathers to report, ie, cpu. Service inputs are not started
+// and only count for what their Gather adds.
+func (c *Config) EstimateCardinality(samples int) (map[string]int, error) {
+	if samples <= 0 {
+		return nil, fmt.Errorf("invalid number of samples %d, must be positive",
+			samples)
+	}
+	if len(c.Inputs) == 0 {
+		return nil, fmt.Errorf("no inputs found, did you provide a valid config file?")
+	}
+
+	a, err := NewAgent(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, input := range c.Inputs {
+		input.SetTrace(false)
+	}
+
+	series := make(map[string]map[uint64]bool)
+	for i := 0; i < samples; i++ {
+		if i > 0 {
+			<-a.clock.After(c.Agent.Interval.Duration)
+		}
+		a.gatherOnce(make(chan struct{}), false, func(m Metric) {
+			ids, ok := series[m.Name()]
+			if !ok {
+				ids = make(map[uint64]bool)
+				series[m.Name()] = ids
+			}
+			ids[m.HashID()] = true
+		})
+	}
+
+	counts := make(map[string]int, len(series))
+	for name, ids := range series {
+		counts[name] = len(ids)
+	}
+	return counts, nil
+}
+
+// printCardinality writes the series counts of EstimateCardinality to w, the
+// measurements with the most series first, and their total.
+func printCardinality(w io.Writer, counts map[string]int) error {
+	names := make([]string, 0, len(counts))
+	total := 0
+	for name, n := range counts {
+		names = append(names, name)
+		total += n
+	}
+	sort.Sort(byCardinality{names: names, counts: counts})
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "%-40s %d\n", name, counts[name]); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%-40s %d\n", "total", total)
+	return err
+}
+
+// byCardinality sorts measurement names by their number of series, most
+// first, then by name.
+type byCardinality struct {
+	names  []string
+	counts map[string]int
+}
+
+func (b byCardinality) Len() int      { return len(b.names) }
+func (b byCardinality) Swap(i, j int) { b.names[i], b.names[j] = b.names[j], b.names[i] }
+func (b byCardinality) Less(i, j int) bool {
+	ci, cj := b.counts[b.names[i]], b.counts[b.names[j]]
+	if ci != cj {
+		return ci > cj
+	}
+	return b.names[i] < b.names[j]
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// cardinalityInput adds Series series of Measurement at each gather, the
+// same ones each time unless Churn, which replaces one of them per gather.
+type cardinalityInput struct {
+	Measurement string
+	Series      int
+	Churn       bool
+
+	gathers int
+}
+
+func (_ *cardinalityInput) SampleConfig() string { return "" }
+func (_ *cardinalityInput) Description() string  { return "An input of known cardinality" }
+func (c *cardinalityInput) Gather(acc Accumulator) error {
+	first := 0
+	if c.Churn {
+		first = c.gathers
+	}
+	for i := first; i < first+c.Series; i++ {
+		acc.AddFields(c.Measurement, map[string]interface{}{"value": i},
+			map[string]string{"id": fmt.Sprint(i)})
+	}
+	c.gathers++
+	return nil
+}
+
+func TestEstimateCardinality(t *testing.T) {
+	AddInput("cardinality_test", func() Input { return &cardinalityInput{} })
+	defer delete(Inputs, "cardinality_test")
+
+	config := `
+[agent]
+  interval = "1ms"
+  omit_hostname = true
+
+[[inputs.cardinality_test]]
+  measurement = "fixed"
+  series = 3
+
+[[inputs.cardinality_test]]
+  measurement = "churn"
+  series = 2
+  churn = true
+
+[[inputs.cardinality_test]]
+  measurement = "fixed"
+  series = 3
+  [inputs.cardinality_test.tags]
+    copy = "1"
+`
+	tests := []struct {
+		samples int
+		want    map[string]int
+	}{
+		{1, map[string]int{"fixed": 6, "churn": 2}},
+		{3, map[string]int{"fixed": 6, "churn": 4}},
+	}
+	for _, tt := range tests {
+		c := loadTestConfig(t, config)
+		got, err := c.EstimateCardinality(tt.samples)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d samples: expected %v, got %v", tt.samples, tt.want, got)
+		}
+	}
+
+	if _, err := loadTestConfig(t, config).EstimateCardinality(0); err == nil {
+		t.Error("expected an error for 0 samples")
+	}
+	if _, err := NewConfig().EstimateCardinality(1); err == nil {
+		t.Error("expected an error without inputs")
+	}
+}
+
+func TestPrintCardinality(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printCardinality(&buf, map[string]int{"mem": 1, "disk": 4, "cpu": 4}); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("%-40s 4\n%-40s 4\n%-40s 1\n%-40s 9\n", "cpu", "disk", "mem", "total")
+	if buf.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, buf.String())
+	}
+}
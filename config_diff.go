@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"sort"
+	"unicode"
+)
+
+// ConfigDiff describes what changed from old to new, ie, to log what a
+// reload changed. Inputs and outputs are compared by name and settings, so
+// a plugin whose settings changed is reported as removed and added again.
+func ConfigDiff(old, new *Config) []string {
+	var changes []string
+
+	oldInputs := make([]pluginKey, len(old.Inputs))
+	for i, in := range old.Inputs {
+		oldInputs[i] = pluginKey{in.Config.Name, in.Config.hash}
+	}
+	newInputs := make([]pluginKey, len(new.Inputs))
+	for i, in := range new.Inputs {
+		newInputs[i] = pluginKey{in.Config.Name, in.Config.hash}
+	}
+	changes = append(changes, diffPlugins("input", oldInputs, newInputs)...)
+
+	oldOutputs := make([]pluginKey, len(old.Outputs))
+	for i, out := range old.Outputs {
+		oldOutputs[i] = pluginKey{out.Config.Name, out.Config.hash}
+	}
+	newOutputs := make([]pluginKey, len(new.Outputs))
+	for i, out := range new.Outputs {
+		newOutputs[i] = pluginKey{out.Config.Name, out.Config.hash}
+	}
+	changes = append(changes, diffPlugins("output", oldOutputs, newOutputs)...)
+
+	oldAgent := reflect.ValueOf(old.Agent).Elem()
+	newAgent := reflect.ValueOf(new.Agent).Elem()
+	for i := 0; i < oldAgent.NumField(); i++ {
+		ov, nv := oldAgent.Field(i).Interface(), newAgent.Field(i).Interface()
+		if reflect.DeepEqual(ov, nv) {
+			continue
+		}
+		field := oldAgent.Type().Field(i)
+		name := field.Tag.Get("toml")
+		if name == "" {
+			name = toSnakeCase(field.Name)
+		}
+		changes = append(changes, fmt.Sprintf("agent %s changed from %s to %s",
+			name, diffValue(ov), diffValue(nv)))
+	}
+
+	var tags []string
+	for k := range old.Tags {
+		tags = append(tags, k)
+	}
+	for k := range new.Tags {
+		if _, ok := old.Tags[k]; !ok {
+			tags = append(tags, k)
+		}
+	}
+	sort.Strings(tags)
+	for _, k := range tags {
+		ov, inOld := old.Tags[k]
+		nv, inNew := new.Tags[k]
+		switch {
+		case !inNew:
+			changes = append(changes, fmt.Sprintf("removed global tag %s", k))
+		case !inOld:
+			changes = append(changes, fmt.Sprintf("added global tag %s=%s", k, nv))
+		case ov != nv:
+			changes = append(changes, fmt.Sprintf("global tag %s changed from %s to %s",
+				k, ov, nv))
+		}
+	}
+	return changes
+}
+
+// pluginKey identifies a plugin by its name and the hash of its settings.
+type pluginKey struct {
+	name string
+	hash uint64
+}
+
+// diffPlugins reports the plugins that are only in old as removed and the
+// ones only in new as added. A plugin may be configured several times with
+// the same settings, so each occurrence is matched once.
+func diffPlugins(kind string, old, new []pluginKey) []string {
+	counts := make(map[pluginKey]int)
+	for _, k := range old {
+		counts[k]++
+	}
+
+	var changes []string
+	for _, k := range new {
+		if counts[k] > 0 {
+			counts[k]--
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("added %s %s", kind, k.name))
+	}
+	for _, k := range old {
+		if counts[k] > 0 {
+			counts[k]--
+			changes = append(changes, fmt.Sprintf("removed %s %s", kind, k.name))
+		}
+	}
+	return changes
+}
+
+func diffValue(v interface{}) string {
+	switch v := v.(type) {
+	case Duration:
+		return v.Duration.String()
+	case string:
+		return fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprint(v)
+}
+
+// tableHash hashes the settings of a plugin table, independently of their
+// order, whitespace and comments.
+func tableHash(tbl *Table) uint64 {
+	h := fnv.New64a()
+	hashTable(h, tbl)
+	return h.Sum64()
+}
+
+// tagsHash returns hash, the hash of a plugin table, with the tags the agent
+// adds to the plugin folded in. hash is returned as is without tags.
+func tagsHash(hash uint64, tags map[string]string) uint64 {
+	if len(tags) == 0 {
+		return hash
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d;", hash)
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%q;", k, tags[k])
+	}
+	return h.Sum64()
+}
+
+func hashTable(w io.Writer, tbl *Table) {
+	keys := make([]string, 0, len(tbl.Fields))
+	for k := range tbl.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s=", k)
+		switch v := tbl.Fields[k].(type) {
+		case *KeyValue:
+			hashValue(w, v.Value)
+		case *Table:
+			io.WriteString(w, "{")
+			hashTable(w, v)
+			io.WriteString(w, "}")
+		case []*Table:
+			for _, t := range v {
+				io.WriteString(w, "[{")
+				hashTable(w, t)
+				io.WriteString(w, "}]")
+			}
+		}
+		io.WriteString(w, ";")
+	}
+}
+
+func hashValue(w io.Writer, v Value) {
+	if a, ok := v.(*Array); ok {
+		io.WriteString(w, "[")
+		for _, item := range a.Value {
+			hashValue(w, item)
+			io.WriteString(w, ",")
+		}
+		io.WriteString(w, "]")
+		return
+	}
+	io.WriteString(w, v.Source())
+}
+
+// toSnakeCase converts a Go field name to its config key, ie, MetricBatchSize
+// to metric_batch_size.
+func toSnakeCase(s string) string {
+	runes := []rune(s)
+	result := make([]rune, 0, len(runes)+4)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// start a new word at a lower to upper case change, and at the
+			// last capital of an acronym, ie, the "B" of "HTTPBody"
+			if i > 0 && (unicode.IsLower(runes[i-1]) ||
+				i+1 < len(runes) && unicode.IsLower(runes[i+1]) &&
+					unicode.IsUpper(runes[i-1])) {
+				result = append(result, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		result = append(result, r)
+	}
+	return string(result)
+}
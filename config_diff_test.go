@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfigDiff(t *testing.T) {
+	old := loadTestConfig(t, `
+[agent]
+  interval = "10s"
+
+[[inputs.cpu]]
+  percpu = true
+
+[[inputs.mem]]
+
+[[inputs.disk]]
+  mount_points = ["/"]
+
+[[outputs.file]]
+  files = ["stdout"]
+`)
+	// the comments and spacing of the disk input changed, not its settings
+	reloaded := loadTestConfig(t, `
+[agent]
+  interval = "30s"
+
+[[inputs.cpu]]
+  percpu = false
+
+[[inputs.disk]]
+  # the root file system only
+  mount_points = [ "/" ]
+
+[[inputs.internal]]
+
+[[outputs.file]]
+  files = ["stdout"]
+`)
+	want := []string{
+		"added input cpu",
+		"added input internal",
+		"removed input cpu",
+		"removed input mem",
+		`agent interval changed from 10s to 30s`,
+	}
+	if changes := ConfigDiff(old, reloaded); !reflect.DeepEqual(changes, want) {
+		t.Errorf("expected the changes %q, got %q", want, changes)
+	}
+
+	if changes := ConfigDiff(old, old); len(changes) != 0 {
+		t.Errorf("expected no changes, got %q", changes)
+	}
+}
+
+func TestToSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"Interval":        "interval",
+		"MetricBatchSize": "metric_batch_size",
+		"HTTPBody":        "http_body",
+		"OmitHostname":    "omit_hostname",
+	} {
+		if got := toSnakeCase(in); got != want {
+			t.Errorf("%s: expected %s, got %s", in, want, got)
+		}
+	}
+}
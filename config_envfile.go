@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// envFileKeys are the environment variables set from an env file, which a
+// reload may set again, unlike those of the real environment.
+var envFileKeys = map[string]bool{}
+
+// envFilePath returns the env_file of the [agent] table of tbl, if any.
+// It is read ahead of the rest of the config, since the global tags and the
+// "enabled" settings read from the environment.
+func envFilePath(tbl *Table) (string, error) {
+	node, ok := tbl.Fields["agent"]
+	if !ok {
+		return "", nil
+	}
+	agent, ok := node.(*Table)
+	if !ok {
+		return "", nil
+	}
+	node, ok = agent.Fields["env_file"]
+	if !ok {
+		return "", nil
+	}
+	kv, ok := node.(*KeyValue)
+	if !ok {
+		return "", nil
+	}
+	str, ok := kv.Value.(*String)
+	if !ok {
+		return "", fmt.Errorf("invalid env_file %s, must be a string", kv.Value.Source())
+	}
+	return str.Value, nil
+}
+
+// loadEnvFile sets the environment variables of the env file at path, ie:
+//
+//     # the InfluxDB credentials
+//     INFLUX_USER=telegraf
+//     export INFLUX_PASSWORD="s3cret"
+//
+// A variable that is already set in the real environment keeps its value.
+// Values may be quoted, blank lines and lines starting with "#" are skipped.
+func loadEnvFile(path string) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	contents = normalizeNewlines(trimBOM(contents))
+
+	for n, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || key == "" || strings.ContainsAny(key, " \t") {
+			return fmt.Errorf("%s line %d: expected KEY=value", path, n+1)
+		}
+		value := unquoteEnvValue(strings.TrimSpace(kv[1]))
+
+		if _, ok := lookupEnv(key); ok && !envFileKeys[key] {
+			log.Printf("D! Environment variable %s is already set, ignoring "+
+				"the value of %s", key, path)
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("%s line %d: %s", path, n+1, err)
+		}
+		envFileKeys[key] = true
+	}
+	return nil
+}
+
+// unquoteEnvValue strips the matching single or double quotes around a
+// value, if any.
+func unquoteEnvValue(value string) string {
+	if len(value) >= 2 {
+		first, last := value[0], value[len(value)-1]
+		if (first == '"' || first == '\'') && first == last {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
+
+// resolveEnvFile returns path, relative to the directory of the config file
+// when it is not absolute. A config fetched over http(s) has no directory,
+// its env_file is relative to the working directory.
+func resolveEnvFile(path, config string) string {
+	if filepath.IsAbs(path) || strings.HasPrefix(config, "http://") ||
+		strings.HasPrefix(config, "https://") {
+		return path
+	}
+	return filepath.Join(filepath.Dir(config), path)
+}
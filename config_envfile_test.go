@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvFile(t *testing.T) {
+	AddInput("slice_test", func() Input { return &sliceInput{} })
+	defer delete(Inputs, "slice_test")
+
+	keys := []string{"TELEGRAF_TEST_ENV_ZONE", "TELEGRAF_TEST_ENV_RACK",
+		"TELEGRAF_TEST_ENV_REAL", "TELEGRAF_TEST_ENV_DISABLED"}
+	for _, key := range keys {
+		os.Unsetenv(key)
+	}
+	os.Setenv("TELEGRAF_TEST_ENV_REAL", "real")
+	defer func() {
+		for _, key := range keys {
+			os.Unsetenv(key)
+			delete(envFileKeys, key)
+		}
+	}()
+
+	dir := writeConfigFiles(t, map[string]string{
+		"telegraf.conf": `
+[global_tags]
+  zone = "$TELEGRAF_TEST_ENV_ZONE"
+  rack = "$TELEGRAF_TEST_ENV_RACK"
+  real = "$TELEGRAF_TEST_ENV_REAL"
+
+[agent]
+  env_file = "telegraf.env"
+
+[[inputs.slice_test]]
+  mount_points = ["/"]
+
+[[inputs.slice_test]]
+  enabled = "$TELEGRAF_TEST_ENV_DISABLED"
+`,
+		"telegraf.env": `# the location of the host
+TELEGRAF_TEST_ENV_ZONE=zone-b
+export TELEGRAF_TEST_ENV_RACK="rack 7"
+
+TELEGRAF_TEST_ENV_REAL=from-file
+TELEGRAF_TEST_ENV_DISABLED='false'
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	c := NewConfig()
+	if err := c.LoadConfig(filepath.Join(dir, "telegraf.conf")); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"zone": "zone-b", "rack": "rack 7", "real": "real"}
+	if !reflect.DeepEqual(c.Tags, want) {
+		t.Errorf("expected the global tags %v, got %v", want, c.Tags)
+	}
+	if len(c.Inputs) != 1 {
+		t.Errorf("expected the input of enabled = false to be disabled, got %d inputs",
+			len(c.Inputs))
+	}
+}
+
+func TestEnvFileErrors(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"bad.env": "TELEGRAF_TEST_ENV_OK=1\nnot a variable\n",
+	})
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv("TELEGRAF_TEST_ENV_OK")
+	defer delete(envFileKeys, "TELEGRAF_TEST_ENV_OK")
+
+	for _, tt := range []struct {
+		file, err string
+	}{
+		{"bad.env", "line 2: expected KEY=value"},
+		{"missing.env", "env_file"},
+	} {
+		err := loadConfigString(t, NewConfig(),
+			"[agent]\n  env_file = \""+filepath.Join(dir, tt.file)+"\"\n")
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected the error %q, got %v", tt.file, tt.err, err)
+		}
+	}
+}
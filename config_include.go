@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// includeDirectiveRe matches an "@include path" line, the path optionally
+// quoted, ie:
+//
+//     [[inputs.exec]]
+//       @include "exec/commands.conf"
+var includeDirectiveRe = regexp.MustCompile(
+	`(?m)^([ \t]*)@include[ \t]+("[^"\n]*"|'[^'\n]*'|[^ \t\r\n]+)[ \t]*\r?$`)
+
+const (
+	// includeKeyPrefix is the prefix of the keys that the include
+	// directives are rewritten to, so that the file still parses as TOML.
+	includeKeyPrefix = "@include "
+
+	// maxIncludeDepth bounds fragments including fragments, to catch
+	// include cycles.
+	maxIncludeDepth = 8
+)
+
+// rewriteIncludes replaces each "@include path" line of a config with a
+// key/value that TOML accepts, line for line so that the line numbers of
+// the config are unchanged.
+func rewriteIncludes(contents []byte) []byte {
+	n := 0
+	return includeDirectiveRe.ReplaceAllFunc(contents, func(line []byte) []byte {
+		m := includeDirectiveRe.FindSubmatch(line)
+		path := string(m[2])
+		if len(path) >= 2 && (path[0] == '"' || path[0] == '\'') {
+			path = path[1 : len(path)-1]
+		}
+		n++
+		return []byte(fmt.Sprintf(`%s"%s%d" = %s`, m[1], includeKeyPrefix, n,
+			strconv.Quote(path)))
+	})
+}
+
+// resolveIncludes merges the fragments included by the tables of tbl into
+// them. Relative paths are resolved from dir, the directory of the file that
+// includes them. A key set both by a table and by a fragment it includes is
+// an error, as is a key set by two fragments.
+func resolveIncludes(tbl *Table, dir string, depth int, strict bool) error {
+	var keys []string
+	for key := range tbl.Fields {
+		if strings.HasPrefix(key, includeKeyPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		kv, ok := tbl.Fields[key].(*KeyValue)
+		if !ok {
+			continue
+		}
+		str, ok := kv.Value.(*String)
+		if !ok {
+			continue
+		}
+		delete(tbl.Fields, key)
+
+		path := str.Value
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if depth >= maxIncludeDepth {
+			return fmt.Errorf("line %d: too many nested includes at %s",
+				kv.Line, path)
+		}
+		fragment, err := parseIncludeFile(path, depth+1, strict)
+		if err != nil {
+			return fmt.Errorf("line %d: include %s: %s", kv.Line, path, err)
+		}
+		for name, val := range fragment.Fields {
+			if _, ok := tbl.Fields[name]; ok {
+				return fmt.Errorf("line %d: include %s: %s is already set",
+					kv.Line, path, name)
+			}
+			tbl.Fields[name] = val
+		}
+	}
+
+	for _, val := range tbl.Fields {
+		switch v := val.(type) {
+		case *Table:
+			if err := resolveIncludes(v, dir, depth, strict); err != nil {
+				return err
+			}
+		case []*Table:
+			for _, t := range v {
+				if err := resolveIncludes(t, dir, depth, strict); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseIncludeFile parses a config file, or a fragment of one, along with
+// the fragments it includes.
+func parseIncludeFile(fpath string, depth int, strict bool) (*Table, error) {
+	contents, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	tbl, err := parseContents(rewriteIncludes(contents), strict)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveIncludes(tbl, filepath.Dir(fpath), depth, strict); err != nil {
+		return nil, err
+	}
+	return tbl, nil
+}
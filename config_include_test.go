@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFiles writes files, by path relative to a new temporary
+// directory, and returns the directory.
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "telegraf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestConfigInclude(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"telegraf.conf": `
+[[inputs.exec]]
+  @include "exec/commands.conf"
+  interval = "30s"
+`,
+		"exec/commands.conf": `commands = ["echo 42", "echo 43"]
+@include timeout.conf
+`,
+		"exec/timeout.conf": `timeout = "2s"
+data_format = "value"
+data_type = "integer"
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	c := NewConfig()
+	if err := c.LoadConfig(filepath.Join(dir, "telegraf.conf")); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Inputs) != 1 {
+		t.Fatalf("expected 1 input, got %d", len(c.Inputs))
+	}
+	ri := c.Inputs[0]
+	if ri.Config.Interval != 30*time.Second {
+		t.Errorf("expected interval 30s, got %s", ri.Config.Interval)
+	}
+	e := ri.Input.(*Exec)
+	if want := []string{"echo 42", "echo 43"}; !reflect.DeepEqual(e.Commands, want) {
+		t.Errorf("expected commands %v from the fragment, got %v", want, e.Commands)
+	}
+	if e.Timeout.Duration != 2*time.Second {
+		t.Errorf("expected timeout 2s from the nested fragment, got %s",
+			e.Timeout.Duration)
+	}
+	if _, ok := e.parser.(*ValueParser); !ok {
+		t.Errorf("expected the value parser from the nested fragment, got %T",
+			e.parser)
+	}
+}
+
+func TestConfigIncludeErrors(t *testing.T) {
+	tests := []struct {
+		files map[string]string
+		err   string
+	}{
+		{
+			map[string]string{
+				"telegraf.conf": "[[inputs.exec]]\n  commands = [\"true\"]\n  @include frag.conf\n",
+				"frag.conf":     "commands = [\"false\"]\n",
+			},
+			"commands is already set",
+		},
+		{
+			map[string]string{
+				"telegraf.conf": "[[inputs.exec]]\n  @include a.conf\n",
+				"a.conf":        "@include b.conf\n",
+				"b.conf":        "@include a.conf\n",
+			},
+			"too many nested includes",
+		},
+		{
+			map[string]string{
+				"telegraf.conf": "[[inputs.exec]]\n  @include missing.conf\n",
+			},
+			"line 2: include",
+		},
+	}
+	for _, tt := range tests {
+		dir := writeConfigFiles(t, tt.files)
+		err := NewConfig().LoadConfig(filepath.Join(dir, "telegraf.conf"))
+		os.RemoveAll(dir)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected an error containing %q, got %v", tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+var (
+	durationType      = reflect.TypeOf(Duration{})
+	timeDurationType  = reflect.TypeOf(time.Duration(0))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// maxDumpDepth stops DumpJSON from following a cycle of pointers forever.
+const maxDumpDepth = 16
+
+// DumpJSON writes the effective config as JSON: the agent settings, the
+// global tags and, for every plugin, its name, its agent-level config and
+// its own settings. Settings are keyed by their config name, durations are
+// strings, ie, "10s". The values of settings whose name contains
+// "password", "secret", "token" or the like, and of the [secrets] table
+// wherever they appear, are redacted to "***".
+func (c *Config) DumpJSON(w io.Writer) error {
+	inputs := make([]interface{}, 0, len(c.Inputs))
+	for _, in := range c.Inputs {
+		inputs = append(inputs, dumpPlugin(in.Config.Name, in.Config, in.Input))
+	}
+	outputs := make([]interface{}, 0, len(c.Outputs))
+	for _, out := range c.Outputs {
+		outputs = append(outputs, dumpPlugin(out.Name, out.Config, out.Output))
+	}
+	processors := make([]interface{}, 0, len(c.Processors))
+	for _, p := range c.Processors {
+		processors = append(processors, dumpPlugin(p.Name, p.Config, p.Processor))
+	}
+	aggregators := make([]interface{}, 0, len(c.Aggregators))
+	for _, a := range c.Aggregators {
+		aggregators = append(aggregators, dumpPlugin(a.Config.Name, a.Config, a.a))
+	}
+
+	dump := map[string]interface{}{
+		"agent":       dumpValue(reflect.ValueOf(c.Agent), 0),
+		"global_tags": c.Tags,
+		"inputs":      inputs,
+		"outputs":     outputs,
+		"processors":  processors,
+		"aggregators": aggregators,
+	}
+	b, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	_, err = w.Write(b)
+	return err
+}
+
+func dumpPlugin(name string, config, plugin interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"name":     name,
+		"config":   dumpValue(reflect.ValueOf(config), 0),
+		"settings": dumpValue(reflect.ValueOf(plugin), 0),
+	}
+}
+
+// dumpValue converts v to a value that encoding/json can marshal. Functions
+// and channels, which it cannot, are nil.
+func dumpValue(v reflect.Value, depth int) interface{} {
+	if !v.IsValid() || depth > maxDumpDepth {
+		return nil
+	}
+	switch v.Type() {
+	case durationType:
+		return v.Interface().(Duration).Duration.String()
+	case timeDurationType:
+		return time.Duration(v.Int()).String()
+	}
+	if v.CanInterface() && v.Type().Implements(jsonMarshalerType) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return dumpValue(v.Elem(), depth+1)
+	case reflect.Struct:
+		// a type of another package, ie, a regexp, is only known by its
+		// string form
+		if v.Type().PkgPath() != reflect.TypeOf(Config{}).PkgPath() {
+			if v.CanAddr() && v.Addr().Type().Implements(stringerType) {
+				return v.Addr().Interface().(fmt.Stringer).String()
+			}
+			if v.Type().Implements(stringerType) {
+				return v.Interface().(fmt.Stringer).String()
+			}
+			return nil
+		}
+		fields := make(map[string]interface{})
+		dumpStruct(v, fields, depth)
+		return fields
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			m[fmt.Sprint(k.Interface())] = dumpValue(v.MapIndex(k), depth+1)
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = dumpValue(v.Index(i), depth+1)
+		}
+		return s
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return nil
+	case reflect.String:
+		// a secret can be part of another setting, ie, the userinfo of a URL
+		return redactSecrets(v.String())
+	}
+	return v.Interface()
+}
+
+// dumpStruct adds the exported fields of the struct v to fields, flattening
+// embedded structs.
+func dumpStruct(v reflect.Value, fields map[string]interface{}, depth int) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if field.Type.PkgPath() == t.PkgPath() {
+				dumpStruct(v.Field(i), fields, depth)
+			}
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+			continue
+		}
+
+		name := field.Tag.Get("toml")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = toSnakeCase(field.Name)
+		}
+		value := dumpValue(v.Field(i), depth+1)
+		if s, ok := value.(string); ok && s != "" && isSecretSetting(name) {
+			value = redacted
+		}
+		fields[name] = value
+	}
+}
+
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// PrintResolved writes the config file at path to w as the agent reads it,
+// to debug the environment variables of a config:
+//
+//   - the fragments of the "@include" lines are inlined,
+//   - the variables of the env_file are set, as when loading,
+//   - the variables are expanded where the agent expands them, in the
+//     [global_tags] and the "enabled" settings. A global tag whose variable
+//     is not set is commented out, since the agent skips it, and an
+//     "enabled" whose variable is not set is shown as false,
+//   - the other variables, which the agent reads as they are, are flagged
+//     with a comment.
+//
+// The values of the secret settings and of the [secrets] table, the secret
+// values found elsewhere and the passwords of URLs are redacted to "***". An empty path is
+// the default config file, as for LoadConfig.
+func (c *Config) PrintResolved(path string, w io.Writer) error {
+	if path == "" {
+		var err error
+		if path, err = getDefaultConfigPath(); err != nil {
+			return err
+		}
+	}
+	// a config the agent would reject is reported the same way
+	tbl, err := parseFile(path, c.StrictTOML)
+	if err != nil {
+		return fmt.Errorf("error parsing %s, %s", path, err)
+	}
+	envFile, err := envFilePath(tbl)
+	if err != nil {
+		return fmt.Errorf("error parsing %s, %s", path, err)
+	}
+	if envFile != "" {
+		if err := loadEnvFile(resolveEnvFile(envFile, path)); err != nil {
+			return fmt.Errorf("error loading env_file of %s, %s", path, err)
+		}
+	}
+
+	r := &configResolver{w: bufio.NewWriter(w)}
+	if err := r.file(path, "", 0); err != nil {
+		return err
+	}
+	return r.w.Flush()
+}
+
+// configResolver writes the lines of a config file, see PrintResolved.
+type configResolver struct {
+	w *bufio.Writer
+
+	// table is the name of the current table, ie, "inputs.cpu"
+	table string
+	// multiline is the delimiter of the multi-line string being written,
+	// redactMultiline is set when that string is the value of a secret.
+	multiline       string
+	redactMultiline bool
+}
+
+// file writes the lines of the config file, or fragment, at path, each
+// after indent.
+func (r *configResolver) file(path, indent string, depth int) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	contents = normalizeNewlines(trimBOM(contents))
+	lines := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+
+	for _, line := range lines {
+		if r.multiline == "" {
+			if m := includeDirectiveRe.FindStringSubmatch(line); m != nil {
+				if err := r.include(path, m[1], m[2], indent, depth); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		resolved, ok := r.line(line)
+		if !ok {
+			continue
+		}
+		if _, err := r.w.WriteString(indent + resolved + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// include writes an "@include" line as a comment, followed by the lines of
+// the fragment it includes.
+func (r *configResolver) include(path, lineIndent, fragment, indent string, depth int) error {
+	if len(fragment) >= 2 && (fragment[0] == '"' || fragment[0] == '\'') {
+		fragment = fragment[1 : len(fragment)-1]
+	}
+	if depth >= maxIncludeDepth {
+		return fmt.Errorf("%s: too many nested includes at %s", path, fragment)
+	}
+	_, err := r.w.WriteString(indent + lineIndent + "# @include " + fragment + "\n")
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(fragment) {
+		fragment = filepath.Join(filepath.Dir(path), fragment)
+	}
+	if err := r.file(fragment, indent+lineIndent, depth+1); err != nil {
+		return fmt.Errorf("%s: include %s: %s", path, fragment, err)
+	}
+	return nil
+}
+
+// line returns a line of the config as the agent reads it, or false for
+// the lines of a redacted multi-line string.
+func (r *configResolver) line(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+
+	if r.multiline != "" {
+		if strings.Contains(trimmed, r.multiline) {
+			r.multiline = ""
+		}
+		return redactSecrets(line), !r.redactMultiline
+	}
+
+	if strings.HasPrefix(trimmed, "[") {
+		r.table = strings.TrimSpace(strings.Trim(trimmed, "[]"))
+		return line, true
+	}
+	eq := strings.Index(line, "=")
+	if eq < 0 || strings.HasPrefix(trimmed, "#") {
+		return redactSecrets(line), true
+	}
+
+	keyPart, value := line[:eq], strings.TrimSpace(line[eq+1:])
+	key := strings.Trim(strings.TrimSpace(keyPart), `"'`)
+	secret := r.table == "secrets" || isSecretSetting(key)
+	for _, delim := range []string{`"""`, `'''`} {
+		if strings.HasPrefix(value, delim) &&
+			!strings.Contains(value[len(delim):], delim) {
+			r.multiline = delim
+			r.redactMultiline = secret
+		}
+	}
+
+	switch {
+	case secret:
+		return keyPart + `= "` + redacted + `"`, true
+	case r.table == "global_tags" || r.table == "tags":
+		expanded, missing := expandEnv(value, escapeEnv)
+		if missing != "" {
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			return indent + "# " + redactSecrets(trimmed) + "  # skipped, $" + missing +
+				" is not set", true
+		}
+		return redactSecrets(keyPart + "= " + expanded), true
+	case key == "enabled":
+		expanded, missing := expandEnv(value, escapeEnv)
+		if missing != "" {
+			return keyPart + "= false  # $" + missing + " is not set", true
+		}
+		return redactSecrets(keyPart + "= " + expanded), true
+	}
+
+	if vars := envVarRe.FindAllString(value, -1); len(vars) > 0 {
+		return redactSecrets(line) + "  # " + strings.Join(vars, ", ") +
+			" not expanded", true
+	}
+	return redactSecrets(line), true
+}
@@ -0,0 +1,1203 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFlushOutputWritesTheWholeBuffer(t *testing.T) {
+	out := &mockOutput{fail: true}
+	c := NewConfig()
+	c.Outputs = append(c.Outputs,
+		NewRunningOutput("mock", out, &OutputConfig{Name: "mock"}, 2, 100))
+	other := &mockOutput{}
+	c.Outputs = append(c.Outputs,
+		NewRunningOutput("other", other, &OutputConfig{Name: "other"}, 2, 100))
+
+	// the failed writes leave several batches in the buffer
+	now := time.Now()
+	for i := 0; i < 7; i++ {
+		m, _ := New("m", nil, map[string]interface{}{"i": int64(i)}, now)
+		for _, o := range c.Outputs {
+			o.AddMetric(m)
+		}
+	}
+	out.setFail(false)
+	if err := c.FlushOutput("mock"); err != nil {
+		t.Fatal(err)
+	}
+	if n := out.written(); n != 7 {
+		t.Errorf("expected 7 metrics written, got %d", n)
+	}
+	ro := c.Outputs[0]
+	if n := ro.failMetrics.Len() + ro.metrics.Len(); n != 0 {
+		t.Errorf("expected an empty buffer, got %d metrics", n)
+	}
+	if n := other.written(); n != 6 {
+		t.Errorf("expected the other output to be left alone, got %d metrics", n)
+	}
+
+	if err := c.FlushOutput("nope"); err == nil {
+		t.Error("expected an error for an unknown output")
+	}
+}
+
+func TestFlushOutputWithAgentFlush(t *testing.T) {
+	out := &mockOutput{fail: true}
+	c := NewConfig()
+	ro := NewRunningOutput("mock", out, &OutputConfig{Name: "mock"}, 1000, 100000)
+	c.Outputs = append(c.Outputs, ro)
+
+	now := time.Now()
+	for i := 0; i < 5000; i++ {
+		m, _ := New("m", nil, map[string]interface{}{"i": int64(i)}, now)
+		ro.AddMetric(m)
+	}
+
+	out.setFail(false)
+
+	// a flush of the agent running at the same time writes each metric
+	// once too
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ro.Write()
+	}()
+	if err := c.FlushOutput("mock"); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if n := out.written(); n != 5000 {
+		t.Errorf("expected 5000 metrics written, got %d", n)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("TEST_EXPAND_A", `a"b`)
+	os.Setenv("TEST_EXPAND_EMPTY", "")
+	defer os.Unsetenv("TEST_EXPAND_A")
+	defer os.Unsetenv("TEST_EXPAND_EMPTY")
+
+	tests := []struct {
+		value    string
+		escape   func(string) string
+		expanded string
+		missing  string
+	}{
+		{"x$TEST_EXPAND_A", nil, `xa"b`, ""},
+		{"$TEST_EXPAND_A", escapeEnv, `a\"b`, ""},
+		{"$TEST_EXPAND_EMPTY", nil, "", ""},
+		{"$TEST_EXPAND_UNSET-$TEST_EXPAND_OTHER", nil, "-", "TEST_EXPAND_UNSET"},
+		{"plain", nil, "plain", ""},
+	}
+	for _, tt := range tests {
+		expanded, missing := expandEnv(tt.value, tt.escape)
+		if expanded != tt.expanded || missing != tt.missing {
+			t.Errorf("%s: expected %q %q, got %q %q", tt.value, tt.expanded,
+				tt.missing, expanded, missing)
+		}
+	}
+
+	if enabled, err := envEnabled("$TEST_EXPAND_UNSET"); enabled || err != nil {
+		t.Errorf("expected an unset variable to disable, got %v %v", enabled, err)
+	}
+	os.Setenv("TEST_EXPAND_ON", "true")
+	defer os.Unsetenv("TEST_EXPAND_ON")
+	if enabled, err := envEnabled(" $TEST_EXPAND_ON "); !enabled || err != nil {
+		t.Errorf("expected enabled, got %v %v", enabled, err)
+	}
+	if _, err := envEnabled("$TEST_EXPAND_A"); err == nil {
+		t.Error("expected an error for a value that is not a boolean")
+	}
+
+	tags := expandTagEnv(map[string]string{
+		"a": "$TEST_EXPAND_A", "b": "$TEST_EXPAND_UNSET", "c": "c"})
+	want := map[string]string{"a": `a"b`, "c": "c"}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("expected the tags %v, got %v", want, tags)
+	}
+}
+
+func TestConfigFileTagPerFragment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telegraf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	main := filepath.Join(dir, "telegraf.conf")
+	fragments := filepath.Join(dir, "telegraf.d")
+	if err := os.Mkdir(fragments, 0700); err != nil {
+		t.Fatal(err)
+	}
+	write := func(path, contents string) {
+		if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(main, "[agent]\n  add_config_file_tag = true\n")
+	write(filepath.Join(fragments, "a.conf"), "[[inputs.mem]]\n")
+	write(filepath.Join(fragments, "b.conf"), "[[inputs.mem]]\n")
+
+	c := NewConfig()
+	if err := c.LoadAll(main, fragments); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Inputs) != 2 {
+		t.Fatalf("expected 2 inputs, got %d", len(c.Inputs))
+	}
+	for i, file := range []string{"a.conf", "b.conf"} {
+		if tag := c.Inputs[i].Config.Tags["config_file"]; tag != file {
+			t.Errorf("expected the config_file tag %s, got %q", file, tag)
+		}
+	}
+	if c.Inputs[0].Config.hash == c.Inputs[1].Config.hash {
+		t.Error("expected the inputs of the two files to hash differently")
+	}
+
+	// a reload without the tag restarts the inputs
+	write(main, "[agent]\n  add_config_file_tag = false\n")
+	reloaded := NewConfig()
+	if err := reloaded.LoadAll(main, fragments); err != nil {
+		t.Fatal(err)
+	}
+	changes := strings.Join(ConfigDiff(c, reloaded), "\n")
+	if strings.Count(changes, "added input mem") != 2 ||
+		strings.Count(changes, "removed input mem") != 2 {
+		t.Errorf("expected the inputs to be replaced, got:\n%s", changes)
+	}
+}
+
+func TestAddDefaultPluginsOutputsOptIn(t *testing.T) {
+	c := NewConfig()
+	if err := c.AddDefaultPlugins(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Outputs) != 0 {
+		t.Errorf("expected no default output, got %d", len(c.Outputs))
+	}
+
+	defer SetOutputDefaults(nil)
+	SetOutputDefaults([]string{"file"})
+	c = NewConfig()
+	if err := c.AddDefaultPlugins(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Outputs) != 1 || c.Outputs[0].Name != "file" {
+		t.Errorf("expected the file output, got %d outputs", len(c.Outputs))
+	}
+}
+
+func TestOutputPrecision(t *testing.T) {
+	c := loadTestConfig(t, `
+[[outputs.influxdb]]
+  urls = ["http://localhost:8086"]
+  precision = "s"
+
+[[outputs.file]]
+  precision = "ns"
+`)
+	if len(c.Outputs) != 2 {
+		t.Fatalf("expected 2 outputs, got %d", len(c.Outputs))
+	}
+	if p := c.Outputs[0].Config.Precision; p != time.Second {
+		t.Errorf("expected the influxdb precision to be 1s, got %s", p)
+	}
+	// nanoseconds leave the timestamps untouched
+	if p := c.Outputs[1].Config.Precision; p != 0 {
+		t.Errorf("expected no file precision, got %s", p)
+	}
+
+	// the same metric is truncated for the first output only
+	outs := []*mockOutput{{}, {}}
+	for i, ro := range c.Outputs {
+		ro.Output = outs[i]
+	}
+	a := &Agent{Config: c}
+	ts := time.Unix(1500000000, 123456789)
+	m, err := New("cpu", nil, map[string]interface{}{"value": 1.0}, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.addToOutputs(m)
+	for _, err := range a.flush() {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, want := range []time.Time{time.Unix(1500000000, 0), ts} {
+		if len(outs[i].metrics) != 1 || !outs[i].metrics[0].Time().Equal(want) {
+			t.Errorf("output %d: expected a metric at %s, got %v", i, want,
+				outs[i].metrics)
+		}
+	}
+}
+
+// loadTestConfig loads contents as a config file.
+func loadTestConfig(t *testing.T, contents string) *Config {
+	c := NewConfig()
+	if err := loadConfigString(t, c, contents); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// loadConfigString loads contents into c as a config file, returning the
+// error of LoadConfig.
+func loadConfigString(t *testing.T, c *Config, contents string) error {
+	f, err := ioutil.TempFile("", "telegraf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(contents)
+	f.Close()
+	return c.LoadConfig(f.Name())
+}
+
+func TestDefaultTagsByMetricConfig(t *testing.T) {
+	c := loadTestConfig(t, `
+[[inputs.exec]]
+  commands = ["echo 42"]
+  data_format = "value"
+  data_type = "integer"
+  name_override = "load"
+  [inputs.exec.default_tags_by_metric.exec]
+    unit = "ratio"
+`)
+	v, ok := c.Inputs[0].Input.(*Exec).parser.(*ValueParser)
+	if !ok {
+		t.Fatalf("expected a value parser, got %T", c.Inputs[0].Input.(*Exec).parser)
+	}
+	want := map[string]map[string]string{"exec": {"unit": "ratio"}}
+	if !reflect.DeepEqual(v.DefaultTagsByMetric, want) {
+		t.Errorf("expected %v, got %v", want, v.DefaultTagsByMetric)
+	}
+}
+
+func TestLoadConfigURL(t *testing.T) {
+	os.Setenv("TEST_URL_NAME", "mem_url")
+	os.Setenv("TEST_URL_DC", "east")
+	defer os.Unsetenv("TEST_URL_NAME")
+	defer os.Unsetenv("TEST_URL_DC")
+
+	body := map[string]string{
+		"/telegraf.conf": `
+[global_tags]
+  dc = "$TEST_URL_DC"
+  rack = "$TEST_URL_UNSET"
+
+[[inputs.mem]]
+  name_override = "$TEST_URL_NAME"
+`,
+		"/large.conf": "#" + strings.Repeat("x", configURLMaxSize) + "\n",
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, ok := body[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(b))
+	}))
+	defer ts.Close()
+
+	c := NewConfig()
+	if err := c.LoadConfig(ts.URL + "/telegraf.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Inputs) != 1 || c.Inputs[0].Config.NameOverride != "mem_url" {
+		t.Errorf("expected the input mem named mem_url, got %d inputs", len(c.Inputs))
+	}
+	tags := map[string]string{"dc": "east"}
+	if !reflect.DeepEqual(c.Tags, tags) {
+		t.Errorf("expected the tags %v, got %v", tags, c.Tags)
+	}
+
+	for _, u := range []string{ts.URL + "/large.conf", ts.URL + "/missing.conf",
+		"ftp://localhost/telegraf.conf", "file:///etc/telegraf.conf"} {
+		if err := NewConfig().LoadConfigURL(u); err == nil {
+			t.Errorf("%s: expected an error", u)
+		}
+	}
+}
+
+func TestPluginEnabled(t *testing.T) {
+	c := loadTestConfig(t, `
+[[inputs.mem]]
+  name_override = "default"
+
+[[inputs.mem]]
+  name_override = "enabled"
+  enabled = true
+
+[[inputs.mem]]
+  name_override = "disabled"
+  enabled = false
+
+[[outputs.file]]
+  enabled = false
+
+[[outputs.file]]
+  files = ["stdout"]
+`)
+	var names []string
+	for _, in := range c.Inputs {
+		names = append(names, in.Config.NameOverride)
+	}
+	if want := []string{"default", "enabled"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected the inputs %v, got %v", want, names)
+	}
+	if len(c.Outputs) != 1 {
+		t.Errorf("expected 1 output, got %d", len(c.Outputs))
+	}
+
+	err := loadConfigString(t, NewConfig(), "[[inputs.mem]]\n  enabled = 1\n")
+	if err == nil {
+		t.Error("expected an error for an enabled that is not a boolean")
+	}
+}
+
+// registryInput is a fake input with the given description and sample config.
+type registryInput struct {
+	description  string
+	sampleConfig string
+}
+
+func (r *registryInput) SampleConfig() string       { return r.sampleConfig }
+func (r *registryInput) Description() string        { return r.description }
+func (r *registryInput) Gather(_ Accumulator) error { return nil }
+
+func TestValidateRegistry(t *testing.T) {
+	if err := ValidateRegistry(); err != nil {
+		t.Fatalf("expected the registered plugins to be valid, got %s", err)
+	}
+
+	AddInput("registry_good", func() Input {
+		return &registryInput{
+			description:  "A good plugin",
+			sampleConfig: "\n  ## The servers\n  servers = [\"localhost\"]\n",
+		}
+	})
+	defer delete(Inputs, "registry_good")
+	if err := ValidateRegistry(); err != nil {
+		t.Errorf("expected the good plugin to be valid, got %s", err)
+	}
+
+	AddInput("registry_bad", func() Input {
+		return &registryInput{sampleConfig: "servers = [\"localhost\""}
+	})
+	defer delete(Inputs, "registry_bad")
+	err := ValidateRegistry()
+	if err == nil {
+		t.Fatal("expected the bad plugin to be reported")
+	}
+	if !strings.Contains(err.Error(), "inputs.registry_bad: empty description") {
+		t.Errorf("expected the empty description to be reported, got %s", err)
+	}
+	if strings.Contains(err.Error(), "registry_good") {
+		t.Errorf("expected only the bad plugin to be reported, got %s", err)
+	}
+
+	Inputs["registry_bad"] = func() Input {
+		return &registryInput{description: "A bad plugin",
+			sampleConfig: "servers = [\"localhost\""}
+	}
+	err = ValidateRegistry()
+	if err == nil || !strings.Contains(err.Error(), "inputs.registry_bad: invalid sample config") {
+		t.Errorf("expected the invalid sample config to be reported, got %v", err)
+	}
+}
+
+// sliceInput is a fake input with a string slice, like the mount_points of
+// the disk input.
+type sliceInput struct {
+	MountPoints []string
+}
+
+func (_ *sliceInput) SampleConfig() string       { return "" }
+func (_ *sliceInput) Description() string        { return "An input with a string slice" }
+func (_ *sliceInput) Gather(_ Accumulator) error { return nil }
+
+func TestStringSliceConfig(t *testing.T) {
+	AddInput("slice_test", func() Input { return &sliceInput{} })
+	defer delete(Inputs, "slice_test")
+
+	c := loadTestConfig(t, `
+[[inputs.slice_test]]
+  mount_points = ["/", "/export"]
+
+[[inputs.slice_test]]
+  mount_points = [
+    # the root file system
+    "/",
+    "/var", # the logs
+    # the home directories
+    "/export/home",
+  ]
+`)
+	want := [][]string{
+		{"/", "/export"},
+		{"/", "/var", "/export/home"},
+	}
+	if len(c.Inputs) != len(want) {
+		t.Fatalf("expected %d inputs, got %d", len(want), len(c.Inputs))
+	}
+	for i, w := range want {
+		got := c.Inputs[i].Input.(*sliceInput).MountPoints
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("input %d: expected the mount points %v, got %v", i, w, got)
+		}
+	}
+}
+
+func TestOutputOrder(t *testing.T) {
+	c := loadTestConfig(t, `
+[[outputs.file]]
+  files = ["influxdb"]
+  order = 3
+
+[[outputs.file]]
+  files = ["stdout"]
+
+[[outputs.file]]
+  files = ["archive"]
+  order = 1
+
+[[outputs.file]]
+  files = ["stderr"]
+`)
+	var files []string
+	for _, ro := range c.Outputs {
+		files = append(files, ro.Output.(*FileOutput).Files[0])
+	}
+	// the outputs without an order keep their declaration order
+	want := []string{"stdout", "stderr", "archive", "influxdb"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("expected the outputs %v, got %v", want, files)
+	}
+}
+
+func TestAddPluginTag(t *testing.T) {
+	AddInput("plugin_tag_test", func() Input { return &serviceInput{} })
+	defer delete(Inputs, "plugin_tag_test")
+
+	c := loadTestConfig(t, `
+[agent]
+  add_plugin_tag = true
+
+[[inputs.plugin_tag_test]]
+
+[[inputs.plugin_tag_test]]
+  [inputs.plugin_tag_test.tags]
+    input = "custom"
+
+[[inputs.plugin_tag_test]]
+  [inputs.plugin_tag_test.tagdrop]
+    input = ["plugin_tag_test"]
+`)
+	var inputs []string
+	for _, ri := range c.Inputs {
+		metricC := make(chan Metric, 10)
+		if err := ri.Input.Gather(NewAccumulator(ri, metricC)); err != nil {
+			t.Fatal(err)
+		}
+		close(metricC)
+		for m := range metricC {
+			inputs = append(inputs, m.Tags()["input"])
+		}
+	}
+	// the tag of the third input is filtered on, and drops its metric
+	want := []string{"plugin_tag_test", "custom"}
+	if !reflect.DeepEqual(inputs, want) {
+		t.Errorf("expected the input tags %v, got %v", want, inputs)
+	}
+}
+
+func TestConfigSyntaxErrorLine(t *testing.T) {
+	err := loadConfigString(t, NewConfig(), `[agent]
+  interval = "10s"
+
+[[outputs.file]]
+  files = ["stdout"
+  data_format = "influx"
+`)
+	if err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	if !strings.Contains(err.Error(), "line 6") {
+		t.Errorf("expected the error to report line 6, got %s", err)
+	}
+	if !strings.Contains(err.Error(), `data_format = "influx"`) {
+		t.Errorf("expected the error to quote the offending line, got %s", err)
+	}
+}
+
+func TestGlobalTagsFromEnv(t *testing.T) {
+	os.Setenv("TELEGRAF_TEST_NODE_NAME", "node-7")
+	os.Setenv("TELEGRAF_TEST_ZONE", "zone-b")
+	os.Unsetenv("TELEGRAF_TEST_UNSET")
+	defer os.Unsetenv("TELEGRAF_TEST_NODE_NAME")
+	defer os.Unsetenv("TELEGRAF_TEST_ZONE")
+
+	c := loadTestConfig(t, `
+[global_tags]
+  dc = "us-east-1"
+
+[agent]
+  global_tags_from_env = [
+    "node=TELEGRAF_TEST_NODE_NAME",
+    "zone=TELEGRAF_TEST_ZONE",
+    "rack=TELEGRAF_TEST_UNSET",
+  ]
+`)
+	want := map[string]string{"dc": "us-east-1", "node": "node-7", "zone": "zone-b"}
+	if !reflect.DeepEqual(c.Tags, want) {
+		t.Errorf("expected the global tags %v, got %v", want, c.Tags)
+	}
+
+	err := loadConfigString(t, NewConfig(), `
+[agent]
+  global_tags_from_env = ["TELEGRAF_TEST_ZONE"]
+`)
+	if err == nil {
+		t.Error("expected an error for an entry without a tag")
+	}
+}
+
+func TestAgentPrecision(t *testing.T) {
+	for precision, want := range map[string]time.Duration{
+		"":    0,
+		"ns":  time.Nanosecond,
+		"us":  time.Microsecond,
+		"µs":  time.Microsecond,
+		"ms":  time.Millisecond,
+		"s":   time.Second,
+		"1ms": time.Millisecond,
+	} {
+		c := loadTestConfig(t, "[agent]\n  precision = \""+precision+"\"\n")
+		if got := c.Agent.Precision.Duration; got != want {
+			t.Errorf("%q: expected a precision of %s, got %s", precision, want, got)
+		}
+	}
+
+	for _, precision := range []string{`"m"`, `"5s"`, `"h"`, `1`} {
+		err := loadConfigString(t, NewConfig(), "[agent]\n  precision = "+precision+"\n")
+		if err == nil || !strings.Contains(err.Error(), "invalid precision") {
+			t.Errorf("%s: expected an invalid precision error, got %v", precision, err)
+		}
+	}
+}
+
+func TestGlobalTagEnv(t *testing.T) {
+	os.Setenv("TELEGRAF_TEST_USER", "ops")
+	os.Unsetenv("TELEGRAF_TEST_NO_USER")
+	os.Unsetenv("TELEGRAF_TEST_NO_RACK")
+	defer os.Unsetenv("TELEGRAF_TEST_USER")
+
+	// the first file sets the default rack, which the unset variable of the
+	// second file leaves in place
+	c := loadTestConfig(t, `
+[global_tags]
+  rack = "default"
+`)
+	if err := loadConfigString(t, c, `
+[global_tags]
+  user = "$TELEGRAF_TEST_USER"
+  team = "team-$TELEGRAF_TEST_USER"
+  owner = "$TELEGRAF_TEST_NO_USER"
+  rack = "$TELEGRAF_TEST_NO_RACK"
+`); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"user": "ops", "team": "team-ops", "rack": "default"}
+	if !reflect.DeepEqual(c.Tags, want) {
+		t.Errorf("expected the global tags %v, got %v", want, c.Tags)
+	}
+}
+
+func TestOutputPasswordSecret(t *testing.T) {
+	c := loadTestConfig(t, `
+[secrets]
+  influx_password = "s3cret"
+  influx_url = "http://db01:8086"
+`)
+	if err := loadConfigString(t, c, `
+[[outputs.influxdb]]
+  urls = ["@secret:influx_url"]
+  username = "telegraf"
+  password = "@secret:influx_password"
+`); err != nil {
+		t.Fatal(err)
+	}
+	out := c.Outputs[0].Output.(*InfluxDB)
+	if out.Password != "s3cret" {
+		t.Errorf("expected the password of the secrets table, got %q", out.Password)
+	}
+	if len(out.URLs) != 1 || out.URLs[0] != "http://db01:8086" {
+		t.Errorf("expected the url of the secrets table, got %v", out.URLs)
+	}
+	if out.Username != "telegraf" {
+		t.Errorf("expected the username to be kept, got %q", out.Username)
+	}
+
+	err := loadConfigString(t, NewConfig(), `
+[[outputs.influxdb]]
+  password = "@secret:missing"
+`)
+	if err == nil || !strings.Contains(err.Error(), `undefined secret "missing"`) {
+		t.Errorf("expected an undefined secret error, got %v", err)
+	}
+}
+
+func TestSkipUnknownPlugins(t *testing.T) {
+	plugins := `
+[[inputs.cpu]]
+
+[[inputs.no_such_input]]
+
+[[outputs.no_such_output]]
+
+[[processors.no_such_processor]]
+
+[[aggregators.no_such_aggregator]]
+`
+	err := loadConfigString(t, NewConfig(), plugins)
+	if err == nil || !strings.Contains(err.Error(), "no_such_input") {
+		t.Errorf("expected the unknown input to fail the config, got %v", err)
+	}
+
+	c := loadTestConfig(t, "[agent]\n  skip_unknown_plugins = true\n"+plugins)
+	if len(c.Inputs) != 1 || c.Inputs[0].Config.Name != "cpu" {
+		t.Errorf("expected only the cpu input, got %d inputs", len(c.Inputs))
+	}
+	if len(c.Outputs) != 0 || len(c.Processors) != 0 || len(c.Aggregators) != 0 {
+		t.Errorf("expected the unknown plugins to be skipped, got %d outputs, "+
+			"%d processors and %d aggregators", len(c.Outputs), len(c.Processors),
+			len(c.Aggregators))
+	}
+}
+
+func TestLoadDirectoryEmptyFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telegraf.d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, contents := range map[string]string{
+		"a_empty.conf":    "",
+		"b_comments.conf": "# [[inputs.mem]]\n\n  # interval = \"10s\"\n",
+		"c_cpu.conf":      "[[inputs.cpu]]\n",
+		"d_notes.txt":     "not a config\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewConfig()
+	if err := c.LoadDirectory(dir); err != nil {
+		t.Fatalf("expected the empty files to be skipped, got %s", err)
+	}
+	if len(c.Inputs) != 1 || c.Inputs[0].Config.Name != "cpu" {
+		t.Errorf("expected only the cpu input, got %d inputs", len(c.Inputs))
+	}
+}
+
+func TestProcessorSameOrder(t *testing.T) {
+	processors := `
+[[processors.scale]]
+  order = 2
+  [[processors.scale.fields]]
+    field = "a"
+    factor = 2.0
+
+[[processors.scale]]
+  order = 1
+  [[processors.scale.fields]]
+    field = "b"
+    factor = 2.0
+
+[[processors.scale]]
+  order = 1
+  [[processors.scale.fields]]
+    field = "c"
+    factor = 2.0
+`
+	// the processors sharing an order keep their declaration order, on
+	// every load
+	for i := 0; i < 5; i++ {
+		var c *Config
+		lines := captureLog(func() {
+			c = loadTestConfig(t, processors)
+		})
+		var fields []string
+		for _, p := range c.Processors {
+			fields = append(fields, p.Processor.(*Scale).Fields[0].Field)
+		}
+		if want := []string{"b", "c", "a"}; !reflect.DeepEqual(fields, want) {
+			t.Fatalf("expected the processors of %v, got %v", want, fields)
+		}
+		var warned int
+		for _, line := range lines {
+			if strings.Contains(line, "have the same order 1") {
+				warned++
+			}
+		}
+		if warned != 1 {
+			t.Errorf("expected a warning about the order 1, got %q", lines)
+		}
+	}
+
+	err := loadConfigString(t, NewConfig(),
+		"[agent]\n  strict_processor_order = true\n"+processors)
+	if err == nil || !strings.Contains(err.Error(), "same order 1") {
+		t.Errorf("expected strict_processor_order to fail the config, got %v", err)
+	}
+}
+
+func TestParseFloatDurations(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"1.5m":    90 * time.Second,
+		`"0.5h"`:  30 * time.Minute,
+		"1.5":     1500 * time.Millisecond,
+		"10":      10 * time.Second,
+		`"1h23m"`: 83 * time.Minute,
+	} {
+		d, err := parseDuration(s)
+		if err != nil {
+			t.Errorf("%s: %s", s, err)
+			continue
+		}
+		if d != want {
+			t.Errorf("%s: expected %s, got %s", s, want, d)
+		}
+	}
+	if _, err := parseDuration("1.5 minutes"); err == nil {
+		t.Error("expected an error for an invalid duration")
+	}
+
+	c := loadTestConfig(t, `
+[agent]
+  interval = "1.5m"
+  flush_interval = 1.5
+
+[[inputs.cpu]]
+  interval = "0.5h"
+
+[[inputs.mem]]
+  interval = 2.5
+`)
+	if d := c.Agent.Interval.Duration; d != 90*time.Second {
+		t.Errorf("expected the agent interval 1m30s, got %s", d)
+	}
+	if d := c.Agent.FlushInterval.Duration; d != 1500*time.Millisecond {
+		t.Errorf("expected the flush interval 1.5s, got %s", d)
+	}
+	want := []time.Duration{30 * time.Minute, 2500 * time.Millisecond}
+	for i, in := range c.Inputs {
+		if in.Config.Interval != want[i] {
+			t.Errorf("%s: expected the interval %s, got %s", in.Config.Name,
+				want[i], in.Config.Interval)
+		}
+	}
+}
+
+func TestConfigCRLF(t *testing.T) {
+	os.Setenv("TELEGRAF_TEST_CRLF_DC", "dc-2")
+	os.Setenv("TELEGRAF_TEST_CRLF_ON", "false")
+	defer os.Unsetenv("TELEGRAF_TEST_CRLF_DC")
+	defer os.Unsetenv("TELEGRAF_TEST_CRLF_ON")
+
+	config := `[global_tags]
+  dc = "$TELEGRAF_TEST_CRLF_DC"
+
+[[inputs.exec]]
+  commands = ["""echo 1
+echo 2"""]
+
+[[inputs.exec]]
+  enabled = "$TELEGRAF_TEST_CRLF_ON"
+  commands = ["echo 3"]
+`
+	c := loadTestConfig(t, strings.Replace(config, "\n", "\r\n", -1))
+	if want := map[string]string{"dc": "dc-2"}; !reflect.DeepEqual(c.Tags, want) {
+		t.Errorf("expected the global tags %v, got %v", want, c.Tags)
+	}
+	if len(c.Inputs) != 1 {
+		t.Fatalf("expected the disabled input to be skipped, got %d inputs",
+			len(c.Inputs))
+	}
+	commands := c.Inputs[0].Input.(*Exec).Commands
+	if want := []string{"echo 1\necho 2"}; !reflect.DeepEqual(commands, want) {
+		t.Errorf("expected the multi-line string %q, got %q", want, commands)
+	}
+
+	// errors report the same line as the LF file
+	err := loadConfigString(t, NewConfig(),
+		"[agent]\r\n  interval = \"10s\"\r\n\r\n[[outputs.file]]\r\n"+
+			"  files = [\"stdout\"\r\n  data_format = \"influx\"\r\n")
+	if err == nil || !strings.Contains(err.Error(), "line 6") {
+		t.Errorf("expected the error to report line 6, got %v", err)
+	}
+}
+
+type deprecatedInput struct {
+	registryInput
+	replacement string
+}
+
+func (d *deprecatedInput) Deprecated() (bool, string) { return true, d.replacement }
+
+func TestDeprecatedPluginWarning(t *testing.T) {
+	AddInput("deprecated_test", func() Input {
+		return &deprecatedInput{replacement: "slice_test"}
+	})
+	AddInput("deprecated_bare_test", func() Input { return &deprecatedInput{} })
+	AddInput("slice_test", func() Input { return &sliceInput{} })
+	defer delete(Inputs, "deprecated_test")
+	defer delete(Inputs, "deprecated_bare_test")
+	defer delete(Inputs, "slice_test")
+
+	var c *Config
+	lines := captureLog(func() {
+		c = loadTestConfig(t, `
+[[inputs.deprecated_test]]
+[[inputs.deprecated_bare_test]]
+[[inputs.slice_test]]
+`)
+	})
+	if len(c.Inputs) != 3 {
+		t.Errorf("expected the deprecated inputs to be loaded, got %d inputs",
+			len(c.Inputs))
+	}
+	want := []string{
+		"W! Plugin [inputs.deprecated_test] is deprecated and will be removed, use [inputs.slice_test] instead",
+		"W! Plugin [inputs.deprecated_bare_test] is deprecated and will be removed",
+	}
+	var got []string
+	for _, line := range lines {
+		if strings.Contains(line, "deprecated") {
+			got = append(got, line)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the warnings %q, got %q", want, got)
+	}
+}
+
+func TestLoadAll(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"telegraf.conf": `
+[agent]
+  interval = "10s"
+  flush_interval = "20s"
+
+[[inputs.exec]]
+  commands = ["echo base"]
+`,
+		"telegraf.d/20-second.conf": `
+[[inputs.exec]]
+  commands = ["echo second"]
+`,
+		"telegraf.d/10-first.conf": `
+[agent]
+  interval = "30s"
+
+[[inputs.exec]]
+  commands = ["echo first"]
+`,
+		"telegraf.d/README": `not a config`,
+	})
+	defer os.RemoveAll(dir)
+
+	c := NewConfig()
+	err := c.LoadAll(filepath.Join(dir, "telegraf.conf"), filepath.Join(dir, "telegraf.d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commands []string
+	for _, ri := range c.Inputs {
+		commands = append(commands, ri.Input.(*Exec).Commands...)
+	}
+	if want := []string{"echo base", "echo first", "echo second"}; !reflect.DeepEqual(commands, want) {
+		t.Errorf("expected the inputs %v, got %v", want, commands)
+	}
+	if c.Agent.Interval.Duration != 30*time.Second {
+		t.Errorf("expected the interval of the fragment, got %s", c.Agent.Interval.Duration)
+	}
+	if c.Agent.FlushInterval.Duration != 20*time.Second {
+		t.Errorf("expected the flush interval of the base file, got %s",
+			c.Agent.FlushInterval.Duration)
+	}
+
+	if err := NewConfig().LoadAll("", ""); err == nil {
+		t.Error("expected an error without a file or directory")
+	}
+	c = NewConfig()
+	if err := c.LoadAll("", filepath.Join(dir, "telegraf.d")); err != nil || len(c.Inputs) != 2 {
+		t.Errorf("expected the 2 inputs of the directory alone, got %d, %v",
+			len(c.Inputs), err)
+	}
+}
+
+type failInput struct{}
+
+func (_ *failInput) SampleConfig() string       { return "" }
+func (_ *failInput) Description() string        { return "" }
+func (_ *failInput) Gather(_ Accumulator) error { return errors.New("device busy") }
+
+func TestTestInput(t *testing.T) {
+	AddInput("test_input_a", func() Input { return &orderInput{id: "a", n: 3} })
+	AddInput("test_input_b", func() Input { return &orderInput{id: "b", n: 2} })
+	AddInput("test_input_service", func() Input { return &serviceInput{} })
+	AddInput("test_input_fail", func() Input { return &failInput{} })
+	defer delete(Inputs, "test_input_a")
+	defer delete(Inputs, "test_input_b")
+	defer delete(Inputs, "test_input_service")
+	defer delete(Inputs, "test_input_fail")
+
+	c := loadTestConfig(t, `
+[global_tags]
+  dc = "us-east-1"
+
+[[inputs.test_input_a]]
+[[inputs.test_input_b]]
+[[inputs.test_input_service]]
+[[inputs.test_input_fail]]
+`)
+	for _, name := range []string{"test_input_a", "inputs.test_input_a"} {
+		var buf bytes.Buffer
+		if err := c.TestInput(name, &buf); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("%s: expected the 3 metrics of the input, got %q", name, lines)
+		}
+		for i, line := range lines {
+			prefix := fmt.Sprintf("> order,dc=us-east-1,input=a n=%di ", i)
+			if !strings.HasPrefix(line, prefix) {
+				t.Errorf("%s: expected line %d to start with %q, got %q",
+					name, i, prefix, line)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	err := c.TestInput("cpu", &buf)
+	if err == nil || !strings.Contains(err.Error(), "inputs.test_input_b") {
+		t.Errorf("expected an error listing the inputs, got %v", err)
+	}
+	if err := c.TestInput("test_input_service", &buf); err == nil {
+		t.Error("expected an error for a service input")
+	}
+	err = c.TestInput("test_input_fail", &buf)
+	if err == nil || !strings.Contains(err.Error(), "device busy") {
+		t.Errorf("expected the gather error, got %v", err)
+	}
+}
+
+func TestAgentTableMerge(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"10-base.conf": `
+[agent]
+  interval = "10s"
+  flush_interval = "20s"
+  heartbeat = true
+  [agent.static_fields]
+    collector_version = "1.2.0"
+    site_id = 1
+  [agent.heartbeat_tags]
+    role = "db"
+`,
+		"20-site.conf": `
+[agent]
+  interval = "30s"
+  [agent.static_fields]
+    site_id = 7
+  [agent.heartbeat_tags]
+    rack = "r12"
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	c := NewConfig()
+	if err := c.LoadDirectory(dir); err != nil {
+		t.Fatal(err)
+	}
+	if c.Agent.Interval.Duration != 30*time.Second {
+		t.Errorf("expected the interval of the later file, got %s", c.Agent.Interval.Duration)
+	}
+	if c.Agent.FlushInterval.Duration != 20*time.Second || !c.Agent.Heartbeat {
+		t.Errorf("expected the options only the first file sets to be kept, got "+
+			"flush_interval %s and heartbeat %t", c.Agent.FlushInterval.Duration,
+			c.Agent.Heartbeat)
+	}
+	fields := map[string]interface{}{"collector_version": "1.2.0", "site_id": int64(7)}
+	if !reflect.DeepEqual(c.Agent.StaticFields, fields) {
+		t.Errorf("expected the static fields %v, got %v", fields, c.Agent.StaticFields)
+	}
+	tags := map[string]string{"role": "db", "rack": "r12"}
+	if !reflect.DeepEqual(c.Agent.HeartbeatTags, tags) {
+		t.Errorf("expected the heartbeat tags %v, got %v", tags, c.Agent.HeartbeatTags)
+	}
+}
+
+func TestPerOutputBufferLimit(t *testing.T) {
+	var outputs []*mockOutput
+	AddOutput("buffer_mock", func() Output {
+		// down, so that the failed batches fill the buffer
+		out := &mockOutput{fail: true}
+		outputs = append(outputs, out)
+		return out
+	})
+	defer delete(Outputs, "buffer_mock")
+
+	c := loadTestConfig(t, `
+[agent]
+  metric_batch_size = 4
+  metric_buffer_limit = 5
+
+[[outputs.buffer_mock]]
+
+[[outputs.buffer_mock]]
+  metric_buffer_limit = 10
+`)
+	if len(c.Outputs) != 2 || len(outputs) != 2 {
+		t.Fatalf("expected 2 outputs, got %d", len(c.Outputs))
+	}
+	for i, want := range []int{5, 10} {
+		ro := c.Outputs[i]
+		if ro.MetricBufferLimit != want {
+			t.Errorf("output %d: expected a buffer limit of %d, got %d",
+				i, want, ro.MetricBufferLimit)
+		}
+		for j := 0; j < 20; j++ {
+			m, _ := New("cpu", nil, map[string]interface{}{"n": int64(j)}, time.Now())
+			ro.AddMetric(m)
+		}
+		outputs[i].setFail(false)
+		if err := ro.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if n := outputs[i].written(); n != want {
+			t.Errorf("output %d: expected the %d buffered metrics to be written, got %d",
+				i, want, n)
+		}
+	}
+
+	err := loadConfigString(t, NewConfig(), `
+[[outputs.buffer_mock]]
+  metric_buffer_limit = -1
+`)
+	if err == nil {
+		t.Error("expected an error for a negative metric_buffer_limit")
+	}
+}
+
+func TestTagFiltersOnGlobalTags(t *testing.T) {
+	AddInput("slice_test", func() Input { return &sliceInput{} })
+	defer delete(Inputs, "slice_test")
+
+	c := loadTestConfig(t, `
+[global_tags]
+  dc = "us-east-1"
+
+[[inputs.slice_test]]
+  [inputs.slice_test.tagpass]
+    dc = ["us-east-*"]
+
+[[inputs.slice_test]]
+  [inputs.slice_test.tagdrop]
+    dc = ["us-*"]
+
+[[inputs.slice_test]]
+  [inputs.slice_test.tags]
+    dc = "eu-west-1"
+  [inputs.slice_test.tagpass]
+    dc = ["us-*"]
+`)
+	if len(c.Inputs) != 3 {
+		t.Fatalf("expected 3 inputs, got %d", len(c.Inputs))
+	}
+	want := []bool{true, false, false}
+	for i, ri := range c.Inputs {
+		ri.SetDefaultTags(c.Tags)
+		gathered := ri.MetricsGathered.Get()
+		m := ri.MakeMetric("test", map[string]interface{}{"value": 1},
+			map[string]string{"host": "h1"}, Untyped, time.Now())
+		if (m != nil) != want[i] {
+			t.Errorf("input %d: expected passed %v, got %v", i, want[i], m)
+			continue
+		}
+		if m != nil && !reflect.DeepEqual(m.Tags(), map[string]string{"host": "h1", "dc": "us-east-1"}) {
+			t.Errorf("input %d: expected the global tag, got %v", i, m.Tags())
+		}
+		if n := ri.MetricsGathered.Get() - gathered; n != map[bool]int64{true: 1, false: 0}[want[i]] {
+			t.Errorf("input %d: expected a filtered metric not to be counted, got %d gathered", i, n)
+		}
+	}
+
+	err := loadConfigString(t, NewConfig(), `
+[[inputs.slice_test]]
+  [inputs.slice_test.tagpass]
+    dc = "us-*"
+`)
+	if err == nil || !strings.Contains(err.Error(), "slice_test") {
+		t.Errorf("expected an error naming the input, got %v", err)
+	}
+}
+
+func TestInvalidIntervals(t *testing.T) {
+	AddInput("slice_test", func() Input { return &sliceInput{} })
+	defer delete(Inputs, "slice_test")
+
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{"[agent]\n  interval = \"0s\"\n", "invalid interval 0s"},
+		{"[agent]\n  interval = \"-10s\"\n", "invalid interval -10s"},
+		{"[agent]\n  interval = 0\n", "invalid interval 0s"},
+		{"[agent]\n  flush_interval = \"0s\"\n", "invalid flush_interval 0s"},
+		{"[agent]\n  flush_interval = \"-1m\"\n", "invalid flush_interval -1m0s"},
+		// without an [agent] table
+		{"[[inputs.slice_test]]\n  interval = \"0s\"\n", "input slice_test: invalid interval 0s"},
+		{"[[inputs.slice_test]]\n  interval = -5\n", "input slice_test: invalid interval -5s"},
+		{"[[inputs.slice_test]]\n  interval = \"-1s\"\n", "input slice_test: invalid interval -1s"},
+		{"[agent]\n  interval = \"10s\"\n\n[[inputs.slice_test]]\n  interval = \"0s\"\n",
+			"input slice_test: invalid interval 0s"},
+	}
+	for _, tt := range tests {
+		err := loadConfigString(t, NewConfig(), tt.config)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: expected the error %q, got %v", tt.config, tt.err, err)
+		}
+	}
+
+	c := loadTestConfig(t, "[[inputs.slice_test]]\n  interval = \"30s\"\n\n[[inputs.slice_test]]\n")
+	if d := c.Inputs[0].Config.Interval; d != 30*time.Second {
+		t.Errorf("expected the interval 30s, got %s", d)
+	}
+	if d := c.Inputs[1].Config.Interval; d != 0 {
+		t.Errorf("expected an input without interval to keep the agent's, got %s", d)
+	}
+
+	// an input of a negative interval, however it was set
+	c.Inputs[1].Config.Interval = -time.Second
+	if err := c.validateIntervals(); err == nil || !strings.Contains(err.Error(), "input slice_test") {
+		t.Errorf("expected an error naming the input, got %v", err)
+	}
+}
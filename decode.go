@@ -380,6 +380,10 @@ type toml struct {
 	tableMap     map[string]*Table
 	stack        []*stack
 	skip         bool
+	// strict rejects a table header that repeats one already defined, and
+	// defined holds the line of the header of each table, for strict.
+	strict  bool
+	defined map[*Table]int
 }
 
 func (p *toml) init(data []rune) {
@@ -479,6 +483,15 @@ func (p *toml) setTable(t *Table, buf []rune, begin, end int) {
 	if err != nil {
 		p.Error(err)
 	}
+	if p.strict {
+		if line, ok := p.defined[t]; ok {
+			p.Error(fmt.Errorf("duplicate table `%s', already defined in line %d", name, line))
+		}
+		if p.defined == nil {
+			p.defined = make(map[*Table]int)
+		}
+		p.defined[t] = p.line
+	}
 	p.currentTable = t
 	p.tableMap[name] = p.currentTable
 }
@@ -3,22 +3,34 @@ package main
 import (
 	"fmt"
 	"reflect"
+	"strings"
 )
 
-func (e *parseError) Line() int {
-	tokens := e.p.tokenTree.Error()
-	positions := make([]int, len(tokens)*2)
-	p := 0
-	for _, token := range tokens {
-		positions[p], p = int(token.begin), p+1
-		positions[p], p = int(token.end), p+1
+// Position returns the line and column, both starting at 1, of the furthest
+// point the parser reached before failing, along with the text of that line.
+func (e *parseError) Position() (int, int, string) {
+	end := 0
+	for _, token := range e.p.tokenTree.Error() {
+		if int(token.end) > end {
+			end = int(token.end)
+		}
+	}
+
+	buffer := e.p.buffer
+	if end > len(buffer) {
+		end = len(buffer)
 	}
-	for _, t := range translatePositions(e.p.Buffer, positions) {
-		if e.p.line < t.line {
-			e.p.line = t.line
+	line, start := 1, 0
+	for i, c := range buffer[:end] {
+		if c == '\n' {
+			line, start = line+1, i+1
 		}
 	}
-	return e.p.line
+	stop := start
+	for stop < len(buffer) && buffer[stop] != '\n' && buffer[stop] != end_symbol {
+		stop++
+	}
+	return line, end - start + 1, strings.TrimRight(string(buffer[start:stop]), "\r")
 }
 
 type errorOutOfRange struct {
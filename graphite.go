@@ -0,0 +1,186 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultGraphiteTemplate puts the host first, then the other tags sorted by
+// key, the measurement and the field.
+const DefaultGraphiteTemplate = "host.tags.measurement.field"
+
+// GraphiteSerializer writes each numeric field of a metric as a line of the
+// Graphite plaintext protocol, ie:
+//
+//     prefix.myhost.cpu0.cpu.usage_idle 98.5 1500000000
+//
+// The path is built from Template, whose dot-separated parts are
+// "measurement", "field", "tags" for the tags not named elsewhere, or a tag
+// key. A field called "value" is left out of the path. Booleans are written
+// as 1 or 0, and string fields are skipped.
+type GraphiteSerializer struct {
+	Prefix   string
+	Template string
+	// Separator joins the segments of the path, defaults to ".".
+	Separator string
+	// Replacement replaces the characters of a tag value, measurement or
+	// field that would corrupt the path, ie, the dots and spaces of
+	// "Intel Xeon 2.4GHz", defaults to "_".
+	Replacement string
+}
+
+func (s *GraphiteSerializer) Serialize(metric Metric) ([]byte, error) {
+	path := s.path(metric.Name(), metric.Tags())
+	if path == "" {
+		return []byte{}, nil
+	}
+	timestamp := strconv.FormatInt(metric.UnixNano()/1000000000, 10)
+
+	fields := metric.Fields()
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var out []byte
+	for _, k := range keys {
+		var value string
+		switch v := fields[k].(type) {
+		case int64:
+			value = strconv.FormatInt(v, 10)
+		case uint64:
+			value = strconv.FormatUint(v, 10)
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			value = "0"
+			if v {
+				value = "1"
+			}
+		default:
+			continue
+		}
+		out = append(out, s.insertField(path, k)...)
+		out = append(out, ' ')
+		out = append(out, value...)
+		out = append(out, ' ')
+		out = append(out, timestamp...)
+		out = append(out, '\n')
+	}
+	return out, nil
+}
+
+// graphiteFieldMarker stands for the field in a path, until it is known.
+const graphiteFieldMarker = "\x00"
+
+// path returns the path of a metric, with graphiteFieldMarker in place of
+// the field.
+func (s *GraphiteSerializer) path(measurement string, tags map[string]string) string {
+	template := s.Template
+	if template == "" {
+		template = DefaultGraphiteTemplate
+	}
+	rest := make(map[string]string, len(tags))
+	for k, v := range tags {
+		rest[k] = v
+	}
+
+	parts := strings.Split(template, ".")
+	var segments []string
+	tagsAt := -1
+	for _, part := range parts {
+		switch part {
+		case "measurement":
+			segments = append(segments, s.sanitize(measurement))
+		case "field":
+			segments = append(segments, graphiteFieldMarker)
+		case "tags":
+			tagsAt = len(segments)
+			segments = append(segments, "")
+		default:
+			if v, ok := rest[part]; ok {
+				segments = append(segments, s.sanitize(v))
+				delete(rest, part)
+			}
+		}
+	}
+	if tagsAt >= 0 {
+		keys := make([]string, 0, len(rest))
+		for k := range rest {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		values := make([]string, 0, len(keys))
+		for _, k := range keys {
+			values = append(values, s.sanitize(rest[k]))
+		}
+		segments = append(segments[:tagsAt],
+			append(values, segments[tagsAt+1:]...)...)
+	}
+
+	var kept []string
+	for _, seg := range segments {
+		if seg != "" {
+			kept = append(kept, seg)
+		}
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	path := strings.Join(kept, s.separator())
+	if s.Prefix != "" {
+		path = s.Prefix + s.separator() + path
+	}
+	return path
+}
+
+// insertField replaces the field marker of path with field, or removes it
+// when the field is "value".
+func (s *GraphiteSerializer) insertField(path, field string) string {
+	if !strings.Contains(path, graphiteFieldMarker) {
+		return path
+	}
+	if field == "value" {
+		sep := s.separator()
+		path = strings.Replace(path, sep+graphiteFieldMarker, "", 1)
+		path = strings.Replace(path, graphiteFieldMarker+sep, "", 1)
+		return strings.Replace(path, graphiteFieldMarker, "", 1)
+	}
+	return strings.Replace(path, graphiteFieldMarker, s.sanitize(field), 1)
+}
+
+// graphiteIllegal are the characters that Graphite would misread in a path
+// segment: the dots that make the hierarchy and those of its glob patterns.
+const graphiteIllegal = `./\*?[]{}@`
+
+// sanitize replaces each character of a path segment that would corrupt the
+// path with Replacement: the separator, graphiteIllegal and whitespace.
+func (s *GraphiteSerializer) sanitize(segment string) string {
+	replacement := s.Replacement
+	if replacement == "" {
+		replacement = "_"
+	}
+	if sep := s.separator(); sep != "." {
+		segment = strings.Replace(segment, sep, replacement, -1)
+	}
+	var b []byte
+	for _, r := range segment {
+		if unicode.IsSpace(r) || unicode.IsControl(r) ||
+			strings.ContainsRune(graphiteIllegal, r) {
+			b = append(b, replacement...)
+			continue
+		}
+		b = append(b, string(r)...)
+	}
+	return string(b)
+}
+
+func (s *GraphiteSerializer) separator() string {
+	if s.Separator == "" {
+		return "."
+	}
+	return s.Separator
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGraphiteSerializerSanitize(t *testing.T) {
+	m, _ := New("cpu info",
+		map[string]string{"host": "web1.example.com", "model": "Intel Xeon 2.4GHz"},
+		map[string]interface{}{"mhz": int64(2400), "value": 1.5, "name": "skipped"},
+		time.Unix(1500000000, 0))
+
+	tests := []struct {
+		s    *GraphiteSerializer
+		want string
+	}{
+		{
+			&GraphiteSerializer{Prefix: "prod"},
+			"prod.web1_example_com.Intel_Xeon_2_4GHz.cpu_info.mhz 2400 1500000000\n" +
+				"prod.web1_example_com.Intel_Xeon_2_4GHz.cpu_info 1.5 1500000000\n",
+		},
+		{
+			&GraphiteSerializer{Replacement: "-"},
+			"web1-example-com.Intel-Xeon-2-4GHz.cpu-info.mhz 2400 1500000000\n" +
+				"web1-example-com.Intel-Xeon-2-4GHz.cpu-info 1.5 1500000000\n",
+		},
+		{
+			// the dots are replaced whatever the separator
+			&GraphiteSerializer{Separator: "/", Template: "measurement.model.field"},
+			"cpu_info/Intel_Xeon_2_4GHz/mhz 2400 1500000000\n" +
+				"cpu_info/Intel_Xeon_2_4GHz 1.5 1500000000\n",
+		},
+	}
+	for _, tt := range tests {
+		out, err := tt.s.Serialize(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != tt.want {
+			t.Errorf("%+v: expected\n%s\ngot\n%s", *tt.s, tt.want, out)
+		}
+	}
+}
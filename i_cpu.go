@@ -1,19 +1,45 @@
 package main
 
 import (
+	"fmt"
 	"os/exec"
-	"strings"
 	"strconv"
+	"strings"
 	"time"
-	"fmt"
 )
 
+// cpuTicksPerSecond is the clock rate the cpu_stat tick counters are kept in,
+// 100 unless hires_tick is set in /etc/system.
+const cpuTicksPerSecond = 100
+
 type CPUStats struct {
 	ps             PS
 	PerCPU         bool `toml:"percpu"`
 	TotalCPU       bool `toml:"totalcpu"`
 	CollectCPUTime bool `toml:"collect_cpu_time"`
 	ReportActive   bool `toml:"report_active"`
+
+	// lastStats holds the counters of the previous gather, the usage
+	// percentages are computed from the difference.
+	lastStats map[string]cpuTimes
+	lastTime  time.Time
+
+	// kstat returns the output of "kstat -p cpu_stat", it is replaced in tests
+	kstat func() ([]byte, error)
+}
+
+// cpuTimes holds the cumulative counters of a cpu_stat kstat.
+type cpuTimes struct {
+	user    uint64
+	system  uint64
+	idle    uint64
+	iowait  uint64
+	pswitch uint64
+	forks   uint64
+}
+
+func (t cpuTimes) total() uint64 {
+	return t.user + t.system + t.idle + t.iowait
 }
 
 func NewCPUStats(ps PS) *CPUStats {
@@ -34,6 +60,8 @@ var sampleConfig = `
   ## Whether to report total system cpu stats or not
   totalcpu = true
   ## If true, collect raw CPU time metrics.
+  ## The usage percentages need two samples, so the first gather reports
+  ## only the raw CPU time metrics when this is set, and nothing otherwise.
   collect_cpu_time = false
   ## If true, compute and report the sum of all non-idle CPU states.
   report_active = false
@@ -43,43 +71,168 @@ func (_ *CPUStats) SampleConfig() string {
 	return sampleConfig
 }
 
+func kstatCPUStat() ([]byte, error) {
+	return exec.Command("kstat", "-p", "cpu_stat").CombinedOutput()
+}
+
 func (s *CPUStats) Gather(acc Accumulator) error {
-	output, err := exec.Command("/usr/bin/vmstat", "-S", "1", "2").CombinedOutput()
+	if s.kstat == nil {
+		s.kstat = kstatCPUStat
+	}
+
+	output, err := s.kstat()
 	if err != nil {
-		return fmt.Errorf("error getting CPU info: %s", err.Error())
+		return fmt.Errorf("error getting CPU (kstat) info: %s", err.Error())
 	}
 
 	now := time.Now()
+	stats := parseKstatCPUStat(string(output))
+	if len(stats) == 0 {
+		return fmt.Errorf("no cpu_stat kstats found")
+	}
+
+	var total cpuTimes
+	for _, t := range stats {
+		total.user += t.user
+		total.system += t.system
+		total.idle += t.idle
+		total.iowait += t.iowait
+		total.pswitch += t.pswitch
+		total.forks += t.forks
+	}
 
-	stats := string(output)
-	rows := strings.Split(stats, "\n")
-	rows = rows[1:]
-	data := make(map[string]float64)
-	headers := strings.Fields(rows[0])
-	values := strings.Fields(rows[2])
-	for count := 0; count < len(headers); count++ {
-		v, _ := strconv.ParseFloat(values[count], 64)
-		data[headers[count]] = v
+	current := make(map[string]cpuTimes, len(stats)+1)
+	if s.PerCPU {
+		for cpu, t := range stats {
+			current[cpu] = t
+		}
 	}
+	if s.TotalCPU {
+		current["cpu-total"] = total
+	}
+
+	for cpu, t := range current {
+		tags := map[string]string{
+			"cpu": cpu,
+		}
+
+		if s.CollectCPUTime {
+			acc.AddCounter("cpu", cpuTimeFields(t, s.ReportActive), tags, now)
+		}
 
-	tags := map[string]string{
-		"cpu": "cpu-total",
+		last, ok := s.lastStats[cpu]
+		if !ok {
+			continue
+		}
+		fields := cpuUsageFields(last, t, s.ReportActive)
+		if fields != nil {
+			acc.AddGauge("cpu", fields, tags, now)
+		}
 	}
 
-	fieldsC := map[string]interface{}{
-		"usage_idle":   data["id"],
-		"usage_system": data["sy"],
-		"usage_user":   data["us"],
+	if last, ok := s.lastStats["total"]; ok {
+		if elapsed := now.Sub(s.lastTime).Seconds(); elapsed > 0 {
+			fields := make(map[string]interface{})
+			// a counter that went down, ie, of a cpu taken offline, has no
+			// rate until the next gather
+			if total.pswitch >= last.pswitch {
+				fields["cswch_per_s"] = float64(total.pswitch-last.pswitch) / elapsed
+			}
+			if total.forks >= last.forks {
+				fields["proc_per_s"] = float64(total.forks-last.forks) / elapsed
+			}
+			if len(fields) > 0 {
+				acc.AddGauge("task", fields, nil, now)
+			}
+		}
 	}
 
-	acc.AddCounter("cpu", fieldsC, tags, now)
+	// the total is kept separately, it is needed for the task metrics even
+	// when the cpu-total metrics are disabled.
+	current["total"] = total
+	s.lastStats = current
+	s.lastTime = now
+	return nil
+}
 
-	// Task
+// cpuTimeFields returns the counters of t in seconds.
+func cpuTimeFields(t cpuTimes, active bool) map[string]interface{} {
 	fields := map[string]interface{}{
-		"cswch_per_s": data["cs"],
-		"proc_per_s":  data["sy"],
+		"time_user":   float64(t.user) / cpuTicksPerSecond,
+		"time_system": float64(t.system) / cpuTicksPerSecond,
+		"time_idle":   float64(t.idle) / cpuTicksPerSecond,
+		"time_iowait": float64(t.iowait) / cpuTicksPerSecond,
 	}
+	if active {
+		fields["time_active"] = float64(t.total()-t.idle) / cpuTicksPerSecond
+	}
+	return fields
+}
 
-	acc.AddCounter("task", fields, nil, now)
-	return nil
+// cpuUsageFields returns the share of the ticks between last and t spent in
+// each state as a percentage. It returns nil if no ticks have passed, ie, when
+// the counters were reset.
+func cpuUsageFields(last, t cpuTimes, active bool) map[string]interface{} {
+	if t.total() <= last.total() {
+		return nil
+	}
+	delta := float64(t.total() - last.total())
+	percent := func(cur, prev uint64) float64 {
+		if cur < prev {
+			return 0
+		}
+		return 100 * float64(cur-prev) / delta
+	}
+
+	fields := map[string]interface{}{
+		"usage_user":   percent(t.user, last.user),
+		"usage_system": percent(t.system, last.system),
+		"usage_idle":   percent(t.idle, last.idle),
+		"usage_iowait": percent(t.iowait, last.iowait),
+	}
+	if active {
+		fields["usage_active"] = 100 - percent(t.idle, last.idle)
+	}
+	return fields
+}
+
+// parseKstatCPUStat parses the "cpu_stat:instance:name:statistic value" lines
+// of kstat -p into the counters of each cpu, keyed by "cpu<instance>".
+func parseKstatCPUStat(output string) map[string]cpuTimes {
+	stats := make(map[string]cpuTimes)
+	for _, row := range strings.Split(output, "\n") {
+		data := strings.Fields(row)
+		if len(data) != 2 {
+			continue
+		}
+		key := strings.Split(data[0], ":")
+		if len(key) != 4 || key[0] != "cpu_stat" {
+			continue
+		}
+		v, err := strconv.ParseUint(data[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		cpu := "cpu" + key[1]
+		t := stats[cpu]
+		switch key[3] {
+		case "user":
+			t.user = v
+		case "kernel":
+			t.system = v
+		case "idle":
+			t.idle = v
+		case "wait":
+			t.iowait = v
+		case "pswitch":
+			t.pswitch = v
+		case "sysfork", "sysvfork":
+			t.forks += v
+		default:
+			continue
+		}
+		stats[cpu] = t
+	}
+	return stats
 }
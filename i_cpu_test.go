@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCPUStatsTaskRatesOnCounterReset(t *testing.T) {
+	samples := []struct {
+		pswitch, forks int
+	}{
+		{1000, 100},
+		{1500, 50},
+		{200, 60},
+	}
+	var sample int
+	s := NewCPUStats(nil)
+	s.kstat = func() ([]byte, error) {
+		p := samples[sample]
+		return []byte(fmt.Sprintf("cpu_stat:0:cpu_stat0:user\t%d\n"+
+			"cpu_stat:0:cpu_stat0:idle\t%d\n"+
+			"cpu_stat:0:cpu_stat0:pswitch\t%d\n"+
+			"cpu_stat:0:cpu_stat0:sysfork\t%d\n",
+			10*sample, 10*sample, p.pswitch, p.forks)), nil
+	}
+
+	want := []map[string]bool{
+		nil,
+		{"cswch_per_s": true},
+		{"proc_per_s": true},
+	}
+	for sample = range samples {
+		metricC := make(chan Metric, 10)
+		acc := NewAccumulator(NewRunningInput(s, &InputConfig{Name: "cpu"}), metricC)
+		if err := s.Gather(acc); err != nil {
+			t.Fatal(err)
+		}
+		close(metricC)
+		var task map[string]interface{}
+		for m := range metricC {
+			if m.Name() == "task" {
+				task = m.Fields()
+			}
+		}
+		if len(task) != len(want[sample]) {
+			t.Errorf("sample %d: expected the task fields %v, got %v", sample,
+				want[sample], task)
+		}
+		for name, v := range task {
+			if !want[sample][name] {
+				t.Errorf("sample %d: unexpected task field %s", sample, name)
+			}
+			if f, _ := v.(float64); f < 0 {
+				t.Errorf("sample %d: negative %s %v", sample, name, f)
+			}
+		}
+	}
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
-	"os/exec"
-	"strings"
+	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
-	"fmt"
+)
+
+var (
+	// dfHeaderRe matches the first line of a filesystem in 'df -g', ie,
+	// "/      (rpool/ROOT/solaris):  131072 block size  512 frag size".
+	dfHeaderRe = regexp.MustCompile(`^(\S+)\s*\(\s*(.*?)\s*\):\s*(\d+) block size\s+(\d+) frag size`)
+	dfBlocksRe = regexp.MustCompile(`(\d+) total blocks\s+(\d+) free blocks\s+(\d+) available\s+(\d+) total files`)
+	dfFilesRe  = regexp.MustCompile(`(\d+) free files`)
+	dfFSTypeRe = regexp.MustCompile(`(\S+) fstype`)
 )
 
 type DiskStats struct {
@@ -14,8 +23,31 @@ type DiskStats struct {
 	// Legacy support
 	Mountpoints []string
 
-	MountPoints []string
-	IgnoreFS    []string `toml:"ignore_fs"`
+	MountPoints       []string
+	IgnoreMountPoints []string `toml:"ignore_mount_points"`
+	IgnoreFS          []string `toml:"ignore_fs"`
+
+	compiled          bool
+	mountPoints       Filter
+	ignoreMountPoints Filter
+	ignoreFS          Filter
+
+	// run runs a command and returns its output, it is replaced in tests
+	run func(name string, args ...string) ([]byte, error)
+}
+
+// dfStat is the statvfs of a filesystem as printed by 'df -g'.
+type dfStat struct {
+	path   string
+	device string
+	fstype string
+
+	frsize    uint64
+	blocks    uint64
+	bfree     uint64
+	bavail    uint64
+	files     uint64
+	freeFiles uint64
 }
 
 func (_ *DiskStats) Description() string {
@@ -25,56 +57,138 @@ func (_ *DiskStats) Description() string {
 var diskSampleConfig = `
   ## By default, telegraf gather stats for all mountpoints.
   ## Setting mountpoints will restrict the stats to the specified mountpoints.
+  ## "*" matches any characters, ie, "/export/*".
   # mount_points = ["/"]
+  ## Mount points to skip.
+  # ignore_mount_points = ["/system/*"]
 
-  ## Ignore some mountpoints by filesystem type. For example (dev)tmpfs (usually
-  ## present on /run, /var/run, /dev/shm or /dev).
-  ignore_fs = ["tmpfs", "devtmpfs", "devfs"]
+  ## Ignore some mountpoints by filesystem type. For example tmpfs (usually
+  ## present on /tmp, /var/run and /etc/svc/volatile) and the pseudo
+  ## filesystems of Solaris.
+  ignore_fs = ["tmpfs", "devfs", "proc", "ctfs", "objfs", "mntfs", "sharefs", "fd"]
 `
 
 func (_ *DiskStats) SampleConfig() string {
 	return diskSampleConfig
 }
 
+func (s *DiskStats) compileFilters() error {
+	if s.compiled {
+		return nil
+	}
+	var err error
+	mountPoints := append(s.MountPoints, s.Mountpoints...)
+	if s.mountPoints, err = CompileFilter(mountPoints); err != nil {
+		return fmt.Errorf("invalid mount_points: %s", err)
+	}
+	if s.ignoreMountPoints, err = CompileFilter(s.IgnoreMountPoints); err != nil {
+		return fmt.Errorf("invalid ignore_mount_points: %s", err)
+	}
+	if s.ignoreFS, err = CompileFilter(s.IgnoreFS); err != nil {
+		return fmt.Errorf("invalid ignore_fs: %s", err)
+	}
+	s.compiled = true
+	return nil
+}
+
 func (s *DiskStats) Gather(acc Accumulator) error {
-	output, err := exec.Command("df", "-k").CombinedOutput()
+	if s.run == nil {
+		s.run = runCommand
+	}
+	if err := s.compileFilters(); err != nil {
+		return err
+	}
+
+	output, err := s.run("df", "-g")
 	if err != nil {
 		return fmt.Errorf("error getting Disk info: %s", err.Error())
 	}
 
 	now := time.Now()
 
-	stats := string(output)
-	rows := strings.Split(stats, "\n")
-	rows = rows[1:len(rows)-1]
-	for _, row := range rows {
-		data := strings.Fields(row)
-		tags := map[string]string{
-			"path":   data[5],
-			"device": data[0],
+	for _, st := range parseDfG(string(output)) {
+		if s.mountPoints != nil && !s.mountPoints.Match(st.path) {
+			continue
 		}
-		total, _ := strconv.ParseUint(data[1], 10, 0)
-		total = total * 1024
-		used, _ := strconv.ParseUint(data[2], 10, 0)
-		used = used * 1024
-		free, _ := strconv.ParseUint(data[3], 10, 0)
-		free = free * 1024
-
-		var used_percent float64
-		if used+free > 0 {
-			used_percent = float64(used) /
-				(float64(used) + float64(free)) * 100
+		if s.ignoreMountPoints != nil && s.ignoreMountPoints.Match(st.path) {
+			continue
 		}
-
-		fields := map[string]interface{}{
-			"total":        total,
-			"used":         used,
-			"free":         free,
-			"used_percent": used_percent,
+		if s.ignoreFS != nil && s.ignoreFS.Match(st.fstype) {
+			continue
 		}
 
-		acc.AddGauge("disk", fields, tags, now)
+		tags := map[string]string{
+			"path":   st.path,
+			"device": st.device,
+			"fstype": st.fstype,
+		}
+		acc.AddGauge("disk", diskFields(st), tags, now)
 	}
 
 	return nil
 }
+
+// diskFields returns the fields of a filesystem. As with df, free is the
+// space available to unprivileged users and used_percent is relative to
+// used+free, so that a filesystem is 100% full when they cannot write.
+func diskFields(st dfStat) map[string]interface{} {
+	total := st.blocks * st.frsize
+	free := st.bavail * st.frsize
+	var used uint64
+	if st.blocks > st.bfree {
+		used = (st.blocks - st.bfree) * st.frsize
+	}
+
+	var inodesUsed uint64
+	if st.files > st.freeFiles {
+		inodesUsed = st.files - st.freeFiles
+	}
+
+	return map[string]interface{}{
+		"total":        total,
+		"used":         used,
+		"free":         free,
+		"used_percent": percent(used, used+free),
+		"inodes_total": st.files,
+		"inodes_free":  st.freeFiles,
+		"inodes_used":  inodesUsed,
+	}
+}
+
+// parseDfG parses the output of the Solaris 'df -g', four lines for each
+// filesystem, ie:
+//
+//     /                  (rpool/ROOT/solaris):       131072 block size          512 frag size
+//     205520896 total blocks 180426814 free blocks 180426814 available        9050624 total files
+//      9003487 free files    83886097 filesys id
+//          zfs fstype       0x00000004 flag             255 filename length
+//
+// The block counts are in units of the frag size.
+func parseDfG(output string) []dfStat {
+	var stats []dfStat
+	var st *dfStat
+	for _, line := range strings.Split(output, "\n") {
+		if m := dfHeaderRe.FindStringSubmatch(line); m != nil {
+			stats = append(stats, dfStat{path: m[1], device: m[2]})
+			st = &stats[len(stats)-1]
+			st.frsize, _ = strconv.ParseUint(m[4], 10, 64)
+			continue
+		}
+		if st == nil {
+			continue
+		}
+		if m := dfBlocksRe.FindStringSubmatch(line); m != nil {
+			st.blocks, _ = strconv.ParseUint(m[1], 10, 64)
+			st.bfree, _ = strconv.ParseUint(m[2], 10, 64)
+			st.bavail, _ = strconv.ParseUint(m[3], 10, 64)
+			st.files, _ = strconv.ParseUint(m[4], 10, 64)
+		}
+		if m := dfFilesRe.FindStringSubmatch(line); m != nil {
+			st.freeFiles, _ = strconv.ParseUint(m[1], 10, 64)
+		}
+		if m := dfFSTypeRe.FindStringSubmatch(line); m != nil {
+			st.fstype = m[1]
+		}
+	}
+	return stats
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// dfGFixture is the output of 'df -g' with a zfs, a ufs and a tmpfs
+// filesystem.
+const dfGFixture = `/                  (rpool/ROOT/solaris):       131072 block size          512 frag size
+2000 total blocks 1000 free blocks 1000 available 100 total files
+40 free files    83886097 filesys id
+zfs fstype       0x00000004 flag             255 filename length
+
+/export/home       (/dev/dsk/c0t0d0s7 ):         8192 block size         1024 frag size
+4000 total blocks 3000 free blocks 2000 available 500 total files
+450 free files    8388615 filesys id
+ufs fstype       0x00000004 flag             255 filename length
+
+/tmp               (swap              ):         4096 block size         4096 frag size
+100 total blocks 100 free blocks 100 available 10 total files
+10 free files    1 filesys id
+tmpfs fstype       0x00000004 flag             255 filename length
+`
+
+func gatherDisk(t *testing.T, s *DiskStats) map[string]Metric {
+	s.run = func(name string, args ...string) ([]byte, error) {
+		return []byte(dfGFixture), nil
+	}
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(s, &InputConfig{Name: "disk"}), metricC)
+	if err := s.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+	metrics := make(map[string]Metric)
+	for m := range metricC {
+		metrics[m.Tags()["path"]] = m
+	}
+	return metrics
+}
+
+func TestDiskStatsDfG(t *testing.T) {
+	metrics := gatherDisk(t, &DiskStats{IgnoreFS: []string{"tmpfs"}})
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 filesystems, got %d", len(metrics))
+	}
+
+	root := metrics["/"]
+	if root == nil {
+		t.Fatal("expected a metric for /")
+	}
+	wantTags := map[string]string{
+		"path":   "/",
+		"device": "rpool/ROOT/solaris",
+		"fstype": "zfs",
+	}
+	if !reflect.DeepEqual(root.Tags(), wantTags) {
+		t.Errorf("expected tags %v, got %v", wantTags, root.Tags())
+	}
+	want := map[string]interface{}{
+		"total":        int64(1024000),
+		"used":         int64(512000),
+		"free":         int64(512000),
+		"used_percent": float64(50),
+		"inodes_total": int64(100),
+		"inodes_free":  int64(40),
+		"inodes_used":  int64(60),
+	}
+	if !reflect.DeepEqual(root.Fields(), want) {
+		t.Errorf("expected %v, got %v", want, root.Fields())
+	}
+
+	home := metrics["/export/home"]
+	if home == nil {
+		t.Fatal("expected a metric for /export/home")
+	}
+	if d := home.Tags()["device"]; d != "/dev/dsk/c0t0d0s7" {
+		t.Errorf("expected the device to be trimmed, got %q", d)
+	}
+	// free is the space available to unprivileged users, not the free blocks
+	want = map[string]interface{}{
+		"total":        int64(4096000),
+		"used":         int64(1024000),
+		"free":         int64(2048000),
+		"used_percent": percent(1024000, 3072000),
+		"inodes_total": int64(500),
+		"inodes_free":  int64(450),
+		"inodes_used":  int64(50),
+	}
+	if !reflect.DeepEqual(home.Fields(), want) {
+		t.Errorf("expected %v, got %v", want, home.Fields())
+	}
+}
+
+func TestDiskStatsMountPoints(t *testing.T) {
+	metrics := gatherDisk(t, &DiskStats{MountPoints: []string{"/export/*", "/tmp"}})
+	if len(metrics) != 2 || metrics["/export/home"] == nil || metrics["/tmp"] == nil {
+		t.Errorf("expected /export/home and /tmp, got %v", metrics)
+	}
+
+	metrics = gatherDisk(t, &DiskStats{IgnoreMountPoints: []string{"/export/*"}})
+	if len(metrics) != 2 || metrics["/"] == nil || metrics["/tmp"] == nil {
+		t.Errorf("expected / and /tmp, got %v", metrics)
+	}
+}
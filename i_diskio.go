@@ -1,16 +1,18 @@
 package main
 
 import (
+	"fmt"
 	"os/exec"
-	"strings"
 	"strconv"
+	"strings"
 	"time"
-	"fmt"
-	"regexp"
 )
 
 type DiskIOStats struct {
 	Devices []string
+
+	// kstat returns the output of "kstat -p -c disk", it is replaced in tests
+	kstat func() ([]byte, error)
 }
 
 func (_ *DiskIOStats) Description() string {
@@ -18,98 +20,101 @@ func (_ *DiskIOStats) Description() string {
 }
 
 var diskIoSampleConfig = `
-  ## By default, telegraf will gather stats for all devices including
-  ## disk partitions.
+  ## By default, telegraf will gather stats for all disk devices (the "disk"
+  ## kstat class, ie, the sd, ssd and cmdk modules).
   ## Setting devices will restrict the stats to the specified devices.
-  # devices = ["sda", "sdb"]
-  ## Uncomment the following line if you need disk serial numbers.
-  # skip_serial_number = false
-  #
-  ## On systems which support it, device metadata can be added in the form of
-  ## tags.
-  ## Currently only Linux is supported via udev properties. You can view
-  ## available properties for a device by running:
-  ## 'udevadm info -q property -n /dev/sda'
-  # device_tags = ["ID_FS_TYPE", "ID_FS_USAGE"]
-  #
-  ## Using the same metadata source as device_tags, you can also customize the
-  ## name of the device via templates.
-  ## The 'name_templates' parameter is a list of templates to try and apply to
-  ## the device. The template may contain variables in the form of '$PROPERTY' or
-  ## '${PROPERTY}'. The first template which does not contain any variables not
-  ## present for the device is used as the device name tag.
-  ## The typical use case is for LVM volumes, to get the VG/LV name instead of
-  ## the near-meaningless DM-0 name.
-  # name_templates = ["$ID_FS_LABEL","$DM_VG_NAME/$DM_LV_NAME"]
+  # devices = ["sd0", "sd1"]
 `
 
 func (_ *DiskIOStats) SampleConfig() string {
 	return diskIoSampleConfig
 }
 
+func kstatDisk() ([]byte, error) {
+	return exec.Command("kstat", "-p", "-c", "disk").CombinedOutput()
+}
+
 func (s *DiskIOStats) Gather(acc Accumulator) error {
+	if s.kstat == nil {
+		s.kstat = kstatDisk
+	}
 
-	var devices []string
+	output, err := s.kstat()
+	if err != nil {
+		return fmt.Errorf("error getting DiskIO (kstat) info: %s", err.Error())
+	}
 
-	if len(s.Devices) > 0 {
-		devices = s.Devices
-	} else {
-		output, err := exec.Command("iostat", "-d").CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("error getting DiskIO info: %s", err.Error())
+	now := time.Now()
+	for device, fields := range parseKstatDiskIO(string(output), s.Devices) {
+		tags := map[string]string{
+			"name": device,
 		}
-		devices = strings.Fields(strings.Split(string(output), "\n")[0])
+		acc.AddGauge("diskio", fields, tags, now)
 	}
+	return nil
+}
 
-	for _, device := range devices {
-		output, err := exec.Command("kstat", "-p", fmt.Sprintf("*:*:%s:*", device)).CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("error getting DiskIO (kstat) info: %s", err.Error())
+// parseKstatDiskIO parses the "module:instance:name:statistic value" lines of
+// kstat -p into the diskio fields of each device. If devices is not empty,
+// only those devices are returned.
+func parseKstatDiskIO(output string, devices []string) map[string]map[string]interface{} {
+	stats := make(map[string]map[string]interface{})
+	for _, row := range strings.Split(output, "\n") {
+		data := strings.Fields(row)
+		if len(data) != 2 {
+			continue
+		}
+		key := strings.Split(data[0], ":")
+		if len(key) != 4 {
+			continue
+		}
+		device, stat, value := key[2], key[3], data[1]
+
+		// skip the error and partition kstats, ie, sd0,err and sd0,a
+		if strings.Contains(device, ",") {
+			continue
+		}
+		if len(devices) > 0 && !sliceContains(device, devices) {
+			continue
+		}
+
+		fields, ok := stats[device]
+		if !ok {
+			fields = make(map[string]interface{})
+			stats[device] = fields
 		}
-		s := string(output)
-		if s != "" {
-			fields := map[string]interface{}{}
-			tags := map[string]string{
-				"name": device,
-			}
-			stats := strings.Split(s, "\n")
-			stats = stats[0: len(stats)-1]
-			for _, row := range stats {
-				data := strings.Fields(row)
-				reg := regexp.MustCompile(".*:.*:.*:")
-				field := reg.ReplaceAllString(data[0], "${1}")
 
-				switch field {
-				case "reads":
-					fields["reads"], _ = strconv.ParseInt(data[1], 10, 0)
-					break
-				case "writes":
-					fields["writes"], _ = strconv.ParseInt(data[1], 10, 0)
-					break
-				case "rtime":
-					f, _ := strconv.ParseFloat(data[1], 64)
-					fields["read_time"] = int(f)
-					break
-				case "wtime":
-					f, _ := strconv.ParseFloat(data[1], 64)
-					fields["write_time"] = int(f)
-					break
-				case "nread":
-					fields["read_bytes"], _ = strconv.ParseInt(data[1], 10, 0)
-					break
-				case "nwritten":
-					fields["write_bytes"], _ = strconv.ParseInt(data[1], 10, 0)
-					break
-				case "rcnt":
-					fields["iops_in_progress"], _ = strconv.ParseInt(data[1], 10, 0)
-					break
-				case "wcnt":
-					fields["iops_in_progress"], _ = strconv.ParseInt(data[1], 10, 0)
-					break
-				}
+		switch stat {
+		case "reads":
+			fields["reads"], _ = strconv.ParseInt(value, 10, 64)
+		case "writes":
+			fields["writes"], _ = strconv.ParseInt(value, 10, 64)
+		case "nread":
+			fields["read_bytes"], _ = strconv.ParseInt(value, 10, 64)
+		case "nwritten":
+			fields["write_bytes"], _ = strconv.ParseInt(value, 10, 64)
+		case "rtime":
+			// cumulative time the device was busy, in nanoseconds
+			f, _ := strconv.ParseFloat(value, 64)
+			fields["read_time"] = int64(f)
+			fields["io_time"] = int64(f / float64(time.Millisecond))
+		case "wtime":
+			// cumulative time requests spent waiting, in nanoseconds
+			f, _ := strconv.ParseFloat(value, 64)
+			fields["write_time"] = int64(f)
+		case "rcnt", "wcnt":
+			n, _ := strconv.ParseInt(value, 10, 64)
+			if prev, ok := fields["iops_in_progress"].(int64); ok {
+				n += prev
 			}
-			acc.AddGauge("diskio", fields, tags, time.Now())
+			fields["iops_in_progress"] = n
 		}
 	}
-	return nil
-}
\ No newline at end of file
+
+	for device, fields := range stats {
+		if len(fields) == 0 {
+			delete(stats, device)
+		}
+	}
+	return stats
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// kstatDiskFixture is the output of "kstat -p -c disk" on a host with two
+// disks, sd0 with a partition kstat.
+var kstatDiskFixture = `sd:0:sd0:class	disk
+sd:0:sd0:crtime	40.2136523
+sd:0:sd0:nread	1185536512
+sd:0:sd0:nwritten	8523862016
+sd:0:sd0:rcnt	0
+sd:0:sd0:reads	49311
+sd:0:sd0:rlastupdate	1814623155203214
+sd:0:sd0:rlentime	498264015632
+sd:0:sd0:rtime	347105113504
+sd:0:sd0:snaptime	1814624.7290934
+sd:0:sd0:wcnt	1
+sd:0:sd0:wlastupdate	1814623155200916
+sd:0:sd0:wlentime	12342543
+sd:0:sd0:writes	395813
+sd:0:sd0:wtime	9853291
+sd:0:sd0,a:class	partition
+sd:0:sd0,a:nread	1185536000
+sd:0:sd0,a:reads	49300
+sd:1:sd1:class	disk
+sd:1:sd1:nread	20480
+sd:1:sd1:nwritten	0
+sd:1:sd1:rcnt	0
+sd:1:sd1:reads	5
+sd:1:sd1:rtime	1500000
+sd:1:sd1:wcnt	0
+sd:1:sd1:writes	0
+sd:1:sd1:wtime	0
+`
+
+func gatherDiskIO(t *testing.T, s *DiskIOStats) map[string]map[string]interface{} {
+	s.kstat = func() ([]byte, error) { return []byte(kstatDiskFixture), nil }
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(s, &InputConfig{Name: "diskio"}), metricC)
+	if err := s.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+	devices := make(map[string]map[string]interface{})
+	for m := range metricC {
+		devices[m.Tags()["name"]] = m.Fields()
+	}
+	return devices
+}
+
+func TestDiskIOKstat(t *testing.T) {
+	devices := gatherDiskIO(t, &DiskIOStats{})
+	want := map[string]map[string]interface{}{
+		"sd0": {
+			"reads":            int64(49311),
+			"writes":           int64(395813),
+			"read_bytes":       int64(1185536512),
+			"write_bytes":      int64(8523862016),
+			"read_time":        int64(347105113504),
+			"write_time":       int64(9853291),
+			"io_time":          int64(347105),
+			"iops_in_progress": int64(1),
+		},
+		"sd1": {
+			"reads":            int64(5),
+			"writes":           int64(0),
+			"read_bytes":       int64(20480),
+			"write_bytes":      int64(0),
+			"read_time":        int64(1500000),
+			"write_time":       int64(0),
+			"io_time":          int64(1),
+			"iops_in_progress": int64(0),
+		},
+	}
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("expected %v, got %v", want, devices)
+	}
+}
+
+func TestDiskIODevicesFilter(t *testing.T) {
+	devices := gatherDiskIO(t, &DiskIOStats{Devices: []string{"sd1"}})
+	if len(devices) != 1 || devices["sd1"] == nil {
+		t.Errorf("expected only sd1, got %v", devices)
+	}
+}
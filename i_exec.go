@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const execSampleConfig = `
+  ## Commands array
+  commands = [
+    "/tmp/test.sh",
+    "/usr/bin/mycollector --foo=bar",
+    "/tmp/collect_*.sh"
+  ]
+
+  ## Timeout for each command to complete.
+  timeout = "5s"
+
+  ## measurement name suffix (for separating different commands)
+  name_suffix = "_mycollector"
+
+  ## Data format to consume.
+  ## Each data format has its own unique set of configuration options.
+  ## Supported formats: influx, json, prometheus, value, keyvalue, logfmt,
+  ## kstat, opentsdb, multi
+  data_format = "influx"
+
+  ## Number of lines discarded at the start of the output of each command,
+  ## ie, column names or a banner, with any data format.
+  # skip_lines = 0
+
+  ## Case of the measurement names, "lower" or "upper", with any data
+  ## format. Tags and fields keep theirs.
+  # name_case = "none"
+
+  ## With the keyvalue data format, each line is a metric of key/value
+  ## pairs, ie, "read:12;write:3" with these settings. Keys listed in
+  ## tag_keys are tags.
+  # keyvalue_pair_delimiter = ";"
+  # keyvalue_separator = ":"
+  # tag_keys = ["device"]
+
+  ## The kstat data format reads the output of "kstat -p", ie,
+  ## "unix:0:system_misc:nproc	85" is the field nproc of the measurement
+  ## unix, tagged with instance "0" and name "system_misc".
+
+  ## With the multi data format, each line is parsed with the first of
+  ## data_formats that accepts it. Lines that none accepts are skipped, and
+  ## counted, unless multi_strict is set, which makes them an error.
+  # data_formats = ["value", "json"]
+  # multi_strict = false
+
+  ## With the value data format, unique_timestamps makes the time of each
+  ## metric a nanosecond later than the previous one when the clock has not
+  ## moved, so that the values of commands run together are not written
+  ## over each other. Their metrics then keep the nanosecond precision,
+  ## whatever the precision of the agent.
+  # unique_timestamps = false
+`
+
+// MaxStderrBytes is the most stderr output that is included in the error
+// of a failed command.
+const MaxStderrBytes = 512
+
+type Exec struct {
+	Commands []string
+	Command  string
+	Timeout  Duration
+
+	parser Parser
+
+	runner Runner
+}
+
+func NewExec() *Exec {
+	return &Exec{
+		runner:  CommandRunner{},
+		Timeout: Duration{Duration: time.Second * 5},
+	}
+}
+
+// Runner runs a command and returns its stdout.
+type Runner interface {
+	Run(*Exec, string) ([]byte, error)
+}
+
+type CommandRunner struct{}
+
+func (c CommandRunner) Run(e *Exec, command string) ([]byte, error) {
+	splitCmd := strings.Fields(command)
+	if len(splitCmd) == 0 {
+		return nil, fmt.Errorf("exec: unable to parse command %q", command)
+	}
+
+	cmd := exec.Command(splitCmd[0], splitCmd[1:]...)
+
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	if err := RunTimeout(cmd, e.Timeout.Duration); err != nil {
+		errMsg := stderr.String()
+		if len(errMsg) > MaxStderrBytes {
+			errMsg = errMsg[:MaxStderrBytes]
+		}
+		errMsg = strings.TrimSpace(errMsg)
+		if errMsg != "" {
+			return nil, fmt.Errorf("exec: %s for command '%s': %s",
+				err, command, errMsg)
+		}
+		return nil, fmt.Errorf("exec: %s for command '%s'", err, command)
+	}
+
+	return out.Bytes(), nil
+}
+
+var (
+	execSlotsMu sync.Mutex
+	// execSlots holds a token for each command running, when the number of
+	// commands run at once is limited.
+	execSlots chan struct{}
+)
+
+// SetMaxExecProcesses limits the number of commands that the exec inputs
+// run at once, all of them together, 0 means unlimited. The commands already
+// running count against the limit they were started under.
+func SetMaxExecProcesses(n int) {
+	execSlotsMu.Lock()
+	defer execSlotsMu.Unlock()
+	if n <= 0 {
+		execSlots = nil
+		return
+	}
+	execSlots = make(chan struct{}, n)
+}
+
+// acquireExecSlot waits until a command may be run, and returns the function
+// that frees its slot once it has.
+func acquireExecSlot() func() {
+	execSlotsMu.Lock()
+	slots := execSlots
+	execSlotsMu.Unlock()
+	if slots == nil {
+		return func() {}
+	}
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+func (e *Exec) ProcessCommand(command string, acc Accumulator, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	release := acquireExecSlot()
+	out, err := e.runner.Run(e, command)
+	release()
+	if err != nil {
+		acc.AddError(err)
+		return
+	}
+
+	metrics, err := e.parser.Parse(out)
+	if err != nil {
+		acc.AddError(fmt.Errorf("exec: unable to parse output of '%s': %s",
+			command, err))
+		return
+	}
+
+	for _, metric := range metrics {
+		acc.AddFields(metric.Name(), metric.Fields(), metric.Tags(), metric.Time())
+	}
+}
+
+func (e *Exec) SampleConfig() string {
+	return execSampleConfig
+}
+
+func (e *Exec) Description() string {
+	return "Read metrics from one or more commands that can output to stdout"
+}
+
+func (e *Exec) SetParser(parser Parser) {
+	e.parser = parser
+}
+
+func (e *Exec) Gather(acc Accumulator) error {
+	// rounding to the precision of the agent would merge the unique times
+	// back together
+	if uniqueTimestamps(e.parser) {
+		acc.SetPrecision(time.Nanosecond, 0)
+	}
+
+	var wg sync.WaitGroup
+	// Legacy single command support
+	if e.Command != "" {
+		e.Commands = append(e.Commands, e.Command)
+		e.Command = ""
+	}
+
+	commands := make([]string, 0, len(e.Commands))
+	for _, pattern := range e.Commands {
+		cmdAndArgs := strings.SplitN(pattern, " ", 2)
+		if len(cmdAndArgs) == 0 {
+			continue
+		}
+
+		matches, err := filepath.Glob(cmdAndArgs[0])
+		if err != nil {
+			acc.AddError(err)
+			continue
+		}
+
+		if len(matches) == 0 {
+			// There were no matches with the glob pattern, so let's assume
+			// that the command is in PATH and just run it as it is
+			commands = append(commands, pattern)
+		} else {
+			// There were matches, so we'll append each match together with
+			// the arguments to the commands slice
+			for _, match := range matches {
+				if len(cmdAndArgs) == 1 {
+					commands = append(commands, match)
+				} else {
+					commands = append(commands,
+						strings.Join([]string{match, cmdAndArgs[1]}, " "))
+				}
+			}
+		}
+	}
+
+	wg.Add(len(commands))
+	for _, command := range commands {
+		go e.ProcessCommand(command, acc, &wg)
+	}
+
+	wg.Wait()
+	return nil
+}
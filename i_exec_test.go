@@ -0,0 +1,189 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runnerFunc runs the commands of an Exec with a function.
+type runnerFunc func(command string) ([]byte, error)
+
+func (f runnerFunc) Run(_ *Exec, command string) ([]byte, error) {
+	return f(command)
+}
+
+// TestExecUniqueTimestamps checks that the metrics of commands run in the
+// same gather keep distinct times through the accumulator, whose precision
+// would otherwise round them to the same second.
+func TestExecUniqueTimestamps(t *testing.T) {
+	parser, err := NewParser(&ParserConfig{
+		DataFormat:       "value",
+		DataType:         "integer",
+		MetricName:       "queue",
+		UniqueTimestamps: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewExec()
+	e.SetParser(parser)
+	e.Commands = []string{"a", "b", "c"}
+	e.runner = runnerFunc(func(string) ([]byte, error) {
+		return []byte("42\n"), nil
+	})
+
+	metricC := make(chan Metric, 10)
+	ri := NewRunningInput(e, &InputConfig{Name: "exec"})
+	acc := NewAccumulator(ri, metricC)
+	acc.SetPrecision(0, 10*time.Second)
+	if err := e.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+
+	times := make(map[time.Time]bool)
+	n := 0
+	for m := range metricC {
+		times[m.Time()] = true
+		n++
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 metrics, got %d", n)
+	}
+	if len(times) != 3 {
+		t.Errorf("expected 3 distinct times, got %d", len(times))
+	}
+}
+
+// TestExecScriptFixture runs real scripts matched by a glob, and checks that
+// their arguments are passed, their output is parsed and that a failing
+// script adds an error and no metrics.
+func TestExecScriptFixture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	scripts := map[string]string{
+		"disk.sh": "#!/bin/sh\necho \"disk,device=$1 used=10i,free=20i\"\n",
+		"zfs.sh":  "#!/bin/sh\necho \"zfs,device=$1 arcsize=30i\"\n",
+		"fail.sh": "#!/bin/sh\necho broken >&2\nexit 1\n",
+	}
+	for name, script := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	parser, err := NewParser(&ParserConfig{DataFormat: "influx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewExec()
+	e.SetParser(parser)
+	e.Commands = []string{filepath.Join(dir, "*.sh") + " sd0"}
+
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(e, &InputConfig{Name: "exec"}), metricC)
+	before := NErrors.Get()
+	if err := e.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+
+	var names []string
+	for m := range metricC {
+		names = append(names, m.Name())
+		if m.Tags()["device"] != "sd0" {
+			t.Errorf("expected the argument as the device, got %v", m.Tags())
+		}
+		if m.Name() == "disk" && (m.Fields()["used"] != int64(10) ||
+			m.Fields()["free"] != int64(20)) {
+			t.Errorf("unexpected fields %v", m.Fields())
+		}
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "disk" || names[1] != "zfs" {
+		t.Errorf("expected the metrics of disk.sh and zfs.sh, got %v", names)
+	}
+	if n := NErrors.Get() - before; n != 1 {
+		t.Errorf("expected 1 error of fail.sh, got %d", n)
+	}
+}
+
+// TestMaxExecProcesses checks that the commands of a gather never run more
+// than max_exec_processes at once, and that they all run.
+func TestMaxExecProcesses(t *testing.T) {
+	SetMaxExecProcesses(2)
+	defer SetMaxExecProcesses(0)
+
+	parser, _ := NewParser(&ParserConfig{
+		DataFormat: "value",
+		DataType:   "integer",
+		MetricName: "slot",
+	})
+	e := NewExec()
+	e.SetParser(parser)
+	e.Commands = []string{"a", "b", "c", "d", "e", "f"}
+	var mu sync.Mutex
+	running, peak := 0, 0
+	e.runner = runnerFunc(func(string) ([]byte, error) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return []byte("1\n"), nil
+	})
+
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(e, &InputConfig{Name: "exec"}), metricC)
+	if err := e.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	if len(metricC) != 6 {
+		t.Errorf("expected 6 metrics, got %d", len(metricC))
+	}
+	if peak != 2 {
+		t.Errorf("expected at most 2 commands at once, got %d", peak)
+	}
+
+	// unlimited, all the commands run at once
+	SetMaxExecProcesses(0)
+	for len(metricC) > 0 {
+		<-metricC
+	}
+	started := make(chan struct{}, len(e.Commands))
+	all := make(chan struct{})
+	e.runner = runnerFunc(func(string) ([]byte, error) {
+		started <- struct{}{}
+		select {
+		case <-all:
+		case <-time.After(5 * time.Second):
+		}
+		return []byte("1\n"), nil
+	})
+	go func() {
+		for i := 0; i < len(e.Commands); i++ {
+			<-started
+		}
+		close(all)
+	}()
+	start := time.Now()
+	if err := e.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) >= 5*time.Second {
+		t.Error("expected the commands to run at once without a limit")
+	}
+}
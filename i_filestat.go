@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStat reports the presence, size and modification time of files.
+type FileStat struct {
+	Files []string
+
+	// stat returns the info of a file, it is replaced in tests
+	stat func(path string) (os.FileInfo, error)
+	// glob returns the files matching a pattern, it is replaced in tests
+	glob func(pattern string) ([]string, error)
+}
+
+const fileStatSampleConfig = `
+  ## Files to gather stats about. Shell-style globs are supported, ie,
+  ## "/var/log/*.log"; "**" is not.
+  files = ["/var/adm/messages"]
+  ## Metrics are tagged with the file path. A missing file, or a glob that
+  ## matches nothing, is reported with exists=false.
+`
+
+func NewFileStat() *FileStat {
+	return &FileStat{
+		stat: os.Stat,
+		glob: filepath.Glob,
+	}
+}
+
+func (_ *FileStat) Description() string {
+	return "Read stats about given file(s)"
+}
+
+func (_ *FileStat) SampleConfig() string {
+	return fileStatSampleConfig
+}
+
+// compileFilters validates the globs of Files. They are expanded against the
+// filesystem on every gather, as the files they match come and go.
+func (f *FileStat) compileFilters() error {
+	for _, pattern := range f.Files {
+		if _, err := filepath.Match(pattern, pattern); err != nil {
+			return fmt.Errorf("invalid file pattern %q: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+func (f *FileStat) Gather(acc Accumulator) error {
+	for _, pattern := range f.Files {
+		paths := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			matches, err := f.glob(pattern)
+			if err != nil {
+				acc.AddError(fmt.Errorf("invalid file pattern %q: %s", pattern, err))
+				continue
+			}
+			if len(matches) > 0 {
+				paths = matches
+			}
+		}
+
+		for _, path := range paths {
+			tags := map[string]string{"file": path}
+			info, err := f.stat(path)
+			if os.IsNotExist(err) {
+				acc.AddGauge("filestat", map[string]interface{}{"exists": false}, tags)
+				continue
+			}
+			if err != nil {
+				acc.AddError(fmt.Errorf("stat %s: %s", path, err))
+				continue
+			}
+
+			fields := map[string]interface{}{
+				"exists":            true,
+				"size_bytes":        info.Size(),
+				"modification_time": info.ModTime().UnixNano(),
+			}
+			acc.AddGauge("filestat", fields, tags)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStatExistingAndMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	existing := filepath.Join(dir, "messages")
+	if err := ioutil.WriteFile(existing, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Unix(1500000000, 0)
+	if err := os.Chtimes(existing, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing")
+
+	f := NewFileStat()
+	f.Files = []string{existing, missing, filepath.Join(dir, "*.gz")}
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(f, &InputConfig{Name: "filestat"}), metricC)
+	if err := f.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+
+	files := make(map[string]map[string]interface{})
+	for m := range metricC {
+		files[m.Tags()["file"]] = m.Fields()
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files, got %v", files)
+	}
+	fields := files[existing]
+	if fields["exists"] != true || fields["size_bytes"] != int64(6) ||
+		fields["modification_time"] != mtime.UnixNano() {
+		t.Errorf("unexpected fields of the existing file %v", fields)
+	}
+	for _, path := range []string{missing, filepath.Join(dir, "*.gz")} {
+		if fields := files[path]; len(fields) != 1 || fields["exists"] != false {
+			t.Errorf("%s: expected only exists=false, got %v", path, fields)
+		}
+	}
+}
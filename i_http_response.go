@@ -22,6 +22,7 @@ type HTTPResponse struct {
 	Headers             map[string]string
 	FollowRedirects     bool
 	ResponseStringMatch string
+	ExpectedStatusCode  int `toml:"expected_status_code"`
 
 	// Path to CA file
 	SSLCA string `toml:"ssl_ca"`
@@ -64,6 +65,10 @@ var httpResponseSampleConfig = `
   # response_string_match = "ok"
   # response_string_match = "\".*_status\".?:.?\"up\""
 
+  ## Optional HTTP status code the response must have, otherwise the result
+  ## is status_code_mismatch
+  # expected_status_code = 200
+
   ## Optional SSL Config
   # ssl_ca = "/etc/telegraf/ca.pem"
   # ssl_cert = "/etc/telegraf/cert.pem"
@@ -134,6 +139,9 @@ func (h *HTTPResponse) httpGather() (map[string]interface{}, error) {
 	start := time.Now()
 	resp, err := h.client.Do(request)
 
+	// the body of the redirect response may already be closed when the
+	// redirect is not followed
+	var redirected bool
 	if err != nil {
 		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 			fields["result_type"] = "timeout"
@@ -145,6 +153,7 @@ func (h *HTTPResponse) httpGather() (map[string]interface{}, error) {
 		}
 		if urlError, ok := err.(*url.Error); ok &&
 			urlError.Err == ErrRedirectAttempted {
+			redirected = true
 			err = nil
 		} else {
 			return fields, nil
@@ -155,15 +164,34 @@ func (h *HTTPResponse) httpGather() (map[string]interface{}, error) {
 		resp.Body.Close()
 	}()
 
+	var bodyBytes []byte
+	if !redirected {
+		bodyBytes, err = ioutil.ReadAll(resp.Body)
+	}
 	fields["response_time"] = time.Since(start).Seconds()
 	fields["http_response_code"] = resp.StatusCode
+	if err != nil {
+		log.Printf("E! Failed to read body of HTTP Response : %s", err)
+		fields["result_type"] = "body_read_error"
+		return fields, nil
+	}
+	if resp.ContentLength >= 0 {
+		fields["content_length"] = resp.ContentLength
+	} else {
+		fields["content_length"] = int64(len(bodyBytes))
+	}
+
+	if h.ExpectedStatusCode != 0 && resp.StatusCode != h.ExpectedStatusCode {
+		fields["result_type"] = "status_code_mismatch"
+		return fields, nil
+	}
 
 	// Check the response for a regex match.
 	if h.ResponseStringMatch != "" {
 
 		// Compile once and reuse
 		if h.compiledStringMatch == nil {
-			h.compiledStringMatch = regexp.MustCompile(h.ResponseStringMatch)
+			h.compiledStringMatch, err = regexp.Compile(h.ResponseStringMatch)
 			if err != nil {
 				log.Printf("E! Failed to compile regular expression %s : %s", h.ResponseStringMatch, err)
 				fields["result_type"] = "response_string_mismatch"
@@ -171,14 +199,6 @@ func (h *HTTPResponse) httpGather() (map[string]interface{}, error) {
 			}
 		}
 
-		bodyBytes, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Printf("E! Failed to read body of HTTP Response : %s", err)
-			fields["result_type"] = "response_string_mismatch"
-			fields["response_string_match"] = 0
-			return fields, nil
-		}
-
 		if h.compiledStringMatch.Match(bodyBytes) {
 			fields["result_type"] = "success"
 			fields["response_string_match"] = 1
@@ -230,6 +250,9 @@ func (h *HTTPResponse) Gather(acc Accumulator) error {
 	if err != nil {
 		return err
 	}
+	if result, ok := fields["result_type"].(string); ok {
+		tags["result"] = result
+	}
 	// Add metrics
 	acc.AddFields("http_response", fields, tags)
 	return nil
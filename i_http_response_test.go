@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func gatherHTTPResponse(t *testing.T, h *HTTPResponse) Metric {
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(h, &InputConfig{Name: "http_response"}), metricC)
+	if err := h.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+	m, ok := <-metricC
+	if !ok {
+		t.Fatal("expected a metric")
+	}
+	return m
+}
+
+func TestHTTPResponse(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/good", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"service_status": "up"}`)
+	})
+	mux.HandleFunc("/bad", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/good", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, "late")
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	tests := []struct {
+		path            string
+		followRedirects bool
+		expectedStatus  int
+		match           string
+		result          string
+		code            int64
+	}{
+		{path: "/good", match: `"service_status": "up"`, result: "success", code: 200},
+		{path: "/good", match: "down", result: "response_string_mismatch", code: 200},
+		{path: "/bad", result: "success", code: 500},
+		{path: "/bad", expectedStatus: 200, result: "status_code_mismatch", code: 500},
+		{path: "/redirect", result: "success", code: 301},
+		{path: "/redirect", followRedirects: true, result: "success", code: 200},
+	}
+	for _, tt := range tests {
+		h := &HTTPResponse{
+			Address:             ts.URL + tt.path,
+			FollowRedirects:     tt.followRedirects,
+			ExpectedStatusCode:  tt.expectedStatus,
+			ResponseStringMatch: tt.match,
+		}
+		m := gatherHTTPResponse(t, h)
+		if result := m.Tags()["result"]; result != tt.result {
+			t.Errorf("%s: expected the result %s, got %s", tt.path, tt.result, result)
+		}
+		if code := m.Fields()["http_response_code"]; code != tt.code {
+			t.Errorf("%s: expected the code %d, got %v", tt.path, tt.code, code)
+		}
+		if _, ok := m.Fields()["response_time"]; !ok {
+			t.Errorf("%s: expected a response_time", tt.path)
+		}
+	}
+
+	// the client is made up front, so that its timeout is shorter than the
+	// minimum of a second that Gather enforces
+	h := &HTTPResponse{Address: ts.URL + "/slow"}
+	h.ResponseTimeout.Duration = 50 * time.Millisecond
+	client, err := h.createHttpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.client = client
+	m := gatherHTTPResponse(t, h)
+	if result := m.Tags()["result"]; result != "timeout" {
+		t.Errorf("expected the result timeout, got %s", result)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"runtime"
+)
+
+type Internal struct {
+	CollectMemstats bool `toml:"collect_memstats"`
+}
+
+func NewInternal() *Internal {
+	return &Internal{
+		CollectMemstats: true,
+	}
+}
+
+var internalSampleConfig = `
+  ## Reports the agent's own statistics as internal_* metrics:
+  ##   internal_agent: metrics_gathered, metrics_written, metrics_dropped,
+  ##     gather_errors
+  ##   internal_gather: metrics_gathered, gather_time_ns, per input
+  ##   internal_write: metrics_written, metrics_dropped, write_errors,
+  ##     buffer_size, buffer_limit, write_time_ns, per output
+  ## If true, collect telegraf memory stats.
+  # collect_memstats = true
+`
+
+func (_ *Internal) Description() string {
+	return "Collect statistics about itself"
+}
+
+func (_ *Internal) SampleConfig() string {
+	return internalSampleConfig
+}
+
+func (s *Internal) Gather(acc Accumulator) error {
+	if s.CollectMemstats {
+		m := &runtime.MemStats{}
+		runtime.ReadMemStats(m)
+		fields := map[string]interface{}{
+			"alloc_bytes":       m.Alloc,      // bytes allocated and not yet freed
+			"total_alloc_bytes": m.TotalAlloc, // bytes allocated (even if freed)
+			"sys_bytes":         m.Sys,        // bytes obtained from system
+			"pointer_lookups":   m.Lookups,    // number of pointer lookups
+			"mallocs":           m.Mallocs,    // number of mallocs
+			"frees":             m.Frees,      // number of frees
+			"heap_alloc_bytes":  m.HeapAlloc,  // bytes allocated and not yet freed
+			"heap_objects":      m.HeapObjects,
+			"num_gc":            m.NumGC,
+		}
+		acc.AddFields("internal_memstats", fields, map[string]string{})
+	}
+
+	for _, m := range Metrics() {
+		acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// internalStats gathers the internal input and returns the fields of the
+// measurement name tagged with tag=value.
+func internalStats(t *testing.T, name, tag, value string) map[string]interface{} {
+	s := &Internal{}
+	metricC := make(chan Metric, 1000)
+	acc := NewAccumulator(NewRunningInput(s, &InputConfig{Name: "internal"}), metricC)
+	if err := s.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+	var fields map[string]interface{}
+	for m := range metricC {
+		if m.Name() == name && m.Tags()[tag] == value {
+			fields = m.Fields()
+		}
+	}
+	if fields == nil {
+		t.Fatalf("expected a %s metric with %s=%s", name, tag, value)
+	}
+	return fields
+}
+
+func TestInternalCounters(t *testing.T) {
+	in := &orderInput{id: "internal", n: 3}
+	ri := NewRunningInput(in, &InputConfig{Name: "internal_test_input"})
+	metricC := make(chan Metric, 10)
+	if err := in.Gather(NewAccumulator(ri, metricC)); err != nil {
+		t.Fatal(err)
+	}
+	gather := internalStats(t, "internal_gather", "input", "internal_test_input")
+	if n := gather["metrics_gathered"]; n != int64(3) {
+		t.Errorf("expected 3 metrics gathered, got %v", n)
+	}
+
+	out := &mockOutput{}
+	ro := NewRunningOutput("internal_test_output", out,
+		&OutputConfig{Name: "internal_test_output"}, 10, 100)
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		m, _ := New("cpu", nil, map[string]interface{}{"usage": 1.0}, now)
+		ro.AddMetric(m)
+	}
+	if err := ro.Write(); err != nil {
+		t.Fatal(err)
+	}
+	write := internalStats(t, "internal_write", "output", "internal_test_output")
+	if n := write["metrics_written"]; n != int64(4) {
+		t.Errorf("expected 4 metrics written, got %v", n)
+	}
+	if n := write["write_errors"]; n != int64(0) {
+		t.Errorf("expected no write errors, got %v", n)
+	}
+
+	out.setFail(true)
+	m, _ := New("cpu", nil, map[string]interface{}{"usage": 1.0}, now)
+	ro.AddMetric(m)
+	if err := ro.Write(); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	write = internalStats(t, "internal_write", "output", "internal_test_output")
+	if n := write["write_errors"]; n != int64(1) {
+		t.Errorf("expected 1 write error, got %v", n)
+	}
+	if n := write["metrics_written"]; n != int64(4) {
+		t.Errorf("expected the failed write not to count, got %v", n)
+	}
+	if n := write["buffer_size"]; n != int64(1) {
+		t.Errorf("expected 1 buffered metric, got %v", n)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Kernel reports the context switches, interrupts, system calls and forks
+// of the system since boot. They are counters, the rate processor turns them
+// into per-second rates.
+type Kernel struct {
+	// kstat returns the output of "kstat -p cpu_stat
+	// unix:0:system_misc:boot_time", it is replaced in tests
+	kstat func() ([]byte, error)
+}
+
+func (_ *Kernel) Description() string {
+	return "Get kernel statistics from kstat"
+}
+
+func (_ *Kernel) SampleConfig() string { return "" }
+
+func kstatKernel() ([]byte, error) {
+	return exec.Command("kstat", "-p", "cpu_stat",
+		"unix:0:system_misc:boot_time").CombinedOutput()
+}
+
+func (k *Kernel) Gather(acc Accumulator) error {
+	if k.kstat == nil {
+		k.kstat = kstatKernel
+	}
+
+	output, err := k.kstat()
+	if err != nil {
+		return fmt.Errorf("error getting kernel (kstat) info: %s", err.Error())
+	}
+
+	fields, err := parseKstatKernel(string(output))
+	if err != nil {
+		return err
+	}
+	acc.AddCounter("kernel", fields, nil)
+	return nil
+}
+
+// parseKstatKernel sums the counters of the cpu_stat kstats of every cpu, ie:
+//
+//     cpu_stat:0:cpu_stat0:pswitch    1273892
+//     cpu_stat:0:cpu_stat0:intr       5389244
+//     cpu_stat:0:cpu_stat0:syscall    9271935
+//     cpu_stat:0:cpu_stat0:sysfork    20121
+//     cpu_stat:0:cpu_stat0:sysvfork   1322
+//     unix:0:system_misc:boot_time    1500000000
+//
+// forks and vforks are both counted as processes_forked.
+func parseKstatKernel(output string) (map[string]interface{}, error) {
+	var pswitch, intr, syscall, forks, bootTime int64
+	var found bool
+	for _, row := range strings.Split(output, "\n") {
+		data := strings.Fields(row)
+		if len(data) != 2 {
+			continue
+		}
+		key := strings.Split(data[0], ":")
+		if len(key) != 4 {
+			continue
+		}
+		v, err := strconv.ParseInt(data[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if key[0] == "unix" && key[2] == "system_misc" && key[3] == "boot_time" {
+			bootTime = v
+			continue
+		}
+		if key[0] != "cpu_stat" {
+			continue
+		}
+		switch key[3] {
+		case "pswitch":
+			pswitch += v
+		case "intr":
+			intr += v
+		case "syscall":
+			syscall += v
+		case "sysfork", "sysvfork":
+			forks += v
+		default:
+			continue
+		}
+		found = true
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no cpu_stat kstats found")
+	}
+	fields := map[string]interface{}{
+		"context_switches": pswitch,
+		"interrupts":       intr,
+		"syscalls":         syscall,
+		"processes_forked": forks,
+	}
+	if bootTime > 0 {
+		fields["boot_time"] = bootTime
+	}
+	return fields, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// kstatKernelFixture is the output of "kstat -p cpu_stat
+// unix:0:system_misc:boot_time" on a two cpu system, abridged.
+const kstatKernelFixture = `cpu_stat:0:cpu_stat0:crtime	41.257891
+cpu_stat:0:cpu_stat0:intr	5389244
+cpu_stat:0:cpu_stat0:pswitch	1273892
+cpu_stat:0:cpu_stat0:syscall	9271935
+cpu_stat:0:cpu_stat0:sysfork	20121
+cpu_stat:0:cpu_stat0:sysvfork	1322
+cpu_stat:0:cpu_stat0:snaptime	1814624.7290934
+cpu_stat:1:cpu_stat1:intr	4210756
+cpu_stat:1:cpu_stat1:pswitch	1126108
+cpu_stat:1:cpu_stat1:syscall	8728065
+cpu_stat:1:cpu_stat1:sysfork	19879
+cpu_stat:1:cpu_stat1:sysvfork	678
+unix:0:system_misc:boot_time	1500000000
+`
+
+func TestKernelKstat(t *testing.T) {
+	k := &Kernel{kstat: func() ([]byte, error) {
+		return []byte(kstatKernelFixture), nil
+	}}
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(k, &InputConfig{Name: "kernel"}), metricC)
+	if err := k.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+	m, ok := <-metricC
+	if !ok {
+		t.Fatal("expected a metric")
+	}
+	want := map[string]interface{}{
+		"context_switches": int64(2400000),
+		"interrupts":       int64(9600000),
+		"syscalls":         int64(18000000),
+		"processes_forked": int64(42000),
+		"boot_time":        int64(1500000000),
+	}
+	if !reflect.DeepEqual(m.Fields(), want) {
+		t.Errorf("expected %v, got %v", want, m.Fields())
+	}
+	if m.Type() != Counter {
+		t.Errorf("expected a counter, got type %d", m.Type())
+	}
+}
+
+func TestKernelKstatWithoutCPUs(t *testing.T) {
+	if _, err := parseKstatKernel("unix:0:system_misc:boot_time\t1500000000\n"); err == nil {
+		t.Error("expected an error without cpu_stat kstats")
+	}
+}
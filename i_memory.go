@@ -1,17 +1,34 @@
 package main
 
 import (
-	"regexp"
+	"fmt"
+	"os"
 	"os/exec"
 	"strconv"
-	"errors"
-	"time"
 	"strings"
-	"fmt"
+	"time"
 )
 
 type MemStats struct {
 	ps PS
+
+	// kstat returns the output of "kstat -p unix:0:system_pages
+	// unix:0:vminfo", it is replaced in tests
+	kstat func() ([]byte, error)
+	// pagesize returns the size of a memory page in bytes, it is replaced in
+	// tests
+	pagesize func() int
+
+	// lastVminfo holds the vminfo counters of the previous gather, the free
+	// memory is averaged over the time since.
+	lastVminfo vminfo
+}
+
+// vminfo holds the counters of the vminfo kstat that are used: freemem is
+// the sum of the free pages sampled at each of updates, once a second.
+type vminfo struct {
+	freemem uint64
+	updates uint64
 }
 
 func (_ *MemStats) Description() string {
@@ -20,67 +37,96 @@ func (_ *MemStats) Description() string {
 
 func (_ *MemStats) SampleConfig() string { return "" }
 
-var globalZoneMemoryCapacityMatch = regexp.MustCompile(`Memory size: ([\d]+) Megabytes`)
+func kstatSystemPages() ([]byte, error) {
+	return exec.Command("kstat", "-p", "unix:0:system_pages",
+		"unix:0:vminfo").CombinedOutput()
+}
 
-func globalZoneMemoryCapacity() (uint64, error) {
-	prtconf, err := exec.LookPath("/usr/sbin/prtconf")
-	if err != nil {
-		return 0, err
+func (s *MemStats) Gather(acc Accumulator) error {
+	if s.kstat == nil {
+		s.kstat = kstatSystemPages
 	}
-
-	out, err := exec.Command(prtconf).CombinedOutput()
-	if err != nil {
-		return 0, err
+	if s.pagesize == nil {
+		// the runtime gets the page size from sysconf(_SC_PAGESIZE)
+		s.pagesize = os.Getpagesize
 	}
 
-	match := globalZoneMemoryCapacityMatch.FindAllStringSubmatch(string(out), -1)
-	if len(match) != 1 {
-		return 0, errors.New("memory size not contained in output of /usr/sbin/prtconf")
-	}
+	now := time.Now()
 
-	totalMB, err := strconv.ParseUint(match[0][1], 10, 64)
+	output, err := s.kstat()
 	if err != nil {
-		return 0, err
+		return fmt.Errorf("error getting Memory (kstat) info: %s", err.Error())
 	}
 
-	return totalMB * 1024 * 1024, nil
-}
-
-func (s *MemStats) Gather(acc Accumulator) error {
-	now := time.Now()
-
-	total, err := globalZoneMemoryCapacity()
+	pages := parseKstatUnix(string(output))
+	fields, err := memFields(pages, s.lastVminfo, uint64(s.pagesize()))
 	if err != nil {
 		return err
 	}
+	s.lastVminfo = vminfo{
+		freemem: pages["vminfo:freemem"],
+		updates: pages["vminfo:updates"],
+	}
 
-	output, err := exec.Command("vmstat", "-S").CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("error getting Memory info: %s", err.Error())
+	acc.AddCounter("mem", fields, nil, now)
+	return nil
+}
+
+// parseKstatUnix parses the "unix:0:name:statistic value" lines of kstat -p
+// into the values, keyed by "name:statistic".
+func parseKstatUnix(output string) map[string]uint64 {
+	values := make(map[string]uint64)
+	for _, row := range strings.Split(output, "\n") {
+		data := strings.Fields(row)
+		if len(data) != 2 {
+			continue
+		}
+		key := strings.Split(data[0], ":")
+		if len(key) != 4 || key[0] != "unix" {
+			continue
+		}
+		v, err := strconv.ParseUint(data[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[key[2]+":"+key[3]] = v
 	}
+	return values
+}
 
-	stats := string(output)
-	rows := strings.Split(stats, "\n")
-	rows = rows[1:]
-	data := make(map[string]uint64)
-	headers := strings.Fields(rows[0])
-	values := strings.Fields(rows[1])
-	for count := 0; count < len(headers); count++ {
-		v, _ := strconv.ParseUint(values[count], 10, 0)
-		data[headers[count]] = v
+// memFields returns the mem fields of the system_pages and vminfo kstats, as
+// parsed by parseKstatUnix, which count pages, scaled to bytes with
+// pagesize. The total is physmem. The free memory is averaged, like vmstat
+// does, from the vminfo counters since last, the previous ones, or is the
+// current freemem of system_pages on the first gather, or when the vminfo
+// counters have not been updated since.
+func memFields(pages map[string]uint64, last vminfo, pagesize uint64) (map[string]interface{}, error) {
+	physmem, ok := pages["system_pages:physmem"]
+	if !ok || physmem == 0 {
+		return nil, fmt.Errorf("physmem not contained in kstat system_pages output")
+	}
+	freemem, ok := pages["system_pages:freemem"]
+	if !ok {
+		return nil, fmt.Errorf("freemem not contained in kstat system_pages output")
+	}
+	cur := vminfo{freemem: pages["vminfo:freemem"], updates: pages["vminfo:updates"]}
+	if last.updates > 0 && cur.updates > last.updates && cur.freemem >= last.freemem {
+		freemem = (cur.freemem - last.freemem) / (cur.updates - last.updates)
 	}
 
-	free := data["free"] * 1024
+	total := physmem * pagesize
+	free := freemem * pagesize
+	if free > total {
+		free = total
+	}
+	used := total - free
 
-	fields := map[string]interface{}{
+	return map[string]interface{}{
 		"total":             total,
 		"available":         free,
 		"free":              free,
-		"used":              total - free,
-		"available_percent": 100 * float64(free) / float64(total),
-		"used_percent":      100 * float64(total-free) / float64(total),
-	}
-
-	acc.AddCounter("mem", fields, nil, now)
-	return nil
+		"used":              used,
+		"available_percent": percent(free, total),
+		"used_percent":      percent(used, total),
+	}, nil
 }
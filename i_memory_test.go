@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+const kstatMemFixture = `unix:0:system_pages:physmem	262144
+unix:0:system_pages:freemem	65536
+unix:0:vminfo:freemem	%d
+unix:0:vminfo:updates	%d
+`
+
+func TestMemStatsFields(t *testing.T) {
+	samples := []struct {
+		freemem, updates uint64
+		free             uint64 // in pages
+	}{
+		// the first gather has no average, the current freemem is used
+		{1000000, 100, 65536},
+		// 10 updates averaging 32768 free pages
+		{1000000 + 10*32768, 110, 32768},
+		// no update since, the current freemem again
+		{1000000 + 10*32768, 110, 65536},
+	}
+	const pagesize = 8192
+
+	var last vminfo
+	for i, sample := range samples {
+		pages := parseKstatUnix(fmt.Sprintf(kstatMemFixture, sample.freemem, sample.updates))
+		fields, err := memFields(pages, last, pagesize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = vminfo{freemem: sample.freemem, updates: sample.updates}
+
+		total := uint64(262144 * pagesize)
+		free := sample.free * pagesize
+		if fields["total"] != total || fields["free"] != free ||
+			fields["available"] != free || fields["used"] != total-free {
+			t.Errorf("sample %d: unexpected fields %v", i, fields)
+		}
+		if p := fields["used_percent"]; p != percent(total-free, total) {
+			t.Errorf("sample %d: unexpected used_percent %v", i, p)
+		}
+	}
+
+	if _, err := memFields(parseKstatUnix("unix:0:vminfo:updates\t1\n"), vminfo{}, pagesize); err == nil {
+		t.Error("expected an error without system_pages")
+	}
+}
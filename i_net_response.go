@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"net"
 	"net/textproto"
 	"regexp"
@@ -17,6 +18,8 @@ type NetResponse struct {
 	Send        string
 	Expect      string
 	Protocol    string
+
+	expect *regexp.Regexp
 }
 
 func (_ *NetResponse) Description() string {
@@ -41,14 +44,74 @@ var netResponseSampleConfig = `
   ## expect to receive the given 'expect' string back.
   ## string sent to the server
   # send = "ssh"
-  ## expected string in answer
+  ## regular expression expected in the answer
   # expect = "ssh"
+
+  ## The result of the check is reported in the result_code field, with its
+  ## name in the result field:
+  ##   0 success, 1 timeout, 2 connection_failed, 3 read_failed,
+  ##   4 string_mismatch
+  ## The result_type field is kept as it was: 0 for success and 1 for any
+  ## failure for tcp, the name of the result for udp.
 `
 
 func (_ *NetResponse) SampleConfig() string {
 	return netResponseSampleConfig
 }
 
+// Result codes of a check, reported in the result_code field. The result
+// field carries the matching name.
+const (
+	netResponseSuccess = iota
+	netResponseTimeout
+	netResponseConnectionFailed
+	netResponseReadFailed
+	netResponseStringMismatch
+)
+
+var netResponseResultTypes = []string{
+	"success",
+	"timeout",
+	"connection_failed",
+	"read_failed",
+	"string_mismatch",
+}
+
+// setResult sets the result fields of a check. The legacy result_type keeps
+// the type it had for each protocol, an integer for tcp and a string for
+// udp, so that it does not conflict with the fields already written.
+func (n *NetResponse) setResult(fields map[string]interface{}, result int) {
+	fields["result_code"] = result
+	fields["result"] = netResponseResultTypes[result]
+	if n.Protocol == "udp" {
+		fields["result_type"] = netResponseResultTypes[result]
+	} else if result == netResponseSuccess {
+		fields["result_type"] = 0
+	} else {
+		fields["result_type"] = 1
+	}
+}
+
+// netResponseErrResult maps a network error to a result code.
+func netResponseErrResult(err error, failed int) int {
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return netResponseTimeout
+	}
+	return failed
+}
+
+// matchExpect sets the result of a check based on whether the data received
+// from the server matches the expect regex.
+func (n *NetResponse) matchExpect(fields map[string]interface{}, data string) {
+	if n.expect.MatchString(data) {
+		n.setResult(fields, netResponseSuccess)
+		fields["string_found"] = true
+	} else {
+		n.setResult(fields, netResponseStringMismatch)
+		fields["string_found"] = false
+	}
+}
+
 func (n *NetResponse) TcpGather() (map[string]interface{}, error) {
 	// Prepare fields
 	fields := make(map[string]interface{})
@@ -60,11 +123,8 @@ func (n *NetResponse) TcpGather() (map[string]interface{}, error) {
 	responseTime := time.Since(start).Seconds()
 	// Handle error
 	if err != nil {
-		if e, ok := err.(net.Error); ok && e.Timeout() {
-			fields["result_type"] = 1
-		} else {
-			fields["result_type"] = 1
-		}
+		n.setResult(fields,
+			netResponseErrResult(err, netResponseConnectionFailed))
 		return fields, nil
 	}
 	defer conn.Close()
@@ -89,21 +149,14 @@ func (n *NetResponse) TcpGather() (map[string]interface{}, error) {
 		// Handle error
 		if err != nil {
 			fields["string_found"] = false
-			fields["result_type"] = 1
+			n.setResult(fields,
+				netResponseErrResult(err, netResponseReadFailed))
 		} else {
 			// Looking for string in answer
-			RegEx := regexp.MustCompile(`.*` + n.Expect + `.*`)
-			find := RegEx.FindString(string(data))
-			if find != "" {
-				fields["result_type"] = 0
-				fields["string_found"] = true
-			} else {
-				fields["result_type"] = 1
-				fields["string_found"] = false
-			}
+			n.matchExpect(fields, data)
 		}
 	} else {
-		fields["result_type"] = 0
+		n.setResult(fields, netResponseSuccess)
 	}
 	fields["response_time"] = responseTime
 	return fields, nil
@@ -116,12 +169,15 @@ func (n *NetResponse) UdpGather() (map[string]interface{}, error) {
 	start := time.Now()
 	// Resolving
 	udpAddr, err := net.ResolveUDPAddr("udp", n.Address)
-	LocalAddr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		n.setResult(fields, netResponseConnectionFailed)
+		return fields, nil
+	}
 	// Connecting
-	conn, err := net.DialUDP("udp", LocalAddr, udpAddr)
+	conn, err := net.DialUDP("udp", nil, udpAddr)
 	// Handle error
 	if err != nil {
-		fields["result_type"] = "connection_failed"
+		n.setResult(fields, netResponseConnectionFailed)
 		return fields, nil
 	}
 	defer conn.Close()
@@ -133,24 +189,17 @@ func (n *NetResponse) UdpGather() (map[string]interface{}, error) {
 	conn.SetReadDeadline(time.Now().Add(n.ReadTimeout.Duration))
 	// Read
 	buf := make([]byte, 1024)
-	_, _, err = conn.ReadFromUDP(buf)
+	size, _, err := conn.ReadFromUDP(buf)
 	// Stop timer
 	responseTime := time.Since(start).Seconds()
 	// Handle error
 	if err != nil {
-		fields["result_type"] = "read_failed"
+		n.setResult(fields,
+			netResponseErrResult(err, netResponseReadFailed))
 		return fields, nil
 	} else {
 		// Looking for string in answer
-		RegEx := regexp.MustCompile(`.*` + n.Expect + `.*`)
-		find := RegEx.FindString(string(buf))
-		if find != "" {
-			fields["result_type"] = "success"
-			fields["string_found"] = true
-		} else {
-			fields["result_type"] = "string_mismatch"
-			fields["string_found"] = false
-		}
+		n.matchExpect(fields, string(buf[:size]))
 	}
 	fields["response_time"] = responseTime
 	return fields, nil
@@ -171,6 +220,15 @@ func (n *NetResponse) Gather(acc Accumulator) error {
 	if n.Protocol == "udp" && n.Expect == "" {
 		return errors.New("Expected string cannot be empty")
 	}
+	// The expect string is a regular expression matched against the first
+	// line of the answer
+	if n.Expect != "" && (n.expect == nil || n.expect.String() != n.Expect) {
+		expect, err := regexp.Compile(n.Expect)
+		if err != nil {
+			return fmt.Errorf("Invalid expect regex %q: %s", n.Expect, err)
+		}
+		n.expect = expect
+	}
 	// Prepare host and port
 	host, port, err := net.SplitHostPort(n.Address)
 	if err != nil {
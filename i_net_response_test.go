@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func gatherNetResponse(t *testing.T, n *NetResponse) map[string]interface{} {
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(n, &InputConfig{Name: "net_response"}), metricC)
+	if err := n.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+	m, ok := <-metricC
+	if !ok {
+		t.Fatal("expected a metric")
+	}
+	return m.Fields()
+}
+
+func TestNetResponseResultFields(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-test\n"))
+			conn.Close()
+		}
+	}()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	timeout := Duration{Duration: time.Second}
+	tests := []struct {
+		n          *NetResponse
+		code       int
+		result     string
+		resultType interface{}
+	}{
+		{&NetResponse{Protocol: "tcp", Address: l.Addr().String(), Expect: "SSH"},
+			netResponseSuccess, "success", int64(0)},
+		{&NetResponse{Protocol: "tcp", Address: l.Addr().String(), Expect: "HTTP"},
+			netResponseStringMismatch, "string_mismatch", int64(1)},
+		{&NetResponse{Protocol: "udp", Address: pc.LocalAddr().String(),
+			Send: "ping", Expect: "ping"},
+			netResponseSuccess, "success", "success"},
+		{&NetResponse{Protocol: "udp", Address: pc.LocalAddr().String(),
+			Send: "ping", Expect: "pong"},
+			netResponseStringMismatch, "string_mismatch", "string_mismatch"},
+	}
+	for _, tt := range tests {
+		tt.n.Timeout, tt.n.ReadTimeout = timeout, timeout
+		fields := gatherNetResponse(t, tt.n)
+		if fields["result_code"] != int64(tt.code) || fields["result"] != tt.result {
+			t.Errorf("%s %s: expected the result %d %s, got %v %v", tt.n.Protocol,
+				tt.n.Expect, tt.code, tt.result, fields["result_code"], fields["result"])
+		}
+		if fields["result_type"] != tt.resultType {
+			t.Errorf("%s %s: expected the result_type %#v, got %#v", tt.n.Protocol,
+				tt.n.Expect, tt.resultType, fields["result_type"])
+		}
+	}
+}
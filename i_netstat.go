@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// netstatStatRe matches a counter of 'netstat -s', ie, "tcpActiveOpens = 1025".
+var netstatStatRe = regexp.MustCompile(`(\w+)\s*=\s*(-?\d+)`)
+
+// netstatTCPStates are the TCP connection states of Solaris, as 'netstat -an'
+// names them.
+var netstatTCPStates = []string{
+	"CLOSED", "IDLE", "BOUND", "LISTEN", "SYN_SENT", "SYN_RCVD",
+	"ESTABLISHED", "CLOSE_WAIT", "FIN_WAIT_1", "CLOSING", "LAST_ACK",
+	"FIN_WAIT_2", "TIME_WAIT",
+}
+
+// NetStat reports the per-protocol counters of 'netstat -s' and the number of
+// TCP connections in each state and of UDP sockets from 'netstat -an'.
+type NetStat struct {
+	// run runs a command and returns its output, it is replaced in tests
+	run func(name string, args ...string) ([]byte, error)
+}
+
+func (_ *NetStat) Description() string {
+	return "Read TCP, UDP and IP counters and TCP connection states from netstat"
+}
+
+func (_ *NetStat) SampleConfig() string { return "" }
+
+func (n *NetStat) Gather(acc Accumulator) error {
+	if n.run == nil {
+		n.run = runCommand
+	}
+
+	output, err := n.run("netstat", "-s")
+	if err != nil {
+		return fmt.Errorf("error getting netstat protocol stats: %s", err)
+	}
+	for protocol, fields := range parseNetstatStats(string(output)) {
+		tags := map[string]string{"protocol": protocol}
+		acc.AddCounter("netstat_stats", fields, tags)
+	}
+
+	output, err = n.run("netstat", "-an")
+	if err != nil {
+		return fmt.Errorf("error getting netstat connections: %s", err)
+	}
+	acc.AddGauge("netstat", parseNetstatConnections(string(output)), nil)
+	return nil
+}
+
+// parseNetstatStats parses the output of the Solaris 'netstat -s', which
+// lists the counters of each protocol in two columns, the first line of a
+// protocol starting with its name, ie:
+//
+//     TCP     tcpRtoAlgorithm     =     4     tcpRtoMin           =   400
+//             tcpActiveOpens      =  1025     tcpPassiveOpens     =    20
+//
+// The counters are returned by lower-cased protocol, in snake case, ie,
+// tcp_active_opens. Sections without counters, such as IGMP, are skipped.
+func parseNetstatStats(output string) map[string]map[string]interface{} {
+	stats := make(map[string]map[string]interface{})
+	var protocol string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			protocol = strings.ToLower(strings.TrimSuffix(strings.Fields(line)[0], ":"))
+		}
+		if protocol == "" {
+			continue
+		}
+
+		for _, match := range netstatStatRe.FindAllStringSubmatch(line, -1) {
+			v, err := strconv.ParseInt(match[2], 10, 64)
+			if err != nil {
+				continue
+			}
+			fields, ok := stats[protocol]
+			if !ok {
+				fields = make(map[string]interface{})
+				stats[protocol] = fields
+			}
+			fields[SnakeCase(match[1])] = v
+		}
+	}
+	return stats
+}
+
+// parseNetstatConnections counts the TCP connections by state and the UDP
+// sockets in the output of the Solaris 'netstat -an', which lists the
+// sockets in sections headed by their protocol, ie:
+//
+//     TCP: IPv4
+//        Local Address        Remote Address    Swind Send-Q Rwind Recv-Q    State
+//     -------------------- -------------------- ----- ------ ----- ------ -----------
+//     10.0.0.5.22          10.0.0.1.51234       64128      0 128872      0 ESTABLISHED
+//
+// The state is not always the last column, IPv6 sockets are followed by
+// their interface, so it is looked up among the words of the line.
+func parseNetstatConnections(output string) map[string]interface{} {
+	fields := map[string]interface{}{"udp_socket": int64(0)}
+	states := make(map[string]bool, len(netstatTCPStates))
+	for _, state := range netstatTCPStates {
+		fields["tcp_"+strings.ToLower(state)] = int64(0)
+		states[state] = true
+	}
+
+	var section string
+	for _, line := range strings.Split(output, "\n") {
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' && strings.HasSuffix(words[0], ":") {
+			section = strings.TrimSuffix(words[0], ":")
+			continue
+		}
+		if strings.HasPrefix(line, "Active UNIX domain sockets") {
+			break
+		}
+		// skip the column names and their underlines
+		if words[0] == "Local" || strings.HasPrefix(words[0], "---") {
+			continue
+		}
+
+		switch section {
+		case "TCP":
+			for _, w := range words[1:] {
+				if states[w] {
+					key := "tcp_" + strings.ToLower(w)
+					fields[key] = fields[key].(int64) + 1
+					break
+				}
+			}
+		case "UDP":
+			fields["udp_socket"] = fields["udp_socket"].(int64) + 1
+		}
+	}
+	return fields
+}
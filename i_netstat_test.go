@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+)
+
+const netstatConnectionsFixture = `
+UDP: IPv4
+   Local Address        Remote Address      State
+-------------------- -------------------- ----------
+      *.123                                 Idle
+      *.514                                 Idle
+
+TCP: IPv4
+   Local Address        Remote Address    Swind Send-Q Rwind Recv-Q    State
+-------------------- -------------------- ----- ------ ----- ------ -----------
+      *.22                 *.*                0      0 128000      0 LISTEN
+10.0.0.5.22          10.0.0.1.51234       64128      0 128872      0 ESTABLISHED
+10.0.0.5.22          10.0.0.2.51300       64128      0 128872      0 SYN_RCVD
+10.0.0.5.22          10.0.0.3.51301       64128      0 128872      0 SYN_RCVD
+
+TCP: IPv6
+   Local Address                     Remote Address                 Swind Send-Q Rwind Recv-Q   State      If
+--------------------------------- --------------------------------- ----- ------ ----- ------ ----------- -----
+::1.25                            ::1.40000                          49152      0 49152      0 TIME_WAIT
+
+Active UNIX domain sockets
+Address  Type          Vnode     Conn  Local Addr      Remote Addr
+30000a1e8 stream-ord 00000000 00000000
+`
+
+func TestParseNetstatConnections(t *testing.T) {
+	fields := parseNetstatConnections(netstatConnectionsFixture)
+	want := map[string]int64{
+		"udp_socket":      2,
+		"tcp_listen":      1,
+		"tcp_established": 1,
+		"tcp_syn_rcvd":    2,
+		"tcp_time_wait":   1,
+		"tcp_closed":      0,
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("expected %s %d, got %v", k, v, fields[k])
+		}
+	}
+	if _, ok := fields["tcp_syn_received"]; ok {
+		t.Error("unexpected tcp_syn_received field")
+	}
+}
@@ -47,6 +47,8 @@ func (_ *Ping) Description() string {
 const pingSampleConfig = `
   ## NOTE: this plugin forks the ping command. You may need to set capabilities
   ## via setcap cap_net_raw+p /bin/ping
+  ## On Solaris /usr/sbin/ping -s is used; the timeout then bounds the whole
+  ## run instead of each ping.
   #
   ## List of urls to ping
   urls = ["www.google.com"] # required
@@ -146,9 +148,13 @@ func (p *Ping) Gather(acc Accumulator) error {
 }
 
 func hostPinger(timeout float64, args ...string) (string, error) {
-	bin, err := exec.LookPath("ping")
-	if err != nil {
-		return "", err
+	// /usr/sbin is often not in the PATH of a Solaris service
+	bin := solarisPing
+	if runtime.GOOS != "solaris" {
+		var err error
+		if bin, err = exec.LookPath("ping"); err != nil {
+			return "", err
+		}
 	}
 	c := exec.Command(bin, args...)
 	out, err := CombinedOutputTimeout(c,
@@ -156,8 +162,15 @@ func hostPinger(timeout float64, args ...string) (string, error) {
 	return string(out), err
 }
 
+// solarisPing is the ping executable of Solaris.
+const solarisPing = "/usr/sbin/ping"
+
 // args returns the arguments for the 'ping' executable
 func (p *Ping) args(url string) []string {
+	if runtime.GOOS == "solaris" {
+		return p.solarisArgs(url)
+	}
+
 	// Build the ping command args based on toml config
 	args := []string{"-c", strconv.Itoa(p.Count), "-n", "-s", "16"}
 	if p.PingInterval > 0 {
@@ -181,6 +194,21 @@ func (p *Ping) args(url string) []string {
 	return args
 }
 
+// solarisArgs returns the arguments for the Solaris 'ping', which takes the
+// packet size and count after the host, ie, 'ping -s -n host 16 3'. It has
+// no per-packet timeout in statistics mode, the timeout only bounds how long
+// the whole command may run.
+func (p *Ping) solarisArgs(url string) []string {
+	args := []string{"-s", "-n"}
+	if p.PingInterval > 0 {
+		args = append(args, "-I", strconv.FormatFloat(p.PingInterval, 'f', 1, 64))
+	}
+	if p.Interface != "" {
+		args = append(args, "-i", p.Interface)
+	}
+	return append(args, url, "16", strconv.Itoa(p.Count))
+}
+
 // processPingOutput takes in a string output from the ping command, like:
 //
 //     PING www.google.com (173.194.115.84): 56 data bytes
@@ -191,6 +219,16 @@ func (p *Ping) args(url string) []string {
 //     2 packets transmitted, 2 packets received, 0.0% packet loss
 //     round-trip min/avg/max/stddev = 34.843/43.508/52.172/8.664 ms
 //
+// or, from the Solaris 'ping -s':
+//
+//     PING www.google.com: 16 data bytes
+//     24 bytes from 173.194.115.84: icmp_seq=0. time=52.172 ms
+//     24 bytes from 173.194.115.84: icmp_seq=1. time=34.843 ms
+//
+//     ----www.google.com PING Statistics----
+//     2 packets transmitted, 2 packets received, 0% packet loss
+//     round-trip (ms)  min/avg/max/stddev = 34.843/43.508/52.172/12.254
+//
 // It returns (<transmitted packets>, <received packets>, <average response>)
 func processPingOutput(out string) (int, int, float64, float64, float64, float64, error) {
 	var trans, recv int
@@ -213,23 +251,37 @@ func processPingOutput(out string) (int, int, float64, float64, float64, float64
 				return trans, recv, min, avg, max, stddev, err
 			}
 		} else if strings.Contains(line, "min/avg/max") {
-			stats := strings.Split(line, " ")[3]
-			min, err = strconv.ParseFloat(strings.Split(stats, "/")[0], 64)
-			if err != nil {
-				return trans, recv, min, avg, max, stddev, err
+			// the statistics are the first word after the "="
+			eq := strings.Index(line, "=")
+			if eq < 0 {
+				continue
 			}
-			avg, err = strconv.ParseFloat(strings.Split(stats, "/")[1], 64)
+			words := strings.Fields(line[eq+1:])
+			if len(words) == 0 {
+				continue
+			}
+			stats := strings.Split(words[0], "/")
+			if len(stats) < 3 {
+				continue
+			}
+			min, err = strconv.ParseFloat(stats[0], 64)
 			if err != nil {
 				return trans, recv, min, avg, max, stddev, err
 			}
-			max, err = strconv.ParseFloat(strings.Split(stats, "/")[2], 64)
+			avg, err = strconv.ParseFloat(stats[1], 64)
 			if err != nil {
 				return trans, recv, min, avg, max, stddev, err
 			}
-			stddev, err = strconv.ParseFloat(strings.Split(stats, "/")[3], 64)
+			max, err = strconv.ParseFloat(stats[2], 64)
 			if err != nil {
 				return trans, recv, min, avg, max, stddev, err
 			}
+			if len(stats) > 3 {
+				stddev, err = strconv.ParseFloat(stats[3], 64)
+				if err != nil {
+					return trans, recv, min, avg, max, stddev, err
+				}
+			}
 		}
 	}
 	return trans, recv, min, avg, max, stddev, err
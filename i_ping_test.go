@@ -0,0 +1,87 @@
+// +build !windows
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// solarisPingOutput is the output of "ping -s -n www.example.com 16 3".
+const solarisPingOutput = `PING www.example.com: 16 data bytes
+24 bytes from 93.184.216.34: icmp_seq=0. time=88.412 ms
+24 bytes from 93.184.216.34: icmp_seq=1. time=87.903 ms
+24 bytes from 93.184.216.34: icmp_seq=2. time=90.121 ms
+
+----www.example.com PING Statistics----
+3 packets transmitted, 3 packets received, 0% packet loss
+round-trip (ms)  min/avg/max/stddev = 87.903/88.812/90.121/1.162
+`
+
+// solarisPingLossOutput is the output of a ping that lost a packet.
+const solarisPingLossOutput = `PING db01: 16 data bytes
+24 bytes from 10.0.0.5: icmp_seq=0. time=0.412 ms
+24 bytes from 10.0.0.5: icmp_seq=2. time=0.398 ms
+
+----db01 PING Statistics----
+4 packets transmitted, 2 packets received, 50% packet loss
+round-trip (ms)  min/avg/max/stddev = 0.398/0.405/0.412/0.010
+`
+
+func TestProcessSolarisPingOutput(t *testing.T) {
+	trans, recv, min, avg, max, stddev, err := processPingOutput(solarisPingOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []float64{float64(trans), float64(recv), min, avg, max, stddev}
+	want := []float64{3, 3, 87.903, 88.812, 90.121, 1.162}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if _, _, _, _, _, _, err := processPingOutput("ping: unknown host nowhere\n"); err == nil {
+		t.Error("expected an error for an output without statistics")
+	}
+}
+
+func TestSolarisPingArgs(t *testing.T) {
+	p := &Ping{Count: 3, PingInterval: 2, Interface: "net0"}
+	want := []string{"-s", "-n", "-I", "2.0", "-i", "net0", "www.example.com", "16", "3"}
+	if args := p.solarisArgs("www.example.com"); !reflect.DeepEqual(args, want) {
+		t.Errorf("expected the arguments %v, got %v", want, args)
+	}
+}
+
+func TestPingGatherPacketLoss(t *testing.T) {
+	p := &Ping{Count: 4, Urls: []string{"localhost"}}
+	p.pingHost = func(timeout float64, args ...string) (string, error) {
+		return solarisPingLossOutput, nil
+	}
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(p, &InputConfig{Name: "ping"}), metricC)
+	if err := p.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+	m, ok := <-metricC
+	if !ok {
+		t.Fatal("expected a metric")
+	}
+	fields := m.Fields()
+	want := map[string]interface{}{
+		"result_code":           int64(0),
+		"packets_transmitted":   int64(4),
+		"packets_received":      int64(2),
+		"percent_packet_loss":   50.0,
+		"minimum_response_ms":   0.398,
+		"average_response_ms":   0.405,
+		"maximum_response_ms":   0.412,
+		"standard_deviation_ms": 0.01,
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("expected %v, got %v", want, fields)
+	}
+	if url := m.Tags()["url"]; url != "localhost" {
+		t.Errorf("expected the url tag localhost, got %s", url)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Offsets in the 64-bit psinfo_t and prusage_t of <sys/procfs.h>.
+const (
+	psinfoNlwp   = 4
+	psinfoPid    = 8
+	psinfoRssize = 56
+	psinfoPctcpu = 80
+	psinfoStart  = 88
+	psinfoFname  = 136
+	psinfoPsargs = 152
+	psinfoSize   = 232
+
+	prusageUtime = 72
+	prusageStime = 88
+	prusageSize  = 104
+)
+
+// psinfo is the part of /proc/<pid>/psinfo reported by procstat.
+type psinfo struct {
+	pid    int64
+	nlwp   int64
+	rssize uint64 // in kilobytes
+	pctcpu float64
+	start  time.Time
+	fname  string
+	psargs string
+}
+
+// prusage is the part of /proc/<pid>/usage reported by procstat.
+type prusage struct {
+	utime time.Duration
+	stime time.Duration
+}
+
+// Procstat reports the resource usage of the processes matching an
+// executable name, a command line pattern, a pid file or an SMF service.
+type Procstat struct {
+	Exe     string
+	Pattern string
+	PidFile string `toml:"pid_file"`
+	FMRI    string `toml:"fmri"`
+
+	exeRe     *regexp.Regexp
+	patternRe *regexp.Regexp
+
+	// procDir is the root of the process file system, it is replaced in
+	// tests
+	procDir string
+	// run runs a command and returns its output, it is replaced in tests
+	run func(name string, args ...string) ([]byte, error)
+}
+
+var procstatSampleConfig = `
+  ## Set exactly one way of finding the processes:
+  ## a regular expression matching the executable name, ie, "^sshd$",
+  # exe = "^sshd$"
+  ## a regular expression matching the command line, with its arguments,
+  # pattern = "java .*catalina"
+  ## a file holding the pid of the process,
+  # pid_file = "/var/run/nginx.pid"
+  ## or the FMRI of an SMF service, for all of its processes.
+  # fmri = "svc:/network/ssh:default"
+`
+
+func (_ *Procstat) Description() string {
+	return "Monitor the resource usage of specific processes"
+}
+
+func (_ *Procstat) SampleConfig() string {
+	return procstatSampleConfig
+}
+
+func (p *Procstat) Gather(acc Accumulator) error {
+	if p.procDir == "" {
+		p.procDir = "/proc"
+	}
+	if p.run == nil {
+		p.run = runCommand
+	}
+
+	pids, tags, err := p.findPids()
+	if err != nil {
+		return err
+	}
+
+	order := nativeByteOrder()
+	now := time.Now()
+	for _, pid := range pids {
+		dir := filepath.Join(p.procDir, strconv.FormatInt(pid, 10))
+		b, err := ioutil.ReadFile(filepath.Join(dir, "psinfo"))
+		if err != nil {
+			// the process exited since it was found
+			log.Printf("D! procstat: skipping pid %d: %s", pid, err)
+			continue
+		}
+		info, err := parsePsinfo(b, order)
+		if err != nil {
+			acc.AddError(fmt.Errorf("pid %d: %s", pid, err))
+			continue
+		}
+
+		fields := map[string]interface{}{
+			"cpu_usage":   info.pctcpu,
+			"memory_rss":  int64(info.rssize * 1024),
+			"num_threads": info.nlwp,
+			"uptime":      int64(now.Sub(info.start) / time.Second),
+		}
+		if b, err := ioutil.ReadFile(filepath.Join(dir, "usage")); err == nil {
+			if usage, err := parsePrusage(b, order); err == nil {
+				fields["cpu_time_user"] = usage.utime.Seconds()
+				fields["cpu_time_system"] = usage.stime.Seconds()
+			}
+		}
+		// only readable for the processes of the same user, or by root
+		if fds, err := ioutil.ReadDir(filepath.Join(dir, "fd")); err == nil {
+			fields["num_fds"] = int64(len(fds))
+		}
+
+		ptags := map[string]string{
+			"pid":          strconv.FormatInt(pid, 10),
+			"process_name": info.fname,
+		}
+		for k, v := range tags {
+			ptags[k] = v
+		}
+		acc.AddGauge("procstat", fields, ptags, now)
+	}
+	return nil
+}
+
+// findPids returns the pids of the processes to report, and the tags naming
+// how they were found.
+func (p *Procstat) findPids() ([]int64, map[string]string, error) {
+	set := 0
+	for _, v := range []string{p.Exe, p.Pattern, p.PidFile, p.FMRI} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, nil, fmt.Errorf("exactly one of exe, pattern, pid_file or fmri must be set")
+	}
+
+	switch {
+	case p.PidFile != "":
+		b, err := ioutil.ReadFile(p.PidFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot read pid file: %s", err)
+		}
+		pid, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid pid file %s: %s", p.PidFile, err)
+		}
+		return []int64{pid}, map[string]string{"pid_file": p.PidFile}, nil
+	case p.FMRI != "":
+		output, err := p.run("svcs", "-H", "-p", p.FMRI)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error listing the processes of %s: %s", p.FMRI, err)
+		}
+		return parseSvcsProcesses(string(output)), map[string]string{"fmri": p.FMRI}, nil
+	}
+
+	var err error
+	if p.Exe != "" && p.exeRe == nil {
+		if p.exeRe, err = regexp.Compile(p.Exe); err != nil {
+			return nil, nil, fmt.Errorf("invalid exe: %s", err)
+		}
+	}
+	if p.Pattern != "" && p.patternRe == nil {
+		if p.patternRe, err = regexp.Compile(p.Pattern); err != nil {
+			return nil, nil, fmt.Errorf("invalid pattern: %s", err)
+		}
+	}
+	pids, err := p.matchProcesses()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.Exe != "" {
+		return pids, map[string]string{"exe": p.Exe}, nil
+	}
+	return pids, map[string]string{"pattern": p.Pattern}, nil
+}
+
+// matchProcesses returns the pids of the processes whose executable name
+// matches exe, or whose command line matches pattern.
+func (p *Procstat) matchProcesses() ([]int64, error) {
+	dirs, err := ioutil.ReadDir(p.procDir)
+	if err != nil {
+		return nil, err
+	}
+	order := nativeByteOrder()
+	var pids []int64
+	for _, d := range dirs {
+		pid, err := strconv.ParseInt(d.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(p.procDir, d.Name(), "psinfo"))
+		if err != nil {
+			continue
+		}
+		info, err := parsePsinfo(b, order)
+		if err != nil {
+			continue
+		}
+		if p.exeRe != nil && p.exeRe.MatchString(info.fname) ||
+			p.patternRe != nil && p.patternRe.MatchString(info.psargs) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// parseSvcsProcesses returns the pids listed by 'svcs -H -p', ie:
+//
+//     online         Jan_01   svc:/network/ssh:default
+//                    Jan_01       1234 sshd
+//                  12:30:01       5678 sshd
+func parseSvcsProcesses(output string) []int64 {
+	var pids []int64
+	for _, line := range strings.Split(output, "\n") {
+		words := strings.Fields(line)
+		if len(words) != 3 {
+			continue
+		}
+		if pid, err := strconv.ParseInt(words[1], 10, 64); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// parsePsinfo decodes a 64-bit psinfo_t. pr_pctcpu is a binary fraction of
+// 0x8000, which is 100% of a CPU.
+func parsePsinfo(b []byte, order binary.ByteOrder) (psinfo, error) {
+	if len(b) < psinfoSize {
+		return psinfo{}, fmt.Errorf("psinfo of %d bytes is too short", len(b))
+	}
+	return psinfo{
+		pid:    int64(int32(order.Uint32(b[psinfoPid:]))),
+		nlwp:   int64(int32(order.Uint32(b[psinfoNlwp:]))),
+		rssize: order.Uint64(b[psinfoRssize:]),
+		pctcpu: float64(order.Uint16(b[psinfoPctcpu:])) * 100 / 0x8000,
+		start:  procTimestruc(b[psinfoStart:], order),
+		fname:  cString(b[psinfoFname : psinfoFname+16]),
+		psargs: cString(b[psinfoPsargs : psinfoPsargs+80]),
+	}, nil
+}
+
+// parsePrusage decodes the user and system CPU times of a 64-bit
+// prusage_t.
+func parsePrusage(b []byte, order binary.ByteOrder) (prusage, error) {
+	if len(b) < prusageSize {
+		return prusage{}, fmt.Errorf("usage of %d bytes is too short", len(b))
+	}
+	return prusage{
+		utime: procTimestruc(b[prusageUtime:], order).Sub(time.Unix(0, 0)),
+		stime: procTimestruc(b[prusageStime:], order).Sub(time.Unix(0, 0)),
+	}, nil
+}
+
+// procTimestruc decodes a 64-bit timestruc_t, seconds then nanoseconds.
+func procTimestruc(b []byte, order binary.ByteOrder) time.Time {
+	return time.Unix(int64(order.Uint64(b)), int64(order.Uint64(b[8:])))
+}
+
+// cString returns the NUL-terminated string at the start of b.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// nativeByteOrder is the byte order of the /proc structures, that of the
+// kernel: big endian on SPARC, little endian on x86.
+func nativeByteOrder() binary.ByteOrder {
+	if strings.HasPrefix(runtime.GOARCH, "sparc") {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
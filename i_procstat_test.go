@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// psinfoFixture returns a 64-bit psinfo_t in the byte order order.
+func psinfoFixture(order binary.ByteOrder, pid, nlwp int32, rssize uint64,
+	pctcpu uint16, start time.Time, fname, psargs string) []byte {
+	b := make([]byte, psinfoSize)
+	order.PutUint32(b[psinfoNlwp:], uint32(nlwp))
+	order.PutUint32(b[psinfoPid:], uint32(pid))
+	order.PutUint64(b[psinfoRssize:], rssize)
+	order.PutUint16(b[psinfoPctcpu:], pctcpu)
+	order.PutUint64(b[psinfoStart:], uint64(start.Unix()))
+	order.PutUint64(b[psinfoStart+8:], uint64(start.Nanosecond()))
+	copy(b[psinfoFname:psinfoFname+16], fname)
+	copy(b[psinfoPsargs:psinfoPsargs+80], psargs)
+	return b
+}
+
+// prusageFixture returns a 64-bit prusage_t in the byte order order.
+func prusageFixture(order binary.ByteOrder, utime, stime time.Duration) []byte {
+	b := make([]byte, prusageSize)
+	order.PutUint64(b[prusageUtime:], uint64(utime/time.Second))
+	order.PutUint64(b[prusageUtime+8:], uint64(utime%time.Second))
+	order.PutUint64(b[prusageStime:], uint64(stime/time.Second))
+	order.PutUint64(b[prusageStime+8:], uint64(stime%time.Second))
+	return b
+}
+
+func TestParsePsinfo(t *testing.T) {
+	start := time.Unix(1500000000, 250000000)
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		b := psinfoFixture(order, 1234, 7, 2048, 0x4000, start,
+			"sshd", "/usr/lib/ssh/sshd -D")
+		info, err := parsePsinfo(b, order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := psinfo{
+			pid:    1234,
+			nlwp:   7,
+			rssize: 2048,
+			pctcpu: 50,
+			start:  start,
+			fname:  "sshd",
+			psargs: "/usr/lib/ssh/sshd -D",
+		}
+		if info != want {
+			t.Errorf("%s: expected %+v, got %+v", order, want, info)
+		}
+	}
+
+	if _, err := parsePsinfo(make([]byte, psinfoSize-1), binary.LittleEndian); err == nil {
+		t.Error("expected an error for a short psinfo")
+	}
+}
+
+func TestParsePrusage(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		b := prusageFixture(order, 3500*time.Millisecond, 1250*time.Millisecond)
+		usage, err := parsePrusage(b, order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if usage.utime != 3500*time.Millisecond || usage.stime != 1250*time.Millisecond {
+			t.Errorf("%s: unexpected usage %+v", order, usage)
+		}
+	}
+
+	if _, err := parsePrusage(make([]byte, prusageSize-1), binary.LittleEndian); err == nil {
+		t.Error("expected an error for a short usage")
+	}
+}
+
+func TestParseSvcsProcesses(t *testing.T) {
+	output := "online         Jan_01   svc:/network/ssh:default\n" +
+		"               Jan_01       1234 sshd\n" +
+		"             12:30:01       5678 sshd\n"
+	pids := parseSvcsProcesses(output)
+	if len(pids) != 2 || pids[0] != 1234 || pids[1] != 5678 {
+		t.Errorf("expected the pids 1234 and 5678, got %v", pids)
+	}
+}
+
+// procstatFixture writes the psinfo and usage of processes into a
+// temporary proc directory, and returns it.
+func procstatFixture(t *testing.T, procs map[int32][2]string) string {
+	dir, err := ioutil.TempDir("", "procstat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := nativeByteOrder()
+	start := time.Now().Add(-time.Hour)
+	for pid, names := range procs {
+		pdir := filepath.Join(dir, strconv.Itoa(int(pid)))
+		if err := os.MkdirAll(filepath.Join(pdir, "fd"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		psinfo := psinfoFixture(order, pid, 2, 1024, 0x8000, start, names[0], names[1])
+		usage := prusageFixture(order, 2*time.Second, time.Second)
+		if err := ioutil.WriteFile(filepath.Join(pdir, "psinfo"), psinfo, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(pdir, "usage"), usage, 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, fd := range []string{"0", "1", "2"} {
+			if err := ioutil.WriteFile(filepath.Join(pdir, "fd", fd), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return dir
+}
+
+func gatherProcstat(t *testing.T, p *Procstat) []Metric {
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(p, &InputConfig{Name: "procstat"}), metricC)
+	if err := p.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+	var metrics []Metric
+	for m := range metricC {
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func TestProcstatMatchesSeveralProcesses(t *testing.T) {
+	dir := procstatFixture(t, map[int32][2]string{
+		100: {"sshd", "/usr/lib/ssh/sshd"},
+		200: {"sshd", "/usr/lib/ssh/sshd -R"},
+		300: {"java", "java -jar catalina.jar"},
+	})
+	defer os.RemoveAll(dir)
+
+	p := &Procstat{Exe: "^sshd$", procDir: dir}
+	metrics := gatherProcstat(t, p)
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 metrics, got %d", len(metrics))
+	}
+	pids := map[string]bool{}
+	for _, m := range metrics {
+		tags := m.Tags()
+		pids[tags["pid"]] = true
+		if tags["process_name"] != "sshd" || tags["exe"] != "^sshd$" {
+			t.Errorf("unexpected tags %v", tags)
+		}
+		fields := m.Fields()
+		want := map[string]interface{}{
+			"cpu_usage":       100.0,
+			"memory_rss":      int64(1024 * 1024),
+			"num_threads":     int64(2),
+			"num_fds":         int64(3),
+			"cpu_time_user":   2.0,
+			"cpu_time_system": 1.0,
+		}
+		for k, v := range want {
+			if fields[k] != v {
+				t.Errorf("expected %s %v, got %v", k, v, fields[k])
+			}
+		}
+		if up, _ := fields["uptime"].(int64); up < 3599 || up > 3601 {
+			t.Errorf("expected an uptime of an hour, got %v", fields["uptime"])
+		}
+	}
+	if !pids["100"] || !pids["200"] {
+		t.Errorf("expected the pids 100 and 200, got %v", pids)
+	}
+
+	p = &Procstat{Pattern: "catalina", procDir: dir}
+	metrics = gatherProcstat(t, p)
+	if len(metrics) != 1 || metrics[0].Tags()["pid"] != "300" {
+		t.Errorf("expected the pid 300, got %v", metrics)
+	}
+}
+
+func TestProcstatPidFile(t *testing.T) {
+	dir := procstatFixture(t, map[int32][2]string{
+		100: {"nginx", "nginx: master process"},
+	})
+	defer os.RemoveAll(dir)
+	pidFile := filepath.Join(dir, "nginx.pid")
+	if err := ioutil.WriteFile(pidFile, []byte("100\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Procstat{PidFile: pidFile, procDir: dir}
+	metrics := gatherProcstat(t, p)
+	if len(metrics) != 1 {
+		t.Fatalf("expected 1 metric, got %d", len(metrics))
+	}
+	tags := metrics[0].Tags()
+	if tags["pid"] != "100" || tags["process_name"] != "nginx" || tags["pid_file"] != pidFile {
+		t.Errorf("unexpected tags %v", tags)
+	}
+}
+
+func TestProcstatFMRI(t *testing.T) {
+	dir := procstatFixture(t, map[int32][2]string{
+		100: {"sshd", "/usr/lib/ssh/sshd"},
+	})
+	defer os.RemoveAll(dir)
+
+	p := &Procstat{FMRI: "svc:/network/ssh:default", procDir: dir}
+	p.run = func(name string, args ...string) ([]byte, error) {
+		return []byte("online         Jan_01   svc:/network/ssh:default\n" +
+			"               Jan_01        100 sshd\n" +
+			"               Jan_01        101 sshd\n"), nil
+	}
+	// 101 has exited, it is skipped
+	metrics := gatherProcstat(t, p)
+	if len(metrics) != 1 || metrics[0].Tags()["fmri"] != p.FMRI {
+		t.Errorf("expected a metric of the fmri, got %v", metrics)
+	}
+}
+
+func TestProcstatNeedsOneSelector(t *testing.T) {
+	for _, p := range []*Procstat{
+		{},
+		{Exe: "sshd", Pattern: "sshd"},
+	} {
+		p.procDir = os.TempDir()
+		acc := NewAccumulator(NewRunningInput(p, &InputConfig{Name: "procstat"}),
+			make(chan Metric, 10))
+		if err := p.Gather(acc); err == nil {
+			t.Errorf("%+v: expected an error", p)
+		}
+	}
+}
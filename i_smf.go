@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// smfStateCodes are the numeric codes of the SMF service states, from
+// healthy to not running.
+var smfStateCodes = map[string]int64{
+	"online":        0,
+	"legacy_run":    1,
+	"degraded":      2,
+	"offline":       3,
+	"maintenance":   4,
+	"disabled":      5,
+	"uninitialized": 6,
+}
+
+// SMF reports the state of the services of the Solaris Service Management
+// Facility.
+type SMF struct {
+	Include []string
+	Exclude []string
+
+	include Filter
+	exclude Filter
+
+	// run runs a command and returns its output, it is replaced in tests
+	run func(name string, args ...string) ([]byte, error)
+}
+
+// smfService is a service as listed by svcs.
+type smfService struct {
+	fmri  string
+	state string
+	// transitioning is set for a service that is moving to another state,
+	// marked with a "*" by svcs.
+	transitioning bool
+}
+
+const smfSampleConfig = `
+  ## FMRIs of the services to report, all by default. "*" matches any
+  ## characters, ie, "svc:/network/*".
+  # include = []
+  ## FMRIs of the services not to report.
+  # exclude = ["lrc:/*"]
+`
+
+func (_ *SMF) Description() string {
+	return "Read the state of the SMF services"
+}
+
+func (_ *SMF) SampleConfig() string {
+	return smfSampleConfig
+}
+
+func (s *SMF) compileFilters() error {
+	if s.include == nil && len(s.Include) > 0 {
+		include, err := CompileFilter(s.Include)
+		if err != nil {
+			return fmt.Errorf("invalid include pattern: %s", err)
+		}
+		s.include = include
+	}
+	if s.exclude == nil && len(s.Exclude) > 0 {
+		exclude, err := CompileFilter(s.Exclude)
+		if err != nil {
+			return fmt.Errorf("invalid exclude pattern: %s", err)
+		}
+		s.exclude = exclude
+	}
+	return nil
+}
+
+func (s *SMF) Gather(acc Accumulator) error {
+	if s.run == nil {
+		s.run = runCommand
+	}
+	if err := s.compileFilters(); err != nil {
+		return err
+	}
+
+	// -a also lists the disabled services
+	output, err := s.run("svcs", "-a", "-H", "-o", "state,fmri")
+	if err != nil {
+		return fmt.Errorf("error getting SMF services: %s", err)
+	}
+
+	counts := make(map[string]int64, len(smfStateCodes))
+	for _, svc := range parseSvcs(string(output)) {
+		if s.include != nil && !s.include.Match(svc.fmri) {
+			continue
+		}
+		if s.exclude != nil && s.exclude.Match(svc.fmri) {
+			continue
+		}
+
+		code, ok := smfStateCodes[svc.state]
+		if !ok {
+			code = -1
+		}
+		tags := map[string]string{"fmri": svc.fmri, "state": svc.state}
+		fields := map[string]interface{}{
+			"state_code":    code,
+			"transitioning": svc.transitioning,
+		}
+		acc.AddGauge("smf", fields, tags)
+
+		counts[svc.state]++
+	}
+
+	// every known state is reported, so that a count going back to 0 shows
+	fields := make(map[string]interface{}, len(smfStateCodes))
+	for state := range smfStateCodes {
+		fields[state] = counts[state]
+	}
+	for state, n := range counts {
+		fields[state] = n
+	}
+	acc.AddGauge("smf_states", fields, nil)
+	return nil
+}
+
+// parseSvcs parses the output of 'svcs -H -o state,fmri', ie:
+//
+//     online         svc:/system/svc/restarter:default
+//     maintenance    svc:/network/ssh:default
+//     offline*       svc:/application/cups/scheduler:default
+//     legacy_run     lrc:/etc/rc2_d/S47pppd
+func parseSvcs(output string) []smfService {
+	var services []smfService
+	for _, line := range strings.Split(output, "\n") {
+		words := strings.Fields(line)
+		if len(words) < 2 {
+			continue
+		}
+		svc := smfService{state: words[0], fmri: words[1]}
+		if strings.HasSuffix(svc.state, "*") {
+			svc.state = strings.TrimSuffix(svc.state, "*")
+			svc.transitioning = true
+		}
+		services = append(services, svc)
+	}
+	return services
+}
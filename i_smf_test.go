@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+)
+
+// svcsFixture is the output of "svcs -a -H -o state,fmri".
+const svcsFixture = `legacy_run     lrc:/etc/rc2_d/S47pppd
+disabled       svc:/network/telnet:default
+online         svc:/system/svc/restarter:default
+online         svc:/network/ssh:default
+maintenance    svc:/application/database/postgresql:version_94
+maintenance    svc:/network/nfs/server:default
+offline*       svc:/application/cups/scheduler:default
+`
+
+func TestParseSvcs(t *testing.T) {
+	services := parseSvcs(svcsFixture)
+	if len(services) != 7 {
+		t.Fatalf("expected 7 services, got %d", len(services))
+	}
+	want := smfService{
+		fmri:          "svc:/application/cups/scheduler:default",
+		state:         "offline",
+		transitioning: true,
+	}
+	if services[6] != want {
+		t.Errorf("expected %+v, got %+v", want, services[6])
+	}
+	if services[4].state != "maintenance" || services[4].transitioning {
+		t.Errorf("unexpected service %+v", services[4])
+	}
+}
+
+func TestSMFGather(t *testing.T) {
+	s := &SMF{Exclude: []string{"lrc:/*"}}
+	s.run = func(name string, args ...string) ([]byte, error) {
+		return []byte(svcsFixture), nil
+	}
+	metricC := make(chan Metric, 20)
+	acc := NewAccumulator(NewRunningInput(s, &InputConfig{Name: "smf"}), metricC)
+	if err := s.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+
+	codes := make(map[string]interface{})
+	var states map[string]interface{}
+	for m := range metricC {
+		switch m.Name() {
+		case "smf":
+			codes[m.Tags()["fmri"]] = m.Fields()["state_code"]
+		case "smf_states":
+			states = m.Fields()
+		}
+	}
+	if len(codes) != 6 {
+		t.Errorf("expected the 6 services that are not excluded, got %v", codes)
+	}
+	for fmri, code := range map[string]int64{
+		"svc:/network/ssh:default":                        0,
+		"svc:/network/telnet:default":                     5,
+		"svc:/application/database/postgresql:version_94": 4,
+		"svc:/network/nfs/server:default":                 4,
+		"svc:/application/cups/scheduler:default":         3,
+	} {
+		if codes[fmri] != code {
+			t.Errorf("%s: expected the state code %d, got %v", fmri, code, codes[fmri])
+		}
+	}
+	want := map[string]int64{
+		"online": 2, "maintenance": 2, "offline": 1, "disabled": 1,
+		"legacy_run": 0, "degraded": 0, "uninitialized": 0,
+	}
+	for state, n := range want {
+		if states[state] != n {
+			t.Errorf("expected %d %s services, got %v", n, state, states[state])
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const socketListenerSampleConfig = `
+  ## URL to listen on, ie:
+  ##   tcp://:8094, tcp4://127.0.0.1:8094, udp://:8094,
+  ##   unix:///var/run/telegraf.sock, unixgram:///var/run/telegraf.sock
+  service_address = "tcp://:8094"
+
+  ## Maximum number of TCP or unix connections at once, further ones are
+  ## refused. 0 means unlimited.
+  # max_connections = 1024
+
+  ## Maximum size in bytes of a line over a stream socket, or of a datagram.
+  ## Longer lines are dropped, longer datagrams truncated.
+  # read_buffer_size = 65536
+
+  ## Timeout for reading from a connection, after which it is closed. 0
+  ## means no timeout.
+  # read_timeout = "0s"
+
+  ## Data format to consume, one metric per line over a stream socket, and
+  ## one or more per datagram.
+  ## Supported formats: influx, json, keyvalue, logfmt, kstat, opentsdb,
+  ## prometheus, value
+  data_format = "influx"
+`
+
+// SocketListener adds the metrics that it receives on a socket, in any of the
+// data formats.
+type SocketListener struct {
+	ServiceAddress string   `toml:"service_address"`
+	MaxConnections int      `toml:"max_connections"`
+	ReadBufferSize int      `toml:"read_buffer_size"`
+	ReadTimeout    Duration `toml:"read_timeout"`
+
+	parser Parser
+	acc    Accumulator
+
+	// path is the file of a unix socket, removed on Stop
+	path       string
+	packetConn net.PacketConn
+	listener   net.Listener
+	conns      map[net.Conn]struct{}
+
+	parseErrors Stat
+	refused     Stat
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	sync.Mutex
+}
+
+func NewSocketListener() *SocketListener {
+	return &SocketListener{
+		ServiceAddress: "tcp://:8094",
+		MaxConnections: 1024,
+		ReadBufferSize: 64 * 1024,
+	}
+}
+
+func (s *SocketListener) SampleConfig() string {
+	return socketListenerSampleConfig
+}
+
+func (s *SocketListener) Description() string {
+	return "Accepts metrics in any data format over a TCP, UDP or unix socket"
+}
+
+func (s *SocketListener) SetParser(parser Parser) {
+	s.parser = parser
+}
+
+// Gather does nothing, metrics are added as they are received.
+func (s *SocketListener) Gather(_ Accumulator) error {
+	return nil
+}
+
+func (s *SocketListener) Start(acc Accumulator) error {
+	s.Lock()
+	defer s.Unlock()
+
+	spl := strings.SplitN(s.ServiceAddress, "://", 2)
+	if len(spl) != 2 {
+		return fmt.Errorf("invalid service_address: %s", s.ServiceAddress)
+	}
+	scheme, addr := spl[0], spl[1]
+	if s.parser == nil {
+		return fmt.Errorf("no parser set for the socket_listener")
+	}
+	if s.ReadBufferSize <= 0 {
+		s.ReadBufferSize = 64 * 1024
+	}
+
+	s.acc = acc
+	s.done = make(chan struct{})
+	s.conns = make(map[net.Conn]struct{})
+	tags := map[string]string{"address": s.ServiceAddress}
+	s.parseErrors = Register("socket_listener", "parse_errors", tags)
+	s.refused = Register("socket_listener", "connections_refused", tags)
+
+	switch scheme {
+	case "unix", "unixgram":
+		// a socket left over by a previous run would fail the listen
+		if info, err := os.Stat(addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(addr)
+		}
+		s.path = addr
+	}
+
+	switch scheme {
+	case "udp", "udp4", "udp6", "unixgram":
+		conn, err := net.ListenPacket(scheme, addr)
+		if err != nil {
+			return err
+		}
+		s.packetConn = conn
+		s.wg.Add(1)
+		go s.listenPacket()
+	case "tcp", "tcp4", "tcp6", "unix":
+		l, err := net.Listen(scheme, addr)
+		if err != nil {
+			return err
+		}
+		s.listener = l
+		s.wg.Add(1)
+		go s.listenStream()
+	default:
+		return fmt.Errorf("unknown protocol '%s' in '%s'", scheme, s.ServiceAddress)
+	}
+
+	log.Printf("I! Started socket_listener at %s\n", s.ServiceAddress)
+	return nil
+}
+
+func (s *SocketListener) Stop() {
+	s.Lock()
+	close(s.done)
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	}
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.Unlock()
+
+	s.wg.Wait()
+	if s.path != "" {
+		os.Remove(s.path)
+	}
+	log.Printf("I! Stopped socket_listener at %s\n", s.ServiceAddress)
+}
+
+// addr returns the address the listener is listening on.
+func (s *SocketListener) addr() net.Addr {
+	if s.packetConn != nil {
+		return s.packetConn.LocalAddr()
+	}
+	return s.listener.Addr()
+}
+
+func (s *SocketListener) listenPacket() {
+	defer s.wg.Done()
+
+	buf := make([]byte, s.ReadBufferSize)
+	for {
+		n, _, err := s.packetConn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-s.done:
+			default:
+				s.acc.AddError(err)
+			}
+			return
+		}
+		s.parse(buf[:n])
+	}
+}
+
+func (s *SocketListener) listenStream() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+			default:
+				s.acc.AddError(err)
+			}
+			return
+		}
+
+		s.Lock()
+		// Stop closes the tracked connections under the lock, a connection
+		// accepted while it runs would be left open
+		select {
+		case <-s.done:
+			s.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		if s.MaxConnections > 0 && len(s.conns) >= s.MaxConnections {
+			s.Unlock()
+			s.refused.Incr(1)
+			log.Printf("W! [inputs.socket_listener] refusing connection from %s, "+
+				"max_connections %d reached", conn.RemoteAddr(), s.MaxConnections)
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.Unlock()
+
+		go s.handleConn(conn)
+	}
+}
+
+// handleConn reads newline delimited lines from a stream connection, each
+// of them parsed on its own.
+func (s *SocketListener) handleConn(conn net.Conn) {
+	defer func() {
+		s.Lock()
+		delete(s.conns, conn)
+		s.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReaderSize(conn, s.ReadBufferSize)
+	for {
+		if s.ReadTimeout.Duration > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.ReadTimeout.Duration))
+		}
+
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// skip the rest of the line, it would not fit in the buffer
+			s.parseErrors.Incr(1)
+			log.Printf("D! [inputs.socket_listener] dropping line from %s "+
+				"longer than read_buffer_size %d", conn.RemoteAddr(), s.ReadBufferSize)
+			for err == bufio.ErrBufferFull {
+				_, err = r.ReadSlice('\n')
+			}
+			if err != nil {
+				return
+			}
+			continue
+		}
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return
+		}
+		s.parse(line)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// parse adds the metrics of buf, logging and counting those it cannot parse.
+func (s *SocketListener) parse(buf []byte) {
+	metrics, err := s.parser.Parse(buf)
+	if err != nil {
+		s.parseErrors.Incr(1)
+		log.Printf("D! [inputs.socket_listener] dropping unparseable data: %s", err)
+		return
+	}
+	for _, m := range metrics {
+		s.acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
+	}
+}
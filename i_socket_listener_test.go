@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSocketListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telegraf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	addresses := []string{"tcp://127.0.0.1:0", "udp://127.0.0.1:0"}
+	if runtime.GOOS != "windows" {
+		addresses = append(addresses,
+			"unix://"+filepath.Join(dir, "stream.sock"),
+			"unixgram://"+filepath.Join(dir, "dgram.sock"))
+	}
+	for _, address := range addresses {
+		s := NewSocketListener()
+		s.ServiceAddress = address
+		parser, _ := NewInfluxParser()
+		s.SetParser(parser)
+
+		metricC := make(chan Metric, 10)
+		acc := NewAccumulator(NewRunningInput(s, &InputConfig{Name: "socket_listener"}), metricC)
+		if err := s.Start(acc); err != nil {
+			t.Fatalf("%s: %s", address, err)
+		}
+		parseErrors := s.parseErrors.Get()
+
+		addr := s.addr()
+		conn, err := net.Dial(addr.Network(), addr.String())
+		if err != nil {
+			s.Stop()
+			t.Fatalf("%s: %s", address, err)
+		}
+		// a datagram holds several lines, a stream is read line by line
+		conn.Write([]byte("cpu,cpu=cpu0 usage=1i 1500000000000000000\n" +
+			"disk,path=/ used=2i 1500000000000000000\n"))
+		conn.Write([]byte("not line protocol\n"))
+
+		got := make(map[string]int64)
+		for i := 0; i < 2; i++ {
+			select {
+			case m := <-metricC:
+				for _, v := range m.Fields() {
+					got[m.Name()] = v.(int64)
+				}
+				if !m.Time().Equal(time.Unix(1500000000, 0)) {
+					t.Errorf("%s: expected the time of the line, got %s", address, m.Time())
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: expected 2 metrics, got %d", address, i)
+			}
+		}
+		if got["cpu"] != 1 || got["disk"] != 2 {
+			t.Errorf("%s: expected cpu 1 and disk 2, got %v", address, got)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for s.parseErrors.Get() == parseErrors && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if n := s.parseErrors.Get() - parseErrors; n != 1 {
+			t.Errorf("%s: expected 1 parse error, got %d", address, n)
+		}
+
+		conn.Close()
+		s.Stop()
+		if s.path != "" {
+			if _, err := os.Stat(s.path); !os.IsNotExist(err) {
+				t.Errorf("%s: expected the socket file to be removed, got %v", address, err)
+			}
+		}
+	}
+}
+
+func TestSocketListenerInvalidAddress(t *testing.T) {
+	parser, _ := NewInfluxParser()
+	for _, address := range []string{"127.0.0.1:8094", "sctp://127.0.0.1:8094"} {
+		s := NewSocketListener()
+		s.ServiceAddress = address
+		s.SetParser(parser)
+		if err := s.Start(nil); err == nil {
+			s.Stop()
+			t.Errorf("%s: expected an error", address)
+		}
+	}
+}
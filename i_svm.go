@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// svmStateCodes are the numeric codes of the states of the Solaris Volume
+// Manager metadevices, from healthy to failed.
+var svmStateCodes = map[string]int64{
+	"okay":         0,
+	"initializing": 1,
+	"resyncing":    2,
+	"degraded":     3,
+	"maintenance":  4,
+	"last_erred":   5,
+}
+
+// svmTypes are the metadevice types of the options of 'metastat -p', a
+// metadevice without one of them is a stripe or concatenation.
+var svmTypes = map[string]string{
+	"-m": "mirror",
+	"-r": "raid5",
+	"-p": "soft_partition",
+	"-t": "trans",
+}
+
+// svmOptionArgs are the options of 'metastat -p' that take an argument, ie,
+// the interlace of "-i 32b" or the hot spare pool of "-h hsp001".
+var svmOptionArgs = map[string]bool{
+	"-i": true,
+	"-h": true,
+	"-o": true,
+	"-b": true,
+}
+
+// SVM reports the state of the Solaris Volume Manager metadevices, with
+// their layout from 'metastat -p' and their states from 'metastat -c'.
+type SVM struct {
+	// run runs a command and returns its output, it is replaced in tests
+	run func(name string, args ...string) ([]byte, error)
+}
+
+// svmDevice is a metadevice as listed by 'metastat -p'.
+type svmDevice struct {
+	name  string
+	kind  string
+	parts []string
+}
+
+// svmStatus is the state of a metadevice as shown by 'metastat -c'.
+type svmStatus struct {
+	// maint and erred are the components in maintenance and in the last
+	// erred state.
+	maint         []string
+	erred         []string
+	resyncing     bool
+	resyncPercent float64
+	// hasPercent is set when the resync progress is known
+	hasPercent   bool
+	initializing bool
+}
+
+func (_ *SVM) Description() string {
+	return "Read the state of the Solaris Volume Manager metadevices"
+}
+
+func (_ *SVM) SampleConfig() string { return "" }
+
+func (s *SVM) Gather(acc Accumulator) error {
+	if s.run == nil {
+		s.run = runCommand
+	}
+
+	layout, err := s.run("metastat", "-p")
+	if err != nil {
+		return fmt.Errorf("error getting SVM metadevices: %s", err)
+	}
+	concise, err := s.run("metastat", "-c")
+	if err != nil {
+		return fmt.Errorf("error getting SVM metadevice states: %s", err)
+	}
+
+	devices := parseMetastatP(string(layout))
+	statuses := parseMetastatC(string(concise))
+	states := svmStates(devices, statuses)
+
+	for _, dev := range devices {
+		state := states[dev.name]
+		code, ok := svmStateCodes[state]
+		if !ok {
+			code = -1
+		}
+		tags := map[string]string{
+			"metadevice": dev.name,
+			"type":       dev.kind,
+			"state":      state,
+		}
+		fields := map[string]interface{}{
+			"state_code": code,
+			"components": int64(len(dev.parts)),
+		}
+		if st, ok := statuses[dev.name]; ok {
+			fields["components_maintenance"] = int64(len(st.maint))
+			fields["components_last_erred"] = int64(len(st.erred))
+			if st.hasPercent {
+				fields["resync_percent"] = st.resyncPercent
+			}
+		}
+		acc.AddGauge("svm", fields, tags)
+	}
+	return nil
+}
+
+// svmStates returns the state of each metadevice. A stripe, soft partition
+// or trans metadevice with a failed component needs maintenance, while a
+// mirror or a RAID5 metadevice that still has a healthy component is only
+// degraded. A mirror takes the states of its submirrors into account.
+// Metadevices missing from 'metastat -c' are in the "unknown" state.
+func svmStates(devices []svmDevice, statuses map[string]*svmStatus) map[string]string {
+	states := make(map[string]string, len(devices))
+	// submirrors are listed after their mirror, so the states of all the
+	// metadevices but the mirrors are settled first
+	for _, dev := range devices {
+		if dev.kind != "mirror" {
+			states[dev.name] = svmState(dev, statuses[dev.name], nil)
+		}
+	}
+	for _, dev := range devices {
+		if dev.kind == "mirror" {
+			states[dev.name] = svmState(dev, statuses[dev.name], states)
+		}
+	}
+	return states
+}
+
+func svmState(dev svmDevice, st *svmStatus, states map[string]string) string {
+	if st == nil {
+		return "unknown"
+	}
+
+	// a submirror may be annotated on the line of its mirror as well as
+	// failed on its own, so the failed components are a set
+	failed := make(map[string]bool)
+	erred := len(st.erred) > 0
+	for _, part := range st.maint {
+		failed[part] = true
+	}
+	for _, part := range st.erred {
+		failed[part] = true
+	}
+	if dev.kind == "mirror" {
+		for _, sub := range dev.parts {
+			switch states[sub] {
+			case "maintenance":
+				failed[sub] = true
+			case "last_erred":
+				failed[sub] = true
+				erred = true
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		redundant := dev.kind == "mirror" || dev.kind == "raid5"
+		if redundant && len(failed) < len(dev.parts) {
+			return "degraded"
+		}
+		if erred {
+			return "last_erred"
+		}
+		return "maintenance"
+	}
+	if st.resyncing {
+		return "resyncing"
+	}
+	if st.initializing {
+		return "initializing"
+	}
+	return "okay"
+}
+
+// parseMetastatP parses the output of 'metastat -p', in md.tab format, ie:
+//
+//     d10 -m d11 d12 1
+//     d11 1 1 c0t0d0s0
+//     d12 1 1 c0t1d0s0
+//     d20 2 1 c1t0d0s0 1 c1t1d0s0
+//     d30 -r c1t2d0s0 c1t3d0s0 c1t4d0s0 -k -i 32b
+//     d40 -p d10 -o 1 -b 2097152
+//     hsp001 c2t0d0s0
+//
+// The components of a metadevice are the slices, submirrors or metadevices
+// it is made of; the numbers that describe the layout of a stripe and the
+// read pass of a mirror are not. Hot spare pools are skipped.
+func parseMetastatP(output string) []svmDevice {
+	var devices []svmDevice
+	// long lines are continued with a backslash
+	output = strings.Replace(output, "\\\n", " ", -1)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words := strings.Fields(line)
+		if len(words) < 2 || strings.HasPrefix(words[0], "hsp") {
+			continue
+		}
+
+		dev := svmDevice{name: words[0], kind: "stripe"}
+		rest := words[1:]
+		if kind, ok := svmTypes[rest[0]]; ok {
+			dev.kind = kind
+			rest = rest[1:]
+		}
+		for i := 0; i < len(rest); i++ {
+			w := rest[i]
+			switch {
+			case svmOptionArgs[w]:
+				i++
+			case strings.HasPrefix(w, "-"), isDigits(w):
+			default:
+				dev.parts = append(dev.parts, w)
+			}
+		}
+		devices = append(devices, dev)
+	}
+	return devices
+}
+
+// parseMetastatC parses the output of 'metastat -c', a metadevice per line
+// with its type, size and components, submirrors indented under their
+// mirror, ie:
+//
+//     d10              m  2.0GB d11 d12 (resync-45%)
+//         d11          s  2.0GB c0t0d0s0
+//         d12          s  2.0GB c0t1d0s0
+//     d30              r  4.0GB c1t2d0s0 c1t3d0s0 (maint) c1t4d0s0
+//     d40              p  1.0GB d10
+//
+// States other than okay are annotated in parentheses: "maint" and
+// "last-erred" after the component they apply to, "resync" with its
+// progress, or "resyncing", and "initializing" for the whole metadevice.
+func parseMetastatC(output string) map[string]*svmStatus {
+	statuses := make(map[string]*svmStatus)
+	for _, line := range strings.Split(output, "\n") {
+		words := strings.Fields(line)
+		if len(words) < 3 || strings.HasPrefix(words[0], "hsp") {
+			continue
+		}
+
+		st := &svmStatus{}
+		// the words after the type and the size are components, each
+		// possibly followed by an annotation of one or more words
+		var part string
+		for i := 3; i < len(words); i++ {
+			if !strings.HasPrefix(words[i], "(") {
+				part = words[i]
+				continue
+			}
+			note := words[i]
+			for !strings.HasSuffix(note, ")") && i+1 < len(words) {
+				i++
+				note += " " + words[i]
+			}
+			note = strings.ToLower(strings.Trim(note, "()"))
+			switch {
+			case strings.HasPrefix(note, "maint"), strings.HasPrefix(note, "needs maint"):
+				if part != "" {
+					st.maint = append(st.maint, part)
+				}
+			case strings.HasPrefix(note, "last-erred"), strings.HasPrefix(note, "last erred"):
+				if part != "" {
+					st.erred = append(st.erred, part)
+				}
+			case strings.HasPrefix(note, "resync"):
+				st.resyncing = true
+				if pct := svmPercent(note); pct >= 0 {
+					st.resyncPercent = pct
+					st.hasPercent = true
+				}
+			case strings.HasPrefix(note, "init"):
+				st.initializing = true
+			}
+		}
+		statuses[words[0]] = st
+	}
+	return statuses
+}
+
+// svmPercent returns the percentage at the end of an annotation, ie, 45 for
+// "resync-45%", or -1 when there is none.
+func svmPercent(note string) float64 {
+	if !strings.HasSuffix(note, "%") {
+		return -1
+	}
+	note = strings.TrimSuffix(note, "%")
+	i := strings.LastIndexAny(note, "- ")
+	pct, err := strconv.ParseFloat(note[i+1:], 64)
+	if err != nil {
+		return -1
+	}
+	return pct
+}
+
+// isDigits reports whether s is a non-empty string of decimal digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
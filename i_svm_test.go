@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const metastatPFixture = `d10 -m d11 d12 1
+d11 1 1 c0t0d0s0
+d12 1 1 c0t1d0s0
+d20 -m d21 d22 1
+d21 1 1 c0t2d0s0
+d22 1 1 c0t3d0s0
+d30 -r c1t2d0s0 c1t3d0s0 c1t4d0s0 -k -i 32b
+d40 -p d10 -o 1 -b 2097152
+d50 2 1 c1t0d0s0 \
+         1 c1t1d0s0
+d60 -m d61 1
+d61 1 1 c2t1d0s0
+hsp001 c2t0d0s0
+`
+
+const metastatCFixture = `d10              m  2.0GB d11 d12 (resync-45%)
+    d11          s  2.0GB c0t0d0s0
+    d12          s  2.0GB c0t1d0s0
+d20              m  2.0GB d21 d22 (maint)
+    d21          s  2.0GB c0t2d0s0
+    d22          s  2.0GB c0t3d0s0 (maint)
+d30              r  4.0GB c1t2d0s0 c1t3d0s0 (maint) c1t4d0s0
+d40              p  1.0GB d10
+d60              m  1.0GB d61 (resyncing)
+    d61          s  1.0GB c2t1d0s0
+hsp001           h  -     c2t0d0s0
+`
+
+func TestSVM(t *testing.T) {
+	s := &SVM{run: func(name string, args ...string) ([]byte, error) {
+		if name != "metastat" || len(args) != 1 {
+			return nil, errors.New("unexpected command " + name)
+		}
+		switch args[0] {
+		case "-p":
+			return []byte(metastatPFixture), nil
+		case "-c":
+			return []byte(metastatCFixture), nil
+		}
+		return nil, errors.New("unexpected option " + args[0])
+	}}
+
+	metricC := make(chan Metric, 20)
+	acc := NewAccumulator(NewRunningInput(s, &InputConfig{Name: "svm"}), metricC)
+	if err := s.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+
+	type device struct {
+		kind, state string
+		fields      map[string]interface{}
+	}
+	got := make(map[string]device)
+	for m := range metricC {
+		got[m.Tags()["metadevice"]] = device{m.Tags()["type"], m.Tags()["state"], m.Fields()}
+	}
+
+	healthy := func(code, components int64) map[string]interface{} {
+		return map[string]interface{}{
+			"state_code":             code,
+			"components":             components,
+			"components_maintenance": int64(0),
+			"components_last_erred":  int64(0),
+		}
+	}
+	resyncing := healthy(2, 2)
+	resyncing["resync_percent"] = float64(45)
+	degraded := healthy(3, 2)
+	degraded["components_maintenance"] = int64(1)
+	raid5 := healthy(3, 3)
+	raid5["components_maintenance"] = int64(1)
+	maint := healthy(4, 1)
+	maint["components_maintenance"] = int64(1)
+
+	want := map[string]device{
+		"d10": {"mirror", "resyncing", resyncing},
+		"d11": {"stripe", "okay", healthy(0, 1)},
+		"d12": {"stripe", "okay", healthy(0, 1)},
+		"d20": {"mirror", "degraded", degraded},
+		"d21": {"stripe", "okay", healthy(0, 1)},
+		"d22": {"stripe", "maintenance", maint},
+		"d30": {"raid5", "degraded", raid5},
+		"d40": {"soft_partition", "okay", healthy(0, 1)},
+		"d50": {"stripe", "unknown", map[string]interface{}{
+			"state_code": int64(-1),
+			"components": int64(2),
+		}},
+		"d60": {"mirror", "resyncing", healthy(2, 1)},
+		"d61": {"stripe", "okay", healthy(0, 1)},
+	}
+	for name, w := range want {
+		g, ok := got[name]
+		if !ok {
+			t.Errorf("%s: missing", name)
+			continue
+		}
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("%s: expected %v, got %v", name, w, g)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d metadevices, got %d: %v", len(want), len(got), got)
+	}
+}
+
+func TestSVMError(t *testing.T) {
+	s := &SVM{run: func(name string, args ...string) ([]byte, error) {
+		return nil, errors.New("metastat: there are no existing databases")
+	}}
+	metricC := make(chan Metric, 1)
+	acc := NewAccumulator(NewRunningInput(s, &InputConfig{Name: "svm"}), metricC)
+	if err := s.Gather(acc); err == nil {
+		t.Error("expected an error when metastat fails")
+	}
+}
@@ -1,14 +1,24 @@
 package main
 
 import (
+	"fmt"
 	"os/exec"
-	"strings"
 	"strconv"
-	"fmt"
+	"strings"
 )
 
 type SwapStats struct {
 	ps PS
+
+	// run runs a command and returns its output, it is replaced in tests
+	run func(name string, args ...string) ([]byte, error)
+}
+
+// swapDevice is a swap area as listed by swap -l.
+type swapDevice struct {
+	path  string
+	total uint64
+	free  uint64
 }
 
 func (_ *SwapStats) Description() string {
@@ -17,71 +27,148 @@ func (_ *SwapStats) Description() string {
 
 func (_ *SwapStats) SampleConfig() string { return "" }
 
+func runCommand(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
 func (s *SwapStats) Gather(acc Accumulator) error {
+	if s.run == nil {
+		s.run = runCommand
+	}
 
-	output, err := exec.Command("swap", "-s").CombinedOutput()
+	output, err := s.run("swap", "-s")
 	if err != nil {
 		return fmt.Errorf("error getting Swap info: %s", err.Error())
 	}
-	sout := string(output)
-	if sout != "" {
-		swapOutput := strings.Split(sout, "\n")
-		swapOutput = swapOutput[0: len(swapOutput)-1]
-
-		s := strings.Split(swapOutput[0], ",")
+	used, avail, err := parseSwapSummary(string(output))
+	if err != nil {
+		return err
+	}
+	acc.AddGauge("swap", swapFields(used+avail, avail), nil)
 
-		if len(s) == 2 {
-			kUsed := strings.Trim(strings.Replace(strings.Split(s[0], "=")[1], "k used", "", 1), " ")
-			kAvailable := strings.Trim(strings.Replace(s[1], "k available", "", 1), " ")
+	output, err = s.run("swap", "-l")
+	if err != nil {
+		return fmt.Errorf("error getting Swap device info: %s", err.Error())
+	}
+	for _, dev := range parseSwapList(string(output)) {
+		tags := map[string]string{"device": dev.path}
+		acc.AddGauge("swap", swapFields(dev.total, dev.free), tags)
+	}
 
-			used, _ := strconv.ParseUint(kUsed, 10, 0)
-			avail, _ := strconv.ParseUint(kAvailable, 10, 0)
+	output, err = s.run("vmstat", "-S")
+	if err != nil {
+		return fmt.Errorf("error getting Swap Memory info: %s", err.Error())
+	}
+	if data := parseVmstat(string(output)); data != nil {
+		fieldsC := map[string]interface{}{
+			"in":  data["si"],
+			"out": data["so"],
+		}
+		acc.AddCounter("swap", fieldsC, nil)
+	}
+	return nil
+}
 
-			used = used * 1024
-			avail = avail * 1024
+func swapFields(total, free uint64) map[string]interface{} {
+	var used uint64
+	if total > free {
+		used = total - free
+	}
 
-			total := used + avail
-			free := total - used
+	return map[string]interface{}{
+		"total":        total,
+		"used":         used,
+		"free":         free,
+		"used_percent": percent(used, total),
+	}
+}
 
-			var usedPercent float64
+// parseSwapSummary parses the output of swap -s, ie:
+//   total: 212436k bytes allocated + 52364k reserved = 264800k used, 3919468k available
+// and returns the used and available swap in bytes.
+func parseSwapSummary(out string) (uint64, uint64, error) {
+	line := strings.TrimSpace(strings.SplitN(out, "\n", 2)[0])
+	eq := strings.LastIndex(line, "=")
+	if eq < 0 {
+		return 0, 0, fmt.Errorf("unexpected swap -s output: %q", line)
+	}
 
-			if total != 0 {
-				usedPercent = float64(used) / float64(total) * 100.0
-			}
+	parts := strings.Split(line[eq+1:], ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("unexpected swap -s output: %q", line)
+	}
 
-			fieldsG := map[string]interface{}{
-				"total":        total,
-				"used":         used,
-				"free":         free,
-				"used_percent": usedPercent,
-			}
+	used, err := parseSwapKB(parts[0], "used")
+	if err != nil {
+		return 0, 0, err
+	}
+	avail, err := parseSwapKB(parts[1], "available")
+	if err != nil {
+		return 0, 0, err
+	}
+	return used, avail, nil
+}
 
-			acc.AddGauge("swap", fieldsG, nil)
+// parseSwapKB parses "264800k used" into bytes.
+func parseSwapKB(s, label string) (uint64, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), label))
+	kb, err := strconv.ParseUint(strings.TrimSuffix(s, "k"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected swap -s value %q: %s", s, err)
+	}
+	return kb * 1024, nil
+}
 
-			output, err = exec.Command("vmstat", "-S").CombinedOutput()
-			if err != nil {
-				return fmt.Errorf("error getting Swap Memory info: %s", err.Error())
-			}
+// parseSwapList parses the output of swap -l, ie:
+//   swapfile                 dev    swaplo   blocks     free
+//   /dev/zvol/dsk/rpool/swap 256,1      16  4194288  4194288
+// The sizes are in 512-byte blocks and are returned in bytes.
+func parseSwapList(out string) []swapDevice {
+	var devices []swapDevice
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		// the header, or "No swap devices configured"
+		if len(fields) < 5 || fields[0] == "swapfile" {
+			continue
+		}
 
-			vmstats := string(output)
-			rows := strings.Split(vmstats, "\n")
-			rows = rows[1:]
-			data := make(map[string]uint64)
-			headers := strings.Fields(rows[0])
-			values := strings.Fields(rows[1])
-			for count := 0; count < len(headers); count++ {
-				v, _ := strconv.ParseUint(values[count], 10, 0)
-				data[headers[count]] = v
-			}
+		n := len(fields)
+		blocks, err := strconv.ParseUint(fields[n-2], 10, 64)
+		if err != nil {
+			continue
+		}
+		free, err := strconv.ParseUint(fields[n-1], 10, 64)
+		if err != nil {
+			continue
+		}
 
-			fieldsC := map[string]interface{}{
-				"in":  data["si"],
-				"out": data["so"],
-			}
+		devices = append(devices, swapDevice{
+			path:  strings.Join(fields[:n-4], " "),
+			total: blocks * 512,
+			free:  free * 512,
+		})
+	}
+	return devices
+}
 
-			acc.AddCounter("swap", fieldsC, nil)
-		}
+// parseVmstat parses the first sample of vmstat into a map of the column
+// headers to their values. It returns nil if the output is incomplete.
+func parseVmstat(out string) map[string]uint64 {
+	rows := strings.Split(out, "\n")
+	// the first row groups the columns, ie "kthr memory page disk ..."
+	if len(rows) < 3 {
+		return nil
+	}
+	headers := strings.Fields(rows[1])
+	values := strings.Fields(rows[2])
+	if len(headers) == 0 || len(headers) != len(values) {
+		return nil
+	}
 
+	data := make(map[string]uint64)
+	for i := range headers {
+		v, _ := strconv.ParseUint(values[i], 10, 64)
+		data[headers[i]] = v
 	}
-	return nil
+	return data
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var (
+	swapSummaryFixture = "total: 212436k bytes allocated + 52364k reserved = " +
+		"264800k used, 3919468k available\n"
+
+	swapListFixture = `swapfile                 dev    swaplo   blocks     free
+/dev/zvol/dsk/rpool/swap 256,1      16  4194288  4194288
+/dev/dsk/c0t1d0s1        32,9       16  2097136  1048568
+/export/swapfile            -       16   204784        0
+`
+)
+
+func TestParseSwapSummary(t *testing.T) {
+	used, avail, err := parseSwapSummary(swapSummaryFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != 264800*1024 || avail != 3919468*1024 {
+		t.Errorf("expected 264800k used and 3919468k available, got %d and %d",
+			used, avail)
+	}
+
+	if _, _, err := parseSwapSummary("swap: command not found\n"); err == nil {
+		t.Error("expected an error for an unexpected output")
+	}
+}
+
+func TestParseSwapList(t *testing.T) {
+	want := []swapDevice{
+		{path: "/dev/zvol/dsk/rpool/swap", total: 4194288 * 512, free: 4194288 * 512},
+		{path: "/dev/dsk/c0t1d0s1", total: 2097136 * 512, free: 1048568 * 512},
+		{path: "/export/swapfile", total: 204784 * 512, free: 0},
+	}
+	if devices := parseSwapList(swapListFixture); !reflect.DeepEqual(devices, want) {
+		t.Errorf("expected %+v, got %+v", want, devices)
+	}
+
+	if devices := parseSwapList("No swap devices configured\n"); len(devices) != 0 {
+		t.Errorf("expected no devices, got %+v", devices)
+	}
+}
+
+func TestSwapGather(t *testing.T) {
+	s := &SwapStats{}
+	s.run = func(name string, args ...string) ([]byte, error) {
+		switch args[0] {
+		case "-s":
+			return []byte(swapSummaryFixture), nil
+		case "-l":
+			return []byte(swapListFixture), nil
+		}
+		return []byte(" kthr      memory            page            disk          faults      cpu\n" +
+			" r b w   swap  free  si  so pi po fr de sr s0 s1 -- --   in   sy   cs us sy id\n" +
+			" 0 0 0 3919468 1048576 3 5 0  0  0  0  0  1  0  0  0  512  988  601  1  1 98\n"), nil
+	}
+
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(s, &InputConfig{Name: "swap"}), metricC)
+	if err := s.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+
+	devices := make(map[string]map[string]interface{})
+	var summary, counters map[string]interface{}
+	for m := range metricC {
+		switch {
+		case m.Tags()["device"] != "":
+			devices[m.Tags()["device"]] = m.Fields()
+		case m.Fields()["in"] != nil:
+			counters = m.Fields()
+		default:
+			summary = m.Fields()
+		}
+	}
+	if len(devices) != 3 {
+		t.Errorf("expected 3 devices, got %v", devices)
+	}
+	if p := devices["/dev/dsk/c0t1d0s1"]["used_percent"]; p != 50.0 {
+		t.Errorf("expected c0t1d0s1 to be 50%% used, got %v", p)
+	}
+	if p := devices["/export/swapfile"]["used_percent"]; p != 100.0 {
+		t.Errorf("expected the swapfile to be 100%% used, got %v", p)
+	}
+	if summary == nil || summary["used_percent"] != 6.33 {
+		t.Errorf("expected a summary 6.33%% used, got %v", summary)
+	}
+	if fmt.Sprint(counters["in"], counters["out"]) != "3 5" {
+		t.Errorf("expected 3 pages in and 5 out, got %v", counters)
+	}
+}
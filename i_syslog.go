@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const syslogSampleConfig = `
+  ## Specify an ip or hostname with port and protocol, ie:
+  ##   udp://:6514, tcp://127.0.0.1:6514
+  address = "udp://:6514"
+
+  ## Timeout for reading a message from a TCP connection.
+  ## 0 means no timeout.
+  # read_timeout = "5s"
+
+  ## Messages are parsed as RFC 5424 and fall back to RFC 3164 (BSD syslog).
+  ## Every message becomes a "syslog" metric tagged with severity, facility,
+  ## hostname and appname, with the message text in the "message" field.
+  ## Malformed messages are counted and dropped.
+`
+
+// maxSyslogMessageSize is the largest message accepted over UDP or via TCP
+// octet counting.
+const maxSyslogMessageSize = 64 * 1024
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon",
+	"auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp",
+	"ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3",
+	"local4", "local5", "local6", "local7",
+}
+
+var syslogSeverities = []string{
+	"emerg", "alert", "crit", "err",
+	"warning", "notice", "info", "debug",
+}
+
+type Syslog struct {
+	Address     string
+	ReadTimeout Duration `toml:"read_timeout"`
+
+	acc Accumulator
+
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+	conns       map[net.Conn]struct{}
+
+	malformed Stat
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	sync.Mutex
+}
+
+func NewSyslog() *Syslog {
+	return &Syslog{
+		Address:     "udp://:6514",
+		ReadTimeout: Duration{Duration: 5 * time.Second},
+	}
+}
+
+func (s *Syslog) SampleConfig() string {
+	return syslogSampleConfig
+}
+
+func (s *Syslog) Description() string {
+	return "Accepts syslog messages following RFC 5424 or RFC 3164"
+}
+
+// Gather does nothing, metrics are added as messages are received.
+func (s *Syslog) Gather(_ Accumulator) error {
+	return nil
+}
+
+func (s *Syslog) Start(acc Accumulator) error {
+	s.Lock()
+	defer s.Unlock()
+
+	spl := strings.SplitN(s.Address, "://", 2)
+	if len(spl) != 2 {
+		return fmt.Errorf("invalid address: %s", s.Address)
+	}
+	scheme, addr := spl[0], spl[1]
+
+	s.acc = acc
+	s.done = make(chan struct{})
+	s.conns = make(map[net.Conn]struct{})
+	s.malformed = Register("syslog", "malformed_messages",
+		map[string]string{"address": s.Address})
+
+	switch scheme {
+	case "udp", "udp4", "udp6":
+		conn, err := net.ListenPacket(scheme, addr)
+		if err != nil {
+			return err
+		}
+		s.udpConn = conn
+		s.wg.Add(1)
+		go s.listenPacket()
+	case "tcp", "tcp4", "tcp6":
+		l, err := net.Listen(scheme, addr)
+		if err != nil {
+			return err
+		}
+		s.tcpListener = l
+		s.wg.Add(1)
+		go s.listenStream()
+	default:
+		return fmt.Errorf("unknown protocol '%s' in '%s'", scheme, s.Address)
+	}
+
+	log.Printf("I! Started syslog receiver at %s\n", s.Address)
+	return nil
+}
+
+func (s *Syslog) Stop() {
+	s.Lock()
+	close(s.done)
+	if s.udpConn != nil {
+		s.udpConn.Close()
+	}
+	if s.tcpListener != nil {
+		s.tcpListener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.Unlock()
+
+	s.wg.Wait()
+	log.Printf("I! Stopped syslog receiver at %s\n", s.Address)
+}
+
+// addr returns the address the receiver is listening on.
+func (s *Syslog) addr() net.Addr {
+	if s.udpConn != nil {
+		return s.udpConn.LocalAddr()
+	}
+	return s.tcpListener.Addr()
+}
+
+func (s *Syslog) listenPacket() {
+	defer s.wg.Done()
+
+	buf := make([]byte, maxSyslogMessageSize)
+	for {
+		n, _, err := s.udpConn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-s.done:
+			default:
+				s.acc.AddError(err)
+			}
+			return
+		}
+		s.handle(string(buf[:n]))
+	}
+}
+
+func (s *Syslog) listenStream() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.tcpListener.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+			default:
+				s.acc.AddError(err)
+			}
+			return
+		}
+
+		s.Lock()
+		// Stop closes the tracked connections under the lock, a connection
+		// accepted while it runs would be left open
+		select {
+		case <-s.done:
+			s.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.Unlock()
+
+		go s.handleConn(conn)
+	}
+}
+
+// handleConn reads messages from a TCP connection. Both octet counting
+// ("<length> <message>") and newline delimited framing are accepted.
+func (s *Syslog) handleConn(conn net.Conn) {
+	defer func() {
+		s.Lock()
+		delete(s.conns, conn)
+		s.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		if s.ReadTimeout.Duration > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.ReadTimeout.Duration))
+		}
+
+		first, err := r.Peek(1)
+		if err != nil {
+			return
+		}
+
+		var msg string
+		if first[0] >= '0' && first[0] <= '9' {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(length))
+			if err != nil || n <= 0 || n > maxSyslogMessageSize {
+				// the framing is lost, there is no way to find the next message
+				s.malformed.Incr(1)
+				return
+			}
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			msg = string(buf)
+		} else {
+			msg, err = r.ReadString('\n')
+			if err != nil && (err != io.EOF || msg == "") {
+				return
+			}
+		}
+
+		s.handle(msg)
+	}
+}
+
+func (s *Syslog) handle(msg string) {
+	msg = strings.TrimRight(msg, "\r\n\x00")
+	if msg == "" {
+		return
+	}
+
+	tags, fields, t, err := parseSyslog(msg, time.Now())
+	if err != nil {
+		s.malformed.Incr(1)
+		log.Printf("D! [inputs.syslog] dropping malformed message: %s", err)
+		return
+	}
+	s.acc.AddFields("syslog", fields, tags, t)
+}
+
+// parseSyslog parses an RFC 5424 message, falling back to RFC 3164 when the
+// message has no version after the priority.
+func parseSyslog(msg string, now time.Time) (map[string]string, map[string]interface{}, time.Time, error) {
+	if len(msg) < 3 || msg[0] != '<' {
+		return nil, nil, now, fmt.Errorf("missing priority: %q", msg)
+	}
+	end := strings.IndexByte(msg, '>')
+	if end < 2 || end > 4 {
+		return nil, nil, now, fmt.Errorf("invalid priority: %q", msg)
+	}
+	pri, err := strconv.Atoi(msg[1:end])
+	if err != nil || pri < 0 || pri >= len(syslogFacilities)*8 {
+		return nil, nil, now, fmt.Errorf("invalid priority: %q", msg)
+	}
+	facility, severity := pri/8, pri%8
+
+	tags := map[string]string{
+		"facility": syslogFacilities[facility],
+		"severity": syslogSeverities[severity],
+	}
+	fields := map[string]interface{}{
+		"facility_code": facility,
+		"severity_code": severity,
+	}
+
+	rest := msg[end+1:]
+	var t time.Time
+	if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		t, err = parseRFC5424(rest, tags, fields, now)
+	} else {
+		t, err = parseRFC3164(rest, tags, fields, now)
+	}
+	if err != nil {
+		return nil, nil, now, err
+	}
+	return tags, fields, t, nil
+}
+
+// parseRFC5424 parses the part after the priority of:
+//   VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parseRFC5424(rest string, tags map[string]string, fields map[string]interface{}, now time.Time) (time.Time, error) {
+	parts := strings.SplitN(rest, " ", 7)
+	if len(parts) < 7 {
+		return now, fmt.Errorf("truncated RFC 5424 message: %q", rest)
+	}
+
+	version, _ := strconv.Atoi(parts[0])
+	fields["version"] = version
+
+	t := now
+	if parts[1] != "-" {
+		var err error
+		t, err = time.Parse(time.RFC3339Nano, parts[1])
+		if err != nil {
+			return now, fmt.Errorf("invalid timestamp %q", parts[1])
+		}
+	}
+
+	if parts[2] != "-" {
+		tags["hostname"] = parts[2]
+	}
+	if parts[3] != "-" {
+		tags["appname"] = parts[3]
+	}
+	if parts[4] != "-" {
+		fields["procid"] = parts[4]
+	}
+	if parts[5] != "-" {
+		fields["msgid"] = parts[5]
+	}
+
+	// structured data is either "-" or one or more bracketed elements, which
+	// may contain escaped brackets and spaces in quoted values.
+	sdAndMsg := parts[6]
+	var sd, message string
+	if strings.HasPrefix(sdAndMsg, "-") {
+		message = strings.TrimPrefix(sdAndMsg[1:], " ")
+	} else if strings.HasPrefix(sdAndMsg, "[") {
+		i := 0
+		for i < len(sdAndMsg) && sdAndMsg[i] == '[' {
+			j := i + 1
+			for ; j < len(sdAndMsg); j++ {
+				if sdAndMsg[j] == '\\' {
+					j++
+				} else if sdAndMsg[j] == ']' {
+					break
+				}
+			}
+			if j >= len(sdAndMsg) {
+				return now, fmt.Errorf("unterminated structured data: %q", sdAndMsg)
+			}
+			i = j + 1
+		}
+		sd = sdAndMsg[:i]
+		message = strings.TrimPrefix(sdAndMsg[i:], " ")
+	} else {
+		return now, fmt.Errorf("invalid structured data: %q", sdAndMsg)
+	}
+
+	if sd != "" {
+		fields["structured_data"] = sd
+	}
+	fields["message"] = strings.TrimPrefix(message, "\xef\xbb\xbf")
+	return t, nil
+}
+
+// syslogMaxFutureSkew is how far ahead of the time it is received an RFC
+// 3164 timestamp may be, beyond that it is of the previous year.
+const syslogMaxFutureSkew = 24 * time.Hour
+
+// parseRFC3164 parses the part after the priority of:
+//   Mmm dd hh:mm:ss HOSTNAME TAG: MSG
+// The year is not part of the message, so the current year is assumed, or
+// the previous one for a message sent before the new year, ie, on Dec 31
+// and received on Jan 1.
+func parseRFC3164(rest string, tags map[string]string, fields map[string]interface{}, now time.Time) (time.Time, error) {
+	if len(rest) < len(time.Stamp)+1 {
+		return now, fmt.Errorf("truncated RFC 3164 message: %q", rest)
+	}
+
+	ts, err := time.ParseInLocation(time.Stamp, rest[:len(time.Stamp)], now.Location())
+	if err != nil {
+		return now, fmt.Errorf("invalid timestamp %q", rest[:len(time.Stamp)])
+	}
+	t := time.Date(now.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(),
+		ts.Second(), 0, now.Location())
+	if t.Sub(now) > syslogMaxFutureSkew {
+		t = time.Date(now.Year()-1, ts.Month(), ts.Day(), ts.Hour(), ts.Minute(),
+			ts.Second(), 0, now.Location())
+	}
+
+	rest = strings.TrimLeft(rest[len(time.Stamp):], " ")
+	if i := strings.IndexByte(rest, ' '); i > 0 {
+		tags["hostname"] = rest[:i]
+		rest = rest[i+1:]
+	} else {
+		return now, fmt.Errorf("missing hostname in RFC 3164 message")
+	}
+
+	// the tag is the alphanumeric program name, optionally followed by a
+	// [pid], and terminated by a colon.
+	if i := strings.Index(rest, ": "); i > 0 && !strings.Contains(rest[:i], " ") {
+		tag := rest[:i]
+		if b := strings.IndexByte(tag, '['); b > 0 && strings.HasSuffix(tag, "]") {
+			fields["procid"] = tag[b+1 : len(tag)-1]
+			tag = tag[:b]
+		}
+		tags["appname"] = tag
+		rest = rest[i+2:]
+	}
+
+	fields["message"] = rest
+	return t, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRFC3164YearRollover(t *testing.T) {
+	tests := []struct {
+		msg  string
+		now  time.Time
+		want time.Time
+	}{
+		{"<13>Jun  5 10:20:30 web1 app: hello",
+			time.Date(2017, 6, 5, 10, 20, 31, 0, time.UTC),
+			time.Date(2017, 6, 5, 10, 20, 30, 0, time.UTC)},
+		{"<13>Dec 31 23:59:59 web1 app: hello",
+			time.Date(2018, 1, 1, 0, 0, 5, 0, time.UTC),
+			time.Date(2017, 12, 31, 23, 59, 59, 0, time.UTC)},
+		// a sender clock slightly ahead is kept in the current year
+		{"<13>Jan  1 00:01:00 web1 app: hello",
+			time.Date(2018, 1, 1, 0, 0, 5, 0, time.UTC),
+			time.Date(2018, 1, 1, 0, 1, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		_, _, ts, err := parseSyslog(tt.msg, tt.now)
+		if err != nil {
+			t.Errorf("%q: %s", tt.msg, err)
+			continue
+		}
+		if !ts.Equal(tt.want) {
+			t.Errorf("%q: expected %s, got %s", tt.msg, tt.want, ts)
+		}
+	}
+}
+
+// startSyslog starts a syslog receiver on a local port of proto.
+func startSyslog(t *testing.T, proto string) (*Syslog, chan Metric) {
+	s := NewSyslog()
+	s.Address = proto + "://127.0.0.1:0"
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(s, &InputConfig{Name: "syslog"}), metricC)
+	if err := s.Start(acc); err != nil {
+		t.Fatal(err)
+	}
+	return s, metricC
+}
+
+func receiveSyslog(t *testing.T, metricC chan Metric) Metric {
+	select {
+	case m := <-metricC:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a metric")
+	}
+	return nil
+}
+
+func TestSyslogReceives(t *testing.T) {
+	messages := []struct {
+		msg    string
+		tags   map[string]string
+		fields map[string]interface{}
+	}{
+		{"<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick",
+			map[string]string{"facility": "auth", "severity": "crit",
+				"hostname": "mymachine", "appname": "su"},
+			map[string]interface{}{"message": "'su root' failed for lonvick"}},
+		{`<165>1 2003-10-11T22:14:15.003Z host.example.com evntslog 1234 ID47 ` +
+			`[exampleSDID@32473 iut="3"] An application event`,
+			map[string]string{"facility": "local4", "severity": "notice",
+				"hostname": "host.example.com", "appname": "evntslog"},
+			map[string]interface{}{"message": "An application event",
+				"procid": "1234", "msgid": "ID47", "version": int64(1),
+				"structured_data": `[exampleSDID@32473 iut="3"]`}},
+	}
+	for _, proto := range []string{"udp", "tcp"} {
+		s, metricC := startSyslog(t, proto)
+		conn, err := net.Dial(proto, s.addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range messages {
+			if _, err := conn.Write([]byte(tt.msg + "\n")); err != nil {
+				t.Fatal(err)
+			}
+			m := receiveSyslog(t, metricC)
+			if !reflect.DeepEqual(m.Tags(), tt.tags) {
+				t.Errorf("%s: expected the tags %v, got %v", proto, tt.tags, m.Tags())
+			}
+			for k, v := range tt.fields {
+				if m.Fields()[k] != v {
+					t.Errorf("%s: expected %s %v, got %v", proto, k, v, m.Fields()[k])
+				}
+			}
+		}
+		conn.Close()
+		s.Stop()
+	}
+}
+
+func TestSyslogCountsMalformed(t *testing.T) {
+	s, metricC := startSyslog(t, "udp")
+	defer s.Stop()
+	before := s.malformed.Get()
+	conn, err := net.Dial("udp", s.addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, msg := range []string{"no priority", "<999>Oct 11 22:14:15 host app: x",
+		"<13>1 not-a-time host app - - - x", "<13>Oct 11 22:14:15 x",
+		"<13>Oct 11 22:14:15 host app: ok"} {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the valid message is handled after the malformed ones
+	m := receiveSyslog(t, metricC)
+	if m.Fields()["message"] != "ok" {
+		t.Errorf("expected the valid message, got %v", m.Fields())
+	}
+	if n := s.malformed.Get() - before; n != 4 {
+		t.Errorf("expected 4 malformed messages, got %d", n)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"os/exec"
@@ -13,7 +14,16 @@ import (
 	"log"
 )
 
-type SystemStats struct{}
+// uptimeLoadRe matches the load averages at the end of the uptime output.
+var uptimeLoadRe = regexp.MustCompile(`load averages?:\s*([\d.]+),?\s+([\d.]+),?\s+([\d.]+)`)
+
+// uptimeUsersRe matches the number of logged in users of the uptime output.
+var uptimeUsersRe = regexp.MustCompile(`(\d+)\s+users?`)
+
+type SystemStats struct {
+	// run runs a command and returns its output, it is replaced in tests
+	run func(name string, args ...string) ([]byte, error)
+}
 
 func (_ *SystemStats) Description() string {
 	return "Read metrics about system load & uptime"
@@ -21,31 +31,28 @@ func (_ *SystemStats) Description() string {
 
 func (_ *SystemStats) SampleConfig() string { return "" }
 
-func (_ *SystemStats) Gather(acc Accumulator) error {
-	output, err := exec.Command("uptime").CombinedOutput()
+func (s *SystemStats) Gather(acc Accumulator) error {
+	if s.run == nil {
+		s.run = runCommand
+	}
+
+	output, err := s.run("uptime")
 	if err != nil {
 		return fmt.Errorf("error getting System info: %s", err.Error())
 	}
+	log.Printf("D! Uptime Response: %s\n", output)
 
-	stats := string(output)
-	log.Printf("D! Uptime Response: %s\n", stats)
-	rows := strings.Split(stats, "\n")
-
-	uptimeOutput := strings.Split(rows[0], ",")
+	fields, err := parseUptime(string(output))
+	if err != nil {
+		return err
+	}
+	fields["n_cpus"] = runtime.NumCPU()
+	acc.AddGauge("system", fields, nil)
 
-	load1, err := strconv.ParseFloat(strings.Trim(uptimeOutput[len(uptimeOutput)-3], "load average: "), 64)
-	load5, err := strconv.ParseFloat(strings.Trim(uptimeOutput[len(uptimeOutput)-2], " "), 64)
-	load15, err := strconv.ParseFloat(strings.Trim(uptimeOutput[len(uptimeOutput)-1], " "), 64)
-	users, err := strconv.ParseUint(strings.Trim(uptimeOutput[len(uptimeOutput)-4], " users"), 10, 64)
 	uptime, err := Uptime()
-
-	acc.AddGauge("system", map[string]interface{}{
-		"load1":   load1,
-		"load5":   load5,
-		"load15":  load15,
-		"n_users": users,
-		"n_cpus":  runtime.NumCPU(),
-	}, nil)
+	if err != nil {
+		return fmt.Errorf("error getting boot time: %s", err)
+	}
 	acc.AddCounter("system", map[string]interface{}{
 		"uptime": uptime,
 	}, nil)
@@ -56,6 +63,36 @@ func (_ *SystemStats) Gather(acc Accumulator) error {
 	return nil
 }
 
+// parseUptime parses the load averages and the number of users of the
+// Solaris uptime output, ie:
+//
+//     11:05am  up 12 day(s),  3:24,  2 users,  load average: 0.04, 0.05, 0.06
+//      9:41pm  up 5 min(s),  1 user,  load average: 1.10, 0.52, 0.20
+func parseUptime(output string) (map[string]interface{}, error) {
+	load := uptimeLoadRe.FindStringSubmatch(output)
+	if load == nil {
+		return nil, fmt.Errorf("no load average in uptime output %q",
+			strings.TrimSpace(output))
+	}
+
+	fields := make(map[string]interface{}, 4)
+	for i, key := range []string{"load1", "load5", "load15"} {
+		v, err := strconv.ParseFloat(load[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %s", key, load[i+1], err)
+		}
+		fields[key] = v
+	}
+
+	if users := uptimeUsersRe.FindStringSubmatch(output); users != nil {
+		n, err := strconv.ParseInt(users[1], 10, 64)
+		if err == nil {
+			fields["n_users"] = n
+		}
+	}
+	return fields, nil
+}
+
 func BootTime() (uint64, error) {
 	kstat, err := exec.LookPath("/usr/bin/kstat")
 	if err != nil {
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUptime(t *testing.T) {
+	tests := []struct {
+		output string
+		want   map[string]interface{}
+	}{
+		{
+			"  11:05am  up 12 day(s),  3:24,  2 users,  load average: 0.04, 0.05, 0.06\n",
+			map[string]interface{}{
+				"load1":   0.04,
+				"load5":   0.05,
+				"load15":  0.06,
+				"n_users": int64(2),
+			},
+		},
+		{
+			"   9:41pm  up 5 min(s),  1 user,  load average: 1.10, 0.52, 0.20\n",
+			map[string]interface{}{
+				"load1":   1.10,
+				"load5":   0.52,
+				"load15":  0.20,
+				"n_users": int64(1),
+			},
+		},
+		{
+			" 10:00am  up 1 hr(s),  load averages: 2.00 1.50 1.00\n",
+			map[string]interface{}{
+				"load1":  2.00,
+				"load5":  1.50,
+				"load15": 1.00,
+			},
+		},
+	}
+	for _, test := range tests {
+		fields, err := parseUptime(test.output)
+		if err != nil {
+			t.Errorf("%q: %s", test.output, err)
+			continue
+		}
+		if !reflect.DeepEqual(fields, test.want) {
+			t.Errorf("%q: expected %v, got %v", test.output, test.want, fields)
+		}
+	}
+}
+
+func TestParseUptimeWithoutLoad(t *testing.T) {
+	if _, err := parseUptime("uptime: command not found\n"); err == nil {
+		t.Error("expected an error without load averages")
+	}
+}
+
+func TestFormatUptime(t *testing.T) {
+	tests := map[uint64]string{
+		59:                     " 0:00",
+		3*3600 + 24*60:         " 3:24",
+		86400 + 60:             "1 day,  0:01",
+		12*86400 + 3*3600 + 60: "12 days,  3:01",
+	}
+	for uptime, want := range tests {
+		if got := format_uptime(uptime); got != want {
+			t.Errorf("%d: expected %q, got %q", uptime, want, got)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tailSampleConfig = `
+  ## files to tail.
+  ## These accept standard unix glob matching rules, without recursion, ie:
+  ##   "/var/log/*.log"   -> find all .log files in /var/log
+  ##   "/var/log/*/*.log" -> find all .log files with a parent dir in /var/log
+  ##   "/var/log/apache.log" -> just tail the apache log file
+  files = ["/var/mymetrics.out"]
+  ## Read file from beginning.
+  from_beginning = false
+  ## How often to check the files for new lines.
+  # poll_interval = "1s"
+  ## File to persist the read offsets in, so that a restart continues where
+  ## the previous run stopped instead of skipping or re-reading lines.
+  # state_file = "/var/lib/telegraf/tail.state"
+
+  ## Data format to consume.
+  ## Each data format has its own unique set of configuration options.
+  ## Supported formats: influx, json, prometheus, value, keyvalue, logfmt
+  data_format = "influx"
+
+  ## With the logfmt data format, each line is a metric of key=value pairs,
+  ## ie, 'level=info msg="request done" duration=12'. Keys listed in tag_keys
+  ## are tags, a key without a value is a true boolean field.
+  # tag_keys = ["level"]
+`
+
+type Tail struct {
+	Files         []string
+	FromBeginning bool     `toml:"from_beginning"`
+	PollInterval  Duration `toml:"poll_interval"`
+	StateFile     string   `toml:"state_file"`
+
+	parser Parser
+	acc    Accumulator
+
+	tailers map[string]*fileTailer
+	// offsets holds the persisted offsets of files that have not been
+	// opened yet.
+	offsets map[string]int64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	sync.Mutex
+}
+
+// fileTailer follows a single file, remembering how far it has been read.
+type fileTailer struct {
+	path   string
+	file   *os.File
+	info   os.FileInfo
+	offset int64
+}
+
+func NewTail() *Tail {
+	return &Tail{
+		PollInterval: Duration{Duration: time.Second},
+	}
+}
+
+func (t *Tail) SampleConfig() string {
+	return tailSampleConfig
+}
+
+func (t *Tail) Description() string {
+	return "Stream a log file, like the tail -f command"
+}
+
+func (t *Tail) SetParser(parser Parser) {
+	t.parser = parser
+}
+
+// Gather picks up the files created since the last poll. The lines are
+// only read by a started tail, so a tail that is not running, ie, with
+// --test or --once, gathers nothing.
+func (t *Tail) Gather(acc Accumulator) error {
+	t.Lock()
+	defer t.Unlock()
+	if t.acc == nil {
+		return nil
+	}
+	t.tailNewFiles()
+	return nil
+}
+
+func (t *Tail) Start(acc Accumulator) error {
+	t.Lock()
+	defer t.Unlock()
+
+	t.acc = acc
+	t.tailers = make(map[string]*fileTailer)
+	t.offsets = make(map[string]int64)
+	t.done = make(chan struct{})
+
+	if t.PollInterval.Duration <= 0 {
+		t.PollInterval.Duration = time.Second
+	}
+
+	if err := t.loadState(); err != nil {
+		log.Printf("W! [inputs.tail] could not load state file %s: %s",
+			t.StateFile, err)
+	}
+
+	t.tailNewFiles()
+
+	t.wg.Add(1)
+	go t.run()
+	return nil
+}
+
+func (t *Tail) Stop() {
+	close(t.done)
+	t.wg.Wait()
+
+	t.Lock()
+	defer t.Unlock()
+
+	// read whatever has been written since the last poll
+	t.poll()
+	if err := t.saveState(); err != nil {
+		log.Printf("E! [inputs.tail] could not save state file %s: %s",
+			t.StateFile, err)
+	}
+	for _, ft := range t.tailers {
+		ft.file.Close()
+	}
+	t.tailers = nil
+	t.acc = nil
+}
+
+func (t *Tail) run() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.PollInterval.Duration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			t.Lock()
+			t.tailNewFiles()
+			t.poll()
+			if err := t.saveState(); err != nil {
+				log.Printf("E! [inputs.tail] could not save state file %s: %s",
+					t.StateFile, err)
+			}
+			t.Unlock()
+		}
+	}
+}
+
+// tailNewFiles opens every file matching the configured globs that is not
+// being tailed yet.
+func (t *Tail) tailNewFiles() {
+	for _, pattern := range t.Files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.acc.AddError(fmt.Errorf("E! Error Glob %s failed to compile, %s",
+				pattern, err))
+			continue
+		}
+
+		for _, path := range matches {
+			if _, ok := t.tailers[path]; ok {
+				continue
+			}
+
+			ft, err := t.openFile(path)
+			if err != nil {
+				t.acc.AddError(err)
+				continue
+			}
+			log.Printf("D! [inputs.tail] tail added for file: %s", path)
+			t.tailers[path] = ft
+		}
+	}
+}
+
+// openFile opens path and positions it at the persisted offset, at the
+// beginning when from_beginning is set, or at the end otherwise.
+func (t *Tail) openFile(path string) (*fileTailer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	ft := &fileTailer{path: path, file: f, info: info}
+	if offset, ok := t.offsets[path]; ok {
+		delete(t.offsets, path)
+		if offset <= info.Size() {
+			ft.offset = offset
+		}
+	} else if !t.FromBeginning {
+		ft.offset = info.Size()
+	}
+	return ft, nil
+}
+
+// poll reads the new lines of every tailed file, reopening files that have
+// been rotated and rewinding files that have been truncated.
+func (t *Tail) poll() {
+	for path, ft := range t.tailers {
+		t.readLines(ft)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			// the file is gone; keep the old handle until it shows up again
+			continue
+		}
+
+		if !os.SameFile(ft.info, info) {
+			log.Printf("D! [inputs.tail] file %s was rotated, reopening", path)
+			ft.file.Close()
+			f, err := os.Open(path)
+			if err != nil {
+				t.acc.AddError(err)
+				delete(t.tailers, path)
+				continue
+			}
+			ft.file = f
+			ft.info = info
+			ft.offset = 0
+			t.readLines(ft)
+			continue
+		}
+
+		if info.Size() < ft.offset {
+			log.Printf("D! [inputs.tail] file %s was truncated, rewinding", path)
+			ft.info = info
+			ft.offset = 0
+			t.readLines(ft)
+		}
+	}
+}
+
+// readLines parses all of the complete lines after the tailer's offset.
+// A trailing line without a newline is left to be read on the next poll.
+func (t *Tail) readLines(ft *fileTailer) {
+	if _, err := ft.file.Seek(ft.offset, os.SEEK_SET); err != nil {
+		t.acc.AddError(err)
+		return
+	}
+
+	r := bufio.NewReader(ft.file)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err != io.EOF {
+				t.acc.AddError(err)
+			}
+			return
+		}
+		ft.offset += int64(len(line))
+
+		text := strings.TrimRight(line, "\r\n")
+		if text == "" {
+			continue
+		}
+
+		m, err := t.parser.ParseLine(text)
+		if err != nil {
+			t.acc.AddError(fmt.Errorf("E! Malformed log line in %s: [%s], Error: %s",
+				ft.path, text, err))
+			continue
+		}
+		if m != nil {
+			t.acc.AddFields(m.Name(), m.Fields(), m.Tags(), m.Time())
+		}
+	}
+}
+
+// loadState reads the offsets saved by a previous run.
+func (t *Tail) loadState() error {
+	if t.StateFile == "" {
+		return nil
+	}
+
+	contents, err := ioutil.ReadFile(t.StateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(contents, &t.offsets)
+}
+
+// saveState writes the current offsets of all files to the state file.
+func (t *Tail) saveState() error {
+	if t.StateFile == "" {
+		return nil
+	}
+
+	offsets := make(map[string]int64, len(t.offsets)+len(t.tailers))
+	for path, offset := range t.offsets {
+		offsets[path] = offset
+	}
+	for path, ft := range t.tailers {
+		offsets[path] = ft.offset
+	}
+
+	contents, err := json.Marshal(offsets)
+	if err != nil {
+		return err
+	}
+
+	tmp := t.StateFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, contents, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.StateFile)
+}
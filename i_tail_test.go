@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startTail starts tailing path, polled by the test only.
+func startTail(t *testing.T, path, stateFile string) (*Tail, chan Metric) {
+	parser, err := NewInfluxParser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tl := NewTail()
+	tl.Files = []string{path}
+	tl.StateFile = stateFile
+	tl.PollInterval.Duration = time.Hour
+	tl.SetParser(parser)
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(tl, &InputConfig{Name: "tail"}), metricC)
+	if err := tl.Start(acc); err != nil {
+		t.Fatal(err)
+	}
+	return tl, metricC
+}
+
+// pollValues polls tl and returns the values of the metrics read.
+func pollValues(tl *Tail, metricC chan Metric) []interface{} {
+	tl.Lock()
+	tl.poll()
+	tl.Unlock()
+	return drainValues(metricC)
+}
+
+func drainValues(metricC chan Metric) []interface{} {
+	var values []interface{}
+	for {
+		select {
+		case m := <-metricC:
+			values = append(values, m.Fields()["value"])
+		default:
+			return values
+		}
+	}
+}
+
+func appendFile(t *testing.T, path, s string) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectValues(t *testing.T, step string, got []interface{}, want ...float64) {
+	if len(got) != len(want) {
+		t.Errorf("%s: expected the values %v, got %v", step, want, got)
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s: expected the values %v, got %v", step, want, got)
+			return
+		}
+	}
+}
+
+func TestTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	stateFile := filepath.Join(dir, "tail.state")
+	appendFile(t, path, "app value=1\n")
+
+	// the lines written before the start are skipped
+	tl, metricC := startTail(t, path, stateFile)
+	expectValues(t, "start", pollValues(tl, metricC))
+
+	appendFile(t, path, "app value=2\napp value=")
+	expectValues(t, "append", pollValues(tl, metricC), 2)
+	// the partial line is read once complete
+	appendFile(t, path, "3\n")
+	expectValues(t, "complete line", pollValues(tl, metricC), 3)
+
+	if err := ioutil.WriteFile(path, []byte("app value=4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectValues(t, "truncate", pollValues(tl, metricC), 4)
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "app value=5\n")
+	expectValues(t, "rotate", pollValues(tl, metricC), 5)
+
+	// a restart resumes from the saved offset
+	tl.Stop()
+	expectValues(t, "stop", drainValues(metricC))
+	appendFile(t, path, "app value=6\n")
+	tl, metricC = startTail(t, path, stateFile)
+	defer tl.Stop()
+	expectValues(t, "resume", pollValues(tl, metricC), 6)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// prtpiclNodeRe matches the first line of a PICL node, ie,
+// "  t_amb (temperature-sensor, 2600000048e)".
+var prtpiclNodeRe = regexp.MustCompile(`^\s*(\S+)\s+\(([\w-]+),\s*\w+\)`)
+
+// Temp reports the temperature sensors of the host, read with ipmitool or,
+// on hosts without it, from the PICL tree with prtpicl.
+type Temp struct {
+	// Method is "ipmitool", "prtpicl" or "" to use ipmitool when it is
+	// installed and prtpicl otherwise.
+	Method string
+
+	// run runs a command and returns its output, it is replaced in tests
+	run func(name string, args ...string) ([]byte, error)
+	// lookPath finds a command, it is replaced in tests
+	lookPath func(file string) (string, error)
+}
+
+var tempSampleConfig = `
+  ## How to read the sensors: "ipmitool" (ipmitool sensor), "prtpicl"
+  ## (prtpicl -v -c temperature-sensor) or "" to use ipmitool when it is
+  ## installed. Hosts without sensors report nothing.
+  # method = ""
+`
+
+func (_ *Temp) Description() string {
+	return "Read the temperature sensors of the host"
+}
+
+func (_ *Temp) SampleConfig() string {
+	return tempSampleConfig
+}
+
+func (t *Temp) Gather(acc Accumulator) error {
+	if t.run == nil {
+		t.run = runCommand
+	}
+	if t.lookPath == nil {
+		t.lookPath = exec.LookPath
+	}
+
+	method := t.Method
+	if method == "" {
+		method = "prtpicl"
+		if _, err := t.lookPath("ipmitool"); err == nil {
+			method = "ipmitool"
+		}
+	}
+
+	var sensors map[string]float64
+	switch method {
+	case "ipmitool":
+		output, err := t.run("ipmitool", "sensor")
+		if err != nil {
+			// ie, no BMC: "Could not open device at /dev/ipmi0"
+			log.Printf("D! temp: no sensors read with ipmitool: %s", err)
+			return nil
+		}
+		sensors = parseIpmitoolSensor(string(output))
+	case "prtpicl":
+		output, err := t.run("prtpicl", "-v", "-c", "temperature-sensor")
+		if err != nil {
+			log.Printf("D! temp: no sensors read with prtpicl: %s", err)
+			return nil
+		}
+		sensors = parsePrtpiclTemperature(string(output))
+	default:
+		return fmt.Errorf("invalid method %q", t.Method)
+	}
+
+	for sensor, celsius := range sensors {
+		tags := map[string]string{"sensor": sensor}
+		fields := map[string]interface{}{"temperature_celsius": celsius}
+		acc.AddGauge("temp", fields, tags)
+	}
+	return nil
+}
+
+// parseIpmitoolSensor returns the temperatures in celsius, by sensor name,
+// of the output of 'ipmitool sensor', ie:
+//
+//     CPU Temp         | 45.000     | degrees C  | ok    | na        | ...
+//     FAN1             | 3000.000   | RPM        | ok    | na        | ...
+//     Ambient Temp     | na         | degrees C  | na    | na        | ...
+//
+// Sensors in fahrenheit are converted, those without a reading skipped.
+func parseIpmitoolSensor(output string) map[string]float64 {
+	sensors := make(map[string]float64)
+	for _, line := range strings.Split(output, "\n") {
+		cols := strings.Split(line, "|")
+		if len(cols) < 3 {
+			continue
+		}
+		name := strings.TrimSpace(cols[0])
+		unit := strings.TrimSpace(cols[2])
+		if unit != "degrees C" && unit != "degrees F" {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(cols[1]), 64)
+		if err != nil {
+			continue
+		}
+		if unit == "degrees F" {
+			v = (v - 32) * 5 / 9
+		}
+		sensors[name] = v
+	}
+	return sensors
+}
+
+// parsePrtpiclTemperature returns the temperatures in celsius, by sensor
+// label or node name, of the output of 'prtpicl -v -c temperature-sensor',
+// ie:
+//
+//       t_amb (temperature-sensor, 2600000048e)
+//        :Label          Ambient
+//        :HighWarningThreshold  45
+//        :Temperature    23
+func parsePrtpiclTemperature(output string) map[string]float64 {
+	sensors := make(map[string]float64)
+	var node, label string
+	var value float64
+	var found bool
+	flush := func() {
+		if !found {
+			return
+		}
+		name := node
+		if label != "" {
+			name = label
+		}
+		sensors[name] = value
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if m := prtpiclNodeRe.FindStringSubmatch(line); m != nil {
+			flush()
+			node, label, found = m[1], "", false
+			if m[2] != "temperature-sensor" {
+				node = ""
+			}
+			continue
+		}
+		if node == "" {
+			continue
+		}
+		words := strings.Fields(line)
+		if len(words) < 2 {
+			continue
+		}
+		switch words[0] {
+		case ":Label":
+			label = strings.Join(words[1:], " ")
+		case ":Temperature":
+			v, err := strconv.ParseFloat(words[1], 64)
+			if err == nil {
+				value, found = v, true
+			}
+		}
+	}
+	flush()
+	return sensors
+}
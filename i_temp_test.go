@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const ipmitoolSensorFixture = `CPU Temp         | 45.000     | degrees C  | ok    | na        | na        | na        | 90.000    | 95.000    | na
+System Temp      | 30.000     | degrees C  | ok    | na        | na        | na        | 80.000    | 85.000    | na
+Inlet Temp       | 77.000     | degrees F  | ok    | na        | na        | na        | na        | na        | na
+Ambient Temp     | na         | degrees C  | na    | na        | na        | na        | na        | na        | na
+FAN1             | 3000.000   | RPM        | ok    | na        | 300.000   | 500.000   | na        | na        | na
+12V              | 12.188     | Volts      | ok    | 10.173    | 10.299    | 10.740    | 12.945    | 13.260    | 13.386
+`
+
+const prtpiclTemperatureFixture = `  t_amb (temperature-sensor, 2600000048e)
+   :Label          Ambient
+   :HighWarningThreshold  45
+   :Temperature    23
+  t_core0 (temperature-sensor, 26000000495)
+   :HighWarningThreshold  90
+   :Temperature    51
+  fan0 (fan, 260000004a0)
+   :Label          FAN0
+   :Temperature    99
+  t_psu (temperature-sensor, 260000004ab)
+   :Label          PSU
+`
+
+// gatherTemp gathers t with the fixtures in place of ipmitool and prtpicl,
+// installed tells whether ipmitool is found.
+func gatherTemp(t *testing.T, temp *Temp, installed bool) map[string]interface{} {
+	temp.lookPath = func(file string) (string, error) {
+		if installed {
+			return "/usr/sbin/" + file, nil
+		}
+		return "", errors.New("not found")
+	}
+	temp.run = func(name string, args ...string) ([]byte, error) {
+		switch name {
+		case "ipmitool":
+			return []byte(ipmitoolSensorFixture), nil
+		case "prtpicl":
+			return []byte(prtpiclTemperatureFixture), nil
+		}
+		return nil, errors.New("unexpected command " + name)
+	}
+
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(temp, &InputConfig{Name: "temp"}), metricC)
+	if err := temp.Gather(acc); err != nil {
+		t.Fatal(err)
+	}
+	close(metricC)
+	sensors := make(map[string]interface{})
+	for m := range metricC {
+		sensors[m.Tags()["sensor"]] = m.Fields()["temperature_celsius"]
+	}
+	return sensors
+}
+
+func TestTempIpmitool(t *testing.T) {
+	want := map[string]interface{}{
+		"CPU Temp":    float64(45),
+		"System Temp": float64(30),
+		"Inlet Temp":  float64(25),
+	}
+	if got := gatherTemp(t, &Temp{}, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := gatherTemp(t, &Temp{Method: "ipmitool"}, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v with method ipmitool, got %v", want, got)
+	}
+}
+
+func TestTempPrtpicl(t *testing.T) {
+	want := map[string]interface{}{
+		"Ambient": float64(23),
+		"t_core0": float64(51),
+	}
+	if got := gatherTemp(t, &Temp{}, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := gatherTemp(t, &Temp{Method: "prtpicl"}, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v with method prtpicl, got %v", want, got)
+	}
+}
+
+func TestTempWithoutSensors(t *testing.T) {
+	temp := &Temp{
+		run: func(name string, args ...string) ([]byte, error) {
+			return nil, errors.New("Could not open device at /dev/ipmi0")
+		},
+		lookPath: func(file string) (string, error) { return file, nil },
+	}
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(NewRunningInput(temp, &InputConfig{Name: "temp"}), metricC)
+	if err := temp.Gather(acc); err != nil {
+		t.Errorf("expected no error without sensors, got %s", err)
+	}
+	if len(metricC) != 0 {
+		t.Errorf("expected no metrics, got %d", len(metricC))
+	}
+
+	temp.Method = "lm_sensors"
+	if err := temp.Gather(acc); err == nil {
+		t.Error("expected an error with an invalid method")
+	}
+}
@@ -13,6 +13,9 @@ type InfluxParser struct {
 }
 
 func (p *InfluxParser) ParseWithDefaultTimePrecision(buf []byte, t time.Time, precision string) ([]Metric, error) {
+	if len(bytes.TrimSpace(buf)) == 0 {
+		return []Metric{}, nil
+	}
 	if !bytes.HasSuffix(buf, []byte("\n")) {
 		buf = append(buf, '\n')
 	}
@@ -42,6 +45,9 @@ func (p *InfluxParser) Parse(buf []byte) ([]Metric, error) {
 }
 
 func (p *InfluxParser) ParseLine(line string) (Metric, error) {
+	if blankLine(line) {
+		return nil, nil
+	}
 	metrics, err := p.Parse([]byte(line + "\n"))
 
 	if err != nil {
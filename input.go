@@ -10,4 +10,38 @@ type Input interface {
 	// Gather takes in an accumulator and adds the metrics that the Input
 	// gathers. This is called every "interval"
 	Gather(Accumulator) error
-}
\ No newline at end of file
+}
+
+type ServiceInput interface {
+	// SampleConfig returns the default configuration of the Input
+	SampleConfig() string
+
+	// Description returns a one-sentence description on the Input
+	Description() string
+
+	// Gather takes in an accumulator and adds the metrics that the Input
+	// gathers. This is called every "interval"
+	Gather(Accumulator) error
+
+	// Start starts the ServiceInput's service, whatever that may be
+	Start(Accumulator) error
+
+	// Stop stops the services and closes any necessary channels and connections
+	Stop()
+}
+
+// DeprecatedPlugin is implemented by the plugins, of any kind, that have been
+// superseded. Deprecated returns whether the plugin is deprecated and, if so,
+// the name of its replacement, or "" if there is none. Configuring such a
+// plugin still works, with a warning.
+type DeprecatedPlugin interface {
+	Deprecated() (bool, string)
+}
+
+// filterCompiler is implemented by the inputs with glob patterns, which are
+// compiled once, when the config is loaded, so that a bad pattern fails the
+// config rather than every gather, and likewise by the processors that
+// filter metrics.
+type filterCompiler interface {
+	compileFilters() error
+}
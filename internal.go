@@ -10,10 +10,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"math/big"
+	mrand "math/rand"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 )
@@ -131,6 +134,21 @@ func SnakeCase(in string) string {
 	return string(out)
 }
 
+// percentDecimals is the number of decimals percent rounds to.
+const percentDecimals = 2
+
+// percent returns part as a percentage of total, 0 when total is 0. It is
+// computed the same way by every input, scaling before dividing and
+// rounding half up to percentDecimals, so that the same ratio gives the same
+// float everywhere.
+func percent(part, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	scale := math.Pow(10, percentDecimals)
+	return math.Floor(float64(part)*100*scale/float64(total)+0.5) / scale
+}
+
 // CombinedOutputTimeout runs the given command with the given timeout and
 // returns the combined output of stdout and stderr.
 // If the command times out, it attempts to kill the process.
@@ -176,26 +194,56 @@ func WaitTimeout(c *exec.Cmd, timeout time.Duration) error {
 	}
 }
 
+var (
+	jitterMu sync.Mutex
+	// jitterRand, when set, replaces crypto/rand as the source of the random
+	// durations of RandomSleep.
+	jitterRand *mrand.Rand
+)
+
+// SetJitterSeed makes the durations of RandomSleep reproducible by drawing
+// them from a PRNG seeded with seed.
+func SetJitterSeed(seed int64) {
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	jitterRand = mrand.New(mrand.NewSource(seed))
+}
+
+// RandomDuration returns a random duration in [0, max).
+func RandomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	if jitterRand != nil {
+		return time.Duration(jitterRand.Int63n(int64(max)))
+	}
+
+	var sleepns int64
+	if j, err := rand.Int(rand.Reader, big.NewInt(max.Nanoseconds())); err == nil {
+		sleepns = j.Int64()
+	}
+	return time.Duration(sleepns)
+}
+
 // RandomSleep will sleep for a random amount of time up to max.
 // If the shutdown channel is closed, it will return before it has finished
 // sleeping.
 func RandomSleep(max time.Duration, shutdown chan struct{}) {
+	randomSleep(RealClock, max, shutdown)
+}
+
+// randomSleep is RandomSleep, timed by the given clock.
+func randomSleep(clock Clock, max time.Duration, shutdown chan struct{}) {
 	if max == 0 {
 		return
 	}
-	maxSleep := big.NewInt(max.Nanoseconds())
-
-	var sleepns int64
-	if j, err := rand.Int(rand.Reader, maxSleep); err == nil {
-		sleepns = j.Int64()
-	}
-
-	t := time.NewTimer(time.Nanosecond * time.Duration(sleepns))
 	select {
-	case <-t.C:
+	case <-clock.After(RandomDuration(max)):
 		return
 	case <-shutdown:
-		t.Stop()
 		return
 	}
 }
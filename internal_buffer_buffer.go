@@ -1,6 +1,7 @@
 package main
 
 import (
+	"log"
 	"sync"
 )
 
@@ -9,9 +10,37 @@ var (
 	MetricsDropped Stat
 )
 
+// Overflow policies of a Buffer, deciding which metric is lost when a metric
+// is added to a full buffer.
+const (
+	OverflowDropOldest = "drop_oldest"
+	OverflowDropNewest = "drop_newest"
+	// OverflowBlock is implemented by the RunningOutput, which waits for room
+	// in its buffer before adding metrics. The Buffer itself drops the oldest.
+	OverflowBlock = "block"
+)
+
+// ValidOverflowPolicy returns true if policy is a known overflow policy.
+func ValidOverflowPolicy(policy string) bool {
+	switch policy {
+	case OverflowDropOldest, OverflowDropNewest, OverflowBlock:
+		return true
+	}
+	return false
+}
+
 // Buffer is an object for storing metrics in a circular buffer.
 type Buffer struct {
 	buf chan Metric
+	// spill, when set, receives the metrics that would otherwise be dropped
+	// when the buffer is full.
+	spill *Spill
+	// dropNewest drops the metric being added instead of the oldest one when
+	// the buffer is full.
+	dropNewest bool
+	// dropped, when set, counts the metrics dropped by this buffer in
+	// addition to the agent-wide MetricsDropped.
+	dropped Stat
 
 	mu sync.Mutex
 }
@@ -25,6 +54,28 @@ func NewBuffer(size int) *Buffer {
 	}
 }
 
+// SetSpill makes the buffer write the oldest metrics to s instead of
+// dropping them when it is full.
+func (b *Buffer) SetSpill(s *Spill) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spill = s
+}
+
+// SetDroppedStat makes the buffer count the metrics it drops in s.
+func (b *Buffer) SetDroppedStat(s Stat) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dropped = s
+}
+
+// SetOverflowPolicy sets which metric is dropped when the buffer is full.
+func (b *Buffer) SetOverflowPolicy(policy string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dropNewest = policy == OverflowDropNewest
+}
+
 // IsEmpty returns true if Buffer is empty.
 func (b *Buffer) IsEmpty() bool {
 	return len(b.buf) == 0
@@ -43,14 +94,32 @@ func (b *Buffer) Add(metrics ...Metric) {
 		case b.buf <- metrics[i]:
 		default:
 			b.mu.Lock()
-			MetricsDropped.Incr(1)
-			<-b.buf
-			b.buf <- metrics[i]
+			var dropped Metric
+			if b.dropNewest {
+				dropped = metrics[i]
+			} else {
+				dropped = <-b.buf
+				b.buf <- metrics[i]
+			}
+			if b.spill == nil {
+				b.drop()
+			} else if err := b.spill.Add(dropped); err != nil {
+				log.Printf("E! Could not spill metric to disk: %s", err)
+				b.drop()
+			}
 			b.mu.Unlock()
 		}
 	}
 }
 
+// drop counts a dropped metric, b.mu must be held.
+func (b *Buffer) drop() {
+	MetricsDropped.Incr(1)
+	if b.dropped != nil {
+		b.dropped.Incr(1)
+	}
+}
+
 // Batch returns a batch of metrics of size batchSize.
 // the batch will be of maximum length batchSize. It can be less than batchSize,
 // if the length of Buffer is less than batchSize.
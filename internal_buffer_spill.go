@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Default maximum disk usage of a spill directory.
+	DEFAULT_SPILL_MAX_SIZE = 100 * 1024 * 1024
+
+	// Number of segments a spill directory is split into, the oldest segment
+	// is removed once the maximum size is exceeded.
+	spillSegments = 10
+
+	spillSuffix = ".spill"
+)
+
+// Spill stores the metrics that overflow a Buffer on disk, as line protocol
+// segment files, so that they survive a restart.
+type Spill struct {
+	dir         string
+	maxSize     int64
+	segmentSize int64
+
+	// segments are ordered from oldest to newest, the newest being the one
+	// that is written to.
+	segments []*spillSegment
+	nextSeq  int64
+	cur      *os.File
+	// dropped, when set, counts the metrics dropped by this spill in
+	// addition to the agent-wide MetricsDropped.
+	dropped Stat
+
+	mu sync.Mutex
+}
+
+type spillSegment struct {
+	path  string
+	size  int64
+	count int
+}
+
+// NewSpill opens the spill directory dir, creating it if needed. Segments
+// left over from a previous run are kept and will be replayed first.
+func NewSpill(dir string, maxSize int64) (*Spill, error) {
+	if maxSize <= 0 {
+		maxSize = DEFAULT_SPILL_MAX_SIZE
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &Spill{
+		dir:         dir,
+		maxSize:     maxSize,
+		segmentSize: maxSize / spillSegments,
+	}
+	if s.segmentSize < 1 {
+		s.segmentSize = 1
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []int
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, spillSuffix) {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimSuffix(name, spillSuffix))
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+
+	for _, seq := range seqs {
+		path := s.segmentPath(int64(seq))
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, &spillSegment{
+			path:  path,
+			size:  int64(len(contents)),
+			count: bytes.Count(contents, []byte("\n")),
+		})
+		s.nextSeq = int64(seq) + 1
+	}
+
+	if len(s.segments) > 0 {
+		log.Printf("I! Found %d spilled metrics in %s", s.Len(), dir)
+	}
+	return s, nil
+}
+
+// SetDroppedStat makes the spill count the metrics it drops in st.
+func (s *Spill) SetDroppedStat(st Stat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped = st
+}
+
+func (s *Spill) segmentPath(seq int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spillSuffix))
+}
+
+// Len returns the number of metrics stored on disk.
+func (s *Spill) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, seg := range s.segments {
+		n += seg.count
+	}
+	return n
+}
+
+// Add appends metrics to the newest segment, starting a new one when it is
+// full. Once the spill is larger than its maximum size the oldest segments
+// are dropped.
+func (s *Spill) Add(metrics ...Metric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range metrics {
+		var seg *spillSegment
+		if s.cur != nil {
+			seg = s.segments[len(s.segments)-1]
+		}
+		if seg == nil || seg.size >= s.segmentSize {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+			seg = s.segments[len(s.segments)-1]
+		}
+
+		n, err := s.cur.Write(m.Serialize())
+		seg.size += int64(n)
+		if err != nil {
+			return err
+		}
+		seg.count++
+	}
+
+	s.truncate()
+	return nil
+}
+
+// rotate closes the current segment and starts a new one.
+func (s *Spill) rotate() error {
+	if s.cur != nil {
+		s.cur.Close()
+		s.cur = nil
+	}
+
+	path := s.segmentPath(s.nextSeq)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.nextSeq++
+	s.cur = f
+	s.segments = append(s.segments, &spillSegment{path: path})
+	return nil
+}
+
+// truncate removes the oldest segments until the spill fits in its maximum
+// size again. The segment being written to is never removed.
+func (s *Spill) truncate() {
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+
+	for total > s.maxSize && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		if err := os.Remove(oldest.path); err != nil {
+			log.Printf("E! Could not remove spill segment %s: %s", oldest.path, err)
+		}
+		log.Printf("W! Spill directory %s is full, dropping %d metrics",
+			s.dir, oldest.count)
+		MetricsDropped.Incr(int64(oldest.count))
+		if s.dropped != nil {
+			s.dropped.Incr(int64(oldest.count))
+		}
+		total -= oldest.size
+		s.segments = s.segments[1:]
+	}
+}
+
+// Pop removes the oldest segment from disk and returns its metrics.
+func (s *Spill) Pop() ([]Metric, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.segments) == 0 {
+		return nil, nil
+	}
+
+	oldest := s.segments[0]
+	if len(s.segments) == 1 && s.cur != nil {
+		s.cur.Close()
+		s.cur = nil
+	}
+	s.segments = s.segments[1:]
+
+	contents, err := ioutil.ReadFile(oldest.path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(oldest.path); err != nil {
+		return nil, err
+	}
+	if len(contents) == 0 {
+		return nil, nil
+	}
+
+	parser := &InfluxParser{}
+	return parser.Parse(contents)
+}
+
+// Close closes the segment that is being written to.
+func (s *Spill) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur == nil {
+		return nil
+	}
+	err := s.cur.Close()
+	s.cur = nil
+	return err
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSpillTruncateCountsDropped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telegraf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	metrics := testMetrics(t, "a", "b", "c", "d", "e", "f", "g", "h", "i", "j")
+	size := int64(len(metrics[0].Serialize()))
+	// room for 4 metrics, a segment being filled by a single one
+	s, err := NewSpill(dir, 4*size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	dropped := Register("test_spill", "metrics_dropped", map[string]string{})
+	s.SetDroppedStat(dropped)
+	before := MetricsDropped.Get()
+
+	if err := s.Add(metrics...); err != nil {
+		t.Fatal(err)
+	}
+	kept := int64(s.Len())
+	if kept == 0 || kept >= int64(len(metrics)) {
+		t.Fatalf("expected the spill to be truncated, it holds %d metrics", kept)
+	}
+	if n := dropped.Get(); n != int64(len(metrics))-kept {
+		t.Errorf("expected %d dropped metrics, got %d", int64(len(metrics))-kept, n)
+	}
+	if n := MetricsDropped.Get() - before; n != int64(len(metrics))-kept {
+		t.Errorf("expected %d metrics counted as dropped by the agent, got %d",
+			int64(len(metrics))-kept, n)
+	}
+}
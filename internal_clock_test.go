@@ -0,0 +1,113 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MockClock is a Clock whose time only moves when Add is called, firing the
+// timers and tickers that are due on the way.
+type MockClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*mockTimer
+}
+
+// mockTimer is a pending After, or a ticker when period is set.
+type mockTimer struct {
+	clock  *MockClock
+	when   time.Time
+	period time.Duration
+	c      chan time.Time
+}
+
+// NewMockClock returns a MockClock set to now.
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{now: now}
+}
+
+func (m *MockClock) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+func (m *MockClock) After(d time.Duration) <-chan time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := &mockTimer{clock: m, when: m.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- m.now
+		return t.c
+	}
+	m.timers = append(m.timers, t)
+	return t.c
+}
+
+func (m *MockClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for MockClock.NewTicker")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := &mockTimer{clock: m, when: m.now.Add(d), period: d, c: make(chan time.Time, 1)}
+	m.timers = append(m.timers, t)
+	return t
+}
+
+// Add moves the clock forward by d, firing the due timers and tickers in
+// time order. Like a time.Ticker, a ticker whose previous tick has not been
+// received drops the tick.
+func (m *MockClock) Add(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	end := m.now.Add(d)
+	for {
+		sort.Sort(mockTimers(m.timers))
+		if len(m.timers) == 0 || m.timers[0].when.After(end) {
+			break
+		}
+		t := m.timers[0]
+		m.now = t.when
+		select {
+		case t.c <- m.now:
+		default:
+		}
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			m.timers = m.timers[1:]
+		}
+	}
+	m.now = end
+}
+
+func (t *mockTimer) C() <-chan time.Time { return t.c }
+
+func (t *mockTimer) Stop() {
+	m := t.clock
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, other := range m.timers {
+		if other == t {
+			m.timers = append(m.timers[:i], m.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+type mockTimers []*mockTimer
+
+func (t mockTimers) Len() int           { return len(t) }
+func (t mockTimers) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t mockTimers) Less(i, j int) bool { return t[i].when.Before(t[j].when) }
+
+// pending returns the number of timers and tickers that have not fired, for
+// the tests to wait for a goroutine to set its timer before moving the
+// clock.
+func (m *MockClock) pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.timers)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+// outputConn is the connection of an output that writes to a socket. It is
+// dialed again when the peer has closed it, or when a write on it fails, in
+// which case the write is retried once, further retries being left to the
+// buffer and the next flush.
+type outputConn struct {
+	// Output names the output in the logs, Peer the server in the errors,
+	// ie, "OpenTSDB at localhost:4242".
+	Output string
+	Peer   string
+
+	Network string
+	Address string
+	// Timeout bounds connecting and each write.
+	Timeout time.Duration
+	// Replied, when set, is given what the peer sent between two writes,
+	// which is otherwise discarded.
+	Replied func(b []byte)
+
+	conn net.Conn
+}
+
+// dial opens the connection, closing the previous one if any.
+func (c *outputConn) dial() error {
+	c.Close()
+	conn, err := net.DialTimeout(c.Network, c.Address, c.Timeout)
+	if err != nil {
+		return fmt.Errorf("unable to connect to %s: %s", c.Peer, err)
+	}
+	c.conn = conn
+	return nil
+}
+
+func (c *outputConn) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// isStream reports whether the connection is a stream, which the peer may
+// close, rather than datagrams.
+func (c *outputConn) isStream() bool {
+	switch c.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return true
+	}
+	return false
+}
+
+// ready dials the connection when it is not open, or when the peer has
+// closed the stream, it is called before the writes of a batch.
+func (c *outputConn) ready() error {
+	if c.conn != nil && (!c.isStream() || c.alive()) {
+		return nil
+	}
+	return c.dial()
+}
+
+// alive reports whether the peer has not closed a stream. A write on a
+// stream closed by the peer succeeds, but its data is lost, so this is
+// checked with a read before writing; the peer is not expected to send
+// anything, but what it does goes to Replied.
+func (c *outputConn) alive() bool {
+	c.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	defer c.conn.SetReadDeadline(time.Time{})
+	b := make([]byte, 512)
+	n, err := c.conn.Read(b)
+	if n > 0 && c.Replied != nil {
+		c.Replied(b[:n])
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return true
+	}
+	return err == nil
+}
+
+// write writes b, within Timeout.
+func (c *outputConn) write(b []byte) error {
+	return c.do(func(conn net.Conn) error {
+		if c.Timeout > 0 {
+			conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+		}
+		_, err := conn.Write(b)
+		return err
+	})
+}
+
+// do runs send on the connection, dialing it first if it is closed, and
+// once more on a new connection if it fails.
+func (c *outputConn) do(send func(conn net.Conn) error) error {
+	if c.conn == nil {
+		if err := c.dial(); err != nil {
+			return err
+		}
+	}
+	if err := send(c.conn); err != nil {
+		log.Printf("D! Output [%s] write to %s failed, reconnecting: %s",
+			c.Output, c.Peer, err)
+		if err := c.dial(); err != nil {
+			return err
+		}
+		if err := send(c.conn); err != nil {
+			c.Close()
+			return fmt.Errorf("error writing to %s: %s", c.Peer, err)
+		}
+	}
+	return nil
+}
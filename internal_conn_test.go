@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestOutputConnReconnectsWhenPeerCloses(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// the first connection is closed by the server, the next ones are read
+	lines := make(chan string, 10)
+	accepted := make(chan struct{}, 10)
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- struct{}{}
+			if n == 0 {
+				conn.Close()
+				continue
+			}
+			go func() {
+				defer conn.Close()
+				s := bufio.NewScanner(conn)
+				for s.Scan() {
+					lines <- s.Text()
+				}
+			}()
+		}
+	}()
+
+	c := &outputConn{
+		Output:  "test",
+		Peer:    ln.Addr().String(),
+		Network: "tcp",
+		Address: ln.Addr().String(),
+		Timeout: 5 * time.Second,
+	}
+	if err := c.dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-accepted
+	time.Sleep(10 * time.Millisecond)
+
+	if err := c.ready(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.write([]byte("cpu value=1\n")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-lines:
+		if line != "cpu value=1" {
+			t.Errorf("unexpected line %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the write was lost")
+	}
+	if n := len(accepted); n != 1 {
+		t.Errorf("expected a single reconnect, got %d", n)
+	}
+}
+
+func TestOutputConnDialError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c := &outputConn{Output: "test", Peer: "Test at " + addr, Network: "tcp",
+		Address: addr, Timeout: time.Second}
+	if err := c.write([]byte("x")); err == nil {
+		t.Error("expected an error")
+	}
+	if c.conn != nil {
+		t.Error("expected no connection")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Filter matches strings against a list of glob patterns, where "*" matches
+// any run of characters, "/" included, and "?" any single character. Any
+// other character, "[" and "\" included, matches itself.
+type Filter interface {
+	Match(s string) bool
+}
+
+// TagFilter matches the value of a tag, an entry of the tagpass or tagdrop
+// table of a plugin.
+type TagFilter struct {
+	Name   string
+	Filter Filter
+}
+
+// matchTagFilters reports whether the value of a tag in tags matches any of
+// the filters. A tag that is not set matches none.
+func matchTagFilters(filters []TagFilter, tags map[string]string) bool {
+	for _, f := range filters {
+		if v, ok := tags[f.Name]; ok && f.Filter.Match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+type globFilter struct {
+	exact map[string]bool
+	globs []*regexp.Regexp
+}
+
+// CompileFilter compiles the patterns into a Filter, once, so that matching
+// does not parse them again. It returns nil when there are no patterns, so
+// that callers can tell "no filter" apart.
+func CompileFilter(patterns []string) (Filter, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	f := &globFilter{exact: make(map[string]bool)}
+	for _, p := range patterns {
+		if !strings.ContainsAny(p, "*?") {
+			f.exact[p] = true
+			continue
+		}
+		quoted := regexp.QuoteMeta(p)
+		quoted = strings.Replace(quoted, `\*`, ".*", -1)
+		quoted = strings.Replace(quoted, `\?`, ".", -1)
+		re, err := regexp.Compile("^" + quoted + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", p, err)
+		}
+		f.globs = append(f.globs, re)
+	}
+	return f, nil
+}
+
+func (f *globFilter) Match(s string) bool {
+	if f.exact[s] {
+		return true
+	}
+	for _, re := range f.globs {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		pattern string
+		match   []string
+		nomatch []string
+	}{
+		{"cpu", []string{"cpu"}, []string{"cpu0", "cp"}},
+		{"cpu*", []string{"cpu", "cpu0", "cpu/total"}, []string{"acpu"}},
+		{"c?u", []string{"cpu", "cxu"}, []string{"cu", "cpuu"}},
+		{"/dev/sd*", []string{"/dev/sda1"}, []string{"/dev/hda"}},
+		// "[" and "\" are not special
+		{"disk[0]", []string{"disk[0]"}, []string{"disk0"}},
+		{"disk[0]*", []string{"disk[0]a"}, []string{"disk0a"}},
+		{"disk[", []string{"disk["}, nil},
+		{`C:\temp*`, []string{`C:\temp`, `C:\temp2`}, []string{"C:temp"}},
+		{"a.b+c", []string{"a.b+c"}, []string{"aXb+c", "abbc"}},
+	}
+	for _, tt := range tests {
+		f, err := CompileFilter([]string{tt.pattern})
+		if err != nil {
+			t.Errorf("%s: %s", tt.pattern, err)
+			continue
+		}
+		for _, s := range tt.match {
+			if !f.Match(s) {
+				t.Errorf("%s: expected %q to match", tt.pattern, s)
+			}
+		}
+		for _, s := range tt.nomatch {
+			if f.Match(s) {
+				t.Errorf("%s: expected %q not to match", tt.pattern, s)
+			}
+		}
+	}
+
+	if f, err := CompileFilter(nil); f != nil || err != nil {
+		t.Errorf("expected no filter, got %v %v", f, err)
+	}
+}
+
+func BenchmarkFilterMatch(b *testing.B) {
+	f, err := CompileFilter([]string{"/", "/var", "/dev/sd*", "/zones/*/root"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Match("/zones/web1/root")
+		f.Match("/var")
+	}
+}
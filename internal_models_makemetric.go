@@ -35,9 +35,6 @@ func makemetric(
 	if len(fields) == 0 || len(measurement) == 0 {
 		return nil
 	}
-	if tags == nil {
-		tags = make(map[string]string)
-	}
 
 	// Override measurement name if set
 	if len(nameOverride) != 0 {
@@ -51,18 +48,7 @@ func makemetric(
 		measurement = measurement + nameSuffix
 	}
 
-	// Apply plugin-wide tags if set
-	for k, v := range pluginTags {
-		if _, ok := tags[k]; !ok {
-			tags[k] = v
-		}
-	}
-	// Apply daemon-wide tags if set
-	for k, v := range daemonTags {
-		if _, ok := tags[k]; !ok {
-			tags[k] = v
-		}
-	}
+	tags = mergeTags(tags, pluginTags, daemonTags)
 
 	for k, v := range tags {
 		if strings.HasSuffix(k, `\`) {
@@ -126,15 +112,6 @@ func makemetric(
 		case float32:
 			fields[k] = float64(val)
 			continue
-		case float64:
-			// NaNs are invalid values in influxdb, skip measurement
-			if math.IsNaN(val) || math.IsInf(val, 0) {
-				log.Printf("D! Measurement [%s] field [%s] has a NaN or Inf "+
-					"field, skipping",
-					measurement, k)
-				delete(fields, k)
-				continue
-			}
 		case string:
 			fields[k] = v
 		default:
@@ -142,6 +119,12 @@ func makemetric(
 		}
 	}
 
+	if !dropNonFinite(measurement, fields) {
+		log.Printf("W! Measurement [%s] has no valid fields left, dropping",
+			measurement)
+		return nil
+	}
+
 	m, err := New(measurement, tags, fields, t, mType)
 	if err != nil {
 		log.Printf("Error adding point [%s]: %s\n", measurement, err.Error())
@@ -150,3 +133,51 @@ func makemetric(
 
 	return m
 }
+
+// dropNonFinite removes the NaN and Inf float fields, which InfluxDB rejects
+// along with the rest of the batch, with a warning, and returns whether any
+// field is left. The parsers use it too, before making their metrics, so
+// that these values are handled the same whatever the data format.
+func dropNonFinite(measurement string, fields map[string]interface{}) bool {
+	for k, v := range fields {
+		var f float64
+		switch val := v.(type) {
+		case float64:
+			f = val
+		case float32:
+			f = float64(val)
+		default:
+			continue
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			log.Printf("W! Measurement [%s] field [%s] has a NaN or Inf "+
+				"value, skipping", measurement, k)
+			delete(fields, k)
+		}
+	}
+	return len(fields) > 0
+}
+
+// mergeTags sets the tags of a metric from its three sources, each only
+// where the tag is not set yet, so that the precedence is the same wherever
+// tags are merged:
+//
+//   1. runtime, the tags the plugin sets on the metric, win,
+//   2. then static, the tags configured for the plugin, ie, its
+//      [inputs.*.tags] table,
+//   3. then global, the [global_tags].
+//
+// runtime is filled in place, or allocated when nil, and returned.
+func mergeTags(runtime, static, global map[string]string) map[string]string {
+	if runtime == nil {
+		runtime = make(map[string]string, len(static)+len(global))
+	}
+	for _, tags := range []map[string]string{static, global} {
+		for k, v := range tags {
+			if _, ok := runtime[k]; !ok {
+				runtime[k] = v
+			}
+		}
+	}
+	return runtime
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeTagsPrecedence(t *testing.T) {
+	runtime := map[string]string{"dc": "runtime", "a": "1"}
+	static := map[string]string{"dc": "static", "b": "2"}
+	global := map[string]string{"dc": "global", "b": "global", "c": "3"}
+
+	got := mergeTags(runtime, static, global)
+	want := map[string]string{"dc": "runtime", "a": "1", "b": "2", "c": "3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	got = mergeTags(nil, map[string]string{"dc": "static"},
+		map[string]string{"dc": "global"})
+	if got["dc"] != "static" {
+		t.Errorf("expected the static tag over the global one, got %v", got)
+	}
+	if _, ok := static["c"]; ok {
+		t.Error("expected the static tags to be left untouched")
+	}
+}
+
+// TestMakeMetricTagPrecedence checks the precedence of the tags of a metric
+// added through the accumulator of an input.
+func TestMakeMetricTagPrecedence(t *testing.T) {
+	ri := NewRunningInput(nil, &InputConfig{
+		Name: "test",
+		Tags: map[string]string{"dc": "static", "rack": "static"},
+	})
+	ri.SetDefaultTags(map[string]string{"dc": "global", "rack": "global",
+		"host": "global"})
+
+	m := ri.MakeMetric("test", map[string]interface{}{"value": 1.0},
+		map[string]string{"dc": "runtime"}, Untyped, time.Now())
+	want := map[string]string{"dc": "runtime", "rack": "static", "host": "global"}
+	if !reflect.DeepEqual(m.Tags(), want) {
+		t.Errorf("expected %v, got %v", want, m.Tags())
+	}
+}
+
+// TestNonFiniteFieldsDropped checks that NaN and Inf fields are dropped the
+// same way by the parsers and by the accumulator, a metric being dropped
+// only once it has no field left.
+func TestNonFiniteFieldsDropped(t *testing.T) {
+	value := &ValueParser{MetricName: "value", DataType: "float"}
+	for _, s := range []string{"NaN", "+Inf", "-Inf"} {
+		if m, err := value.Parse([]byte(s)); err != nil || len(m) != 0 {
+			t.Errorf("value %s: expected no metric, got %v %v", s, m, err)
+		}
+	}
+
+	opentsdb := &OpenTSDBParser{}
+	if m, err := opentsdb.ParseLine("put sys.cpu 1500000000 NaN"); err != nil || m != nil {
+		t.Errorf("opentsdb: expected no metric, got %v %v", m, err)
+	}
+
+	prom := &PrometheusParser{}
+	metrics, err := prom.Parse([]byte("# TYPE rpc summary\n" +
+		"rpc{quantile=\"0.5\"} NaN\nrpc_sum 3\nrpc_count 2\n" +
+		"up NaN\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("prometheus: expected 1 metric, got %d", len(metrics))
+	}
+	if fields := metrics[0].Fields(); len(fields) != 2 {
+		t.Errorf("prometheus: expected the sum and count fields, got %v", fields)
+	}
+
+	m := makemetric("m", map[string]interface{}{"a": math.NaN(), "b": 1.0},
+		nil, "", "", "", nil, nil, false, Untyped, time.Now())
+	if m == nil || !reflect.DeepEqual(m.Fields(), map[string]interface{}{"b": 1.0}) {
+		t.Errorf("makemetric: expected the b field only, got %v", m)
+	}
+	m = makemetric("m", map[string]interface{}{"a": float32(math.Inf(1))},
+		nil, "", "", "", nil, nil, false, Untyped, time.Now())
+	if m != nil {
+		t.Errorf("makemetric: expected no metric, got %v", m)
+	}
+}
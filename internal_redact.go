@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// redacted replaces the secrets in config dumps and logs.
+const redacted = "***"
+
+// minSecretLength is the length below which a secret value is not redacted
+// from free text, where it would match all over.
+const minSecretLength = 4
+
+// secretSettingWords are the words that make a setting a secret when its
+// name contains one, ie, "password" or "api_token".
+var secretSettingWords = []string{"password", "passwd", "secret", "token",
+	"api_key", "apikey", "private_key", "credentials"}
+
+var (
+	secretValuesMu sync.RWMutex
+	secretValues   = make(map[string]struct{})
+)
+
+func isSecretSetting(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range secretSettingWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// addSecretValue registers the value of a secret, from the [secrets] table
+// or a secret setting, to be redacted wherever it appears in the logs or
+// config dumps, ie, in a URL of an error message.
+func addSecretValue(value string) {
+	if len(value) < minSecretLength {
+		return
+	}
+	secretValuesMu.Lock()
+	secretValues[value] = struct{}{}
+	secretValuesMu.Unlock()
+}
+
+// urlPasswordRe matches the userinfo of a URL with a password, ie,
+// "http://user:pass@", the password in its second group.
+var urlPasswordRe = regexp.MustCompile(
+	`([a-zA-Z][a-zA-Z0-9+.-]*://[^/?#@\s"':]*:)([^/?#@\s"']*)@`)
+
+// redactSecrets returns s with the registered secret values, and the
+// passwords of the URLs, replaced by "***".
+func redactSecrets(s string) string {
+	secretValuesMu.RLock()
+	for value := range secretValues {
+		if strings.Contains(s, value) {
+			s = strings.Replace(s, value, redacted, -1)
+		}
+	}
+	secretValuesMu.RUnlock()
+	if strings.Contains(s, "://") {
+		s = urlPasswordRe.ReplaceAllString(s, "${1}"+redacted+"@")
+	}
+	return s
+}
+
+// redactURL returns u with the password of its userinfo, if any, replaced
+// by "***", for the URLs of errors and logs. A URL that does not parse is
+// cut before its userinfo.
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		if i := strings.LastIndex(u, "@"); i >= 0 {
+			if j := strings.Index(u, "://"); j >= 0 && j < i {
+				return u[:j+3] + redacted + u[i:]
+			}
+		}
+		return u
+	}
+	if parsed.User == nil {
+		return u
+	}
+	if _, ok := parsed.User.Password(); ok {
+		parsed.User = url.UserPassword(parsed.User.Username(), redacted)
+	}
+	return parsed.String()
+}
+
+// hasSecretValues reports whether any secret value is registered, so that
+// callers can skip redacting.
+func hasSecretValues() bool {
+	secretValuesMu.RLock()
+	defer secretValuesMu.RUnlock()
+	return len(secretValues) > 0
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		part, total uint64
+		want        float64
+	}{
+		{0, 0, 0},
+		{5, 0, 0},
+		{0, 10, 0},
+		{25, 100, 25},
+		{10, 10, 100},
+		{1, 3, 33.33},
+		{2, 3, 66.67},
+		{1, 8, 12.5},
+		// 0.625% is rounded half up
+		{1, 160, 0.63},
+		{1, 100000, 0},
+		{1, 20000, 0.01},
+	}
+	for _, tt := range tests {
+		if got := percent(tt.part, tt.total); got != tt.want {
+			t.Errorf("percent(%d, %d): expected %v, got %v", tt.part, tt.total,
+				tt.want, got)
+		}
+	}
+}
+
+func TestRandomDurationSeeded(t *testing.T) {
+	defer func() {
+		jitterMu.Lock()
+		jitterRand = nil
+		jitterMu.Unlock()
+	}()
+
+	want := []time.Duration{4231278675, 6543856411, 8101878760}
+	for run := 0; run < 2; run++ {
+		SetJitterSeed(42)
+		for i, w := range want {
+			if got := RandomDuration(10 * time.Second); got != w {
+				t.Errorf("run %d, draw %d: expected %s, got %s", run, i, w, got)
+			}
+		}
+	}
+	if d := RandomDuration(0); d != 0 {
+		t.Errorf("expected no jitter for a max of 0, got %s", d)
+	}
+}
@@ -6,6 +6,11 @@ import (
 
 )
 
+// JsonSerializer writes a metric as a JSON object on a line of its own, ie:
+//
+//     {"fields":{"n":3,"usage":1.5},"name":"cpu","tags":{"host":"a"},"timestamp":1500000000}
+//
+// Integer fields are written without a fraction, so they stay integers.
 type JsonSerializer struct {
 	TimestampUnits time.Duration
 }
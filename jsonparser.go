@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 	"time"
@@ -13,13 +14,18 @@ type JSONParser struct {
 	MetricName  string
 	TagKeys     []string
 	DefaultTags map[string]string
+	// TimestampUnits is the unit of the timestamp of the objects written by
+	// the json serializer, 1s by default as for the serializer.
+	TimestampUnits time.Duration
 }
 
 func (p *JSONParser) parseArray(buf []byte) ([]Metric, error) {
 	metrics := make([]Metric, 0)
 
 	var jsonOut []map[string]interface{}
-	err := json.Unmarshal(buf, &jsonOut)
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	err := dec.Decode(&jsonOut)
 	if err != nil {
 		err = fmt.Errorf("unable to parse out as JSON Array, %s", err)
 		return nil, err
@@ -31,6 +37,16 @@ func (p *JSONParser) parseArray(buf []byte) ([]Metric, error) {
 }
 
 func (p *JSONParser) parseObject(metrics []Metric, jsonOut map[string]interface{}) ([]Metric, error) {
+	if m, ok, err := p.parseSerialized(jsonOut); ok {
+		if err != nil {
+			return nil, err
+		}
+		return append(metrics, m), nil
+	}
+	// the numbers were decoded as json.Number, to keep the integers of the
+	// serialized metrics, the other objects are flattened to floats
+	floatNumbers(jsonOut)
+
 
 	tags := make(map[string]string)
 	for k, v := range p.DefaultTags {
@@ -70,19 +86,130 @@ func (p *JSONParser) Parse(buf []byte) ([]Metric, error) {
 	}
 
 	if !isarray(buf) {
-		metrics := make([]Metric, 0)
+		return p.parseObjects(buf)
+	}
+	return p.parseArray(buf)
+}
+
+// parseObjects parses one JSON object, or several one after another such as
+// the JSON lines written by the json serializer.
+func (p *JSONParser) parseObjects(buf []byte) ([]Metric, error) {
+	metrics := make([]Metric, 0)
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	for {
 		var jsonOut map[string]interface{}
-		err := json.Unmarshal(buf, &jsonOut)
+		err := dec.Decode(&jsonOut)
+		if err == io.EOF {
+			return metrics, nil
+		}
 		if err != nil {
 			err = fmt.Errorf("unable to parse out as JSON, %s", err)
 			return nil, err
 		}
-		return p.parseObject(metrics, jsonOut)
+		metrics, err = p.parseObject(metrics, jsonOut)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return p.parseArray(buf)
+}
+
+// parseSerialized reads back a metric written by the json serializer, an
+// object of its name, tags, fields and timestamp, and returns false for any
+// other object. The integer fields stay integers, and the default tags are
+// added to the tags of the metric.
+func (p *JSONParser) parseSerialized(obj map[string]interface{}) (Metric, bool, error) {
+	if len(obj) > 4 {
+		return nil, false, nil
+	}
+	for k := range obj {
+		switch k {
+		case "name", "tags", "fields", "timestamp":
+		default:
+			return nil, false, nil
+		}
+	}
+	name, ok := obj["name"].(string)
+	if !ok {
+		return nil, false, nil
+	}
+	fieldsIn, ok := obj["fields"].(map[string]interface{})
+	if !ok {
+		return nil, false, nil
+	}
+	tagsIn, _ := obj["tags"].(map[string]interface{})
+	if _, ok := obj["tags"]; ok && tagsIn == nil {
+		return nil, false, nil
+	}
+
+	tags := make(map[string]string, len(p.DefaultTags)+len(tagsIn))
+	for k, v := range p.DefaultTags {
+		tags[k] = v
+	}
+	for k, v := range tagsIn {
+		s, ok := v.(string)
+		if !ok {
+			return nil, false, nil
+		}
+		tags[k] = s
+	}
+
+	fields := make(map[string]interface{}, len(fieldsIn))
+	for k, v := range fieldsIn {
+		switch v := v.(type) {
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				fields[k] = i
+			} else if f, err := v.Float64(); err == nil {
+				fields[k] = f
+			} else {
+				return nil, true, fmt.Errorf("invalid value %s of field %s", v, k)
+			}
+		case string, bool:
+			fields[k] = v
+		}
+	}
+
+	t := time.Now().UTC()
+	if ts, ok := obj["timestamp"].(json.Number); ok {
+		n, err := ts.Int64()
+		if err != nil {
+			return nil, true, fmt.Errorf("invalid timestamp %s", ts)
+		}
+		units := p.TimestampUnits
+		if units <= 0 {
+			units = time.Second
+		}
+		t = time.Unix(0, n*int64(units)).UTC()
+	}
+
+	m, err := New(name, tags, fields, t)
+	return m, true, err
+}
+
+// floatNumbers replaces the json.Number values of v with float64, as
+// decoded without UseNumber.
+func floatNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = floatNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = floatNumbers(e)
+		}
+	}
+	return v
 }
 
 func (p *JSONParser) ParseLine(line string) (Metric, error) {
+	if blankLine(line) {
+		return nil, nil
+	}
 	metrics, err := p.Parse([]byte(line + "\n"))
 
 	if err != nil {
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJSONParserReadsSerializedMetrics(t *testing.T) {
+	now := time.Unix(1500000000, 0).UTC()
+	in := []Metric{}
+	for _, fields := range []map[string]interface{}{
+		{"usage": 1.5, "n": int64(3), "ok": true, "state": "up"},
+		{"n": int64(-1)},
+	} {
+		m, err := New("cpu", map[string]string{"host": "web1"}, fields, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in = append(in, m)
+	}
+
+	for _, units := range []time.Duration{0, time.Millisecond} {
+		serializer, _ := NewJsonSerializer(units)
+		var buf []byte
+		for _, m := range in {
+			b, err := serializer.Serialize(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf = append(buf, b...)
+		}
+
+		parser := &JSONParser{
+			MetricName:     "ignored",
+			DefaultTags:    map[string]string{"dc": "east"},
+			TimestampUnits: units,
+		}
+		out, err := parser.Parse(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != len(in) {
+			t.Fatalf("expected %d metrics, got %d", len(in), len(out))
+		}
+		for i, m := range out {
+			if m.Name() != "cpu" {
+				t.Errorf("expected the name cpu, got %s", m.Name())
+			}
+			tags := map[string]string{"host": "web1", "dc": "east"}
+			if !reflect.DeepEqual(m.Tags(), tags) {
+				t.Errorf("expected the tags %v, got %v", tags, m.Tags())
+			}
+			if !reflect.DeepEqual(m.Fields(), in[i].Fields()) {
+				t.Errorf("expected the fields %v, got %v", in[i].Fields(), m.Fields())
+			}
+			if !m.Time().Equal(now) {
+				t.Errorf("expected the time %s, got %s", now, m.Time())
+			}
+		}
+	}
+}
+
+func TestJSONParserFlattensOtherObjects(t *testing.T) {
+	parser := &JSONParser{MetricName: "app", TagKeys: []string{"host"}}
+	out, err := parser.Parse([]byte(`{"host":"web1","name":"x","a":{"b":5},"c":[1,2.5]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 {
+		t.Fatalf("expected 1 metric, got %d", len(out))
+	}
+	fields := map[string]interface{}{"a_b": 5.0, "c_0": 1.0, "c_1": 2.5}
+	if out[0].Name() != "app" || !reflect.DeepEqual(out[0].Fields(), fields) {
+		t.Errorf("expected app %v, got %s %v", fields, out[0].Name(), out[0].Fields())
+	}
+	if out[0].Tags()["host"] != "web1" {
+		t.Errorf("expected the host tag, got %v", out[0].Tags())
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// KeyValueParser parses lines of key/value pairs into one metric per line,
+// ie, "read:12;write:3;state:ok" with the pair delimiter ";" and the
+// separator ":". Keys and values can be double quoted, with \" and \\
+// escapes, to hold the delimiter or the separator. Unquoted values are typed
+// as the first of int, float and bool they are valid for, quoted values are
+// always strings.
+type KeyValueParser struct {
+	MetricName string
+	// PairDelimiter separates the pairs of a line, defaults to " ". Empty
+	// pairs, ie, of repeated delimiters, are ignored.
+	PairDelimiter string
+	// Separator separates the key of a pair from its value, defaults to "=".
+	Separator string
+	// TagKeys are the keys whose values are tags rather than fields.
+	TagKeys     []string
+	DefaultTags map[string]string
+	// BareKeys makes a key without a separator a true boolean field, as in
+	// logfmt, rather than an error.
+	BareKeys bool
+}
+
+func (p *KeyValueParser) Parse(buf []byte) ([]Metric, error) {
+	metrics := make([]Metric, 0)
+	for _, line := range strings.Split(string(buf), "\n") {
+		m, err := p.ParseLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics, nil
+}
+
+func (p *KeyValueParser) ParseLine(line string) (Metric, error) {
+	if blankLine(line) {
+		return nil, nil
+	}
+	delimiter := p.PairDelimiter
+	if delimiter == "" {
+		delimiter = " "
+	}
+	separator := p.Separator
+	if separator == "" {
+		separator = "="
+	}
+
+	tags := make(map[string]string)
+	for k, v := range p.DefaultTags {
+		tags[k] = v
+	}
+	fields := make(map[string]interface{})
+
+	pairs, err := splitQuoted(strings.TrimRight(line, "\r"), delimiter, -1)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse line %q: %s", line, err)
+	}
+	for _, pair := range pairs {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv, err := splitQuoted(pair, separator, 2)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse line %q: %s", line, err)
+		}
+		if len(kv) == 1 && p.BareKeys {
+			kv = append(kv, "true")
+		}
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("unable to parse line %q: pair %q has no %q",
+				line, strings.TrimSpace(pair), separator)
+		}
+		key, _ := unquoteKeyValue(kv[0])
+		if key == "" {
+			return nil, fmt.Errorf("unable to parse line %q: empty key", line)
+		}
+		value, quoted := unquoteKeyValue(kv[1])
+
+		if sliceContains(key, p.TagKeys) {
+			tags[key] = value
+			continue
+		}
+		if quoted {
+			fields[key] = value
+			continue
+		}
+		fields[key], _ = inferValue(value, value)
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("unable to parse line %q: no fields", line)
+	}
+	return New(p.MetricName, tags, fields, time.Now().UTC())
+}
+
+func (p *KeyValueParser) SetDefaultTags(tags map[string]string) {
+	p.DefaultTags = tags
+}
+
+// splitQuoted splits s around sep, at most n parts if n is positive, except
+// where sep is within double quotes.
+func splitQuoted(s, sep string, n int) ([]string, error) {
+	var parts []string
+	start := 0
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inQuote && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && strings.HasPrefix(s[i:], sep) &&
+			(n <= 0 || len(parts) < n-1):
+			parts = append(parts, s[start:i])
+			i += len(sep) - 1
+			start = i + 1
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	return append(parts, s[start:]), nil
+}
+
+// unquoteKeyValue trims s and removes its double quotes and escapes, if it
+// is quoted, returning whether it was.
+func unquoteKeyValue(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s, false
+	}
+	s = s[1 : len(s)-1]
+	var unquoted []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		unquoted = append(unquoted, s[i])
+	}
+	return string(unquoted), true
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLogfmtParser(t *testing.T) {
+	parser, err := NewParser(&ParserConfig{
+		DataFormat: "logfmt",
+		MetricName: "app",
+		TagKeys:    []string{"level"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := parser.ParseLine(`level=info msg="request done" duration=12 ratio=0.5 cached`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := map[string]string{"level": "info"}
+	fields := map[string]interface{}{"msg": "request done", "duration": int64(12),
+		"ratio": 0.5, "cached": true}
+	if m.Name() != "app" || !reflect.DeepEqual(m.Tags(), tags) ||
+		!reflect.DeepEqual(m.Fields(), fields) {
+		t.Errorf("expected app %v %v, got %s %v %v", tags, fields, m.Name(),
+			m.Tags(), m.Fields())
+	}
+
+	// the keyvalue data format requires a value
+	kv := &KeyValueParser{MetricName: "app"}
+	if _, err := kv.ParseLine("a=1 cached"); err == nil {
+		t.Error("expected an error for a bare key")
+	}
+}
+
+func TestKeyValueParserDelimiters(t *testing.T) {
+	parser, err := NewParser(&ParserConfig{
+		DataFormat:            "keyvalue",
+		MetricName:            "zpool",
+		KeyValuePairDelimiter: ";",
+		KeyValueSeparator:     ":",
+		TagKeys:               []string{"pool"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := parser.Parse([]byte(
+		"pool:rpool;read:12;;write:3.5;state:ok;degraded:false\n" +
+			`pool:"tank;1";note:"a:b \"c\"";"odd key":7` + "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 metrics, got %d", len(metrics))
+	}
+
+	tags := map[string]string{"pool": "rpool"}
+	fields := map[string]interface{}{"read": int64(12), "write": 3.5,
+		"state": "ok", "degraded": false}
+	if !reflect.DeepEqual(metrics[0].Tags(), tags) ||
+		!reflect.DeepEqual(metrics[0].Fields(), fields) {
+		t.Errorf("expected %v %v, got %v %v", tags, fields,
+			metrics[0].Tags(), metrics[0].Fields())
+	}
+
+	// quoted keys and values hold the delimiter, the separator and escapes
+	tags = map[string]string{"pool": "tank;1"}
+	fields = map[string]interface{}{"note": `a:b "c"`, "odd key": int64(7)}
+	if !reflect.DeepEqual(metrics[1].Tags(), tags) ||
+		!reflect.DeepEqual(metrics[1].Fields(), fields) {
+		t.Errorf("expected %v %v, got %v %v", tags, fields,
+			metrics[1].Tags(), metrics[1].Fields())
+	}
+
+	// a quoted value is always a string
+	m, err := parser.ParseLine(`read:"12"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := m.Fields()["read"]; v != "12" {
+		t.Errorf("expected the quoted value to be a string, got %#v", v)
+	}
+}
+
+func TestKeyValueParserErrors(t *testing.T) {
+	parser := &KeyValueParser{MetricName: "app", PairDelimiter: ",", Separator: "="}
+	for _, line := range []string{`a="unterminated`, "a=1,=2", "a", "host"} {
+		if _, err := parser.ParseLine(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+
+	_, err := NewParser(&ParserConfig{
+		DataFormat:            "keyvalue",
+		KeyValuePairDelimiter: ":",
+		KeyValueSeparator:     ":",
+	})
+	if err == nil {
+		t.Error("expected an error with the same delimiter and separator")
+	}
+}
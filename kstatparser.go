@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// KstatParser parses the output of 'kstat -p', one statistic per line:
+//
+//     module:instance:name:statistic	value
+//
+// into metrics named after the module, tagged with the instance and name,
+// with the statistics as fields. Parse groups the statistics of the same
+// module, instance and name into a single metric, ParseLine gives a metric
+// of one field. Values are typed as the first of int, float and bool they
+// are valid for, falling back to strings, ie, for the class statistic.
+type KstatParser struct {
+	DefaultTags map[string]string
+}
+
+func (p *KstatParser) Parse(buf []byte) ([]Metric, error) {
+	type kstat struct {
+		module string
+		tags   map[string]string
+		fields map[string]interface{}
+	}
+	var order []string
+	kstats := make(map[string]*kstat)
+	for _, line := range strings.Split(string(buf), "\n") {
+		if blankLine(line) {
+			continue
+		}
+		module, instance, name, stat, value, err := splitKstatLine(line)
+		if err != nil {
+			return nil, err
+		}
+		key := module + ":" + instance + ":" + name
+		k, ok := kstats[key]
+		if !ok {
+			k = &kstat{
+				module: module,
+				tags:   p.tags(instance, name),
+				fields: make(map[string]interface{}),
+			}
+			kstats[key] = k
+			order = append(order, key)
+		}
+		k.fields[stat], _ = inferValue(value, value)
+	}
+
+	now := time.Now().UTC()
+	metrics := make([]Metric, 0, len(order))
+	for _, key := range order {
+		k := kstats[key]
+		m, err := New(k.module, k.tags, k.fields, now)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+func (p *KstatParser) ParseLine(line string) (Metric, error) {
+	if blankLine(line) {
+		return nil, nil
+	}
+	module, instance, name, stat, value, err := splitKstatLine(line)
+	if err != nil {
+		return nil, err
+	}
+	v, _ := inferValue(value, value)
+	return New(module, p.tags(instance, name),
+		map[string]interface{}{stat: v}, time.Now().UTC())
+}
+
+func (p *KstatParser) SetDefaultTags(tags map[string]string) {
+	p.DefaultTags = tags
+}
+
+func (p *KstatParser) tags(instance, name string) map[string]string {
+	tags := make(map[string]string, len(p.DefaultTags)+2)
+	for k, v := range p.DefaultTags {
+		tags[k] = v
+	}
+	tags["instance"] = instance
+	tags["name"] = name
+	return tags
+}
+
+// splitKstatLine splits a line of 'kstat -p'. The value is separated from
+// the statistic by a tab, or by spaces when the tabs were lost, ie, through
+// a shell pipeline; string values may contain spaces.
+func splitKstatLine(line string) (module, instance, name, stat, value string, err error) {
+	line = strings.TrimSpace(line)
+	i := strings.Index(line, "\t")
+	if i < 0 {
+		i = strings.IndexAny(line, " ")
+	}
+	if i < 0 {
+		return "", "", "", "", "", fmt.Errorf("unable to parse kstat line %q: no value", line)
+	}
+	value = strings.TrimSpace(line[i+1:])
+	parts := strings.SplitN(line[:i], ":", 4)
+	if len(parts) != 4 || parts[0] == "" || parts[3] == "" {
+		return "", "", "", "", "", fmt.Errorf(
+			"unable to parse kstat line %q: expected module:instance:name:statistic", line)
+	}
+	return parts[0], parts[1], parts[2], parts[3], value, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const kstatParserFixture = `zfs:0:arcstats:hits	3081123
+zfs:0:arcstats:misses	29371
+zfs:0:arcstats:class	misc
+cpu_info:0:cpu_info0:brand	SPARC-T4
+cpu_info:0:cpu_info0:clock_MHz	2848
+cpu_info:1:cpu_info1:brand	SPARC-T4
+cpu_info:1:cpu_info1:clock_MHz	2848
+zfs:0:arcstats:c_max	0.5
+unix:0:system_misc:ncpus 2
+unix:0:system_misc:snaptime 1814624.7290934
+`
+
+func TestKstatParser(t *testing.T) {
+	parser, err := NewParser(&ParserConfig{DataFormat: "kstat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser.SetDefaultTags(map[string]string{"host": "sol1"})
+	metrics, err := parser.Parse([]byte(kstatParserFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name   string
+		tags   map[string]string
+		fields map[string]interface{}
+	}{
+		{"zfs", map[string]string{"host": "sol1", "instance": "0", "name": "arcstats"},
+			map[string]interface{}{"hits": int64(3081123), "misses": int64(29371),
+				"class": "misc", "c_max": 0.5}},
+		{"cpu_info", map[string]string{"host": "sol1", "instance": "0", "name": "cpu_info0"},
+			map[string]interface{}{"brand": "SPARC-T4", "clock_MHz": int64(2848)}},
+		{"cpu_info", map[string]string{"host": "sol1", "instance": "1", "name": "cpu_info1"},
+			map[string]interface{}{"brand": "SPARC-T4", "clock_MHz": int64(2848)}},
+		// the tab was lost, the value is separated by a space
+		{"unix", map[string]string{"host": "sol1", "instance": "0", "name": "system_misc"},
+			map[string]interface{}{"ncpus": int64(2), "snaptime": 1814624.7290934}},
+	}
+	if len(metrics) != len(want) {
+		t.Fatalf("expected %d metrics, got %d: %v", len(want), len(metrics), metrics)
+	}
+	for i, w := range want {
+		m := metrics[i]
+		if m.Name() != w.name || !reflect.DeepEqual(m.Tags(), w.tags) ||
+			!reflect.DeepEqual(m.Fields(), w.fields) {
+			t.Errorf("metric %d: expected %s %v %v, got %s %v %v", i, w.name,
+				w.tags, w.fields, m.Name(), m.Tags(), m.Fields())
+		}
+	}
+}
+
+func TestKstatParserLine(t *testing.T) {
+	p := &KstatParser{}
+	m, err := p.ParseLine("sd:0:sd0:Product\tST9146803SS Rev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := map[string]string{"instance": "0", "name": "sd0"}
+	fields := map[string]interface{}{"Product": "ST9146803SS Rev"}
+	if m.Name() != "sd" || !reflect.DeepEqual(m.Tags(), tags) ||
+		!reflect.DeepEqual(m.Fields(), fields) {
+		t.Errorf("expected sd %v %v, got %s %v %v", tags, fields, m.Name(),
+			m.Tags(), m.Fields())
+	}
+
+	for _, line := range []string{"zfs:0:arcstats:hits", "zfs:0:arcstats\t1", ":0:x:y\t1"} {
+		if _, err := p.ParseLine(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
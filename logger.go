@@ -22,6 +22,9 @@ type telegrafLog struct {
 }
 
 func (t *telegrafLog) Write(b []byte) (n int, err error) {
+	if hasSecretValues() {
+		b = []byte(redactSecrets(string(b)))
+	}
 	var line []byte
 	if !prefixRegex.Match(b) {
 		line = append([]byte(time.Now().UTC().Format(time.RFC3339)+" I! "), b...)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	_ "net/http/pprof" // Comment this line to disable pprof endpoint.
@@ -16,7 +17,24 @@ var fDebug = flag.Bool("debug", false,
 var fQuiet = flag.Bool("quiet", false,
 	"run in quiet mode")
 var fTest = flag.Bool("test", false, "gather metrics, print them out, and exit")
-var fConfig = flag.String("config", "", "configuration file to load")
+var fTestInput = flag.String("test-input", "",
+	"gather metrics from the named input only, print them out, and exit")
+var fEstimateCardinality = flag.Int("estimate-cardinality", 0,
+	"gather metrics this many times, print the number of series of each measurement, and exit")
+var fPrintResolved = flag.Bool("print-resolved", false,
+	"print the --config file as the agent reads it, after the environment variables, and exit")
+var fTestFull = flag.Bool("test-full", false,
+	"gather metrics, run them through the processors and aggregators, print them out, and exit")
+var fOnce = flag.Bool("once", false,
+	"gather metrics once, write them to the outputs, and exit")
+var fDumpJSON = flag.Bool("dump-json", false,
+	"print the loaded configuration as JSON, and exit")
+var fConfig = flag.String("config", "",
+	"configuration file or http(s) URL to load")
+var fConfigDirectory = flag.String("config-directory", "",
+	"directory containing additional *.conf files, loaded after --config")
+var fStrictConfig = flag.Bool("strict-config", false,
+	"reject configuration files that define a table twice")
 var fVersion = flag.Bool("version", false, "display the version")
 var fSampleConfig = flag.Bool("sample-config", false,
 	"print out full sample configuration")
@@ -25,6 +43,10 @@ var fInputList = flag.Bool("input-list", false,
 	"print available input plugins.")
 var fOutputList = flag.Bool("output-list", false,
 	"print available output plugins.")
+var fProcessorList = flag.Bool("processor-list", false,
+	"print available processor plugins.")
+var fAggregatorList = flag.Bool("aggregator-list", false,
+	"print available aggregator plugins.")
 var fUsage = flag.String("usage", "",
 	"print usage for a plugin, ie, 'telegraf --usage mysql'")
 
@@ -46,8 +68,19 @@ The commands & flags are:
   config              print out full sample configuration to stdout
   version             print the version to stdout
 
-  --config <file>     configuration file to load
+  --config <file>     configuration file or http(s) URL to load
   --test              gather metrics once, print them to stdout, and exit
+  --test-full         same as --test, but print the metrics as they would be
+                      written, after the processors and aggregators
+  --test-input <name> same as --test, for the named input only
+  --estimate-cardinality <samples>
+                      gather metrics this many times, an interval apart, and
+                      print the number of series of each measurement
+  --once              gather metrics once, write them to the outputs, and exit
+  --dump-json         print the loaded configuration as JSON, and exit
+  --print-resolved    print the --config file with its includes inlined and
+                      its environment variables expanded, and exit
+  --strict-config     reject configuration files that define a table twice
   --config-directory  directory containing additional *.conf files
   --input-filter      filter the input plugins to enable, separator is :
   --output-filter     filter the output plugins to enable, separator is :
@@ -67,6 +100,15 @@ Examples:
   # run a single telegraf collection, outputing metrics to stdout
   telegraf --config telegraf.conf --test
 
+  # run a single telegraf collection, writing metrics to the outputs (cron)
+  telegraf --config telegraf.conf --once
+
+  # estimate the number of series the inputs generate, over three intervals
+  telegraf --config telegraf.conf --estimate-cardinality 3
+
+  # inspect the effective configuration
+  telegraf --config telegraf.conf --dump-json
+
   # run telegraf with all plugins defined in config file
   telegraf --config telegraf.conf
 
@@ -111,6 +153,8 @@ func init() {
 
 	InitAllOutputs()
 
+	InitAllProcessors()
+	InitAllAggregators()
 }
 
 func RegisterAllInit() {
@@ -145,6 +189,18 @@ func main() {
 			fmt.Printf("  %s\n", k)
 		}
 		return
+	case *fProcessorList:
+		fmt.Println("Available Processor Plugins:")
+		for k, _ := range Processors {
+			fmt.Printf("  %s\n", k)
+		}
+		return
+	case *fAggregatorList:
+		fmt.Println("Available Aggregator Plugins:")
+		for k, _ := range Aggregators {
+			fmt.Printf("  %s\n", k)
+		}
+		return
 	case *fInputList:
 		fmt.Println("Available Input Plugins:")
 		for k, _ := range Inputs {
@@ -156,11 +212,20 @@ func main() {
 		return
 	case *fSampleConfig:
 		return
+	case *fPrintResolved:
+		c := NewConfig()
+		c.StrictTOML = *fStrictConfig
+		if err := c.PrintResolved(*fConfig, os.Stdout); err != nil {
+			log.Fatal("E! " + err.Error())
+		}
+		return
 	case *fUsage != "":
 		err := PrintInputConfig(*fUsage)
 		err2 := PrintOutputConfig(*fUsage)
-		if err != nil && err2 != nil {
-			log.Fatalf("E! %s and %s", err, err2)
+		err3 := PrintProcessorConfig(*fUsage)
+		err4 := PrintAggregatorConfig(*fUsage)
+		if err != nil && err2 != nil && err3 != nil && err4 != nil {
+			log.Fatalf("E! %s, %s, %s and %s", err, err2, err3, err4)
 		}
 		return
 	}
@@ -175,20 +240,61 @@ func reloadLoop(
 ) {
 	reload := make(chan bool, 1)
 	reload <- true
+	var previous *Config
 	for <-reload {
 		reload <- false
 
 		// If no other options are specified, load the config file and run.
 		c := NewConfig()
-		err := c.LoadConfig(*fConfig)
+		c.StrictTOML = *fStrictConfig
+		var err error
+		if *fConfigDirectory == "" {
+			err = c.LoadConfig(*fConfig)
+		} else {
+			err = c.LoadAll(*fConfig, *fConfigDirectory)
+		}
 		if err != nil {
 			log.Fatal("E! " + err.Error())
 		}
+		if err := c.AddDefaultPlugins(); err != nil {
+			log.Fatal("E! " + err.Error())
+		}
+		if previous != nil {
+			for _, change := range ConfigDiff(previous, c) {
+				log.Printf("I! Config change: %s", change)
+			}
+		}
+		previous = c
+
+		if *fDumpJSON {
+			if err := c.DumpJSON(os.Stdout); err != nil {
+				log.Fatal("E! " + err.Error())
+			}
+			return
+		}
 
-		if !*fTest && len(c.Outputs) == 0 {
+		if *fTestInput != "" {
+			if err := c.TestInput(*fTestInput, os.Stdout); err != nil {
+				log.Fatal("E! " + err.Error())
+			}
+			return
+		}
+
+		if *fEstimateCardinality != 0 {
+			counts, err := c.EstimateCardinality(*fEstimateCardinality)
+			if err != nil {
+				log.Fatal("E! " + err.Error())
+			}
+			if err := printCardinality(os.Stdout, counts); err != nil {
+				log.Fatal("E! " + err.Error())
+			}
+			return
+		}
+
+		if !*fTest && !*fTestFull && len(c.Outputs) == 0 {
 			log.Fatalf("E! Error: no outputs found, did you provide a valid config file?")
 		}
-		if len(Inputs) == 0 {
+		if len(c.Inputs) == 0 {
 			log.Fatalf("E! Error: no inputs found, did you provide a valid config file?")
 		}
 
@@ -209,6 +315,35 @@ func reloadLoop(
 			ag.Config.Agent.Logfile,
 		)
 
+		if *fTest || *fTestFull {
+			if *fTestFull {
+				err = ag.RunTestFull()
+			} else {
+				err = ag.RunTest()
+			}
+			if err != nil {
+				log.Fatal("E! " + err.Error())
+			}
+			return
+		}
+
+		if *fOnce {
+			ctx, cancel := context.WithCancel(context.Background())
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt)
+			go func() {
+				<-signals
+				cancel()
+			}()
+			err = c.RunOnce(ctx)
+			signal.Stop(signals)
+			cancel()
+			if err != nil {
+				log.Fatal("E! " + err.Error())
+			}
+			return
+		}
+
 		err = ag.Connect()
 		if err != nil {
 			log.Fatal("E! " + err.Error())
@@ -236,6 +371,8 @@ func reloadLoop(
 
 		log.Printf("I! Starting Telegraf %s\n", displayVersion())
 		log.Printf("I! Loaded outputs: %s", strings.Join(c.OutputNames(), " "))
+		log.Printf("I! Loaded processors: %s", strings.Join(c.ProcessorNames(), " "))
+		log.Printf("I! Loaded aggregators: %s", strings.Join(c.AggregatorNames(), " "))
 		log.Printf("I! Loaded inputs: %s", strings.Join(c.InputNames(), " "))
 		log.Printf("I! Tags enabled: %s", c.ListTags())
 
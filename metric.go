@@ -26,6 +26,9 @@ type Metric interface {
 	SerializeTo(dst []byte) int
 	// String is the same as Serialize, but returns a string.
 	String() string
+	// SerializeLineProtocol is the same as String, but with the tags and
+	// fields sorted by key so that the output is stable between calls.
+	SerializeLineProtocol() string
 	// Copy deep-copies the metric.
 	Copy() Metric
 	// Split will attempt to return multiple metrics with the same timestamp
@@ -56,9 +59,18 @@ type Metric interface {
 	UnixNano() int64
 	Type() ValueType
 	Len() int // returns the length of the serialized metric, including newline
+	// HashID returns the identity of the series of the metric: a hash of its
+	// name and sorted tags, but not of its fields or time, so that all the
+	// points of a series share it. It is stable across runs, ie, for keys
+	// kept on disk.
 	HashID() uint64
 
 	// aggregator things:
 	SetAggregate(bool)
 	IsAggregate() bool
+
+	// SetSequence and Sequence set and get the number given to the metric
+	// when it was gathered, 0 when it was not numbered, see preserve_order.
+	SetSequence(uint64)
+	Sequence() uint64
 }
@@ -43,8 +43,6 @@ func New(
 		mType: thisType,
 	}
 
-	// pre-allocate exact size of the tags slice
-	taglen := 0
 	for k, v := range tags {
 		if strings.HasSuffix(k, `\`) {
 			return nil, fmt.Errorf("%s: tag key cannot end with a backslash: %s", name, k)
@@ -52,29 +50,12 @@ func New(
 		if strings.HasSuffix(v, `\`) {
 			return nil, fmt.Errorf("%s: tag value cannot end with a backslash: %s", name, v)
 		}
-
-		if len(k) == 0 || len(v) == 0 {
-			continue
-		}
-		taglen += 2 + len(escape(k, "tagkey")) + len(escape(v, "tagval"))
-	}
-	m.tags = make([]byte, taglen)
-
-	i := 0
-	for k, v := range tags {
-		if len(k) == 0 || len(v) == 0 {
-			continue
-		}
-		m.tags[i] = ','
-		i++
-		i += copy(m.tags[i:], escape(k, "tagkey"))
-		m.tags[i] = '='
-		i++
-		i += copy(m.tags[i:], escape(v, "tagval"))
 	}
+	m.tags = appendTags(nil, tags)
 
 	// pre-allocate capacity of the fields slice
 	fieldlen := 0
+	fieldKeys := make([]string, 0, len(fields))
 	for k, _ := range fields {
 		if strings.HasSuffix(k, `\`) {
 			return nil, fmt.Errorf("%s: field key cannot end with a backslash: %s", name, k)
@@ -84,21 +65,45 @@ func New(
 		// amount of allocations. There's a small possibility this will create
 		// slightly more allocations for a metric that has many short fields.
 		fieldlen += len(k) + 10
+		fieldKeys = append(fieldKeys, k)
 	}
 	m.fields = make([]byte, 0, fieldlen)
 
-	i = 0
-	for k, v := range fields {
+	// fields are sorted by key, so that the serialized metric and the
+	// iteration over its fields are the same for the same input
+	sort.Strings(fieldKeys)
+	for i, k := range fieldKeys {
 		if i != 0 {
 			m.fields = append(m.fields, ',')
 		}
-		m.fields = appendField(m.fields, k, v)
-		i++
+		m.fields = appendField(m.fields, k, fields[k])
 	}
 
 	return m, nil
 }
 
+// appendTags appends the tags to b sorted by key, as line protocol expects
+// them for the best write performance. Tags with an empty key or value are
+// skipped.
+func appendTags(b []byte, tags map[string]string) []byte {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if len(k) == 0 || len(v) == 0 {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		b = append(b, ',')
+		b = append(b, escape(k, "tagkey")...)
+		b = append(b, '=')
+		b = append(b, escape(tags[k], "tagval")...)
+	}
+	return b
+}
+
 // indexUnescapedByte finds the index of the first byte equal to b in buf that
 // is not escaped.  Does not allow the escape char to be escaped. Returns -1 if
 // not found.
@@ -169,6 +174,8 @@ type metric struct {
 
 	mType     ValueType
 	aggregate bool
+	// seq is the gather order of the metric, see preserve_order
+	seq uint64
 
 	// cached values for reuse in "get" functions
 	hashID uint64
@@ -187,6 +194,14 @@ func (m *metric) IsAggregate() bool {
 	return m.aggregate
 }
 
+func (m *metric) SetSequence(seq uint64) {
+	m.seq = seq
+}
+
+func (m *metric) Sequence() uint64 {
+	return m.seq
+}
+
 func (m *metric) Type() ValueType {
 	return m.mType
 }
@@ -211,6 +226,42 @@ func (m *metric) Serialize() []byte {
 	return tmp
 }
 
+func (m *metric) SerializeLineProtocol() string {
+	tags := m.Tags()
+	tagKeys := make([]string, 0, len(tags))
+	for k := range tags {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+
+	fields := m.Fields()
+	fieldKeys := make([]string, 0, len(fields))
+	for k := range fields {
+		fieldKeys = append(fieldKeys, k)
+	}
+	sort.Strings(fieldKeys)
+
+	b := make([]byte, 0, m.Len())
+	b = append(b, m.name...)
+	for _, k := range tagKeys {
+		b = append(b, ',')
+		b = append(b, escape(k, "tagkey")...)
+		b = append(b, '=')
+		b = append(b, escape(tags[k], "tagval")...)
+	}
+	b = append(b, ' ')
+	for i, k := range fieldKeys {
+		if i != 0 {
+			b = append(b, ',')
+		}
+		b = appendField(b, k, fields[k])
+	}
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, m.UnixNano(), 10)
+	b = append(b, '\n')
+	return string(b)
+}
+
 func (m *metric) SerializeTo(dst []byte) int {
 	i := 0
 	if i >= len(dst) {
@@ -440,8 +491,11 @@ func (m *metric) SetSuffix(suffix string) {
 }
 
 func (m *metric) AddTag(key, value string) {
-	m.RemoveTag(key)
-	m.tags = append(m.tags, []byte(","+escape(key, "tagkey")+"="+escape(value, "tagval"))...)
+	m.hashID = 0
+	tags := m.Tags()
+	tags[key] = value
+	// keep the tags sorted
+	m.tags = appendTags(m.tags[:0], tags)
 }
 
 func (m *metric) HasTag(key string) bool {
@@ -506,7 +560,9 @@ func (m *metric) RemoveField(key string) error {
 }
 
 func (m *metric) Copy() Metric {
-	return copyWith(m.name, m.tags, m.fields, m.t)
+	out := copyWith(m.name, m.tags, m.fields, m.t)
+	out.SetSequence(m.seq)
+	return out
 }
 
 func copyWith(name, tags, fields, t []byte) Metric {
@@ -527,18 +583,22 @@ func (m *metric) HashID() uint64 {
 	if m.hashID == 0 {
 		h := fnv.New64a()
 		h.Write(m.name)
+		h.Write([]byte{0})
 
 		tags := m.Tags()
-		tmp := make([]string, len(tags))
-		i := 0
-		for k, v := range tags {
-			tmp[i] = k + v
-			i++
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
 		}
-		sort.Strings(tmp)
-
-		for _, s := range tmp {
-			h.Write([]byte(s))
+		sort.Strings(keys)
+
+		// the keys and values are delimited so that, ie, a=bc and ab=c
+		// do not hash alike
+		for _, k := range keys {
+			h.Write([]byte(k))
+			h.Write([]byte{0})
+			h.Write([]byte(tags[k]))
+			h.Write([]byte{0})
 		}
 
 		m.hashID = h.Sum64()
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSerializeLineProtocolRoundTrip(t *testing.T) {
+	tags := map[string]string{
+		"host":        "web 1",
+		"tag,key":     "a=b",
+		"region name": `us,east=1`,
+	}
+	fields := map[string]interface{}{
+		"value":      1.5,
+		"count":      int64(-3),
+		"ok":         true,
+		"message":    `say "hi", back\slash`,
+		"field key":  "x=y,z",
+		"field,key2": int64(7),
+	}
+	ts := time.Unix(1500000000, 123456789)
+	m, err := New("my measurement,x", tags, fields, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parser, err := NewInfluxParser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := parser.Parse([]byte(m.SerializeLineProtocol()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("expected 1 metric, got %d", len(metrics))
+	}
+	out := metrics[0]
+	if out.Name() != "my measurement,x" {
+		t.Errorf("expected the name %q, got %q", "my measurement,x", out.Name())
+	}
+	if !reflect.DeepEqual(out.Tags(), tags) {
+		t.Errorf("expected the tags %v, got %v", tags, out.Tags())
+	}
+	if !reflect.DeepEqual(out.Fields(), fields) {
+		t.Errorf("expected the fields %v, got %v", fields, out.Fields())
+	}
+	if !out.Time().Equal(ts) {
+		t.Errorf("expected the time %s, got %s", ts, out.Time())
+	}
+}
+
+func TestSerializeLineProtocolSortsTags(t *testing.T) {
+	keys := []string{"e", "b", "d", "a", "c"}
+	want := "cpu,a=1,b=1,c=1,d=1,e=1 a=1i,m=2i,z=3i 0\n"
+	fields := map[string]interface{}{"z": int64(3), "a": int64(1), "m": int64(2)}
+	// insertion orders of the tags, by index in keys
+	orders := [][]int{{0, 1, 2, 3, 4}, {4, 3, 2, 1, 0}, {2, 0, 4, 1, 3}}
+	for _, order := range orders {
+		m, err := New("cpu", nil, fields, time.Unix(0, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range order {
+			m.AddTag(keys[i], "1")
+		}
+		if got := m.SerializeLineProtocol(); got != want {
+			t.Errorf("order %v: expected %q, got %q", order, want, got)
+		}
+		if got := string(m.Serialize()); got != want {
+			t.Errorf("order %v: expected %q, got %q", order, want, got)
+		}
+	}
+
+	tags := map[string]string{}
+	for _, k := range keys {
+		tags[k] = "1"
+	}
+	m, err := New("cpu", tags, fields, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.SerializeLineProtocol(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestHashIDIsTheSeries(t *testing.T) {
+	newMetric := func(name string, tags map[string]string, fields map[string]interface{}, sec int64) Metric {
+		m, err := New(name, tags, fields, time.Unix(sec, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	tags := map[string]string{"host": "web1", "cpu": "cpu0"}
+	a := newMetric("cpu", tags, map[string]interface{}{"usage": 1.5}, 1)
+	b := newMetric("cpu", tags, map[string]interface{}{"idle": int64(90), "usage": 7.0}, 2)
+	if a.HashID() != b.HashID() {
+		t.Error("expected the same series with other fields and time to hash alike")
+	}
+
+	// the tags added in another order
+	c := newMetric("cpu", nil, map[string]interface{}{"usage": 1.5}, 1)
+	c.AddTag("host", "web1")
+	c.AddTag("cpu", "cpu0")
+	d := newMetric("cpu", nil, map[string]interface{}{"usage": 1.5}, 1)
+	d.AddTag("cpu", "cpu0")
+	d.AddTag("host", "web1")
+	if c.HashID() != a.HashID() || d.HashID() != a.HashID() {
+		t.Error("expected the tag order not to change the hash")
+	}
+
+	for _, other := range []Metric{
+		newMetric("mem", tags, map[string]interface{}{"usage": 1.5}, 1),
+		newMetric("cpu", map[string]string{"host": "web2", "cpu": "cpu0"},
+			map[string]interface{}{"usage": 1.5}, 1),
+		newMetric("cpu", map[string]string{"hostc": "pu", "cpu": "cpu0"},
+			map[string]interface{}{"usage": 1.5}, 1),
+	} {
+		if other.HashID() == a.HashID() {
+			t.Errorf("expected %s to hash differently", other.SerializeLineProtocol())
+		}
+	}
+}
@@ -65,7 +65,8 @@ func ParseWithDefaultTimePrecision(
 		if j == -1 {
 			break
 		}
-		if len(buf[i:i+j]) < 2 {
+		// skip empty and whitespace-only lines
+		if len(buf[i:i+j]) < 2 || len(bytes.TrimSpace(buf[i:i+j])) == 0 {
 			i += j + 1 // increment i past the previous newline
 			continue
 		}
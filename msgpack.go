@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// MsgpackSerializer encodes a metric as a MessagePack map:
+//
+//     {"name": "cpu", "time": <timestamp>, "tags": {...}, "fields": {...}}
+//
+// The time uses the timestamp extension type (-1) of the MessagePack spec.
+// Integer, float, boolean and string fields keep their type. MessagePack
+// values are self-delimiting, so no newline separates the metrics.
+type MsgpackSerializer struct{}
+
+func (s *MsgpackSerializer) Serialize(metric Metric) ([]byte, error) {
+	b := make([]byte, 0, 128)
+	b = msgpackMapHeader(b, 4)
+
+	b = msgpackString(b, "name")
+	b = msgpackString(b, metric.Name())
+
+	b = msgpackString(b, "time")
+	b = msgpackTime(b, metric.UnixNano())
+
+	tags := metric.Tags()
+	tagKeys := make([]string, 0, len(tags))
+	for k := range tags {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+	b = msgpackString(b, "tags")
+	b = msgpackMapHeader(b, len(tags))
+	for _, k := range tagKeys {
+		b = msgpackString(b, k)
+		b = msgpackString(b, tags[k])
+	}
+
+	fields := metric.Fields()
+	fieldKeys := make([]string, 0, len(fields))
+	for k := range fields {
+		fieldKeys = append(fieldKeys, k)
+	}
+	sort.Strings(fieldKeys)
+	b = msgpackString(b, "fields")
+	b = msgpackMapHeader(b, len(fields))
+	for _, k := range fieldKeys {
+		b = msgpackString(b, k)
+		var err error
+		b, err = msgpackValue(b, fields[k])
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %s: %s", k, metric.Name(), err)
+		}
+	}
+	return b, nil
+}
+
+func msgpackValue(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case int64:
+		return msgpackInt(b, v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			b = append(b, 0xcf)
+			return msgpackUint64(b, v), nil
+		}
+		return msgpackInt(b, int64(v)), nil
+	case float64:
+		b = append(b, 0xcb)
+		return msgpackUint64(b, math.Float64bits(v)), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case string:
+		return msgpackString(b, v), nil
+	}
+	return b, fmt.Errorf("unsupported type %T", v)
+}
+
+// msgpackInt encodes i in the smallest of the fixint and int64 formats.
+func msgpackInt(b []byte, i int64) []byte {
+	if i >= -32 && i <= 127 {
+		return append(b, byte(i))
+	}
+	b = append(b, 0xd3)
+	return msgpackUint64(b, uint64(i))
+}
+
+func msgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdb)
+		b = msgpackUint32(b, uint32(n))
+	}
+	return append(b, s...)
+}
+
+func msgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xde, byte(n>>8), byte(n))
+	}
+	b = append(b, 0xdf)
+	return msgpackUint32(b, uint32(n))
+}
+
+// msgpackTime encodes a timestamp in nanoseconds with the timestamp 32, 64
+// or 96 format of the extension type -1, whichever is the smallest to fit.
+func msgpackTime(b []byte, ns int64) []byte {
+	sec := ns / 1e9
+	nsec := ns % 1e9
+	if nsec < 0 {
+		sec--
+		nsec += 1e9
+	}
+	if sec>>34 == 0 {
+		data := uint64(nsec)<<34 | uint64(sec)
+		if data&0xffffffff00000000 == 0 {
+			b = append(b, 0xd6, 0xff)
+			return msgpackUint32(b, uint32(data))
+		}
+		b = append(b, 0xd7, 0xff)
+		return msgpackUint64(b, data)
+	}
+	b = append(b, 0xc7, 12, 0xff)
+	b = msgpackUint32(b, uint32(nsec))
+	return msgpackUint64(b, uint64(sec))
+}
+
+func msgpackUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func msgpackUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func msgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xdc, byte(n>>8), byte(n))
+	}
+	b = append(b, 0xdd)
+	return msgpackUint32(b, uint32(n))
+}
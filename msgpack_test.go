@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// msgpackDecode decodes the first MessagePack value of b, for the formats
+// that the serializer and the fluentd output write, and returns it with the
+// rest of b. Maps are map[string]interface{}, timestamps and fluentd event
+// times time.Time.
+func msgpackDecode(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, fmt.Errorf("unexpected end of data")
+	}
+	c := b[0]
+	b = b[1:]
+	need := func(n int) error {
+		if len(b) < n {
+			return fmt.Errorf("unexpected end of data after 0x%x", c)
+		}
+		return nil
+	}
+	switch {
+	case c <= 0x7f:
+		return int64(c), b, nil
+	case c >= 0xe0:
+		return int64(int8(c)), b, nil
+	case c&0xe0 == 0xa0:
+		return msgpackDecodeString(b, int(c&0x1f))
+	case c&0xf0 == 0x80:
+		return msgpackDecodeMap(b, int(c&0x0f))
+	case c&0xf0 == 0x90:
+		return msgpackDecodeArray(b, int(c&0x0f))
+	}
+	switch c {
+	case 0xc2:
+		return false, b, nil
+	case 0xc3:
+		return true, b, nil
+	case 0xcb:
+		if err := need(8); err != nil {
+			return nil, nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), b[8:], nil
+	case 0xcf:
+		if err := need(8); err != nil {
+			return nil, nil, err
+		}
+		return binary.BigEndian.Uint64(b), b[8:], nil
+	case 0xd3:
+		if err := need(8); err != nil {
+			return nil, nil, err
+		}
+		return int64(binary.BigEndian.Uint64(b)), b[8:], nil
+	case 0xd9:
+		if err := need(1); err != nil {
+			return nil, nil, err
+		}
+		return msgpackDecodeString(b[1:], int(b[0]))
+	case 0xda:
+		if err := need(2); err != nil {
+			return nil, nil, err
+		}
+		return msgpackDecodeString(b[2:], int(binary.BigEndian.Uint16(b)))
+	case 0xdb:
+		if err := need(4); err != nil {
+			return nil, nil, err
+		}
+		return msgpackDecodeString(b[4:], int(binary.BigEndian.Uint32(b)))
+	case 0xdc:
+		if err := need(2); err != nil {
+			return nil, nil, err
+		}
+		return msgpackDecodeArray(b[2:], int(binary.BigEndian.Uint16(b)))
+	case 0xde:
+		if err := need(2); err != nil {
+			return nil, nil, err
+		}
+		return msgpackDecodeMap(b[2:], int(binary.BigEndian.Uint16(b)))
+	case 0xd6:
+		if err := need(5); err != nil || b[0] != 0xff {
+			return nil, nil, fmt.Errorf("invalid timestamp 32")
+		}
+		return time.Unix(int64(binary.BigEndian.Uint32(b[1:])), 0), b[5:], nil
+	case 0xd7:
+		if err := need(9); err == nil && b[0] == 0x00 {
+			// the EventTime of the fluentd forward protocol
+			sec := binary.BigEndian.Uint32(b[1:])
+			nsec := binary.BigEndian.Uint32(b[5:])
+			return time.Unix(int64(sec), int64(nsec)), b[9:], nil
+		}
+		if err := need(9); err != nil || b[0] != 0xff {
+			return nil, nil, fmt.Errorf("invalid timestamp 64")
+		}
+		data := binary.BigEndian.Uint64(b[1:])
+		return time.Unix(int64(data&(1<<34-1)), int64(data>>34)), b[9:], nil
+	case 0xc7:
+		if err := need(14); err != nil || b[0] != 12 || b[1] != 0xff {
+			return nil, nil, fmt.Errorf("invalid timestamp 96")
+		}
+		nsec := binary.BigEndian.Uint32(b[2:])
+		sec := binary.BigEndian.Uint64(b[6:])
+		return time.Unix(int64(sec), int64(nsec)), b[14:], nil
+	}
+	return nil, nil, fmt.Errorf("unsupported format 0x%x", c)
+}
+
+func msgpackDecodeString(b []byte, n int) (interface{}, []byte, error) {
+	if len(b) < n {
+		return nil, nil, fmt.Errorf("string of %d bytes truncated", n)
+	}
+	return string(b[:n]), b[n:], nil
+}
+
+func msgpackDecodeMap(b []byte, n int) (interface{}, []byte, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, rest, err := msgpackDecode(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("map key %v is not a string", k)
+		}
+		v, rest, err := msgpackDecode(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		m[key] = v
+		b = rest
+	}
+	return m, b, nil
+}
+
+func msgpackDecodeArray(b []byte, n int) (interface{}, []byte, error) {
+	a := make([]interface{}, n)
+	for i := range a {
+		v, rest, err := msgpackDecode(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		a[i] = v
+		b = rest
+	}
+	return a, b, nil
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	fields := map[string]interface{}{
+		"small":    int64(7),
+		"negative": int64(-5),
+		"large":    int64(-1 << 40),
+		"huge":     uint64(math.MaxUint64),
+		"ratio":    0.25,
+		"whole":    3.0,
+		"up":       true,
+		"down":     false,
+		"state":    "online",
+		"log":      long,
+	}
+	tags := map[string]string{"host": "web01", "zone": "global"}
+	for _, ts := range []time.Time{
+		time.Unix(1500000000, 0),
+		time.Unix(1500000000, 123456789),
+		// before 1970, which needs the 96-bit timestamp
+		time.Unix(-86400, 5),
+	} {
+		m, err := New("cpu", tags, fields, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := (&MsgpackSerializer{}).Serialize(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, rest, err := msgpackDecode(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rest) != 0 {
+			t.Errorf("%s: %d trailing bytes", ts, len(rest))
+		}
+		doc := v.(map[string]interface{})
+		if doc["name"] != "cpu" {
+			t.Errorf("expected the name cpu, got %v", doc["name"])
+		}
+		if got, ok := doc["time"].(time.Time); !ok || !got.Equal(ts) {
+			t.Errorf("expected the time %s, got %v", ts, doc["time"])
+		}
+		wantTags := map[string]interface{}{"host": "web01", "zone": "global"}
+		if !reflect.DeepEqual(doc["tags"], wantTags) {
+			t.Errorf("expected the tags %v, got %v", wantTags, doc["tags"])
+		}
+		// reflect.DeepEqual compares the dynamic types as well
+		if !reflect.DeepEqual(doc["fields"], m.Fields()) {
+			t.Errorf("expected the fields %v, got %v", m.Fields(), doc["fields"])
+		}
+	}
+}
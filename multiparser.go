@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// MultiParser parses each line with the first of its parsers that accepts
+// it, ie, an exec command printing both plain values and JSON objects can be
+// read with the value parser falling back to the json one.
+type MultiParser struct {
+	Parsers []Parser
+	// Formats are the data formats of Parsers, for the log messages
+	Formats []string
+	// Strict makes a line that no parser accepts an error, instead of
+	// skipping it.
+	Strict bool
+
+	// Unparsed counts the lines that no parser accepted
+	Unparsed Stat
+}
+
+// NewMultiParser returns a MultiParser trying the given data formats in order,
+// each parser being built from config.
+func NewMultiParser(config *ParserConfig) (Parser, error) {
+	if len(config.DataFormats) == 0 {
+		return nil, fmt.Errorf("data_formats is required with the multi data format")
+	}
+
+	p := &MultiParser{
+		Strict: config.MultiStrict,
+		Unparsed: Register("parser", "unparsed_lines",
+			map[string]string{"input": config.MetricName}),
+	}
+	for _, format := range config.DataFormats {
+		if format == "multi" {
+			return nil, fmt.Errorf("data_formats cannot contain multi")
+		}
+		c := *config
+		c.DataFormat = format
+		// the lines are skipped, and the names cased, once, by the multi
+		// parser itself
+		c.SkipLines = 0
+		c.NameCase = ""
+		parser, err := NewParser(&c)
+		if err != nil {
+			return nil, err
+		}
+		p.Parsers = append(p.Parsers, parser)
+		p.Formats = append(p.Formats, format)
+	}
+	return p, nil
+}
+
+func (p *MultiParser) Parse(buf []byte) ([]Metric, error) {
+	metrics := make([]Metric, 0)
+	for _, line := range strings.Split(string(buf), "\n") {
+		if blankLine(line) {
+			continue
+		}
+		parsed, err := p.parse(line, func(parser Parser) ([]Metric, error) {
+			return parser.Parse([]byte(line))
+		})
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, parsed...)
+	}
+	return metrics, nil
+}
+
+func (p *MultiParser) ParseLine(line string) (Metric, error) {
+	if blankLine(line) {
+		return nil, nil
+	}
+	parsed, err := p.parse(line, func(parser Parser) ([]Metric, error) {
+		metric, err := parser.ParseLine(line)
+		if err != nil || metric == nil {
+			return nil, err
+		}
+		return []Metric{metric}, nil
+	})
+	if err != nil || len(parsed) == 0 {
+		return nil, err
+	}
+	return parsed[0], nil
+}
+
+// parse returns the metrics of the first parser that parses line without
+// error. A line that no parser accepts is counted, and skipped unless the
+// parser is strict.
+func (p *MultiParser) parse(
+	line string,
+	parse func(parser Parser) ([]Metric, error),
+) ([]Metric, error) {
+	var errs []string
+	for i, parser := range p.Parsers {
+		metrics, err := parse(parser)
+		if err == nil {
+			return metrics, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", p.Formats[i], err))
+	}
+
+	if p.Unparsed != nil {
+		p.Unparsed.Incr(1)
+	}
+	err := fmt.Errorf("no parser accepted line %q (%s)",
+		line, strings.Join(errs, "; "))
+	if p.Strict {
+		return nil, err
+	}
+	log.Printf("D! Skipping line: %s", err)
+	return nil, nil
+}
+
+func (p *MultiParser) SetDefaultTags(tags map[string]string) {
+	for _, parser := range p.Parsers {
+		parser.SetDefaultTags(tags)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+func newTestMultiParser(t *testing.T, strict bool) *MultiParser {
+	parser, err := NewParser(&ParserConfig{
+		DataFormat:  "multi",
+		DataFormats: []string{"value", "json"},
+		MultiStrict: strict,
+		MetricName:  "multi_test",
+		DataType:    "integer",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parser.(*MultiParser)
+}
+
+func TestMultiParserFallback(t *testing.T) {
+	p := newTestMultiParser(t, false)
+	unparsed := p.Unparsed.Get()
+
+	metrics, err := p.Parse([]byte("42\n{\"a\": 1, \"b\": 2}\nnot a number\n\n7\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 3 {
+		t.Fatalf("expected 3 metrics, got %d: %v", len(metrics), metrics)
+	}
+	if v := metrics[0].Fields()["value"]; v != int64(42) {
+		t.Errorf("expected value 42 from the value parser, got %v", metrics[0].Fields())
+	}
+	if a, b := metrics[1].Fields()["a"], metrics[1].Fields()["b"]; a != float64(1) || b != float64(2) {
+		t.Errorf("expected a=1 and b=2 from the json parser, got %v", metrics[1].Fields())
+	}
+	if v := metrics[2].Fields()["value"]; v != int64(7) {
+		t.Errorf("expected value 7 from the value parser, got %v", metrics[2].Fields())
+	}
+	if n := p.Unparsed.Get() - unparsed; n != 1 {
+		t.Errorf("expected 1 unparsed line, got %d", n)
+	}
+
+	m, err := p.ParseLine("{\"a\": 3}")
+	if err != nil || m == nil || m.Fields()["a"] != float64(3) {
+		t.Errorf("expected a=3 from ParseLine, got %v, %v", m, err)
+	}
+	m, err = p.ParseLine("not a number")
+	if err != nil || m != nil {
+		t.Errorf("expected the line to be skipped, got %v, %v", m, err)
+	}
+}
+
+func TestMultiParserStrict(t *testing.T) {
+	p := newTestMultiParser(t, true)
+	if _, err := p.Parse([]byte("42\nnot a number\n")); err == nil {
+		t.Error("expected an error for a line no parser accepts")
+	}
+	if _, err := p.ParseLine("not a number"); err == nil {
+		t.Error("expected an error from ParseLine for a line no parser accepts")
+	}
+}
+
+func TestMultiParserConfig(t *testing.T) {
+	if _, err := NewParser(&ParserConfig{DataFormat: "multi"}); err == nil {
+		t.Error("expected an error without data_formats")
+	}
+	_, err := NewParser(&ParserConfig{
+		DataFormat:  "multi",
+		DataFormats: []string{"value", "multi"},
+	})
+	if err == nil {
+		t.Error("expected an error with multi in data_formats")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The name_case settings of the parsers.
+const (
+	NameCaseNone  = "none"
+	NameCaseLower = "lower"
+	NameCaseUpper = "upper"
+)
+
+// NameCaseParser lowercases or uppercases the measurement names of the
+// metrics parsed by Parser, ie, for kstat module names that do not follow
+// the naming convention of the other measurements. Tags and fields are left
+// as they are.
+type NameCaseParser struct {
+	Parser
+	Case string
+}
+
+// newNameCaseParser wraps parser for the name_case setting, returning parser
+// itself when the names are left as they are.
+func newNameCaseParser(parser Parser, nameCase string) (Parser, error) {
+	switch nameCase {
+	case "", NameCaseNone:
+		return parser, nil
+	case NameCaseLower, NameCaseUpper:
+		return &NameCaseParser{Parser: parser, Case: nameCase}, nil
+	}
+	return nil, fmt.Errorf("invalid name_case %q, must be %q, %q or %q",
+		nameCase, NameCaseNone, NameCaseLower, NameCaseUpper)
+}
+
+func (p *NameCaseParser) Parse(buf []byte) ([]Metric, error) {
+	metrics, err := p.Parser.Parse(buf)
+	for _, m := range metrics {
+		p.setCase(m)
+	}
+	return metrics, err
+}
+
+func (p *NameCaseParser) ParseLine(line string) (Metric, error) {
+	m, err := p.Parser.ParseLine(line)
+	if m != nil {
+		p.setCase(m)
+	}
+	return m, err
+}
+
+func (p *NameCaseParser) setCase(m Metric) {
+	name := m.Name()
+	if p.Case == NameCaseUpper {
+		name = strings.ToUpper(name)
+	} else {
+		name = strings.ToLower(name)
+	}
+	if name != m.Name() {
+		m.SetName(name)
+	}
+}
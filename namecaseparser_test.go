@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNameCaseParser(t *testing.T) {
+	tests := []struct {
+		nameCase string
+		want     string
+	}{
+		{"", "ZFS_arcStats"},
+		{"none", "ZFS_arcStats"},
+		{"lower", "zfs_arcstats"},
+		{"upper", "ZFS_ARCSTATS"},
+	}
+	for _, tt := range tests {
+		parser, err := NewParser(&ParserConfig{DataFormat: "influx", NameCase: tt.nameCase})
+		if err != nil {
+			t.Fatalf("%q: %s", tt.nameCase, err)
+		}
+
+		metrics, err := parser.Parse([]byte("ZFS_arcStats,Pool=Tank Hits=1i 0\n"))
+		if err != nil {
+			t.Fatalf("%q: %s", tt.nameCase, err)
+		}
+		if len(metrics) != 1 || metrics[0].Name() != tt.want {
+			t.Errorf("%q: expected the name %s, got %v", tt.nameCase, tt.want, metrics)
+			continue
+		}
+		// tags and fields are left as they are
+		if !reflect.DeepEqual(metrics[0].Tags(), map[string]string{"Pool": "Tank"}) {
+			t.Errorf("%q: expected the tags to be kept, got %v", tt.nameCase, metrics[0].Tags())
+		}
+		if _, ok := metrics[0].Fields()["Hits"]; !ok {
+			t.Errorf("%q: expected the fields to be kept, got %v", tt.nameCase, metrics[0].Fields())
+		}
+
+		m, err := parser.ParseLine("ZFS_arcStats Hits=1i 0")
+		if err != nil {
+			t.Fatalf("%q: %s", tt.nameCase, err)
+		}
+		if m == nil || m.Name() != tt.want {
+			t.Errorf("%q: expected ParseLine to return %s, got %v", tt.nameCase, tt.want, m)
+		}
+	}
+
+	if _, err := NewParser(&ParserConfig{DataFormat: "influx", NameCase: "title"}); err == nil {
+		t.Error("expected an error for an invalid name_case")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenTSDBParser parses the lines of the OpenTSDB telnet protocol, ie:
+//
+//     put sys.cpu.user 1500000000 42.5 host=web01 cpu=0
+//
+// into a metric per line. The metric name is split at its last dot into the
+// measurement and the field, "sys.cpu" and "user" here; a name without a dot
+// is the measurement of a "value" field. The "put" is optional. Timestamps
+// are in seconds, or in milliseconds when longer than 10 digits, as OpenTSDB
+// reads them.
+type OpenTSDBParser struct {
+	DefaultTags map[string]string
+}
+
+func (p *OpenTSDBParser) Parse(buf []byte) ([]Metric, error) {
+	metrics := make([]Metric, 0)
+	for _, line := range strings.Split(string(buf), "\n") {
+		m, err := p.ParseLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics, nil
+}
+
+func (p *OpenTSDBParser) ParseLine(line string) (Metric, error) {
+	if blankLine(line) {
+		return nil, nil
+	}
+	words := strings.Fields(line)
+	if words[0] == "put" {
+		words = words[1:]
+	}
+	if len(words) < 3 {
+		return nil, fmt.Errorf("unable to parse line %q: expected "+
+			"put <metric> <timestamp> <value> <tagk=tagv>...", line)
+	}
+
+	measurement, field := words[0], "value"
+	if i := strings.LastIndex(words[0], "."); i > 0 && i < len(words[0])-1 {
+		measurement, field = words[0][:i], words[0][i+1:]
+	}
+
+	ts, err := strconv.ParseInt(words[1], 10, 64)
+	if err != nil || ts < 0 {
+		return nil, fmt.Errorf("unable to parse line %q: invalid timestamp %q",
+			line, words[1])
+	}
+	var t time.Time
+	if len(words[1]) > 10 {
+		t = time.Unix(0, ts*int64(time.Millisecond))
+	} else {
+		t = time.Unix(ts, 0)
+	}
+
+	var value interface{}
+	if i, err := strconv.ParseInt(words[2], 10, 64); err == nil {
+		value = i
+	} else if f, err := strconv.ParseFloat(words[2], 64); err == nil {
+		value = f
+	} else {
+		return nil, fmt.Errorf("unable to parse line %q: invalid value %q",
+			line, words[2])
+	}
+
+	tags := make(map[string]string, len(p.DefaultTags)+len(words)-3)
+	for k, v := range p.DefaultTags {
+		tags[k] = v
+	}
+	for _, pair := range words[3:] {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("unable to parse line %q: invalid tag %q",
+				line, pair)
+		}
+		tags[kv[0]] = kv[1]
+	}
+
+	fields := map[string]interface{}{field: value}
+	if !dropNonFinite(measurement, fields) {
+		return nil, nil
+	}
+	return New(measurement, tags, fields, t)
+}
+
+func (p *OpenTSDBParser) SetDefaultTags(tags map[string]string) {
+	p.DefaultTags = tags
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOpenTSDBParser(t *testing.T) {
+	parser, err := NewParser(&ParserConfig{
+		DataFormat:  "opentsdb",
+		DefaultTags: map[string]string{"dc": "east"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := parser.Parse([]byte(`put sys.cpu.user 1500000000 42.5 host=web01 cpu=0
+sys.if.bytes_out 1500000000123 1024 host=web01 dc=west
+
+put uptime 1500000000 3600
+put sys.cpu.idle 1500000000 NaN host=web01
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name   string
+		tags   map[string]string
+		fields map[string]interface{}
+		time   time.Time
+	}{
+		{"sys.cpu", map[string]string{"dc": "east", "host": "web01", "cpu": "0"},
+			map[string]interface{}{"user": 42.5}, time.Unix(1500000000, 0)},
+		// the line overrides the default tag, the timestamp is in ms
+		{"sys.if", map[string]string{"dc": "west", "host": "web01"},
+			map[string]interface{}{"bytes_out": int64(1024)},
+			time.Unix(1500000000, 123000000)},
+		{"uptime", map[string]string{"dc": "east"},
+			map[string]interface{}{"value": int64(3600)}, time.Unix(1500000000, 0)},
+	}
+	if len(metrics) != len(want) {
+		t.Fatalf("expected %d metrics, got %d: %v", len(want), len(metrics), metrics)
+	}
+	for i, w := range want {
+		m := metrics[i]
+		if m.Name() != w.name || !reflect.DeepEqual(m.Tags(), w.tags) ||
+			!reflect.DeepEqual(m.Fields(), w.fields) || !m.Time().Equal(w.time) {
+			t.Errorf("metric %d: expected %s %v %v %s, got %s %v %v %s", i,
+				w.name, w.tags, w.fields, w.time, m.Name(), m.Tags(), m.Fields(),
+				m.Time())
+		}
+	}
+}
+
+func TestOpenTSDBParserErrors(t *testing.T) {
+	p := &OpenTSDBParser{}
+	for _, line := range []string{
+		"put sys.cpu.user 1500000000",
+		"put sys.cpu.user yesterday 1",
+		"put sys.cpu.user -1 1",
+		"put sys.cpu.user 1500000000 high",
+		"put sys.cpu.user 1500000000 1 host",
+		"put sys.cpu.user 1500000000 1 =web01",
+	} {
+		if _, err := p.ParseLine(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
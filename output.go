@@ -11,4 +11,117 @@ type Output interface {
 	SampleConfig() string
 	// Write takes in group of points to be written to the Output
 	Write(metrics []Metric) error
-}
\ No newline at end of file
+}
+
+// RetryableError is implemented by the errors of Output.Write that know
+// whether writing the same metrics again may succeed. Errors that do not
+// implement it are retryable: the metrics stay in the buffer of the output
+// and are written again on the next flush.
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
+// writeError is a Write error with an explicit retry classification.
+type writeError struct {
+	err       error
+	retryable bool
+}
+
+func (e *writeError) Error() string   { return e.err.Error() }
+func (e *writeError) Retryable() bool { return e.retryable }
+
+// NewFatalWriteError marks a Write error as not retryable, ie, a rejected
+// request. The metrics of the write are dropped rather than kept for a retry.
+func NewFatalWriteError(err error) error {
+	return &writeError{err: err, retryable: false}
+}
+
+// NewRetryableWriteError marks a Write error as retryable, which is also what
+// a plain error is.
+func NewRetryableWriteError(err error) error {
+	return &writeError{err: err, retryable: true}
+}
+
+// IsRetryable reports whether the metrics of a failed write should be kept
+// for a retry.
+func IsRetryable(err error) bool {
+	if e, ok := err.(RetryableError); ok {
+		return e.Retryable()
+	}
+	return true
+}
+
+// partialWriteError is the error of a write that wrote some of its metrics
+// and not the others. retry holds the metrics to keep for a retry, dropped
+// is the number of metrics that were rejected; the rest were written.
+type partialWriteError struct {
+	err     error
+	retry   []Metric
+	dropped int
+}
+
+func (e *partialWriteError) Error() string   { return e.err.Error() }
+func (e *partialWriteError) Retryable() bool { return len(e.retry) > 0 }
+
+// writeChunks writes metrics in the chunks that end at ends, as returned by
+// splitBySize, with write. A chunk that fails with a fatal error is dropped
+// and the next chunks are still written. A retryable error stops the write,
+// keeping that chunk and the next ones for a retry, but not the chunks that
+// were written before it, which would then be written twice. A chunk may
+// itself be partly written, write returning a partialWriteError.
+func writeChunks(metrics []Metric, ends []int, write func(start, end int) error) error {
+	start, dropped := 0, 0
+	var fatal error
+	for _, end := range ends {
+		if err := write(start, end); err != nil {
+			if pe, ok := err.(*partialWriteError); ok {
+				dropped += pe.dropped
+				if len(pe.retry) > 0 {
+					retry := append(append([]Metric(nil), pe.retry...), metrics[end:]...)
+					return &partialWriteError{err: pe.err, retry: retry, dropped: dropped}
+				}
+				fatal = pe.err
+				start = end
+				continue
+			}
+			if IsRetryable(err) {
+				if start == 0 {
+					return err
+				}
+				return &partialWriteError{err: err, retry: metrics[start:], dropped: dropped}
+			}
+			dropped += end - start
+			fatal = err
+		}
+		start = end
+	}
+	if fatal == nil {
+		return nil
+	}
+	if dropped == len(metrics) {
+		return fatal
+	}
+	return &partialWriteError{err: fatal, dropped: dropped}
+}
+
+// splitBySize splits a batch of n items, item i being size(i) bytes, into
+// consecutive chunks of at most max bytes, and returns the index each chunk
+// ends at. An item larger than max is a chunk of its own. A max of 0 keeps
+// the batch whole.
+func splitBySize(n int, max int64, size func(i int) int64) []int {
+	if max <= 0 {
+		return []int{n}
+	}
+	var ends []int
+	var total int64
+	for i := 0; i < n; i++ {
+		s := size(i)
+		if total > 0 && total+s > max {
+			ends = append(ends, i)
+			total = 0
+		}
+		total += s
+	}
+	return append(ends, n)
+}
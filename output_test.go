@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testMetrics(t *testing.T, names ...string) []Metric {
+	var metrics []Metric
+	for _, name := range names {
+		m, err := New(name, nil, map[string]interface{}{"value": int64(1)},
+			time.Unix(1500000000, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func TestWriteChunks(t *testing.T) {
+	metrics := testMetrics(t, "a", "b", "c", "d")
+	ends := []int{1, 2, 3, 4}
+	retryable := errors.New("unavailable")
+	fatal := NewFatalWriteError(errors.New("bad request"))
+
+	tests := []struct {
+		name    string
+		errs    map[int]error // by chunk start
+		err     bool
+		retry   int
+		dropped int
+	}{
+		{"ok", nil, false, 0, 0},
+		{"first retryable", map[int]error{0: retryable}, true, 4, 0},
+		{"later retryable", map[int]error{2: retryable}, true, 2, 0},
+		{"fatal then retryable", map[int]error{1: fatal, 2: retryable}, true, 2, 1},
+		{"fatal", map[int]error{1: fatal}, true, 0, 1},
+		{"all fatal", map[int]error{0: fatal, 1: fatal, 2: fatal, 3: fatal}, true, 0, 4},
+	}
+	for _, tt := range tests {
+		var written []int
+		err := writeChunks(metrics, ends, func(start, end int) error {
+			if err := tt.errs[start]; err != nil {
+				return err
+			}
+			written = append(written, start)
+			return nil
+		})
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		retry, dropped := 0, 0
+		switch e := err.(type) {
+		case *partialWriteError:
+			retry, dropped = len(e.retry), e.dropped
+		case nil:
+		default:
+			if IsRetryable(err) {
+				retry = len(metrics)
+			} else {
+				dropped = len(metrics)
+			}
+		}
+		if retry != tt.retry || dropped != tt.dropped {
+			t.Errorf("%s: expected %d to retry and %d dropped, got %d and %d",
+				tt.name, tt.retry, tt.dropped, retry, dropped)
+		}
+		if n := len(metrics) - tt.retry - tt.dropped; len(written) != n {
+			t.Errorf("%s: expected %d chunks written, got %v", tt.name, n, written)
+		}
+	}
+}
+
+// TestHTTPOutputRetriesOnlyUnsentChunks checks that the chunks accepted by
+// the server before a failed one are not sent again, and that a rejected
+// chunk does not drop the others.
+func TestHTTPOutputRetriesOnlyUnsentChunks(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	status := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		name := strings.SplitN(string(body), " ", 2)[0]
+		mu.Lock()
+		defer mu.Unlock()
+		if code, ok := status[name]; ok {
+			delete(status, name)
+			w.WriteHeader(code)
+			return
+		}
+		received = append(received, name)
+	}))
+	defer ts.Close()
+
+	serializer, _ := NewInfluxSerializer()
+	h := NewHTTPOutput()
+	h.URL = ts.URL
+	h.MaxRequestBytes.Size = 1 // a request per metric
+	h.SetSerializer(serializer)
+	if err := h.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	ro := NewRunningOutput("http", h, &OutputConfig{Name: "http"}, 10, 100)
+
+	// b is rejected for good, c fails once
+	status["b"] = http.StatusBadRequest
+	status["c"] = http.StatusServiceUnavailable
+	for _, m := range testMetrics(t, "a", "b", "c", "d") {
+		ro.AddMetric(m)
+	}
+	if err := ro.Write(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := ro.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(received, ","); got != "a,c,d" {
+		t.Errorf("expected a,c,d to be received once each, got %s", got)
+	}
+	if n := ro.MetricsDropped.Get(); n != 1 {
+		t.Errorf("expected 1 dropped metric, got %d", n)
+	}
+	if n := ro.MetricsWritten.Get(); n != 3 {
+		t.Errorf("expected 3 written metrics, got %d", n)
+	}
+}
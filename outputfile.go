@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// FileOutput writes the metrics, in the configured data format, to files or to
+// stdout.
+type FileOutput struct {
+	Files []string
+	// FilePattern, when set, is the path of a file per measurement, the
+	// "{measurement}" placeholder replaced with the name of the metrics
+	// written to it, ie, "/var/log/telegraf/{measurement}.log".
+	FilePattern string
+
+	writers    []io.Writer
+	closers    []io.Closer
+	serializer Serializer
+
+	// patternFiles are the files of FilePattern opened so far, by path.
+	patternFiles map[string]*os.File
+	// written holds the files each metric of a failed write was written
+	// to, so that its retry is only written to the others.
+	written map[Metric]map[string]bool
+}
+
+var fileOutputSampleConfig = `
+  ## Files to write to, "stdout" is a specially handled file.
+  files = ["stdout", "/tmp/metrics.out"]
+
+  ## Path of a file per measurement, "{measurement}" being replaced with the
+  ## name of the metrics, ie, cpu.log and mem.log. The files are opened as
+  ## metrics of each measurement come, and reopened when they have been
+  ## moved or removed, ie, by logrotate. The metrics are only written to
+  ## the files above if they are set too.
+  # file_pattern = "/var/log/telegraf/{measurement}.log"
+
+  ## Data format to output.
+  ## Supported formats: influx, json, msgpack, graphite
+  data_format = "influx"
+
+  ## With the graphite data format, the path of each field is built from the
+  ## template, after the prefix. Dots, spaces and the other characters of
+  ## tag values that would corrupt the path are replaced with
+  ## graphite_replacement.
+  # prefix = "telegraf"
+  # template = "host.tags.measurement.field"
+  # graphite_separator = "."
+  # graphite_replacement = "_"
+`
+
+func (f *FileOutput) SetSerializer(serializer Serializer) {
+	f.serializer = serializer
+}
+
+func (f *FileOutput) Connect() error {
+	if f.FilePattern != "" {
+		if !strings.Contains(f.FilePattern, "{measurement}") {
+			return fmt.Errorf("file_pattern %q has no {measurement}", f.FilePattern)
+		}
+		f.patternFiles = make(map[string]*os.File)
+	} else if len(f.Files) == 0 {
+		f.Files = []string{"stdout"}
+	}
+
+	for _, file := range f.Files {
+		if file == "stdout" {
+			f.writers = append(f.writers, os.Stdout)
+			continue
+		}
+		of, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %s", file, err)
+		}
+		f.writers = append(f.writers, of)
+		f.closers = append(f.closers, of)
+	}
+	return nil
+}
+
+func (f *FileOutput) Close() error {
+	var lastErr error
+	for _, c := range f.closers {
+		if err := c.Close(); err != nil {
+			lastErr = err
+		}
+	}
+	for _, of := range f.patternFiles {
+		if err := of.Close(); err != nil {
+			lastErr = err
+		}
+	}
+	f.writers = nil
+	f.closers = nil
+	f.patternFiles = nil
+	f.written = nil
+	return lastErr
+}
+
+func (f *FileOutput) SampleConfig() string {
+	return fileOutputSampleConfig
+}
+
+func (f *FileOutput) Description() string {
+	return "Send telegraf metrics to file(s)"
+}
+
+func (f *FileOutput) Write(metrics []Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	if f.serializer == nil {
+		return fmt.Errorf("no serializer set for the file output")
+	}
+
+	// the metrics to write to each file, but those a failed write already
+	// wrote to it
+	dests := make(map[string]*fileDest)
+	add := func(file string, m Metric, b []byte) {
+		if f.written[m][file] {
+			return
+		}
+		d := dests[file]
+		if d == nil {
+			d = &fileDest{}
+			dests[file] = d
+		}
+		d.buf = append(d.buf, b...)
+		d.metrics = append(d.metrics, m)
+	}
+	for _, metric := range metrics {
+		b, err := f.serializer.Serialize(metric)
+		if err != nil {
+			return fmt.Errorf("failed to serialize metric: %s", err)
+		}
+		for _, file := range f.Files {
+			add(file, metric, b)
+		}
+		if f.FilePattern != "" {
+			add(f.patternPath(metric.Name()), metric, b)
+		}
+	}
+
+	// each file is written even when another fails, the files of
+	// FilePattern in the order of their paths
+	var paths, patternPaths []string
+	for _, file := range f.Files {
+		if dests[file] != nil {
+			paths = append(paths, file)
+		}
+	}
+	for file := range dests {
+		if sliceIndex(file, f.Files) < 0 {
+			patternPaths = append(patternPaths, file)
+		}
+	}
+	sort.Strings(patternPaths)
+	paths = append(paths, patternPaths...)
+
+	var errs []string
+	failed := make(map[Metric]bool)
+	for _, file := range paths {
+		d := dests[file]
+		if err := f.writeFile(file, d.buf); err != nil {
+			errs = append(errs, err.Error())
+			d.failed = true
+			for _, m := range d.metrics {
+				failed[m] = true
+			}
+		}
+	}
+	if len(errs) == 0 {
+		for _, m := range metrics {
+			delete(f.written, m)
+		}
+		return nil
+	}
+
+	if f.written == nil {
+		f.written = make(map[Metric]map[string]bool)
+	}
+	for _, file := range paths {
+		if d := dests[file]; !d.failed {
+			for _, m := range d.metrics {
+				if !failed[m] {
+					continue
+				}
+				if f.written[m] == nil {
+					f.written[m] = make(map[string]bool)
+				}
+				f.written[m][file] = true
+			}
+		}
+	}
+	var retry []Metric
+	for _, m := range metrics {
+		if failed[m] {
+			retry = append(retry, m)
+		} else {
+			delete(f.written, m)
+		}
+	}
+	return &partialWriteError{
+		err:   fmt.Errorf("failed to write metrics: %s", strings.Join(errs, "; ")),
+		retry: retry,
+	}
+}
+
+// fileDest holds the metrics of a write to a file.
+type fileDest struct {
+	buf     []byte
+	metrics []Metric
+	failed  bool
+}
+
+// writeFile writes buf to file, one of Files or a path of FilePattern.
+func (f *FileOutput) writeFile(file string, buf []byte) error {
+	if i := sliceIndex(file, f.Files); i >= 0 {
+		if _, err := f.writers[i].Write(buf); err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		return nil
+	}
+	of, err := f.patternFile(file)
+	if err != nil {
+		return err
+	}
+	if _, err := of.Write(buf); err != nil {
+		return fmt.Errorf("%s: %s", of.Name(), err)
+	}
+	return nil
+}
+
+// patternPath returns the path of FilePattern for the measurement name.
+func (f *FileOutput) patternPath(name string) string {
+	// a measurement cannot reach out of the directory of the pattern
+	name = strings.Replace(name, "/", "_", -1)
+	if name == "" || name == "." || name == ".." {
+		name = "_" + name
+	}
+	return strings.Replace(f.FilePattern, "{measurement}", name, -1)
+}
+
+// patternFile returns the file of FilePattern at path, opening it on first
+// use, or again when the open file is no longer at its path, ie, once it has
+// been rotated.
+func (f *FileOutput) patternFile(path string) (*os.File, error) {
+	if of, ok := f.patternFiles[path]; ok {
+		info, err := os.Stat(path)
+		if err == nil {
+			if open, err := of.Stat(); err == nil && os.SameFile(info, open) {
+				return of, nil
+			}
+		}
+		of.Close()
+		delete(f.patternFiles, path)
+	}
+
+	of, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %s", path, err)
+	}
+	f.patternFiles[path] = of
+	return of, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// flakyWriter fails the writes while fail is positive.
+type flakyWriter struct {
+	fail int
+	buf  bytes.Buffer
+}
+
+func (w *flakyWriter) Write(b []byte) (int, error) {
+	if w.fail > 0 {
+		w.fail--
+		return 0, errors.New("no space left on device")
+	}
+	return w.buf.Write(b)
+}
+
+func TestFileOutputRetriesOnlyFailedFiles(t *testing.T) {
+	serializer, _ := NewInfluxSerializer()
+	good, bad := &flakyWriter{}, &flakyWriter{fail: 1}
+	f := &FileOutput{
+		Files:   []string{"good", "bad"},
+		writers: []io.Writer{good, bad},
+	}
+	f.SetSerializer(serializer)
+	ro := NewRunningOutput("file", f, &OutputConfig{Name: "file"}, 10, 100)
+
+	for _, m := range testMetrics(t, "a", "b") {
+		ro.AddMetric(m)
+	}
+	if err := ro.Write(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := ro.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "a value=1i 1500000000000000000\nb value=1i 1500000000000000000\n"
+	if got := good.buf.String(); got != want {
+		t.Errorf("expected the metrics written once to good:\n%s\ngot:\n%s", want, got)
+	}
+	if got := bad.buf.String(); got != want {
+		t.Errorf("expected the metrics written to bad on retry:\n%s\ngot:\n%s", want, got)
+	}
+	if len(f.written) != 0 {
+		t.Errorf("expected nothing left to track, got %d metrics", len(f.written))
+	}
+}
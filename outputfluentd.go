@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Fluentd writes the metrics to a Fluentd, or Fluent Bit, forward input over
+// the forward protocol, in its Forward mode: a MessagePack array of the tag,
+// the entries of that tag, each a time and a record, and the options.
+//
+//     ["telegraf.cpu", [[<time>, {"cpu": "cpu0", "usage_idle": 98.5}]], {}]
+//
+// The record holds the tags and the fields of the metric, a field winning
+// over a tag of the same name. The shared key authentication of the
+// protocol is not supported.
+type Fluentd struct {
+	Host string
+	Port int
+	// TagPrefix is joined with a dot to the measurement to make the Fluentd
+	// tag, ie, "telegraf.cpu". The tag is the measurement when it is empty.
+	TagPrefix string
+	// RequireAck asks the server to acknowledge each chunk, which is then
+	// retried on the next flush if the acknowledgement does not come.
+	RequireAck bool
+	Timeout    Duration
+
+	conn outputConn
+}
+
+var fluentdSampleConfig = `
+  ## Address of the forward input of Fluentd
+  host = "localhost"
+  port = 24224
+
+  ## The Fluentd tag of the metrics is the measurement after this prefix and a
+  ## dot, ie, telegraf.cpu.
+  tag_prefix = "telegraf"
+
+  ## Wait for the server to acknowledge each write, ie, with
+  ## require_ack_response in Fluent Bit, or in the forward output of another
+  ## Fluentd.
+  # require_ack = false
+
+  ## Timeout for connecting, each write and its acknowledgement
+  # timeout = "5s"
+`
+
+func NewFluentd() *Fluentd {
+	return &Fluentd{
+		Port:      24224,
+		TagPrefix: "telegraf",
+		Timeout:   Duration{Duration: 5 * time.Second},
+	}
+}
+
+func (f *Fluentd) Connect() error {
+	if f.Host == "" {
+		return fmt.Errorf("host is required for the fluentd output")
+	}
+	addr := net.JoinHostPort(f.Host, strconv.Itoa(f.Port))
+	f.conn = outputConn{
+		Output:  "fluentd",
+		Peer:    "Fluentd at " + addr,
+		Network: "tcp",
+		Address: addr,
+		Timeout: f.Timeout.Duration,
+	}
+	return f.conn.dial()
+}
+
+func (f *Fluentd) Close() error {
+	return f.conn.Close()
+}
+
+func (f *Fluentd) SampleConfig() string {
+	return fluentdSampleConfig
+}
+
+func (f *Fluentd) Description() string {
+	return "Configuration for Fluentd server to send metrics to"
+}
+
+func (f *Fluentd) Write(metrics []Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	// a message per tag, in tag order
+	byTag := make(map[string][]Metric)
+	for _, m := range metrics {
+		tag := f.tag(m)
+		byTag[tag] = append(byTag[tag], m)
+	}
+	tags := make([]string, 0, len(byTag))
+	for tag := range byTag {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	// the server closes idle connections
+	if err := f.conn.ready(); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		msg, chunk, err := f.message(tag, byTag[tag])
+		if err != nil {
+			return err
+		}
+		err = f.conn.do(func(conn net.Conn) error {
+			return f.send(conn, msg, chunk)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Fluentd) tag(m Metric) string {
+	if f.TagPrefix == "" {
+		return m.Name()
+	}
+	return f.TagPrefix + "." + m.Name()
+}
+
+// message returns the Forward mode message of the metrics of a tag, and the
+// chunk id that the server acknowledges when RequireAck is set.
+func (f *Fluentd) message(tag string, metrics []Metric) ([]byte, string, error) {
+	b := make([]byte, 0, 128*len(metrics))
+	b = msgpackArrayHeader(b, 3)
+	b = msgpackString(b, tag)
+	b = msgpackArrayHeader(b, len(metrics))
+	for _, m := range metrics {
+		var err error
+		b = msgpackArrayHeader(b, 2)
+		b = fluentdEventTime(b, m.UnixNano())
+		if b, err = fluentdRecord(b, m); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if !f.RequireAck {
+		return msgpackMapHeader(b, 0), "", nil
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", fmt.Errorf("unable to make a chunk id: %s", err)
+	}
+	chunk := base64.StdEncoding.EncodeToString(id)
+	b = msgpackMapHeader(b, 1)
+	b = msgpackString(b, "chunk")
+	b = msgpackString(b, chunk)
+	return b, chunk, nil
+}
+
+// fluentdEventTime encodes a timestamp in nanoseconds as the EventTime of the
+// forward protocol, the extension type 0 with the seconds and nanoseconds.
+func fluentdEventTime(b []byte, ns int64) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = msgpackUint32(b, uint32(ns/int64(time.Second)))
+	return msgpackUint32(b, uint32(ns%int64(time.Second)))
+}
+
+// fluentdRecord encodes the tags and the fields of m as a single map.
+func fluentdRecord(b []byte, m Metric) ([]byte, error) {
+	record := make(map[string]interface{})
+	for k, v := range m.Tags() {
+		record[k] = v
+	}
+	for k, v := range m.Fields() {
+		record[k] = v
+	}
+	keys := make([]string, 0, len(record))
+	for k := range record {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b = msgpackMapHeader(b, len(record))
+	for _, k := range keys {
+		b = msgpackString(b, k)
+		var err error
+		b, err = msgpackValue(b, record[k])
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %s: %s", k, m.Name(), err)
+		}
+	}
+	return b, nil
+}
+
+// send writes a message on conn and, for a chunk, waits for its
+// acknowledgement.
+func (f *Fluentd) send(conn net.Conn, msg []byte, chunk string) error {
+	if f.Timeout.Duration > 0 {
+		conn.SetDeadline(time.Now().Add(f.Timeout.Duration))
+		defer conn.SetDeadline(time.Time{})
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	ack, err := readFluentdAck(bufio.NewReader(conn))
+	if err != nil {
+		return fmt.Errorf("no acknowledgement: %s", err)
+	}
+	if ack != chunk {
+		return fmt.Errorf("acknowledgement of chunk %q, expected %q", ack, chunk)
+	}
+	return nil
+}
+
+// readFluentdAck reads the {"ack": <chunk>} response of the server and
+// returns the chunk id.
+func readFluentdAck(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	var n int
+	switch {
+	case c&0xf0 == 0x80:
+		n = int(c & 0x0f)
+	case c == 0xde:
+		var buf [2]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint16(buf[:]))
+	default:
+		return "", fmt.Errorf("unexpected response, type 0x%02x", c)
+	}
+
+	var ack string
+	for i := 0; i < n; i++ {
+		k, err := readMsgpackString(r)
+		if err != nil {
+			return "", err
+		}
+		v, err := readMsgpackString(r)
+		if err != nil {
+			return "", err
+		}
+		if k == "ack" {
+			ack = v
+		}
+	}
+	return ack, nil
+}
+
+func readMsgpackString(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	var n int
+	switch {
+	case c&0xe0 == 0xa0:
+		n = int(c & 0x1f)
+	case c == 0xd9:
+		l, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		n = int(l)
+	case c == 0xda:
+		var buf [2]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return "", err
+		}
+		n = int(binary.BigEndian.Uint16(buf[:]))
+	default:
+		return "", fmt.Errorf("expected a string, type 0x%02x", c)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fluentdServer is a forward input that decodes the messages it receives,
+// and acknowledges their chunks when ack is set.
+type fluentdServer struct {
+	ln       net.Listener
+	ack      bool
+	messages chan []interface{}
+}
+
+func newFluentdServer(t *testing.T, ack bool) *fluentdServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fluentdServer{ln: ln, ack: ack, messages: make(chan []interface{}, 10)}
+	go s.serve()
+	return s
+}
+
+func (s *fluentdServer) serve() {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var data []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		data = append(data, buf[:n]...)
+		for len(data) > 0 {
+			v, rest, err := msgpackDecode(data)
+			if err != nil {
+				// truncated, wait for the rest of the message
+				break
+			}
+			data = rest
+			msg, _ := v.([]interface{})
+			s.messages <- msg
+			if s.ack && len(msg) == 3 {
+				chunk, _ := msg[2].(map[string]interface{})["chunk"].(string)
+				reply := msgpackMapHeader(nil, 1)
+				reply = msgpackString(reply, "ack")
+				reply = msgpackString(reply, chunk)
+				conn.Write(reply)
+			}
+		}
+	}
+}
+
+func (s *fluentdServer) output() *Fluentd {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	f := NewFluentd()
+	f.Host = host
+	f.Port, _ = strconv.Atoi(port)
+	return f
+}
+
+func (s *fluentdServer) next(t *testing.T) []interface{} {
+	select {
+	case msg := <-s.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	return nil
+}
+
+func TestFluentdForwardMessage(t *testing.T) {
+	s := newFluentdServer(t, false)
+	defer s.ln.Close()
+	f := s.output()
+	if err := f.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	now := time.Unix(1500000000, 123456789)
+	m1, _ := New("cpu", map[string]string{"cpu": "cpu0", "state": "tag"},
+		map[string]interface{}{"usage_idle": 98.5, "state": "field"}, now)
+	m2, _ := New("disk", nil, map[string]interface{}{"used": int64(3)}, now)
+	m3, _ := New("cpu", map[string]string{"cpu": "cpu1"},
+		map[string]interface{}{"usage_idle": 50.0}, now.Add(time.Second))
+	if err := f.Write([]Metric{m2, m1, m3}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a message per tag, in tag order, the field winning over the tag
+	want := [][]interface{}{
+		{"telegraf.cpu", []interface{}{
+			[]interface{}{now, map[string]interface{}{
+				"cpu": "cpu0", "state": "field", "usage_idle": 98.5}},
+			[]interface{}{now.Add(time.Second), map[string]interface{}{
+				"cpu": "cpu1", "usage_idle": 50.0}},
+		}, map[string]interface{}{}},
+		{"telegraf.disk", []interface{}{
+			[]interface{}{now, map[string]interface{}{"used": int64(3)}},
+		}, map[string]interface{}{}},
+	}
+	for _, w := range want {
+		if msg := s.next(t); !reflect.DeepEqual(msg, w) {
+			t.Errorf("expected the message\n%v\ngot\n%v", w, msg)
+		}
+	}
+}
+
+func TestFluentdRequireAck(t *testing.T) {
+	s := newFluentdServer(t, true)
+	defer s.ln.Close()
+	f := s.output()
+	f.TagPrefix = ""
+	f.RequireAck = true
+	if err := f.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	m, _ := New("cpu", nil, map[string]interface{}{"usage_idle": 98.5},
+		time.Unix(1500000000, 0))
+	if err := f.Write([]Metric{m}); err != nil {
+		t.Fatalf("expected the chunk to be acknowledged, got %s", err)
+	}
+	msg := s.next(t)
+	if len(msg) != 3 || msg[0] != "cpu" {
+		t.Fatalf("expected a message tagged cpu, got %v", msg)
+	}
+	chunk, _ := msg[2].(map[string]interface{})["chunk"].(string)
+	if chunk == "" {
+		t.Errorf("expected a chunk option, got %v", msg[2])
+	}
+}
+
+func TestFluentdMissingAck(t *testing.T) {
+	// a server that never acknowledges
+	s := newFluentdServer(t, false)
+	defer s.ln.Close()
+	f := s.output()
+	f.RequireAck = true
+	f.Timeout = Duration{Duration: 100 * time.Millisecond}
+	if err := f.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	m, _ := New("cpu", nil, map[string]interface{}{"usage_idle": 98.5},
+		time.Unix(1500000000, 0))
+	if err := f.Write([]Metric{m}); err == nil {
+		t.Error("expected an error without an acknowledgement")
+	}
+}
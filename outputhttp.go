@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPOutput sends the metrics of each write, in the configured data format,
+// in the body of a single request.
+type HTTPOutput struct {
+	URL         string
+	Method      string
+	Timeout     Duration
+	Headers     map[string]string
+	ContentType string `toml:"content_type"`
+	// MaxRequestBytes, when set, splits a write into several requests whose
+	// bodies are at most this size.
+	MaxRequestBytes Size `toml:"max_request_bytes"`
+
+	// Path to CA file
+	SSLCA string `toml:"ssl_ca"`
+	// Path to host cert file
+	SSLCert string `toml:"ssl_cert"`
+	// Path to cert key file
+	SSLKey string `toml:"ssl_key"`
+	// Use SSL but skip chain & host verification
+	InsecureSkipVerify bool
+
+	client     *http.Client
+	serializer Serializer
+}
+
+var httpOutputSampleConfig = `
+  ## URL is the address to send metrics to
+  url = "http://127.0.0.1:8080/metric"
+
+  ## HTTP method, one of: "POST" or "PUT"
+  # method = "POST"
+
+  ## Timeout for HTTP message
+  # timeout = "5s"
+
+  ## Additional HTTP headers
+  # [outputs.http.headers]
+  #   X-Special-Header = "Special-Value"
+
+  ## Content-Type of the requests, by default the one of the data format,
+  ## ie, "application/msgpack" for msgpack.
+  # content_type = "application/json"
+
+  ## Maximum size of a request body, ie, "1MiB". A write with a larger body
+  ## is split into several requests; a single metric larger than this is
+  ## sent on its own. 0 means no limit.
+  # max_request_bytes = 0
+
+  ## Optional SSL Config
+  # ssl_ca = "/etc/telegraf/ca.pem"
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+  ## Use SSL but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## Data format to output.
+  ## Supported formats: influx, json, msgpack, graphite
+  data_format = "influx"
+`
+
+func NewHTTPOutput() *HTTPOutput {
+	return &HTTPOutput{
+		Method:  "POST",
+		Timeout: Duration{Duration: 5 * time.Second},
+	}
+}
+
+func (h *HTTPOutput) SetSerializer(serializer Serializer) {
+	h.serializer = serializer
+	if h.ContentType == "" {
+		switch serializer.(type) {
+		case *InfluxSerializer:
+			h.ContentType = "text/plain; charset=utf-8"
+		case *JsonSerializer:
+			h.ContentType = "application/json"
+		case *MsgpackSerializer:
+			h.ContentType = "application/msgpack"
+		}
+	}
+}
+
+func (h *HTTPOutput) Connect() error {
+	if h.URL == "" {
+		return fmt.Errorf("url is required for the http output")
+	}
+	h.Method = strings.ToUpper(h.Method)
+	if h.Method != "POST" && h.Method != "PUT" {
+		return fmt.Errorf("invalid method [%s] for the http output", h.Method)
+	}
+
+	tlsCfg, err := GetTLSConfig(h.SSLCert, h.SSLKey, h.SSLCA, h.InsecureSkipVerify)
+	if err != nil {
+		return err
+	}
+	h.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsCfg,
+		},
+		Timeout: h.Timeout.Duration,
+	}
+	return nil
+}
+
+func (h *HTTPOutput) Close() error {
+	return nil
+}
+
+func (h *HTTPOutput) SampleConfig() string {
+	return httpOutputSampleConfig
+}
+
+func (h *HTTPOutput) Description() string {
+	return "A plugin that can transmit metrics over HTTP"
+}
+
+func (h *HTTPOutput) Write(metrics []Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	if h.serializer == nil {
+		return fmt.Errorf("no serializer set for the http output")
+	}
+
+	serialized := make([][]byte, len(metrics))
+	for i, metric := range metrics {
+		b, err := h.serializer.Serialize(metric)
+		if err != nil {
+			return fmt.Errorf("failed to serialize metric: %s", err)
+		}
+		serialized[i] = b
+	}
+
+	ends := splitBySize(len(serialized), h.MaxRequestBytes.Size,
+		func(i int) int64 { return int64(len(serialized[i])) })
+	return writeChunks(metrics, ends, func(start, end int) error {
+		var body []byte
+		for _, b := range serialized[start:end] {
+			body = append(body, b...)
+		}
+		return h.send(body)
+	})
+}
+
+// send sends body in a single request.
+func (h *HTTPOutput) send(body []byte) error {
+	req, err := http.NewRequest(h.Method, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if h.ContentType != "" {
+		req.Header.Set("Content-Type", h.ContentType)
+	}
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending metrics to %s: %s", h.URL, err)
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("when writing to [%s] received status code: %d", h.URL, resp.StatusCode)
+		// the server rejected the metrics themselves, sending them again
+		// would fail the same way
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout &&
+			resp.StatusCode != 429 {
+			return NewFatalWriteError(err)
+		}
+		return err
+	}
+	return nil
+}
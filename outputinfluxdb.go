@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"log"
-	"math/rand"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -11,6 +14,10 @@ import (
 var (
 	// Quote Ident replacer.
 	qiReplacer = strings.NewReplacer("\n", `\n`, `\`, `\\`, `"`, `\"`)
+
+	// influxDroppedRe matches the number of points InfluxDB rejected from a
+	// request it otherwise wrote.
+	influxDroppedRe = regexp.MustCompile(`partial write:.* dropped=(\d+)`)
 )
 
 // InfluxDB struct is the primary data structure for the plugin
@@ -29,6 +36,12 @@ type InfluxDB struct {
 	HTTPProxy        string            `toml:"http_proxy"`
 	HTTPHeaders      map[string]string `toml:"http_headers"`
 	ContentEncoding  string            `toml:"content_encoding"`
+	// MaxRequestBytes, when set, splits a write into several requests of at
+	// most this much line protocol.
+	MaxRequestBytes Size `toml:"max_request_bytes"`
+	// FailoverRetry is how long a URL is passed over after a failed write,
+	// before the writes go back to it.
+	FailoverRetry Duration `toml:"failover_retry"`
 
 	// Path to CA file
 	SSLCA string `toml:"ssl_ca"`
@@ -39,19 +52,35 @@ type InfluxDB struct {
 	// Use SSL but skip chain & host verification
 	InsecureSkipVerify bool
 
-	// Precision is only here for legacy support. It will be ignored.
+	// Precision is only here for legacy support, the precision option of
+	// the output truncates the timestamps before they are written, see
+	// OutputConfig.Precision.
 	Precision string
 
+	// serializer, when not the standard line protocol one, serializes the
+	// request bodies.
+	serializer Serializer
+
 	clients []Client
+	// urls are the URLs of the clients, for the logs.
+	urls []string
+	// active is the client of the last successful write.
+	active int
+	// failedAt holds the time of the last failed write of each client.
+	failedAt []time.Time
 }
 
 var influxOutputSampleConfig = `
   ## The full HTTP or UDP URL for your InfluxDB instance.
   ##
-  ## Multiple urls can be specified as part of the same cluster,
-  ## this means that only ONE of the urls will be written to each interval.
+  ## Multiple urls can be specified, in order of preference, ie, a primary
+  ## and its fallbacks. Each write goes to ONE of them, the first that has not
+  ## failed within failover_retry, failing over to the next ones on error.
   # urls = ["udp://127.0.0.1:8089"] # UDP endpoint example
   urls = ["http://127.0.0.1:8086"] # required
+  ## How long a URL is passed over after a failed write, before the writes
+  ## go back to it.
+  # failover_retry = "1m"
   ## The target database for metrics (telegraf will create it if not exists).
   database = "telegraf" # required
 
@@ -86,6 +115,16 @@ var influxOutputSampleConfig = `
 
   ## Compress each HTTP request payload using GZIP.
   # content_encoding = "gzip"
+
+  ## Maximum size of the line protocol of a request, before compression,
+  ## ie, "1MiB". A larger write is split into several requests; a single
+  ## metric larger than this is sent on its own. 0 means no limit.
+  # max_request_bytes = 0
+
+  ## Data format of the request bodies, the standard line protocol by
+  ## default. Another serializer may be chosen when the endpoint, ie, a
+  ## proxy in front of InfluxDB, expects a variant of it.
+  # data_format = "influx"
 `
 
 // Connect initiates the primary connection to the range of provided URLs
@@ -117,6 +156,7 @@ func (i *InfluxDB) Connect() error {
 				return fmt.Errorf("Error creating UDP Client [%s]: %s", u, err)
 			}
 			i.clients = append(i.clients, c)
+			i.urls = append(i.urls, u)
 		default:
 			// If URL doesn't start with "udp", assume HTTP client
 			config := HTTPConfig{
@@ -143,6 +183,7 @@ func (i *InfluxDB) Connect() error {
 				return fmt.Errorf("Error creating HTTP Client [%s]: %s", u, err)
 			}
 			i.clients = append(i.clients, c)
+			i.urls = append(i.urls, u)
 
 			err = c.Query(fmt.Sprintf(`CREATE DATABASE "%s"`, qiReplacer.Replace(i.Database)))
 			if err != nil {
@@ -154,7 +195,7 @@ func (i *InfluxDB) Connect() error {
 		}
 	}
 
-	rand.Seed(time.Now().UnixNano())
+	i.failedAt = make([]time.Time, len(i.clients))
 	return nil
 }
 
@@ -173,17 +214,87 @@ func (i *InfluxDB) Description() string {
 	return "Configuration for influxdb server to send metrics to"
 }
 
-// Write will choose a random server in the cluster to write to until a successful write
-// occurs, logging each unsuccessful. If all servers fail, return error.
+// SetSerializer sets the serializer of the request bodies. The standard line
+// protocol one is not kept, the metrics are then streamed as they are.
+func (i *InfluxDB) SetSerializer(serializer Serializer) {
+	if _, ok := serializer.(*InfluxSerializer); ok {
+		serializer = nil
+	}
+	i.serializer = serializer
+}
+
+// Write writes to the servers in order of preference until a write succeeds,
+// logging each unsuccessful one. If all servers fail, return error.
 func (i *InfluxDB) Write(metrics []Metric) error {
-	r := NewReader(metrics)
+	if i.serializer != nil {
+		return i.writeSerialized(metrics)
+	}
+
+	ends := splitBySize(len(metrics), i.MaxRequestBytes.Size,
+		func(n int) int64 { return int64(metrics[n].Len()) })
+	return writeChunks(metrics, ends, func(start, end int) error {
+		return i.writeRange(metrics, start, end, func(start, end int) io.Reader {
+			return NewReader(metrics[start:end])
+		})
+	})
+}
+
+// writeSerialized writes metrics with the serializer, splitting them by the
+// size of their serialized form.
+func (i *InfluxDB) writeSerialized(metrics []Metric) error {
+	bufs := make([][]byte, len(metrics))
+	for n, m := range metrics {
+		b, err := i.serializer.Serialize(m)
+		if err != nil {
+			return fmt.Errorf("failed to serialize metric: %s", err)
+		}
+		bufs[n] = b
+	}
+
+	ends := splitBySize(len(bufs), i.MaxRequestBytes.Size,
+		func(n int) int64 { return int64(len(bufs[n])) })
+	return writeChunks(metrics, ends, func(start, end int) error {
+		return i.writeRange(metrics, start, end, func(start, end int) io.Reader {
+			return bytes.NewReader(bytes.Join(bufs[start:end], nil))
+		})
+	})
+}
+
+// writeRange writes metrics[start:end], with the request body returned by
+// body. A rejected point, ie, of a field type conflict, must not take the
+// other points of its request with it: InfluxDB usually writes them anyway,
+// reporting how many points it dropped, and when it rejects the whole
+// request instead, the request is split in two and each half written again,
+// down to the points that are rejected on their own.
+func (i *InfluxDB) writeRange(metrics []Metric, start, end int, body func(start, end int) io.Reader) error {
+	err := i.write(func() io.Reader { return body(start, end) })
+	if err == nil || IsRetryable(err) {
+		return err
+	}
+	if m := influxDroppedRe.FindStringSubmatch(err.Error()); m != nil {
+		if dropped, _ := strconv.Atoi(m[1]); dropped < end-start {
+			return &partialWriteError{err: err, dropped: dropped}
+		}
+		return err
+	}
+	if end-start == 1 {
+		return err
+	}
+	mid := (end - start) / 2
+	return writeChunks(metrics[start:end], []int{mid, end - start}, func(s, e int) error {
+		return i.writeRange(metrics, start+s, start+e, body)
+	})
+}
 
+// write writes a request body, as returned by newBody, to one of the
+// servers.
+func (i *InfluxDB) write(newBody func() io.Reader) error {
 	// This will get set to nil if a successful write occurs
 	err := fmt.Errorf("Could not write to any InfluxDB server in cluster")
 
-	p := rand.Perm(len(i.clients))
-	for _, n := range p {
-		if e := i.clients[n].WriteStream(r); e != nil {
+	for _, n := range i.writeOrder(time.Now()) {
+		// a failed write may have read part of the body
+		if e := i.clients[n].WriteStream(newBody()); e != nil {
 			// If the database was not found, try to recreate it:
 			if strings.Contains(e.Error(), "database not found") {
 				errc := i.clients[n].Query(fmt.Sprintf(`CREATE DATABASE "%s"`, qiReplacer.Replace(i.Database)))
@@ -194,10 +305,9 @@ func (i *InfluxDB) Write(metrics []Metric) error {
 			}
 
 			if strings.Contains(e.Error(), "field type conflict") {
-				log.Printf("E! Field type conflict, dropping conflicted points: %s", e)
-				// setting err to nil, otherwise we will keep retrying and points
-				// w/ conflicting types will get stuck in the buffer forever.
-				err = nil
+				// not retryable, otherwise points w/ conflicting types
+				// will get stuck in the buffer forever.
+				err = NewFatalWriteError(fmt.Errorf("field type conflict: %s", e))
 				break
 			}
 
@@ -212,10 +322,9 @@ func (i *InfluxDB) Write(metrics []Metric) error {
 			}
 
 			if strings.Contains(e.Error(), "unable to parse") {
-				log.Printf("E! Parse error; dropping points: %s", e)
 				// This error indicates a bug in Telegraf or InfluxDB parsing
 				// of line protocol.  Retries will not be successful.
-				err = nil
+				err = NewFatalWriteError(fmt.Errorf("parse error: %s", e))
 				break
 			}
 
@@ -225,9 +334,15 @@ func (i *InfluxDB) Write(metrics []Metric) error {
 				break
 			}
 
-			// Log write failure
+			// Log write failure, and fail over to the next server
 			log.Printf("E! InfluxDB Output Error: %s", e)
+			i.failedAt[n] = time.Now()
 		} else {
+			if n != i.active {
+				log.Printf("I! InfluxDB output writing to %s", i.urls[n])
+				i.active = n
+			}
+			i.failedAt[n] = time.Time{}
 			err = nil
 			break
 		}
@@ -236,9 +351,25 @@ func (i *InfluxDB) Write(metrics []Metric) error {
 	return err
 }
 
+// writeOrder returns the clients in the order to try them: those that have
+// not failed within FailoverRetry, then the others as a last resort, each in
+// order of preference.
+func (i *InfluxDB) writeOrder(now time.Time) []int {
+	var healthy, failed []int
+	for n := range i.clients {
+		if i.failedAt[n].IsZero() || now.Sub(i.failedAt[n]) >= i.FailoverRetry.Duration {
+			healthy = append(healthy, n)
+		} else {
+			failed = append(failed, n)
+		}
+	}
+	return append(healthy, failed...)
+}
+
 func newInflux() *InfluxDB {
 	return &InfluxDB{
-		Timeout: Duration{Duration: time.Second * 5},
+		Timeout:       Duration{Duration: time.Second * 5},
+		FailoverRetry: Duration{Duration: time.Minute},
 	}
 }
 
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestInfluxDBWriteDropsOnlyRejectedPoints checks that the points InfluxDB
+// rejects, whether it writes the others of their request or not, are the
+// only ones dropped.
+func TestInfluxDBWriteDropsOnlyRejectedPoints(t *testing.T) {
+	for _, partial := range []bool{true, false} {
+		var mu sync.Mutex
+		var received []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/write" {
+				return
+			}
+			var names []string
+			bad := 0
+			s := bufio.NewScanner(r.Body)
+			for s.Scan() {
+				name := strings.SplitN(s.Text(), " ", 2)[0]
+				if strings.HasPrefix(name, "bad") {
+					bad++
+					continue
+				}
+				names = append(names, name)
+			}
+			if bad > 0 && !partial {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"unable to parse 'bad': invalid field format"}`)
+				return
+			}
+			mu.Lock()
+			received = append(received, names...)
+			mu.Unlock()
+			if bad > 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, `{"error":"partial write: field type conflict: input `+
+					`field \"value\" on measurement \"bad\" is type integer, already `+
+					`exists as type float dropped=%d"}`, bad)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		i := newInflux()
+		i.URLs = []string{ts.URL}
+		i.Database = "telegraf"
+		if err := i.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		name := fmt.Sprintf("influxdb_partial_%v", partial)
+		ro := NewRunningOutput(name, i, &OutputConfig{Name: name}, 10, 100)
+		for _, m := range testMetrics(t, "a", "bad1", "b", "c", "bad2", "d") {
+			ro.AddMetric(m)
+		}
+		if err := ro.Write(); err != nil {
+			t.Errorf("partial %v: %s", partial, err)
+		}
+		ts.Close()
+
+		if got := strings.Join(received, ","); got != "a,b,c,d" {
+			t.Errorf("partial %v: expected a,b,c,d to be written, got %s", partial, got)
+		}
+		if n := ro.MetricsDropped.Get(); n != 2 {
+			t.Errorf("partial %v: expected 2 dropped metrics, got %d", partial, n)
+		}
+		if n := ro.MetricsWritten.Get(); n != 4 {
+			t.Errorf("partial %v: expected 4 written metrics, got %d", partial, n)
+		}
+	}
+}
+
+// failoverServer is an InfluxDB mock, counting the points written to it,
+// whose writes fail while it is down.
+type failoverServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	down   bool
+	points int
+}
+
+func newFailoverServer() *failoverServer {
+	s := &failoverServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/write" {
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.down {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":"timeout"}`)
+			return
+		}
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			s.points++
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return s
+}
+
+func (s *failoverServer) setDown(down bool) {
+	s.mu.Lock()
+	s.down = down
+	s.mu.Unlock()
+}
+
+func (s *failoverServer) written() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.points
+}
+
+// TestInfluxDBFailover checks that the writes go to the second URL while the
+// first one fails, that the first one is passed over for failover_retry, and
+// that the writes go back to it afterwards.
+func TestInfluxDBFailover(t *testing.T) {
+	primary, secondary := newFailoverServer(), newFailoverServer()
+	defer primary.Close()
+	defer secondary.Close()
+
+	i := newInflux()
+	i.URLs = []string{primary.URL, secondary.URL}
+	i.Database = "telegraf"
+	if err := i.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	primary.setDown(true)
+	if err := i.Write(testMetrics(t, "a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+	if p, s := primary.written(), secondary.written(); p != 0 || s != 3 {
+		t.Fatalf("expected 3 points on the secondary, got %d on the primary and %d on the secondary", p, s)
+	}
+	if order := i.writeOrder(time.Now()); order[0] != 1 {
+		t.Errorf("expected the secondary to be tried first, got order %v", order)
+	}
+
+	// within failover_retry, the primary is not tried again even though
+	// it is back
+	primary.setDown(false)
+	if err := i.Write(testMetrics(t, "d")); err != nil {
+		t.Fatal(err)
+	}
+	if p, s := primary.written(), secondary.written(); p != 0 || s != 4 {
+		t.Errorf("expected 4 points on the secondary, got %d on the primary and %d on the secondary", p, s)
+	}
+
+	// once failover_retry has passed, the writes go back to the primary
+	i.failedAt[0] = time.Now().Add(-i.FailoverRetry.Duration)
+	if err := i.Write(testMetrics(t, "e", "f")); err != nil {
+		t.Fatal(err)
+	}
+	if p, s := primary.written(), secondary.written(); p != 2 || s != 4 {
+		t.Errorf("expected 2 points on the primary, got %d on the primary and %d on the secondary", p, s)
+	}
+	if order := i.writeOrder(time.Now()); order[0] != 0 {
+		t.Errorf("expected the primary to be tried first, got order %v", order)
+	}
+
+	// with every URL failing, the write fails
+	primary.setDown(true)
+	secondary.setDown(true)
+	if err := i.Write(testMetrics(t, "g")); err == nil {
+		t.Error("expected an error with every server down")
+	}
+}
+
+// TestInfluxDBDataFormat checks that the request bodies are serialized with
+// the serializer of data_format, the line protocol by default, and that
+// each request is made of whole serialized metrics.
+func TestInfluxDBDataFormat(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/write" {
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"", []string{"a value=1i 1500000000000000000\n", "b value=1i 1500000000000000000\n"}},
+		{`data_format = "influx"`, []string{"a value=1i 1500000000000000000\n", "b value=1i 1500000000000000000\n"}},
+		{`data_format = "json"`, []string{
+			`{"fields":{"value":1},"name":"a","tags":{},"timestamp":1500000000}` + "\n",
+			`{"fields":{"value":1},"name":"b","tags":{},"timestamp":1500000000}` + "\n",
+		}},
+	}
+	for _, tt := range tests {
+		c := loadTestConfig(t, fmt.Sprintf(`
+[[outputs.influxdb]]
+  urls = ["%s"]
+  database = "telegraf"
+  %s
+`, ts.URL, tt.format))
+		i := c.Outputs[0].Output.(*InfluxDB)
+		if err := i.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		// a request per metric
+		i.MaxRequestBytes.Size = 1
+
+		bodies = nil
+		if err := i.Write(testMetrics(t, "a", "b")); err != nil {
+			t.Errorf("%q: %s", tt.format, err)
+			continue
+		}
+		if !reflect.DeepEqual(bodies, tt.want) {
+			t.Errorf("%q: expected the bodies %q, got %q", tt.format, tt.want, bodies)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// Kafka produces the metrics, in the configured data format, to a Kafka
+// topic, a message per metric. The batches of metric_batch_size metrics are
+// a write each, which fails and is retried from the buffer when a broker
+// does not accept it.
+type Kafka struct {
+	Brokers []string
+	Topic   string
+	// RoutingTag, when set, keys each metric with the value of this tag, so
+	// the metrics of the same value go to the same partition. Metrics
+	// without the tag are spread over the partitions.
+	RoutingTag string `toml:"routing_tag"`
+	ClientID   string `toml:"client_id"`
+	// RequiredAcks is 0 to not wait for the leader, 1 to wait for the leader
+	// and -1 to wait for all the in-sync replicas.
+	RequiredAcks int `toml:"required_acks"`
+	Timeout      Duration
+
+	// Path to CA file
+	SSLCA string `toml:"ssl_ca"`
+	// Path to host cert file
+	SSLCert string `toml:"ssl_cert"`
+	// Path to cert key file
+	SSLKey string `toml:"ssl_key"`
+	// Use SSL but skip chain & host verification
+	InsecureSkipVerify bool
+
+	serializer Serializer
+	producer   kafkaProducer
+	// newProducer connects to the brokers, it is replaced in tests
+	newProducer func() (kafkaProducer, error)
+}
+
+var kafkaSampleConfig = `
+  ## Kafka brokers, the metadata of the topic is fetched from the first one
+  ## that answers.
+  brokers = ["localhost:9092"]
+
+  ## Kafka topic to produce to
+  topic = "telegraf"
+
+  ## The value of this tag is the key of the messages, so the metrics of the
+  ## same value go to the same partition. Metrics without it, or all the
+  ## metrics when it is not set, are spread over the partitions.
+  # routing_tag = "host"
+
+  ## Client id of the producer
+  # client_id = "telegraf"
+
+  ## Acknowledgements to wait for:
+  ##   0: none, the metrics may be lost
+  ##   1: the leader of the partition has written the metrics
+  ##  -1: all the in-sync replicas have written the metrics
+  # required_acks = 1
+
+  ## Timeout for connecting and for the brokers to accept a write
+  # timeout = "5s"
+
+  ## Optional SSL Config
+  # ssl_ca = "/etc/telegraf/ca.pem"
+  # ssl_cert = "/etc/telegraf/cert.pem"
+  # ssl_key = "/etc/telegraf/key.pem"
+  ## Use SSL but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## Data format to output.
+  ## Supported formats: influx, json, msgpack, graphite
+  data_format = "influx"
+`
+
+func NewKafka() *Kafka {
+	return &Kafka{
+		ClientID:     "telegraf",
+		RequiredAcks: 1,
+		Timeout:      Duration{Duration: DEFAULT_WRITE_TIMEOUT},
+	}
+}
+
+func (k *Kafka) SetSerializer(serializer Serializer) {
+	k.serializer = serializer
+}
+
+func (k *Kafka) Connect() error {
+	if len(k.Brokers) == 0 {
+		return fmt.Errorf("brokers are required for the kafka output")
+	}
+	if k.Topic == "" {
+		return fmt.Errorf("topic is required for the kafka output")
+	}
+	if k.RequiredAcks < -1 || k.RequiredAcks > 1 {
+		return fmt.Errorf("invalid required_acks %d for the kafka output, "+
+			"must be 0, 1 or -1", k.RequiredAcks)
+	}
+
+	if k.newProducer == nil {
+		tlsConfig, err := GetTLSConfig(
+			k.SSLCert, k.SSLKey, k.SSLCA, k.InsecureSkipVerify)
+		if err != nil {
+			return err
+		}
+		config := kafkaConfig{
+			Brokers:      k.Brokers,
+			Topic:        k.Topic,
+			ClientID:     k.ClientID,
+			TLSConfig:    tlsConfig,
+			Timeout:      k.Timeout.Duration,
+			RequiredAcks: int16(k.RequiredAcks),
+		}
+		k.newProducer = func() (kafkaProducer, error) {
+			c, err := dialKafka(config)
+			if err != nil {
+				return nil, err
+			}
+			return c, nil
+		}
+	}
+	return k.connect()
+}
+
+// connect opens the producer, closing the previous one if any.
+func (k *Kafka) connect() error {
+	k.Close()
+	producer, err := k.newProducer()
+	if err != nil {
+		return err
+	}
+	k.producer = producer
+	return nil
+}
+
+func (k *Kafka) Close() error {
+	if k.producer == nil {
+		return nil
+	}
+	err := k.producer.Close()
+	k.producer = nil
+	return err
+}
+
+func (k *Kafka) SampleConfig() string {
+	return kafkaSampleConfig
+}
+
+func (k *Kafka) Description() string {
+	return "Configuration for the Kafka server to send metrics to"
+}
+
+func (k *Kafka) Write(metrics []Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	if k.serializer == nil {
+		return fmt.Errorf("no serializer set for the kafka output")
+	}
+
+	msgs := make([]kafkaMessage, 0, len(metrics))
+	for _, m := range metrics {
+		b, err := k.serializer.Serialize(m)
+		if err != nil {
+			return fmt.Errorf("failed to serialize metric: %s", err)
+		}
+		msg := kafkaMessage{value: b}
+		if k.RoutingTag != "" {
+			if key, ok := m.Tags()[k.RoutingTag]; ok {
+				msg.key = []byte(key)
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+
+	// a leader may have moved to another broker, so a failed write fetches
+	// the metadata again and is retried once, further retries are left to
+	// the buffer and the next flush
+	if k.producer == nil {
+		if err := k.connect(); err != nil {
+			return err
+		}
+	}
+	if err := k.producer.SendMessages(msgs); err != nil {
+		log.Printf("D! Output [kafka] write to topic %s failed, reconnecting: %s",
+			k.Topic, err)
+		if err := k.connect(); err != nil {
+			return err
+		}
+		if err := k.producer.SendMessages(msgs); err != nil {
+			k.Close()
+			return fmt.Errorf("error writing to topic %s: %s", k.Topic, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKafkaProducer records the messages sent to it, failing the sends
+// while fail is positive.
+type fakeKafkaProducer struct {
+	fail   int
+	sent   []kafkaMessage
+	closed bool
+}
+
+func (f *fakeKafkaProducer) SendMessages(msgs []kafkaMessage) error {
+	if f.fail > 0 {
+		f.fail--
+		return errors.New("kafka: NOT_LEADER_FOR_PARTITION")
+	}
+	f.sent = append(f.sent, msgs...)
+	return nil
+}
+
+func (f *fakeKafkaProducer) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestKafkaWrite(t *testing.T) {
+	serializer, _ := NewInfluxSerializer()
+	fake := &fakeKafkaProducer{}
+	k := NewKafka()
+	k.Brokers = []string{"localhost:9092"}
+	k.Topic = "telegraf"
+	k.RoutingTag = "host"
+	k.SetSerializer(serializer)
+	k.newProducer = func() (kafkaProducer, error) { return fake, nil }
+	if err := k.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1500000000, 0)
+	m1, _ := New("cpu", map[string]string{"host": "web1"},
+		map[string]interface{}{"usage": 1.5}, now)
+	m2, _ := New("cpu", nil, map[string]interface{}{"usage": 2.5}, now)
+	if err := k.Write([]Metric{m1, m2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.sent) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(fake.sent))
+	}
+	if key := string(fake.sent[0].key); key != "web1" {
+		t.Errorf("expected the key of the host tag, got %q", key)
+	}
+	if fake.sent[1].key != nil {
+		t.Errorf("expected no key, got %q", fake.sent[1].key)
+	}
+}
+
+func TestKafkaWriteReconnects(t *testing.T) {
+	serializer, _ := NewInfluxSerializer()
+	fake := &fakeKafkaProducer{fail: 1}
+	dials := 0
+	k := NewKafka()
+	k.Brokers = []string{"localhost:9092"}
+	k.Topic = "telegraf"
+	k.SetSerializer(serializer)
+	k.newProducer = func() (kafkaProducer, error) {
+		dials++
+		return fake, nil
+	}
+	if err := k.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	m, _ := New("cpu", nil, map[string]interface{}{"usage": 1.5}, time.Now())
+	if err := k.Write([]Metric{m}); err != nil {
+		t.Fatal(err)
+	}
+	if dials != 2 || len(fake.sent) != 1 {
+		t.Errorf("expected a reconnect and a retry, got %d dials and %d "+
+			"messages", dials, len(fake.sent))
+	}
+
+	// a send that fails again is returned, and the producer closed
+	fake.fail = 2
+	if err := k.Write([]Metric{m}); err == nil {
+		t.Error("expected an error")
+	}
+	if k.producer != nil || !fake.closed {
+		t.Error("expected the producer to be closed")
+	}
+}
+
+// fakeKafkaBroker answers the metadata requests with a single partition it
+// leads, and decodes the record batches of the produce requests.
+type fakeKafkaBroker struct {
+	t  *testing.T
+	ln net.Listener
+
+	mu       sync.Mutex
+	versions map[int16]int16
+	records  []kafkaMessage
+}
+
+func newFakeKafkaBroker(t *testing.T) *fakeKafkaBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeKafkaBroker{t: t, ln: ln, versions: make(map[int16]int16)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *fakeKafkaBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		var size int32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		req := make([]byte, size)
+		if _, err := io.ReadFull(r, req); err != nil {
+			return
+		}
+		h := kafkaReader{b: req}
+		apiKey, version, id := h.int16(), h.int16(), h.int32()
+		h.string()
+		b.mu.Lock()
+		b.versions[apiKey] = version
+		b.mu.Unlock()
+
+		var w kafkaWriter
+		w.int32(0)
+		w.int32(id)
+		switch apiKey {
+		case kafkaMetadataKey:
+			host, port, _ := net.SplitHostPort(b.ln.Addr().String())
+			p, _ := strconv.Atoi(port)
+			w.int32(1)
+			w.int32(1)
+			w.string(host)
+			w.int32(int32(p))
+			w.int32(1)
+			w.int16(0)
+			w.string("telegraf")
+			w.int32(1)
+			w.int16(0)
+			w.int32(0) // partition
+			w.int32(1) // leader
+			w.int32(0)
+			w.int32(0)
+		case kafkaProduceKey:
+			b.produce(h)
+			w.int32(1)
+			w.string("telegraf")
+			w.int32(1)
+			w.int32(0)
+			w.int16(0)
+			w.int64(0)
+			w.int64(-1)
+			w.int32(0)
+		}
+		resp := w.Bytes()
+		binary.BigEndian.PutUint32(resp, uint32(len(resp)-4))
+		conn.Write(resp)
+	}
+}
+
+// produce decodes the record batch of a produce request of a partition.
+func (b *fakeKafkaBroker) produce(r kafkaReader) {
+	r.string() // transactional id
+	r.int16()
+	r.int32()
+	r.int32()
+	r.string()
+	r.int32()
+	r.int32()
+	batch := r.next(int(r.int32()))
+	if r.err != nil {
+		b.t.Errorf("short produce request: %s", r.err)
+		return
+	}
+	if batch[16] != 2 {
+		b.t.Errorf("expected the magic 2, got %d", batch[16])
+	}
+	if n := binary.BigEndian.Uint32(batch[8:]); int(n) != len(batch)-12 {
+		b.t.Errorf("expected the batch length %d, got %d", len(batch)-12, n)
+	}
+	crc := crc32.Checksum(batch[21:], crc32.MakeTable(crc32.Castagnoli))
+	if got := binary.BigEndian.Uint32(batch[17:]); got != crc {
+		b.t.Errorf("expected the CRC %x, got %x", crc, got)
+	}
+
+	br := kafkaReader{b: batch[57:]}
+	n := br.int32()
+	records := br.b
+	for i := int32(0); i < n; i++ {
+		length, k := binary.Varint(records)
+		rec := records[k : k+int(length)]
+		records = records[k+int(length):]
+
+		rec = rec[1:] // attributes
+		_, k = binary.Varint(rec)
+		rec = rec[k:]
+		delta, k := binary.Varint(rec)
+		rec = rec[k:]
+		if delta != int64(i) {
+			b.t.Errorf("expected the offset delta %d, got %d", i, delta)
+		}
+		var m kafkaMessage
+		for _, field := range []*[]byte{&m.key, &m.value} {
+			l, k := binary.Varint(rec)
+			rec = rec[k:]
+			if l >= 0 {
+				*field = rec[:l]
+				rec = rec[l:]
+			}
+		}
+		b.mu.Lock()
+		b.records = append(b.records, m)
+		b.mu.Unlock()
+	}
+}
+
+func TestKafkaClientProducesRecordBatches(t *testing.T) {
+	b := newFakeKafkaBroker(t)
+	defer b.ln.Close()
+
+	c, err := dialKafka(kafkaConfig{
+		Brokers:      []string{b.ln.Addr().String()},
+		Topic:        "telegraf",
+		ClientID:     "telegraf",
+		Timeout:      5 * time.Second,
+		RequiredAcks: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	msgs := []kafkaMessage{
+		{key: []byte("web1"), value: []byte("cpu usage=1.5")},
+		{value: []byte("cpu usage=2.5")},
+	}
+	if err := c.SendMessages(msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if v := b.versions[kafkaProduceKey]; v != 3 {
+		t.Errorf("expected produce version 3, got %d", v)
+	}
+	if len(b.records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(b.records))
+	}
+	for i, m := range msgs {
+		got := b.records[i]
+		if string(got.key) != string(m.key) || (got.key == nil) != (m.key == nil) ||
+			string(got.value) != string(m.value) {
+			t.Errorf("expected the record %q %q, got %q %q", m.key, m.value,
+				got.key, got.value)
+		}
+	}
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// The Kafka API keys of the requests the client sends, and their versions.
+// Produce is sent in version 3, the first with record batches, as the
+// brokers since Kafka 4.0 no longer accept the older message sets.
+const (
+	kafkaProduceKey      = 0
+	kafkaProduceVersion  = 3
+	kafkaMetadataKey     = 3
+	kafkaMetadataVersion = 0
+)
+
+// kafkaErrors are the names of the Kafka error codes a producer may get.
+var kafkaErrors = map[int16]string{
+	-1: "UNKNOWN",
+	2:  "CORRUPT_MESSAGE",
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_FOR_PARTITION",
+	7:  "REQUEST_TIMED_OUT",
+	8:  "BROKER_NOT_AVAILABLE",
+	10: "MESSAGE_TOO_LARGE",
+	17: "INVALID_TOPIC_EXCEPTION",
+	18: "RECORD_LIST_TOO_LARGE",
+	19: "NOT_ENOUGH_REPLICAS",
+	20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	21: "INVALID_REQUIRED_ACKS",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+}
+
+func kafkaError(code int16) error {
+	name, ok := kafkaErrors[code]
+	if !ok {
+		name = "error " + strconv.Itoa(int(code))
+	}
+	return fmt.Errorf("kafka: %s", name)
+}
+
+// kafkaMessage is a message to produce, with its key. A nil key spreads the
+// messages over the partitions of the topic.
+type kafkaMessage struct {
+	key   []byte
+	value []byte
+}
+
+// kafkaProducer produces messages to a topic and waits for the brokers to
+// accept them. It is the seam between the output and the protocol,
+// replaced in tests.
+type kafkaProducer interface {
+	SendMessages(msgs []kafkaMessage) error
+	Close() error
+}
+
+// kafkaConfig holds the settings of a kafkaClient.
+type kafkaConfig struct {
+	Brokers   []string
+	Topic     string
+	ClientID  string
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+	// RequiredAcks is 0 to not wait for the leader, 1 to wait for the leader
+	// and -1 to wait for all the in-sync replicas.
+	RequiredAcks int16
+}
+
+// kafkaClient is a minimal Kafka producer: it learns the partitions of the
+// topic and their leaders from the metadata of a broker, and sends each
+// leader the messages of its partitions in a produce request, a record
+// batch per partition. Records are not compressed. Any error closes the connections, the metadata is fetched
+// again on the next send.
+type kafkaClient struct {
+	config kafkaConfig
+
+	// leaders are the ids of the leader brokers of the partitions of the
+	// topic, addrs the addresses of the brokers and conns the connections
+	// opened to them.
+	leaders []int32
+	addrs   map[int32]string
+	conns   map[int32]*kafkaConn
+
+	// next is the partition of the next message without a key
+	next          int
+	correlationID int32
+}
+
+type kafkaConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialKafka returns a client for the topic, with its metadata fetched from
+// the first of the brokers that answers.
+func dialKafka(config kafkaConfig) (*kafkaClient, error) {
+	if len(config.Brokers) == 0 {
+		return nil, fmt.Errorf("no kafka brokers")
+	}
+	k := &kafkaClient{config: config}
+	if err := k.refreshMetadata(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// SendMessages produces msgs, a request per leader broker, and returns the
+// first error of a broker or a partition. Some of the messages may have been
+// accepted by then.
+func (k *kafkaClient) SendMessages(msgs []kafkaMessage) error {
+	if k.leaders == nil {
+		if err := k.refreshMetadata(); err != nil {
+			return err
+		}
+	}
+
+	// the messages of each partition, by leader
+	sets := make(map[int32]map[int32][]kafkaMessage)
+	for _, m := range msgs {
+		partition := k.partition(m.key)
+		leader := k.leaders[partition]
+		if leader < 0 {
+			k.reset()
+			return fmt.Errorf("kafka: no leader for partition %d of %s",
+				partition, k.config.Topic)
+		}
+		if sets[leader] == nil {
+			sets[leader] = make(map[int32][]kafkaMessage)
+		}
+		sets[leader][partition] = append(sets[leader][partition], m)
+	}
+
+	for leader, partitions := range sets {
+		if err := k.produce(leader, partitions); err != nil {
+			k.reset()
+			return err
+		}
+	}
+	return nil
+}
+
+// partition returns the partition of a message: the FNV-1a hash of its key,
+// the same as the default partitioner of the sarama library, or the next
+// partition in turn without a key.
+func (k *kafkaClient) partition(key []byte) int32 {
+	n := len(k.leaders)
+	if key == nil {
+		k.next = (k.next + 1) % n
+		return int32(k.next)
+	}
+	h := fnv.New32a()
+	h.Write(key)
+	p := int32(h.Sum32()) % int32(n)
+	if p < 0 {
+		p = -p
+	}
+	return p
+}
+
+func (k *kafkaClient) produce(leader int32, partitions map[int32][]kafkaMessage) error {
+	now := time.Now()
+	var w kafkaWriter
+	w.nullString()
+	w.int16(k.config.RequiredAcks)
+	w.int32(int32(k.config.Timeout / time.Millisecond))
+	w.int32(1)
+	w.string(k.config.Topic)
+	w.int32(int32(len(partitions)))
+	for partition, msgs := range partitions {
+		batch := kafkaRecordBatch(msgs, now)
+		w.int32(partition)
+		w.int32(int32(len(batch)))
+		w.Write(batch)
+	}
+
+	conn, err := k.conn(leader)
+	if err != nil {
+		return err
+	}
+	if k.config.RequiredAcks == 0 {
+		// the broker does not respond without acks
+		return k.send(conn, kafkaProduceKey, kafkaProduceVersion, w.Bytes())
+	}
+	resp, err := k.roundTrip(conn, kafkaProduceKey, kafkaProduceVersion, w.Bytes())
+	if err != nil {
+		return err
+	}
+
+	r := kafkaReader{b: resp}
+	for topics := r.int32(); topics > 0 && r.err == nil; topics-- {
+		r.string()
+		for n := r.int32(); n > 0 && r.err == nil; n-- {
+			r.int32()
+			code := r.int16()
+			r.int64()
+			r.int64()
+			if r.err == nil && code != 0 {
+				return kafkaError(code)
+			}
+		}
+	}
+	return r.err
+}
+
+// refreshMetadata fetches the partitions of the topic and the brokers that
+// lead them.
+func (k *kafkaClient) refreshMetadata() error {
+	k.reset()
+	var w kafkaWriter
+	w.int32(1)
+	w.string(k.config.Topic)
+
+	var resp []byte
+	var err error
+	for _, broker := range k.config.Brokers {
+		var conn *kafkaConn
+		conn, err = k.dial(broker)
+		if err != nil {
+			continue
+		}
+		resp, err = k.roundTrip(conn, kafkaMetadataKey, kafkaMetadataVersion, w.Bytes())
+		conn.conn.Close()
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	r := kafkaReader{b: resp}
+	addrs := make(map[int32]string)
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		id := r.int32()
+		host := r.string()
+		port := r.int32()
+		addrs[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	var leaders []int32
+	for topics := r.int32(); topics > 0 && r.err == nil; topics-- {
+		code := r.int16()
+		name := r.string()
+		var partitions []int32
+		for n := r.int32(); n > 0 && r.err == nil; n-- {
+			r.int16()
+			id := r.int32()
+			leader := r.int32()
+			r.skipInt32s()
+			r.skipInt32s()
+			for int(id) >= len(partitions) {
+				partitions = append(partitions, -1)
+			}
+			partitions[id] = leader
+		}
+		if name != k.config.Topic {
+			continue
+		}
+		if r.err == nil && code != 0 {
+			return fmt.Errorf("%s for topic %s", kafkaError(code), name)
+		}
+		leaders = partitions
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if len(leaders) == 0 {
+		return fmt.Errorf("kafka: no partitions for topic %s", k.config.Topic)
+	}
+	k.leaders, k.addrs = leaders, addrs
+	return nil
+}
+
+// conn returns the connection to a broker, opening it if need be.
+func (k *kafkaClient) conn(id int32) (*kafkaConn, error) {
+	if conn, ok := k.conns[id]; ok {
+		return conn, nil
+	}
+	addr, ok := k.addrs[id]
+	if !ok {
+		return nil, fmt.Errorf("kafka: unknown broker %d", id)
+	}
+	conn, err := k.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	if k.conns == nil {
+		k.conns = make(map[int32]*kafkaConn)
+	}
+	k.conns[id] = conn
+	return conn, nil
+}
+
+func (k *kafkaClient) dial(addr string) (*kafkaConn, error) {
+	var conn net.Conn
+	var err error
+	if k.config.TLSConfig != nil {
+		dialer := &net.Dialer{Timeout: k.config.Timeout}
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, k.config.TLSConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, k.config.Timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to kafka broker %s: %s", addr, err)
+	}
+	return &kafkaConn{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// send writes a request, its size, the header and the body.
+func (k *kafkaClient) send(c *kafkaConn, apiKey, version int16, body []byte) error {
+	k.correlationID++
+	var w kafkaWriter
+	w.int32(0)
+	w.int16(apiKey)
+	w.int16(version)
+	w.int32(k.correlationID)
+	w.string(k.config.ClientID)
+	w.Write(body)
+	b := w.Bytes()
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+
+	if k.config.Timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(k.config.Timeout))
+	}
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// roundTrip sends a request and returns the body of its response.
+func (k *kafkaClient) roundTrip(c *kafkaConn, apiKey, version int16, body []byte) ([]byte, error) {
+	if err := k.send(c, apiKey, version, body); err != nil {
+		return nil, err
+	}
+	var header [8]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size < 4 || size > 64*1024*1024 {
+		return nil, fmt.Errorf("kafka: invalid response size %d", size)
+	}
+	if id := int32(binary.BigEndian.Uint32(header[4:])); id != k.correlationID {
+		return nil, fmt.Errorf("kafka: response %d to request %d", id, k.correlationID)
+	}
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// reset closes the connections and forgets the metadata.
+func (k *kafkaClient) reset() {
+	for _, c := range k.conns {
+		c.conn.Close()
+	}
+	k.conns = nil
+	k.leaders = nil
+}
+
+func (k *kafkaClient) Close() error {
+	k.reset()
+	return nil
+}
+
+// kafkaCastagnoli is the CRC-32C table of the checksum of record batches.
+var kafkaCastagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaRecordBatch returns msgs as a record batch, the magic 2 format: its
+// header, with the offsets and the producer ids left for the broker to set,
+// and a record per message, all timestamped with now.
+func kafkaRecordBatch(msgs []kafkaMessage, now time.Time) []byte {
+	ts := now.UnixNano() / int64(time.Millisecond)
+	var w kafkaWriter
+	w.int64(0)  // base offset
+	w.int32(0)  // length, set below
+	w.int32(-1) // partition leader epoch
+	w.int8(2)   // magic
+	w.int32(0)  // CRC, set below
+	w.int16(0)  // attributes
+	w.int32(int32(len(msgs) - 1))
+	w.int64(ts)
+	w.int64(ts)
+	w.int64(-1) // producer id
+	w.int16(-1) // producer epoch
+	w.int32(-1) // base sequence
+	w.int32(int32(len(msgs)))
+	for i, m := range msgs {
+		var r kafkaWriter
+		r.int8(0)   // attributes
+		r.varint(0) // timestamp delta
+		r.varint(int64(i))
+		r.varintBytes(m.key)
+		r.varintBytes(m.value)
+		r.varint(0) // headers
+		w.varint(int64(r.Len()))
+		w.Write(r.Bytes())
+	}
+
+	b := w.Bytes()
+	binary.BigEndian.PutUint32(b[8:], uint32(len(b)-12))
+	binary.BigEndian.PutUint32(b[17:], crc32.Checksum(b[21:], kafkaCastagnoli))
+	return b
+}
+
+// kafkaWriter encodes Kafka requests.
+type kafkaWriter struct {
+	bytes.Buffer
+}
+
+func (w *kafkaWriter) int8(v int8) {
+	w.WriteByte(byte(v))
+}
+
+func (w *kafkaWriter) int16(v int16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], uint16(v))
+	w.Write(b[:])
+}
+
+func (w *kafkaWriter) int32(v int32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(v))
+	w.Write(b[:])
+}
+
+func (w *kafkaWriter) int64(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	w.Write(b[:])
+}
+
+func (w *kafkaWriter) string(s string) {
+	w.int16(int16(len(s)))
+	w.WriteString(s)
+}
+
+// nullString writes the null string, a length of -1.
+func (w *kafkaWriter) nullString() {
+	w.int16(-1)
+}
+
+// varint writes v zigzag encoded, as the lengths and deltas of records are.
+func (w *kafkaWriter) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	w.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+// varintBytes writes b with its length as a varint, nil as a length of -1.
+func (w *kafkaWriter) varintBytes(b []byte) {
+	if b == nil {
+		w.varint(-1)
+		return
+	}
+	w.varint(int64(len(b)))
+	w.Write(b)
+}
+
+// kafkaReader decodes Kafka responses, err is set once they run short.
+type kafkaReader struct {
+	b   []byte
+	err error
+}
+
+func (r *kafkaReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.b) < n {
+		r.err = fmt.Errorf("kafka: short response")
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *kafkaReader) int16() int16 {
+	if b := r.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if b := r.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int64() int64 {
+	if b := r.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
+
+// skipInt32s skips an array of int32, ie, the replicas of a partition.
+func (r *kafkaReader) skipInt32s() {
+	n := r.int32()
+	if n > 0 {
+		r.next(int(n) * 4)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenTSDB writes the metrics to an OpenTSDB server over its telnet
+// protocol, a "put" line for each numeric field, ie:
+//
+//     put telegraf.cpu.usage_idle 1500000000 98.5 cpu=cpu0 host=myhost
+type OpenTSDB struct {
+	Host string
+	Port int
+	// Prefix is prepended to the metric names, ie, "telegraf.".
+	Prefix  string
+	Timeout Duration
+
+	conn outputConn
+}
+
+var openTSDBSampleConfig = `
+  ## Address of the OpenTSDB server
+  host = "opentsdb.example.com"
+  port = 4242
+
+  ## Prefix of the metric names, which are the measurement and the field
+  ## joined with a dot.
+  prefix = ""
+
+  ## Timeout for connecting and for each write
+  # timeout = "5s"
+`
+
+func NewOpenTSDB() *OpenTSDB {
+	return &OpenTSDB{
+		Port:    4242,
+		Timeout: Duration{Duration: 5 * time.Second},
+	}
+}
+
+func (o *OpenTSDB) Connect() error {
+	if o.Host == "" {
+		return fmt.Errorf("host is required for the opentsdb output")
+	}
+	addr := net.JoinHostPort(o.Host, strconv.Itoa(o.Port))
+	o.conn = outputConn{
+		Output:  "opentsdb",
+		Peer:    "OpenTSDB at " + addr,
+		Network: "tcp",
+		Address: addr,
+		Timeout: o.Timeout.Duration,
+		// the server only answers the puts it rejects
+		Replied: func(b []byte) {
+			log.Printf("W! Output [opentsdb] server replied: %s",
+				strings.TrimSpace(string(b)))
+		},
+	}
+	return o.conn.dial()
+}
+
+func (o *OpenTSDB) Close() error {
+	return o.conn.Close()
+}
+
+func (o *OpenTSDB) SampleConfig() string {
+	return openTSDBSampleConfig
+}
+
+func (o *OpenTSDB) Description() string {
+	return "Configuration for OpenTSDB server to send metrics to"
+}
+
+func (o *OpenTSDB) Write(metrics []Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	var buf []byte
+	for _, m := range metrics {
+		buf = append(buf, o.serialize(m)...)
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+
+	// the server closes idle connections
+	if err := o.conn.ready(); err != nil {
+		return err
+	}
+	return o.conn.write(buf)
+}
+
+// serialize returns the put lines of the numeric fields of m, in field
+// order. Booleans are written as 1 or 0, strings, NaN and Inf are skipped.
+func (o *OpenTSDB) serialize(m Metric) []byte {
+	timestamp := strconv.FormatInt(m.UnixNano()/int64(time.Second), 10)
+
+	tags := m.Tags()
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var tagStr string
+	for _, k := range keys {
+		if tags[k] == "" {
+			continue
+		}
+		tagStr += " " + sanitizeOpenTSDB(k) + "=" + sanitizeOpenTSDB(tags[k])
+	}
+
+	fields := m.Fields()
+	names := make([]string, 0, len(fields))
+	for k := range fields {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var out []byte
+	for _, k := range names {
+		var value string
+		switch v := fields[k].(type) {
+		case int64:
+			value = strconv.FormatInt(v, 10)
+		case uint64:
+			value = strconv.FormatUint(v, 10)
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			value = "0"
+			if v {
+				value = "1"
+			}
+		default:
+			continue
+		}
+		name := sanitizeOpenTSDB(o.Prefix + m.Name() + "." + k)
+		out = append(out, "put "+name+" "+timestamp+" "+value+tagStr+"\n"...)
+	}
+	return out
+}
+
+// sanitizeOpenTSDB replaces the characters that OpenTSDB does not accept in
+// metric names and tags with underscores. It accepts letters, digits and
+// "-_./".
+func sanitizeOpenTSDB(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '-', r == '_', r == '.', r == '/':
+			return r
+		}
+		return '_'
+	}, s)
+}
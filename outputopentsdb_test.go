@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestOpenTSDBWireFormat(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		b, _ := ioutil.ReadAll(conn)
+		received <- string(b)
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	o := NewOpenTSDB()
+	o.Host = host
+	o.Port, _ = strconv.Atoi(port)
+	o.Prefix = "telegraf."
+	if err := o.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1500000000, 999000000)
+	m1, _ := New("cpu", map[string]string{"host": "web1", "cpu": "cpu 0", "empty": ""},
+		map[string]interface{}{
+			"usage_idle": 98.5,
+			"busy":       true,
+			"state":      "ok",
+			"nan":        math.NaN(),
+		}, now)
+	m2, _ := New("disk:io", nil, map[string]interface{}{"reads": int64(42)}, now)
+	if err := o.Write([]Metric{m1, m2}); err != nil {
+		t.Fatal(err)
+	}
+	o.Close()
+
+	want := "put telegraf.cpu.busy 1500000000 1 cpu=cpu_0 host=web1\n" +
+		"put telegraf.cpu.usage_idle 1500000000 98.5 cpu=cpu_0 host=web1\n" +
+		"put telegraf.disk_io.reads 1500000000 42\n"
+	select {
+	case got := <-received:
+		if got != want {
+			t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no data received")
+	}
+}
+
+func TestOpenTSDBRequiresHost(t *testing.T) {
+	if err := NewOpenTSDB().Connect(); err == nil {
+		t.Error("expected an error without a host")
+	}
+}
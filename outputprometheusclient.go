@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var prometheusLabelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// PrometheusClient exposes the metrics written to it on an HTTP endpoint,
+// for Prometheus to scrape.
+type PrometheusClient struct {
+	Listen             string
+	Path               string
+	ExpirationInterval Duration `toml:"expiration_interval"`
+
+	listener net.Listener
+	// done stops the expiry sweep when the output is closed
+	done chan struct{}
+
+	// families holds the latest sample of every series, by metric name.
+	families map[string]*prometheusFamily
+	sync.Mutex
+
+	// now returns the current time, it is replaced in tests
+	now func() time.Time
+}
+
+type prometheusFamily struct {
+	typ     string
+	samples map[string]*prometheusSample
+}
+
+type prometheusSample struct {
+	labels string
+	value  float64
+	expire time.Time
+}
+
+var prometheusClientSampleConfig = `
+  ## Address to listen on.
+  listen = ":9273"
+  ## Path to expose the metrics on.
+  # path = "/metrics"
+
+  ## Series that have not been written for this long are no longer exposed.
+  ## 0 keeps them forever.
+  # expiration_interval = "60s"
+
+  ## Every numeric field becomes a <measurement>_<field> metric, or just
+  ## <measurement> for a field called "value", labelled with the tags.
+`
+
+func NewPrometheusClient() *PrometheusClient {
+	return &PrometheusClient{
+		Listen:             ":9273",
+		Path:               "/metrics",
+		ExpirationInterval: Duration{Duration: 60 * time.Second},
+		now:                time.Now,
+	}
+}
+
+func (p *PrometheusClient) Description() string {
+	return "Configuration for the Prometheus client to spawn"
+}
+
+func (p *PrometheusClient) SampleConfig() string {
+	return prometheusClientSampleConfig
+}
+
+func (p *PrometheusClient) Connect() error {
+	p.Lock()
+	p.families = make(map[string]*prometheusFamily)
+	p.Unlock()
+
+	path := p.Path
+	if path == "" {
+		path = "/metrics"
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, p)
+
+	l, err := net.Listen("tcp", p.Listen)
+	if err != nil {
+		return err
+	}
+	p.listener = l
+
+	go func() {
+		err := http.Serve(l, mux)
+		log.Printf("D! [outputs.prometheus_client] stopped listening on %s: %s",
+			p.Listen, err)
+	}()
+
+	if p.ExpirationInterval.Duration > 0 {
+		p.done = make(chan struct{})
+		go p.sweep(p.done)
+	}
+	return nil
+}
+
+// sweep expires the stale samples every expiration interval, so that the
+// memory of series that stopped being written is released even when nothing
+// scrapes the output.
+func (p *PrometheusClient) sweep(done chan struct{}) {
+	ticker := time.NewTicker(p.ExpirationInterval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			p.Lock()
+			p.expire()
+			p.Unlock()
+		}
+	}
+}
+
+func (p *PrometheusClient) Close() error {
+	if p.done != nil {
+		close(p.done)
+		p.done = nil
+	}
+	if p.listener == nil {
+		return nil
+	}
+	err := p.listener.Close()
+	p.listener = nil
+	return err
+}
+
+func (p *PrometheusClient) Write(metrics []Metric) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.families == nil {
+		p.families = make(map[string]*prometheusFamily)
+	}
+	now := p.now()
+	for _, m := range metrics {
+		labels := prometheusLabels(m.Tags())
+
+		var typ string
+		switch m.Type() {
+		case Counter:
+			typ = "counter"
+		case Gauge:
+			typ = "gauge"
+		default:
+			typ = "untyped"
+		}
+
+		for field, v := range m.Fields() {
+			var value float64
+			switch v := v.(type) {
+			case float64:
+				value = v
+			case int64:
+				value = float64(v)
+			case bool:
+				if v {
+					value = 1
+				}
+			default:
+				continue
+			}
+
+			name := sanitizePrometheusName(m.Name())
+			if field != "value" {
+				name += "_" + sanitizePrometheusName(field)
+			}
+
+			family, ok := p.families[name]
+			if !ok {
+				family = &prometheusFamily{
+					samples: make(map[string]*prometheusSample),
+				}
+				p.families[name] = family
+			}
+			// the type of the last write wins, Prometheus allows only one
+			family.typ = typ
+			family.samples[labels] = &prometheusSample{
+				labels: labels,
+				value:  value,
+				expire: now.Add(p.ExpirationInterval.Duration),
+			}
+		}
+	}
+	return nil
+}
+
+// ServeHTTP writes the current samples in the Prometheus text format.
+func (p *PrometheusClient) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.Lock()
+	p.expire()
+	var buf bytes.Buffer
+	names := make([]string, 0, len(p.families))
+	for name := range p.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := p.families[name]
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", name, family.typ)
+
+		keys := make([]string, 0, len(family.samples))
+		for k := range family.samples {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := family.samples[k]
+			fmt.Fprintf(&buf, "%s%s %s\n", name, s.labels,
+				strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+	p.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+// expire removes the samples that have not been written within the
+// expiration interval.
+func (p *PrometheusClient) expire() {
+	if p.ExpirationInterval.Duration <= 0 {
+		return
+	}
+	now := p.now()
+	for name, family := range p.families {
+		for k, s := range family.samples {
+			if now.After(s.expire) {
+				delete(family.samples, k)
+			}
+		}
+		if len(family.samples) == 0 {
+			delete(p.families, name)
+		}
+	}
+}
+
+// prometheusLabels formats tags as a sorted label set, ie, {cpu="cpu0"}.
+func prometheusLabels(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	labels := make([]string, len(keys))
+	for i, k := range keys {
+		labels[i] = fmt.Sprintf(`%s="%s"`, sanitizePrometheusName(k),
+			prometheusLabelValueReplacer.Replace(tags[k]))
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// sanitizePrometheusName replaces the characters that are not allowed in a
+// Prometheus metric or label name with underscores.
+func sanitizePrometheusName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' ||
+			i > 0 && c >= '0' && c <= '9' {
+			continue
+		}
+		b[i] = '_'
+	}
+	return string(b)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrapePrometheus returns the samples of the endpoint of p, by metric name
+// and labels, and the TYPE of each metric.
+func scrapePrometheus(t *testing.T, p *PrometheusClient) (map[string]string, map[string]string) {
+	resp, err := http.Get("http://" + p.listener.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples := make(map[string]string)
+	types := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(string(body)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# TYPE ") {
+			parts := strings.Fields(line)
+			types[parts[2]] = parts[3]
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		if i < 0 {
+			t.Fatalf("unexpected line %q", line)
+		}
+		samples[line[:i]] = line[i+1:]
+	}
+	return samples, types
+}
+
+func newTestPrometheusClient(t *testing.T) *PrometheusClient {
+	p := NewPrometheusClient()
+	p.Listen = "127.0.0.1:0"
+	if err := p.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPrometheusClientScrape(t *testing.T) {
+	p := newTestPrometheusClient(t)
+	defer p.Close()
+
+	now := time.Now()
+	cpu, _ := New("cpu", map[string]string{"cpu": "cpu0", "host": "web01"},
+		map[string]interface{}{"usage_idle": 92.5, "usage_user": int64(3)}, now,
+		Gauge)
+	swap, _ := New("swap", nil, map[string]interface{}{"in": int64(12)}, now,
+		Counter)
+	up, _ := New("zone.up", map[string]string{"zone": `web "1"`},
+		map[string]interface{}{"value": true, "state": "running"}, now)
+	if err := p.Write([]Metric{cpu, swap, up}); err != nil {
+		t.Fatal(err)
+	}
+
+	samples, types := scrapePrometheus(t, p)
+	want := map[string]string{
+		`cpu_usage_idle{cpu="cpu0",host="web01"}`: "92.5",
+		`cpu_usage_user{cpu="cpu0",host="web01"}`: "3",
+		`swap_in`:                   "12",
+		`zone_up{zone="web \"1\""}`: "1",
+	}
+	for series, value := range want {
+		if samples[series] != value {
+			t.Errorf("expected %s %s, got %q", series, value, samples[series])
+		}
+	}
+	if len(samples) != len(want) {
+		t.Errorf("expected %d samples, the string field skipped, got %v",
+			len(want), samples)
+	}
+	wantTypes := map[string]string{
+		"cpu_usage_idle": "gauge",
+		"cpu_usage_user": "gauge",
+		"swap_in":        "counter",
+		"zone_up":        "untyped",
+	}
+	for name, typ := range wantTypes {
+		if types[name] != typ {
+			t.Errorf("expected %s to be a %s, got %q", name, typ, types[name])
+		}
+	}
+
+	// a new write replaces the sample of its series
+	cpu, _ = New("cpu", map[string]string{"cpu": "cpu0", "host": "web01"},
+		map[string]interface{}{"usage_idle": 80.0}, now, Gauge)
+	if err := p.Write([]Metric{cpu}); err != nil {
+		t.Fatal(err)
+	}
+	samples, _ = scrapePrometheus(t, p)
+	if v := samples[`cpu_usage_idle{cpu="cpu0",host="web01"}`]; v != "80" {
+		t.Errorf("expected the updated usage_idle 80, got %q", v)
+	}
+}
+
+func TestPrometheusClientExpiry(t *testing.T) {
+	p := newTestPrometheusClient(t)
+	defer p.Close()
+	clock := NewMockClock(time.Unix(1500000000, 0))
+	p.Lock()
+	p.now = clock.Now
+	p.Unlock()
+
+	stale, _ := New("zfs", map[string]string{"pool": "tank"},
+		map[string]interface{}{"size": int64(100)}, clock.Now())
+	fresh, _ := New("zfs", map[string]string{"pool": "rpool"},
+		map[string]interface{}{"size": int64(200)}, clock.Now())
+	if err := p.Write([]Metric{stale, fresh}); err != nil {
+		t.Fatal(err)
+	}
+	samples, _ := scrapePrometheus(t, p)
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 samples, got %v", samples)
+	}
+
+	// only rpool is updated within the expiration interval
+	clock.Add(40 * time.Second)
+	fresh, _ = New("zfs", map[string]string{"pool": "rpool"},
+		map[string]interface{}{"size": int64(210)}, clock.Now())
+	if err := p.Write([]Metric{fresh}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(30 * time.Second)
+
+	samples, types := scrapePrometheus(t, p)
+	if _, ok := samples[`zfs_size{pool="tank"}`]; ok {
+		t.Errorf("expected the tank series to expire, got %v", samples)
+	}
+	if v := samples[`zfs_size{pool="rpool"}`]; v != "210" {
+		t.Errorf("expected the rpool series to be kept, got %q", v)
+	}
+
+	clock.Add(time.Minute)
+	samples, types = scrapePrometheus(t, p)
+	if len(samples) != 0 || len(types) != 0 {
+		t.Errorf("expected every series to expire, got %v %v", samples, types)
+	}
+}
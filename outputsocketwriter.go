@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SocketWriter writes the metrics, in the configured data format, to a TCP,
+// UDP or unix socket. Over a datagram socket each metric is a datagram of
+// its own.
+type SocketWriter struct {
+	Address string
+	// Timeout bounds connecting and each write, the same as the write
+	// timeout of the output.
+	Timeout Duration
+
+	serializer Serializer
+	conn       outputConn
+	// name is the output in the logs and errors, "socket_writer" unless it
+	// is wrapped by another output.
+	name string
+}
+
+var socketWriterSampleConfig = `
+  ## URL to connect to, ie:
+  ##   tcp://127.0.0.1:8094, tcp4://example.com:8094, udp://127.0.0.1:8094,
+  ##   unix:///var/run/telegraf.sock, unixgram:///var/run/telegraf.sock
+  address = "tcp://127.0.0.1:8094"
+
+  ## Timeout for connecting and for each write
+  # timeout = "5s"
+
+  ## Data format to output.
+  ## Supported formats: influx, json, msgpack, graphite
+  data_format = "influx"
+`
+
+func NewSocketWriter() *SocketWriter {
+	return &SocketWriter{
+		Timeout: Duration{Duration: DEFAULT_WRITE_TIMEOUT},
+	}
+}
+
+func (s *SocketWriter) SetSerializer(serializer Serializer) {
+	s.serializer = serializer
+}
+
+func (s *SocketWriter) Connect() error {
+	network, addr, err := s.splitAddress()
+	if err != nil {
+		return err
+	}
+	if s.name == "" {
+		s.name = "socket_writer"
+	}
+	s.conn = outputConn{
+		Output:  s.name,
+		Peer:    s.Address,
+		Network: network,
+		Address: addr,
+		Timeout: s.Timeout.Duration,
+	}
+	return s.conn.dial()
+}
+
+// splitAddress returns the network and the address of Address.
+func (s *SocketWriter) splitAddress() (string, string, error) {
+	spl := strings.SplitN(s.Address, "://", 2)
+	if len(spl) != 2 {
+		return "", "", fmt.Errorf("invalid address: %s", s.Address)
+	}
+	switch spl[0] {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "unix", "unixgram":
+		return spl[0], spl[1], nil
+	}
+	return "", "", fmt.Errorf("unknown protocol '%s' in '%s'", spl[0], s.Address)
+}
+
+func (s *SocketWriter) Close() error {
+	return s.conn.Close()
+}
+
+func (s *SocketWriter) SampleConfig() string {
+	return socketWriterSampleConfig
+}
+
+func (s *SocketWriter) Description() string {
+	return "Generic socket writer capable of handling multiple socket types"
+}
+
+func (s *SocketWriter) Write(metrics []Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	if s.serializer == nil {
+		return fmt.Errorf("no serializer set for the %s output", s.name)
+	}
+
+	// a stream gets the whole batch at once, a datagram socket a write per
+	// metric
+	var writes [][]byte
+	var buf []byte
+	stream := s.isStream()
+	for _, m := range metrics {
+		b, err := s.serializer.Serialize(m)
+		if err != nil {
+			return fmt.Errorf("failed to serialize metric: %s", err)
+		}
+		if stream {
+			buf = append(buf, b...)
+		} else {
+			writes = append(writes, b)
+		}
+	}
+	if stream {
+		writes = [][]byte{buf}
+	}
+
+	if err := s.conn.ready(); err != nil {
+		return err
+	}
+	for _, b := range writes {
+		if err := s.conn.write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SocketWriter) isStream() bool {
+	network, _, _ := s.splitAddress()
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SyslogOutput sends each metric as an RFC 5424 message to a local or
+// remote syslog daemon. The message id is the measurement, and the tags and
+// the fields are the parameters of two structured data elements, ie:
+//
+//     <14>1 2017-06-01T10:00:00.000000Z web1 telegraf 1234 cpu
+//       [tags@32473 cpu="cpu0" host="web1"][fields@32473 usage_idle="98.5"]
+//
+// The metrics go over a socket_writer connection, a datagram each over UDP
+// and unixgram, framed over TCP and unix streams.
+type SyslogOutput struct {
+	Address  string
+	Facility string
+	Severity string
+	AppName  string `toml:"appname"`
+	// Hostname is the HOSTNAME of the messages, the host tag of each metric
+	// by default.
+	Hostname string
+	// EnterpriseID is the private enterprise number of the structured data
+	// ids, the documentation number 32473 by default.
+	EnterpriseID string `toml:"enterprise_id"`
+	// Framing is how messages are delimited on a stream: "octet-counting",
+	// the default, or "non-transparent", a newline after each message.
+	Framing string
+	Timeout Duration
+
+	writer *SocketWriter
+}
+
+var syslogOutputSampleConfig = `
+  ## URL of the syslog daemon, ie:
+  ##   udp://127.0.0.1:514, tcp://loghost:6514, unixgram:///var/run/syslog
+  address = "udp://127.0.0.1:514"
+
+  ## Facility and severity of the messages, ie, "local0" and "notice"
+  # facility = "user"
+  # severity = "info"
+
+  ## APP-NAME of the messages
+  # appname = "telegraf"
+
+  ## HOSTNAME of the messages, the host tag of each metric by default
+  # hostname = ""
+
+  ## Private enterprise number of the structured data ids, ie,
+  ## [tags@32473 ...][fields@32473 ...]
+  # enterprise_id = "32473"
+
+  ## Framing of the messages over TCP and unix streams, "octet-counting"
+  ## (RFC 6587) or "non-transparent", a newline after each message.
+  # framing = "octet-counting"
+
+  ## Timeout for connecting and for each write
+  # timeout = "5s"
+`
+
+func NewSyslogOutput() *SyslogOutput {
+	return &SyslogOutput{
+		Facility:     "user",
+		Severity:     "info",
+		AppName:      "telegraf",
+		EnterpriseID: "32473",
+		Framing:      "octet-counting",
+		Timeout:      Duration{Duration: DEFAULT_WRITE_TIMEOUT},
+	}
+}
+
+func (s *SyslogOutput) Connect() error {
+	serializer, err := s.serializer()
+	if err != nil {
+		return err
+	}
+	s.writer = NewSocketWriter()
+	s.writer.name = "syslog"
+	s.writer.Address = s.Address
+	s.writer.Timeout = s.Timeout
+	serializer.stream = s.writer.isStream()
+	s.writer.SetSerializer(serializer)
+	return s.writer.Connect()
+}
+
+// serializer checks the options and returns the serializer of the messages.
+func (s *SyslogOutput) serializer() (*syslogSerializer, error) {
+	facility := sliceIndex(s.Facility, syslogFacilities)
+	if facility < 0 {
+		return nil, fmt.Errorf("invalid facility %q for the syslog output", s.Facility)
+	}
+	severity := sliceIndex(s.Severity, syslogSeverities)
+	if severity < 0 {
+		return nil, fmt.Errorf("invalid severity %q for the syslog output", s.Severity)
+	}
+	if _, err := strconv.ParseUint(s.EnterpriseID, 10, 32); err != nil {
+		return nil, fmt.Errorf("invalid enterprise_id %q for the syslog output, "+
+			"must be a number", s.EnterpriseID)
+	}
+	switch s.Framing {
+	case "octet-counting", "non-transparent":
+	default:
+		return nil, fmt.Errorf("invalid framing %q for the syslog output, must be "+
+			"\"octet-counting\" or \"non-transparent\"", s.Framing)
+	}
+
+	return &syslogSerializer{
+		priority:      facility*8 + severity,
+		appName:       syslogHeaderField(s.AppName, 48),
+		hostname:      s.Hostname,
+		procID:        strconv.Itoa(os.Getpid()),
+		enterpriseID:  s.EnterpriseID,
+		octetCounting: s.Framing == "octet-counting",
+	}, nil
+}
+
+func (s *SyslogOutput) Close() error {
+	if s.writer == nil {
+		return nil
+	}
+	return s.writer.Close()
+}
+
+func (s *SyslogOutput) SampleConfig() string {
+	return syslogOutputSampleConfig
+}
+
+func (s *SyslogOutput) Description() string {
+	return "Send metrics as RFC 5424 messages to a syslog daemon"
+}
+
+func (s *SyslogOutput) Write(metrics []Metric) error {
+	if s.writer == nil {
+		return fmt.Errorf("the syslog output is not connected")
+	}
+	return s.writer.Write(metrics)
+}
+
+// syslogSerializer formats a metric as an RFC 5424 message.
+type syslogSerializer struct {
+	priority     int
+	appName      string
+	hostname     string
+	procID       string
+	enterpriseID string
+	// stream is set over TCP and unix streams, where the messages are
+	// framed, by their length with octetCounting or else by a newline.
+	stream        bool
+	octetCounting bool
+}
+
+func (s *syslogSerializer) Serialize(metric Metric) ([]byte, error) {
+	tags := metric.Tags()
+	hostname := s.hostname
+	if hostname == "" {
+		hostname = tags["host"]
+	}
+
+	msg := "<" + strconv.Itoa(s.priority) + ">1 " +
+		metric.Time().UTC().Format("2006-01-02T15:04:05.000000Z07:00") + " " +
+		syslogHeaderField(hostname, 255) + " " +
+		s.appName + " " +
+		s.procID + " " +
+		syslogHeaderField(metric.Name(), 32) + " " +
+		syslogElement("tags@"+s.enterpriseID, tags) +
+		syslogElement("fields@"+s.enterpriseID, syslogFieldValues(metric.Fields()))
+
+	if !s.stream {
+		return []byte(msg), nil
+	}
+	if s.octetCounting {
+		return []byte(strconv.Itoa(len(msg)) + " " + msg), nil
+	}
+	return []byte(msg + "\n"), nil
+}
+
+// syslogElement formats a structured data element, its parameters sorted by
+// name. An element without parameters is valid.
+func syslogElement(id string, params map[string]string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	elem := "[" + id
+	for _, name := range names {
+		elem += " " + syslogParamName(name) + `="` +
+			syslogParamEscaper.Replace(params[name]) + `"`
+	}
+	return elem + "]"
+}
+
+// syslogFieldValues returns the fields of a metric as strings.
+func syslogFieldValues(fields map[string]interface{}) map[string]string {
+	values := make(map[string]string, len(fields))
+	for k, v := range fields {
+		switch v := v.(type) {
+		case float64:
+			values[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			values[k] = fmt.Sprint(v)
+		}
+	}
+	return values
+}
+
+// syslogParamEscaper escapes the characters that RFC 5424 requires escaped
+// in a parameter value.
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogParamName returns name as a valid parameter name, of at most 32
+// printable US-ASCII characters other than '=', ' ', ']' and '"', which are
+// replaced with '_'.
+func syslogParamName(name string) string {
+	b := []byte(name)
+	if len(b) > 32 {
+		b = b[:32]
+	}
+	for i, c := range b {
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+// syslogHeaderField returns s as a header field of at most max printable
+// US-ASCII characters, the others replaced with '_', or "-" when s is empty.
+func syslogHeaderField(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	b := []byte(s)
+	if len(b) > max {
+		b = b[:max]
+	}
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// sliceIndex returns the index of s in list, or -1.
+func sliceIndex(s string, list []string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
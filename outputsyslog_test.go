@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// syslogTestMetrics returns a metric with the characters to escape in a
+// parameter value, and one without tags.
+func syslogTestMetrics(t *testing.T) ([]Metric, []string) {
+	now := time.Unix(1500000000, 123456789)
+	m1, err := New("cpu", map[string]string{"host": "web1", "path": `a"b]c\d`},
+		map[string]interface{}{"usage": 1.5}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := New("disk free", nil, map[string]interface{}{"used": int64(3)}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := strconv.Itoa(os.Getpid())
+	return []Metric{m1, m2}, []string{
+		"<134>1 2017-07-14T02:40:00.123456Z web1 telegraf " + pid + ` cpu ` +
+			`[tags@32473 host="web1" path="a\"b\]c\\d"][fields@32473 usage="1.5"]`,
+		"<134>1 2017-07-14T02:40:00.123456Z - telegraf " + pid + ` disk_free ` +
+			`[tags@32473][fields@32473 used="3"]`,
+	}
+}
+
+func TestSyslogOutputUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s := NewSyslogOutput()
+	s.Address = "udp://" + conn.LocalAddr().String()
+	s.Facility = "local0"
+	if err := s.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.writer.conn.Output != "syslog" {
+		t.Errorf("expected the syslog output in the logs, got %s", s.writer.conn.Output)
+	}
+
+	metrics, want := syslogTestMetrics(t)
+	if err := s.Write(metrics); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	for _, msg := range want {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != msg {
+			t.Errorf("expected the datagram:\n%s\ngot:\n%s", msg, got)
+		}
+	}
+}
+
+func TestSyslogOutputTCPFraming(t *testing.T) {
+	metrics, want := syslogTestMetrics(t)
+	tests := []struct {
+		framing string
+		frame   func(msg string) string
+	}{
+		{"octet-counting", func(msg string) string {
+			return strconv.Itoa(len(msg)) + " " + msg
+		}},
+		{"non-transparent", func(msg string) string { return msg + "\n" }},
+	}
+	for _, tt := range tests {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		received := make(chan string, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			b, _ := ioutil.ReadAll(conn)
+			received <- string(b)
+		}()
+
+		s := NewSyslogOutput()
+		s.Address = "tcp://" + ln.Addr().String()
+		s.Facility = "local0"
+		s.Framing = tt.framing
+		if err := s.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Write(metrics); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+
+		expected := tt.frame(want[0]) + tt.frame(want[1])
+		if got := <-received; got != expected {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", tt.framing, expected, got)
+		}
+		ln.Close()
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"log"
+	"regexp"
+)
+
+// fieldTemplateTagRe matches a tag reference of a field template, ie,
+// "{{device}}".
+var fieldTemplateTagRe = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// FieldTemplate renames fields after the values of tags, ie, the field
+// read_bytes of a metric tagged device=sd0 becomes read_bytes_sd0 with the
+// template "read_bytes_{{device}}".
+type FieldTemplate struct {
+	Fields []*FieldTemplateRule
+
+	// warned holds the rule and tag pairs a missing tag was logged for, so
+	// that the warning is not repeated for every metric.
+	warned map[string]bool
+}
+
+// FieldTemplateRule is the renaming of a single field.
+type FieldTemplateRule struct {
+	Field    string
+	Template string
+}
+
+var fieldTemplateSampleConfig = `
+  ## Each rule renames a field with a template that references tags as
+  ## {{tag}}. A metric lacking one of the tags keeps the field as is.
+  [[processors.field_template.fields]]
+    field = "read_bytes"
+    template = "read_bytes_{{device}}"
+`
+
+func (_ *FieldTemplate) SampleConfig() string {
+	return fieldTemplateSampleConfig
+}
+
+func (_ *FieldTemplate) Description() string {
+	return "Rename fields with templates referencing tag values"
+}
+
+func (p *FieldTemplate) Apply(in ...Metric) []Metric {
+	for i, m := range in {
+		fields := m.Fields()
+		tags := m.Tags()
+		changed := false
+		for _, rule := range p.Fields {
+			value, ok := fields[rule.Field]
+			if !ok {
+				continue
+			}
+			name, missing := expandFieldTemplate(rule.Template, tags)
+			if missing != "" {
+				p.warnMissing(rule, missing, m.Name())
+				continue
+			}
+			if name == "" || name == rule.Field {
+				continue
+			}
+			delete(fields, rule.Field)
+			fields[name] = value
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+
+		renamed, err := New(m.Name(), tags, fields, m.Time(), m.Type())
+		if err != nil {
+			log.Printf("E! Unable to rename fields of metric [%s]: %s",
+				m.Name(), err)
+			continue
+		}
+		in[i] = renamed
+	}
+	return in
+}
+
+func (p *FieldTemplate) warnMissing(rule *FieldTemplateRule, tag, metric string) {
+	key := rule.Field + "\x00" + rule.Template + "\x00" + tag
+	if p.warned[key] {
+		return
+	}
+	if p.warned == nil {
+		p.warned = make(map[string]bool)
+	}
+	p.warned[key] = true
+	log.Printf("W! Metric [%s] has no tag %q for the field template %q, "+
+		"leaving field %s unchanged", metric, tag, rule.Template, rule.Field)
+}
+
+// expandFieldTemplate replaces the {{tag}} references of template with the
+// values of tags. It returns the first tag that is missing, if any.
+func expandFieldTemplate(template string, tags map[string]string) (string, string) {
+	var missing string
+	name := fieldTemplateTagRe.ReplaceAllStringFunc(template, func(ref string) string {
+		tag := fieldTemplateTagRe.FindStringSubmatch(ref)[1]
+		value, ok := tags[tag]
+		if !ok && missing == "" {
+			missing = tag
+		}
+		return value
+	})
+	return name, missing
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFieldTemplate(t *testing.T) {
+	p := &FieldTemplate{Fields: []*FieldTemplateRule{
+		{Field: "read_bytes", Template: "read_bytes_{{device}}"},
+		{Field: "writes", Template: "{{ pool }}_{{device}}_writes"},
+	}}
+	m, _ := New("diskio",
+		map[string]string{"device": "sd0", "pool": "rpool"},
+		map[string]interface{}{"read_bytes": int64(1), "writes": int64(2), "reads": int64(3)},
+		time.Unix(0, 0))
+
+	out := p.Apply(m)
+	want := map[string]interface{}{
+		"read_bytes_sd0":   int64(1),
+		"rpool_sd0_writes": int64(2),
+		"reads":            int64(3),
+	}
+	if !reflect.DeepEqual(out[0].Fields(), want) {
+		t.Errorf("expected %v, got %v", want, out[0].Fields())
+	}
+	if !reflect.DeepEqual(out[0].Tags(), m.Tags()) {
+		t.Errorf("expected the tags to be kept, got %v", out[0].Tags())
+	}
+}
+
+func TestFieldTemplateMissingTag(t *testing.T) {
+	p := &FieldTemplate{Fields: []*FieldTemplateRule{
+		{Field: "read_bytes", Template: "read_bytes_{{device}}"},
+	}}
+	fields := map[string]interface{}{"read_bytes": int64(1)}
+
+	var out []Metric
+	lines := captureLog(func() {
+		for i := 0; i < 3; i++ {
+			m, _ := New("diskio", map[string]string{"pool": "rpool"}, fields,
+				time.Unix(0, 0))
+			out = p.Apply(m)
+		}
+	})
+	if !reflect.DeepEqual(out[0].Fields(), fields) {
+		t.Errorf("expected the field to be unchanged, got %v", out[0].Fields())
+	}
+	if len(lines) != 1 {
+		t.Errorf("expected the missing tag to be logged once, got %q", lines)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// Rate adds the per-second rate of change of counter fields, computed from
+// the previous value of the same series.
+type Rate struct {
+	// Fields restricts the conversion to these fields, all numeric fields
+	// are converted if empty.
+	Fields []string
+
+	// CounterWidths gives the width in bits, 32 or 64, of the counter
+	// fields that wrap around rather than reset, ie, the 32-bit kstat
+	// counters. A decrease of such a field that is consistent with a wrap
+	// is rated across the wrap, see wrapDelta.
+	CounterWidths map[string]int
+
+	// last holds the previous value of each field, by series.
+	last map[uint64]map[string]ratePoint
+	sync.Mutex
+}
+
+type ratePoint struct {
+	value float64
+	t     time.Time
+	// rate is the rate computed at this point, if rated.
+	rate  float64
+	rated bool
+}
+
+// maxWrapRateFactor is how much faster than its previous rate a counter may
+// have increased across a wrap, for the decrease to be taken as a wrap
+// rather than a reset.
+const maxWrapRateFactor = 2
+
+var rateSampleConfig = `
+  ## Fields to compute the rate of, as <field>_rate. All numeric fields are
+  ## used if empty. The first metric of a series, and the first one after a
+  ## counter reset, have no rate.
+  # fields = ["reads", "writes"]
+
+  ## The width in bits, 32 or 64, of counter fields that wrap around. When
+  ## such a field decreases, its rate is computed across the wrap if the
+  ## increase across it is plausible: at most twice the previous rate of the
+  ## field, and less than half of the counter range. Otherwise, and for the
+  ## fields not listed here, the decrease is taken as a reset.
+  # [processors.rate.counter_widths]
+  #   rbytes = 32
+  #   obytes = 32
+`
+
+func (_ *Rate) SampleConfig() string {
+	return rateSampleConfig
+}
+
+func (_ *Rate) Description() string {
+	return "Add the per-second rate of counter fields as <field>_rate"
+}
+
+func (r *Rate) Apply(in ...Metric) []Metric {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.last == nil {
+		r.last = make(map[uint64]map[string]ratePoint)
+	}
+
+	for i, m := range in {
+		id := m.HashID()
+		last, ok := r.last[id]
+		if !ok {
+			last = make(map[string]ratePoint)
+			r.last[id] = last
+		}
+
+		fields := m.Fields()
+		// the rates are added once all the fields are visited, so that
+		// they are not rated themselves
+		rates := make(map[string]interface{})
+		for name, v := range fields {
+			if len(r.Fields) > 0 && !sliceContains(name, r.Fields) {
+				continue
+			}
+			value, ok := toFloat(v)
+			if !ok {
+				continue
+			}
+
+			cur := ratePoint{value: value, t: m.Time()}
+			prev, ok := last[name]
+			last[name] = cur
+			if !ok {
+				continue
+			}
+
+			elapsed := cur.t.Sub(prev.t).Seconds()
+			// a metric that is not newer than the previous one has no
+			// meaningful rate
+			if elapsed <= 0 {
+				continue
+			}
+			delta := cur.value - prev.value
+			if delta < 0 {
+				// a decreasing value is a counter reset, unless the counter
+				// wrapped
+				var wrapped bool
+				if delta, wrapped = wrapDelta(prev, cur.value, elapsed,
+					r.CounterWidths[name]); !wrapped {
+					continue
+				}
+			}
+			cur.rate, cur.rated = delta/elapsed, true
+			last[name] = cur
+			rates[name+"_rate"] = cur.rate
+		}
+		if len(rates) == 0 {
+			continue
+		}
+		for name, rate := range rates {
+			fields[name] = rate
+		}
+
+		rated, err := New(m.Name(), m.Tags(), fields, m.Time(), m.Type())
+		if err != nil {
+			log.Printf("E! Unable to add rates to metric [%s]: %s", m.Name(), err)
+			continue
+		}
+		in[i] = rated
+	}
+	return in
+}
+
+// wrapDelta returns the increase from prev to cur, lower than prev, of a
+// counter of width bits that wrapped around over elapsed seconds, and
+// whether the decrease is plausibly a wrap: both values fit in the width,
+// the increase is less than half of the counter range, and its rate is at
+// most maxWrapRateFactor times the previous rate of the counter. Anything
+// else, including a counter with no previous rate, is a reset: a counter
+// reset from above the middle of its range would otherwise look like a
+// wrap. A width other than 32 or 64 never wraps.
+func wrapDelta(prev ratePoint, cur, elapsed float64, width int) (float64, bool) {
+	var size float64
+	switch width {
+	case 32:
+		size = math.Exp2(32)
+	case 64:
+		size = math.Exp2(64)
+	default:
+		return 0, false
+	}
+	if !prev.rated || cur < 0 || prev.value >= size {
+		return 0, false
+	}
+	delta := size - prev.value + cur
+	if delta >= size/2 || delta/elapsed > maxWrapRateFactor*prev.rate {
+		return 0, false
+	}
+	return delta, true
+}
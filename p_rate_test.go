@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRateCounterWrap(t *testing.T) {
+	wrap := math.Exp2(32)
+	tests := []struct {
+		name   string
+		values []float64
+		rate   float64 // of the last value, -1 for none
+	}{
+		{"increase", []float64{100, 200, 300}, 10},
+		{"wrap", []float64{wrap - 250, wrap - 150, 50}, 20},
+		{"reset above half the range", []float64{3e9, 3e9 + 100, 10}, -1},
+		{"reset near the top of the range", []float64{wrap - 200, wrap - 100, 5e6}, -1},
+		{"no previous rate", []float64{wrap - 100, 50}, -1},
+	}
+	for _, tt := range tests {
+		r := &Rate{CounterWidths: map[string]int{"value": 32}}
+		now := time.Unix(1500000000, 0)
+		var out []Metric
+		for i, v := range tt.values {
+			m, err := New("net", nil, map[string]interface{}{"value": v},
+				now.Add(time.Duration(i)*10*time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = r.Apply(m)
+		}
+		rate, ok := out[0].Fields()["value_rate"]
+		switch {
+		case tt.rate < 0 && ok:
+			t.Errorf("%s: expected no rate, got %v", tt.name, rate)
+		case tt.rate >= 0 && rate != tt.rate:
+			t.Errorf("%s: expected the rate %v, got %v", tt.name, tt.rate, rate)
+		}
+	}
+}
+
+func TestRateCountersAndReset(t *testing.T) {
+	r := &Rate{}
+	now := time.Unix(1500000000, 0)
+	samples := []map[string]interface{}{
+		{"x": int64(0), "y": int64(0)},
+		{"x": int64(100), "y": int64(50)},
+		{"x": int64(300), "y": int64(100)},
+		{"x": int64(10), "y": int64(150)},
+		{"x": int64(40), "y": int64(200)},
+	}
+	want := []map[string]interface{}{
+		{"x": int64(0), "y": int64(0)},
+		{"x": int64(100), "y": int64(50), "x_rate": 10.0, "y_rate": 5.0},
+		{"x": int64(300), "y": int64(100), "x_rate": 20.0, "y_rate": 5.0},
+		// x was reset
+		{"x": int64(10), "y": int64(150), "y_rate": 5.0},
+		{"x": int64(40), "y": int64(200), "x_rate": 3.0, "y_rate": 5.0},
+	}
+	for i, fields := range samples {
+		m, err := New("disk", map[string]string{"name": "sd0"}, fields,
+			now.Add(time.Duration(i)*10*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := r.Apply(m)
+		if !reflect.DeepEqual(out[0].Fields(), want[i]) {
+			t.Errorf("metric %d: expected %v, got %v", i, want[i], out[0].Fields())
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+)
+
+// sampleBuckets is the resolution of the per-series sampling rate.
+const sampleBuckets = 1000000
+
+// Sample keeps a fraction of the metrics passing through it and drops the
+// rest.
+type Sample struct {
+	Rate   float64
+	KeyTag string `toml:"key_tag"`
+}
+
+var sampleSampleConfig = `
+  ## Fraction of metrics to keep, between 0.0 (drop all) and 1.0 (keep all).
+  rate = 0.1
+  ## If set, the decision to keep a metric is made by hashing the value of
+  ## this tag instead of at random, so that a given series is either always
+  ## or never kept.
+  # key_tag = "host"
+`
+
+func (_ *Sample) SampleConfig() string {
+	return sampleSampleConfig
+}
+
+func (_ *Sample) Description() string {
+	return "Keep a random or per-series fraction of metrics, dropping the rest"
+}
+
+func (s *Sample) Apply(in ...Metric) []Metric {
+	out := in[:0]
+	for _, m := range in {
+		if s.keep(m) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// keep decides whether the metric is part of the sample.
+func (s *Sample) keep(m Metric) bool {
+	if s.Rate >= 1 {
+		return true
+	}
+	if s.Rate <= 0 {
+		return false
+	}
+	if s.KeyTag == "" {
+		return rand.Float64() < s.Rate
+	}
+
+	// metrics without the tag are all hashed as the empty string, so they
+	// are consistently kept or dropped together.
+	h := fnv.New64a()
+	h.Write([]byte(m.Tags()[s.KeyTag]))
+	// the low bits of the hash are the best distributed for short values
+	return float64(h.Sum64()%sampleBuckets)/sampleBuckets < s.Rate
+}
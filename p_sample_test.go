@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func sampleMetrics(t *testing.T, n int, value int64) []Metric {
+	var metrics []Metric
+	for i := 0; i < n; i++ {
+		m, err := New("cpu", map[string]string{"host": fmt.Sprintf("web%d", i)},
+			map[string]interface{}{"value": value}, time.Unix(int64(i), 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func keptHosts(s *Sample, metrics []Metric) map[string]bool {
+	kept := map[string]bool{}
+	for _, m := range s.Apply(metrics...) {
+		kept[m.Tags()["host"]] = true
+	}
+	return kept
+}
+
+func TestSampleKeyTagIsDeterministic(t *testing.T) {
+	s := &Sample{Rate: 0.3, KeyTag: "host"}
+	first := keptHosts(s, sampleMetrics(t, 1000, 1))
+	if n := len(first); n < 250 || n > 350 {
+		t.Errorf("expected about 300 of 1000 series kept, got %d", n)
+	}
+
+	// the same series are kept whatever their fields and times, and by
+	// another processor of the same settings
+	again := keptHosts(&Sample{Rate: 0.3, KeyTag: "host"}, sampleMetrics(t, 1000, 2))
+	if len(again) != len(first) {
+		t.Fatalf("expected %d series kept again, got %d", len(first), len(again))
+	}
+	for host := range first {
+		if !again[host] {
+			t.Errorf("expected %s to be kept again", host)
+		}
+	}
+
+	// a higher rate keeps a superset
+	more := keptHosts(&Sample{Rate: 0.6, KeyTag: "host"}, sampleMetrics(t, 1000, 1))
+	for host := range first {
+		if !more[host] {
+			t.Errorf("expected %s to be kept at a higher rate", host)
+		}
+	}
+
+	if n := len(keptHosts(&Sample{Rate: 0, KeyTag: "host"}, sampleMetrics(t, 100, 1))); n != 0 {
+		t.Errorf("expected no metric kept at rate 0, got %d", n)
+	}
+	if n := len(keptHosts(&Sample{Rate: 1, KeyTag: "host"}, sampleMetrics(t, 100, 1))); n != 100 {
+		t.Errorf("expected every metric kept at rate 1, got %d", n)
+	}
+}
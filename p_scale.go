@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+)
+
+// Scale converts numeric fields with a linear transformation, ie,
+// output = value * factor + offset.
+type Scale struct {
+	Fields []*ScaleField
+}
+
+// ScaleField is the conversion applied to a single field.
+type ScaleField struct {
+	Field  string
+	Factor *float64
+	Offset float64
+	// Rename, if set, writes the result to a new field and keeps the
+	// original one.
+	Rename string
+}
+
+var scaleSampleConfig = `
+  ## Each conversion computes output = value * factor + offset for a numeric
+  ## field. factor defaults to 1.0 and offset to 0.0; both must be floats.
+  ## Fields that are not numbers are left untouched.
+  [[processors.scale.fields]]
+    ## Convert bytes to gigabytes, writing the result to a new field.
+    field = "used"
+    factor = 0.000000001
+    rename = "used_gb"
+
+  [[processors.scale.fields]]
+    ## Convert celsius to fahrenheit in place.
+    field = "temperature"
+    factor = 1.8
+    offset = 32.0
+`
+
+func (_ *Scale) SampleConfig() string {
+	return scaleSampleConfig
+}
+
+func (_ *Scale) Description() string {
+	return "Convert numeric fields with a multiplier and an offset"
+}
+
+func (s *Scale) Apply(in ...Metric) []Metric {
+	for i, m := range in {
+		fields := m.Fields()
+		changed := false
+		for _, f := range s.Fields {
+			value, ok := toFloat(fields[f.Field])
+			if !ok {
+				continue
+			}
+
+			factor := 1.0
+			if f.Factor != nil {
+				factor = *f.Factor
+			}
+			name := f.Field
+			if f.Rename != "" {
+				name = f.Rename
+			}
+			fields[name] = value*factor + f.Offset
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+
+		scaled, err := New(m.Name(), m.Tags(), fields, m.Time(), m.Type())
+		if err != nil {
+			log.Printf("E! Unable to scale metric [%s]: %s", m.Name(), err)
+			continue
+		}
+		in[i] = scaled
+	}
+	return in
+}
+
+// toFloat returns the value of a numeric field as a float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScaleBytesAndTemperature(t *testing.T) {
+	c := loadTestConfig(t, `
+[[processors.scale]]
+  [[processors.scale.fields]]
+    field = "used"
+    factor = 0.000000001
+    rename = "used_gb"
+
+  [[processors.scale.fields]]
+    field = "temperature"
+    factor = 1.8
+    offset = 32.0
+
+  [[processors.scale.fields]]
+    field = "state"
+    factor = 2.0
+`)
+	if len(c.Processors) != 1 {
+		t.Fatalf("expected 1 processor, got %d", len(c.Processors))
+	}
+	m, err := New("system", nil, map[string]interface{}{
+		"used":        int64(5500000000),
+		"temperature": 37.5,
+		"state":       "ok",
+	}, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := c.Processors[0].Apply(m)
+	if len(out) != 1 {
+		t.Fatalf("expected 1 metric, got %d", len(out))
+	}
+	fields := out[0].Fields()
+	for name, want := range map[string]float64{
+		"used_gb":     5.5,
+		"temperature": 99.5,
+	} {
+		got, ok := fields[name].(float64)
+		if !ok || math.Abs(got-want) > 1e-9 {
+			t.Errorf("expected %s %v, got %v", name, want, fields[name])
+		}
+	}
+	if fields["used"] != int64(5500000000) {
+		t.Errorf("expected the renamed field to be kept, got %v", fields["used"])
+	}
+	if fields["state"] != "ok" {
+		t.Errorf("expected the string field untouched, got %v", fields["state"])
+	}
+}
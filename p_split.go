@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+)
+
+// Split carves subsets of the fields of a metric into new metrics, with the
+// same tags and time, the inverse of the merge aggregator.
+type Split struct {
+	Templates []*SplitTemplate `toml:"template"`
+	// DropOriginal drops the metrics that have been split.
+	DropOriginal bool `toml:"drop_original"`
+}
+
+// SplitTemplate describes one of the metrics a metric is split into.
+type SplitTemplate struct {
+	// Name is the measurement of the new metric, the measurement of the
+	// original metric is kept if empty.
+	Name   string
+	Fields []string
+}
+
+var splitSampleConfig = `
+  ## Drop the original metric once it has been split.
+  drop_original = true
+
+  ## Each template creates a metric out of the listed fields, if the metric
+  ## has any of them.
+  [[processors.split.template]]
+    name = "diskio_ops"
+    fields = ["reads", "writes"]
+
+  [[processors.split.template]]
+    name = "diskio_bytes"
+    fields = ["read_bytes", "write_bytes"]
+`
+
+func (_ *Split) SampleConfig() string {
+	return splitSampleConfig
+}
+
+func (_ *Split) Description() string {
+	return "Split metrics into several metrics, each with a subset of the fields"
+}
+
+func (s *Split) Apply(in ...Metric) []Metric {
+	out := make([]Metric, 0, len(in))
+	for _, m := range in {
+		fields := m.Fields()
+		split := false
+		for _, t := range s.Templates {
+			subset := make(map[string]interface{}, len(t.Fields))
+			for _, name := range t.Fields {
+				if v, ok := fields[name]; ok {
+					subset[name] = v
+				}
+			}
+			if len(subset) == 0 {
+				continue
+			}
+
+			name := t.Name
+			if name == "" {
+				name = m.Name()
+			}
+			sm, err := New(name, m.Tags(), subset, m.Time(), m.Type())
+			if err != nil {
+				log.Printf("E! Unable to split metric [%s]: %s", m.Name(), err)
+				continue
+			}
+			out = append(out, sm)
+			split = true
+		}
+
+		if !split || !s.DropOriginal {
+			out = append(out, m)
+		}
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitFourFieldsIntoTwo(t *testing.T) {
+	c := loadTestConfig(t, `
+[[processors.split]]
+  drop_original = true
+
+  [[processors.split.template]]
+    name = "diskio_ops"
+    fields = ["reads", "writes"]
+
+  [[processors.split.template]]
+    name = "diskio_bytes"
+    fields = ["read_bytes", "write_bytes"]
+`)
+	if len(c.Processors) != 1 {
+		t.Fatalf("expected 1 processor, got %d", len(c.Processors))
+	}
+	now := time.Unix(1500000000, 0)
+	m, err := New("diskio", map[string]string{"name": "sd0"}, map[string]interface{}{
+		"reads":       int64(10),
+		"writes":      int64(20),
+		"read_bytes":  int64(4096),
+		"write_bytes": int64(8192),
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := c.Processors[0].Apply(m)
+	if len(out) != 2 {
+		t.Fatalf("expected 2 metrics, got %d", len(out))
+	}
+
+	want := map[string]map[string]interface{}{
+		"diskio_ops":   {"reads": int64(10), "writes": int64(20)},
+		"diskio_bytes": {"read_bytes": int64(4096), "write_bytes": int64(8192)},
+	}
+	for _, m := range out {
+		if !reflect.DeepEqual(m.Fields(), want[m.Name()]) {
+			t.Errorf("%s: expected the fields %v, got %v", m.Name(),
+				want[m.Name()], m.Fields())
+		}
+		if m.Tags()["name"] != "sd0" || !m.Time().Equal(now) {
+			t.Errorf("%s: expected the tags and time to be kept", m.Name())
+		}
+	}
+
+	// a metric with none of the fields is passed through
+	other, _ := New("cpu", nil, map[string]interface{}{"usage": 1.0}, now)
+	if out := c.Processors[0].Apply(other); len(out) != 1 || out[0].Name() != "cpu" {
+		t.Errorf("expected the metric to pass through, got %v", out)
+	}
+}
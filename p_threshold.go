@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// The ways the conditions of the threshold processor combine, and what it
+// drops once they hold.
+const (
+	ThresholdAnd       = "and"
+	ThresholdOr        = "or"
+	ThresholdDrop      = "drop"
+	ThresholdDropField = "drop_field"
+)
+
+// Threshold drops the metrics, or only some of their fields, whose numeric
+// fields are below, above or equal to thresholds, ie, counters that are
+// zero.
+type Threshold struct {
+	// Combine is "and" for all the conditions to hold, "or" for any of them.
+	Combine string
+	// Action is "drop" to drop the metric, or "drop_field" to drop the
+	// fields of the conditions that hold, and the metric once it has no
+	// field left.
+	Action     string
+	Conditions []*ThresholdCondition `toml:"condition"`
+
+	// checked is set once the options have been checked, valid tells
+	// whether they are.
+	checked bool
+	valid   bool
+	sync.Mutex
+}
+
+// ThresholdCondition compares a field to a threshold. A metric without the
+// field, or whose field is not a number, does not meet the condition.
+type ThresholdCondition struct {
+	Field string
+	// Operator is one of below, below_or_equal, equal, not_equal,
+	// above_or_equal and above.
+	Operator string
+	// Value is the threshold, an integer or a float.
+	Value interface{}
+}
+
+var thresholdSampleConfig = `
+  ## Whether all the conditions must hold, "and", or any of them, "or".
+  # combine = "and"
+
+  ## What to drop when the conditions hold: "drop" the metric, or
+  ## "drop_field" the fields of the conditions that hold, and the metric once
+  ## it has no field left.
+  # action = "drop"
+
+  ## Each condition compares a numeric field to a value with an operator,
+  ## one of below, below_or_equal, equal, not_equal, above_or_equal and
+  ## above. A metric without the field does not meet the condition.
+  [[processors.threshold.condition]]
+    ## Drop the error counters that are zero.
+    field = "errors"
+    operator = "equal"
+    value = 0
+`
+
+func (_ *Threshold) SampleConfig() string {
+	return thresholdSampleConfig
+}
+
+func (_ *Threshold) Description() string {
+	return "Drop metrics or fields whose values are below, above or equal to thresholds"
+}
+
+func (t *Threshold) Apply(in ...Metric) []Metric {
+	t.Lock()
+	defer t.Unlock()
+
+	if !t.checked {
+		if err := t.check(); err != nil {
+			log.Printf("E! Processor [threshold]: %s", err)
+		} else {
+			t.valid = true
+		}
+		t.checked = true
+	}
+	if !t.valid || len(t.Conditions) == 0 {
+		return in
+	}
+
+	out := make([]Metric, 0, len(in))
+	for _, m := range in {
+		fields := m.Fields()
+		met := t.met(fields)
+		if len(met) == 0 {
+			out = append(out, m)
+			continue
+		}
+		if t.Action != ThresholdDropField {
+			continue
+		}
+
+		for _, name := range met {
+			delete(fields, name)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		dropped, err := New(m.Name(), m.Tags(), fields, m.Time(), m.Type())
+		if err != nil {
+			log.Printf("E! Unable to drop the fields of metric [%s]: %s", m.Name(), err)
+			out = append(out, m)
+			continue
+		}
+		dropped.SetAggregate(m.IsAggregate())
+		out = append(out, dropped)
+	}
+	return out
+}
+
+// met returns the fields of the conditions that hold, or none when they do
+// not combine to hold.
+func (t *Threshold) met(fields map[string]interface{}) []string {
+	var met []string
+	for _, c := range t.Conditions {
+		if c.holds(fields) {
+			met = append(met, c.Field)
+		} else if t.Combine != ThresholdOr {
+			return nil
+		}
+	}
+	return met
+}
+
+func (c *ThresholdCondition) holds(fields map[string]interface{}) bool {
+	value, ok := toFloat(fields[c.Field])
+	if !ok {
+		return false
+	}
+	threshold, _ := toFloat(c.Value)
+	switch c.Operator {
+	case "below":
+		return value < threshold
+	case "below_or_equal":
+		return value <= threshold
+	case "equal":
+		return value == threshold
+	case "not_equal":
+		return value != threshold
+	case "above_or_equal":
+		return value >= threshold
+	case "above":
+		return value > threshold
+	}
+	return false
+}
+
+// compileFilters checks the options when the config is loaded, so that
+// invalid ones fail it rather than let every metric through.
+func (t *Threshold) compileFilters() error {
+	t.Lock()
+	defer t.Unlock()
+	err := t.check()
+	t.valid = err == nil
+	t.checked = true
+	return err
+}
+
+// check returns the first invalid option. The processor lets every metric
+// through when there is one, which only happens when it was not built from
+// a config.
+func (t *Threshold) check() error {
+	switch t.Combine {
+	case "":
+		t.Combine = ThresholdAnd
+	case ThresholdAnd, ThresholdOr:
+	default:
+		return fmt.Errorf("invalid combine %q, must be %q or %q",
+			t.Combine, ThresholdAnd, ThresholdOr)
+	}
+	switch t.Action {
+	case "":
+		t.Action = ThresholdDrop
+	case ThresholdDrop, ThresholdDropField:
+	default:
+		return fmt.Errorf("invalid action %q, must be %q or %q",
+			t.Action, ThresholdDrop, ThresholdDropField)
+	}
+	for _, c := range t.Conditions {
+		switch c.Operator {
+		case "below", "below_or_equal", "equal", "not_equal", "above_or_equal", "above":
+		default:
+			return fmt.Errorf("invalid operator %q for field %s", c.Operator, c.Field)
+		}
+		if _, ok := toFloat(c.Value); !ok {
+			return fmt.Errorf("the value for field %s must be a number", c.Field)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThresholdInvalidConfigFailsLoad(t *testing.T) {
+	f, err := ioutil.TempFile("", "telegraf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`
+[[processors.threshold]]
+  [[processors.threshold.condition]]
+    field = "errors"
+    operator = "greater"
+    value = 0
+`)
+	f.Close()
+
+	err = NewConfig().LoadConfig(f.Name())
+	if err == nil || !strings.Contains(err.Error(), `invalid operator "greater"`) {
+		t.Errorf("expected an invalid operator error, got %v", err)
+	}
+}
+
+func TestThresholdDropField(t *testing.T) {
+	th := &Threshold{
+		Combine: ThresholdOr,
+		Action:  ThresholdDropField,
+		Conditions: []*ThresholdCondition{
+			{Field: "errors", Operator: "equal", Value: int64(0)},
+			{Field: "drops", Operator: "equal", Value: 0.0},
+		},
+	}
+	if err := th.compileFilters(); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := New("net", nil, map[string]interface{}{
+		"errors": int64(0), "drops": int64(2), "bytes": int64(5)}, time.Unix(1500000000, 0))
+	empty, _ := New("net", nil, map[string]interface{}{
+		"errors": int64(0), "drops": 0.0}, time.Unix(1500000000, 0))
+	out := th.Apply(m, empty)
+	if len(out) != 1 {
+		t.Fatalf("expected 1 metric, got %d", len(out))
+	}
+	if fields := out[0].Fields(); len(fields) != 2 || fields["errors"] != nil {
+		t.Errorf("expected the errors field to be dropped, got %v", fields)
+	}
+}
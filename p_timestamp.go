@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Timestamp sets the time of metrics from one of their fields, ie, for
+// sources that embed the time of the measurement in their output, and
+// removes the field.
+type Timestamp struct {
+	Field string
+	// Format is one of unix, unix_ms, unix_us and unix_ns, for a number of
+	// seconds, milliseconds, microseconds or nanoseconds since the epoch, or
+	// a Go time layout for a string field.
+	Format string
+	// Timezone is the location of the times of a layout that has no zone,
+	// defaults to UTC.
+	Timezone string
+
+	location *time.Location
+}
+
+var timestampSampleConfig = `
+  ## The field holding the time of the metric, removed once parsed.
+  field = "timestamp"
+
+  ## Either unix, unix_ms, unix_us or unix_ns for a number of seconds,
+  ## milliseconds, microseconds or nanoseconds since the epoch, or a Go time
+  ## layout, ie, "2006-01-02 15:04:05".
+  format = "unix"
+
+  ## The timezone of the times of a layout without a zone.
+  # timezone = "UTC"
+`
+
+func (_ *Timestamp) SampleConfig() string {
+	return timestampSampleConfig
+}
+
+func (_ *Timestamp) Description() string {
+	return "Set the time of metrics from one of their fields"
+}
+
+func (p *Timestamp) Apply(in ...Metric) []Metric {
+	for i, m := range in {
+		fields := m.Fields()
+		value, ok := fields[p.Field]
+		if !ok {
+			continue
+		}
+		t, err := p.parse(value)
+		if err != nil {
+			log.Printf("W! Unable to set the time of metric [%s] from field %s: %s",
+				m.Name(), p.Field, err)
+			continue
+		}
+		delete(fields, p.Field)
+		if len(fields) == 0 {
+			log.Printf("W! Not setting the time of metric [%s] from field %s, "+
+				"its only field", m.Name(), p.Field)
+			continue
+		}
+
+		out, err := New(m.Name(), m.Tags(), fields, t, m.Type())
+		if err != nil {
+			log.Printf("E! Unable to set the time of metric [%s]: %s", m.Name(), err)
+			continue
+		}
+		out.SetAggregate(m.IsAggregate())
+		in[i] = out
+	}
+	return in
+}
+
+// parse returns the time that a field value stands for.
+func (p *Timestamp) parse(value interface{}) (time.Time, error) {
+	var unit int64
+	switch p.Format {
+	case "", "unix":
+		unit = int64(time.Second)
+	case "unix_ms":
+		unit = int64(time.Millisecond)
+	case "unix_us":
+		unit = int64(time.Microsecond)
+	case "unix_ns":
+		unit = 1
+	default:
+		s, ok := value.(string)
+		if !ok {
+			return time.Time{}, fmt.Errorf("%v is not a string for format %q",
+				value, p.Format)
+		}
+		if p.location == nil {
+			loc, err := time.LoadLocation(p.Timezone)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid timezone: %s", err)
+			}
+			p.location = loc
+		}
+		return time.ParseInLocation(p.Format, s, p.location)
+	}
+
+	switch v := value.(type) {
+	case int64:
+		return time.Unix(0, v*unit), nil
+	case uint64:
+		return time.Unix(0, int64(v)*unit), nil
+	case float64:
+		return unixFloat(v, unit)
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(0, i*unit), nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%q is not a number", v)
+		}
+		return unixFloat(f, unit)
+	}
+	return time.Time{}, fmt.Errorf("%v is not a number", value)
+}
+
+// unixFloat returns the time of f units since the epoch, keeping its
+// fraction, ie, 1500000000.25 seconds.
+func unixFloat(f float64, unit int64) (time.Time, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return time.Time{}, fmt.Errorf("%v is not a time", f)
+	}
+	whole, frac := math.Modf(f)
+	return time.Unix(0, int64(whole)*unit+int64(frac*float64(unit))), nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func applyTimestamp(p *Timestamp, ts interface{}) Metric {
+	m, _ := New("app", map[string]string{"host": "web1"},
+		map[string]interface{}{"value": int64(1), "ts": ts},
+		time.Unix(1, 0))
+	return p.Apply(m)[0]
+}
+
+func TestTimestampUnix(t *testing.T) {
+	tests := []struct {
+		format string
+		value  interface{}
+		want   time.Time
+	}{
+		{"unix", int64(1500000000), time.Unix(1500000000, 0)},
+		{"", "1500000000", time.Unix(1500000000, 0)},
+		{"unix", 1500000000.25, time.Unix(1500000000, 250000000)},
+		{"unix", "1500000000.5", time.Unix(1500000000, 500000000)},
+		{"unix_ms", int64(1500000000123), time.Unix(1500000000, 123000000)},
+		{"unix_us", int64(1500000000123456), time.Unix(1500000000, 123456000)},
+		{"unix_ns", int64(1500000000123456789), time.Unix(1500000000, 123456789)},
+	}
+	for _, tt := range tests {
+		m := applyTimestamp(&Timestamp{Field: "ts", Format: tt.format}, tt.value)
+		if !m.Time().Equal(tt.want) {
+			t.Errorf("%s %v: expected %s, got %s", tt.format, tt.value, tt.want, m.Time())
+		}
+		want := map[string]interface{}{"value": int64(1)}
+		if !reflect.DeepEqual(m.Fields(), want) {
+			t.Errorf("%s %v: expected the field to be removed, got %v",
+				tt.format, tt.value, m.Fields())
+		}
+	}
+}
+
+func TestTimestampLayout(t *testing.T) {
+	p := &Timestamp{Field: "ts", Format: "2006-01-02 15:04:05"}
+	m := applyTimestamp(p, "2017-07-14 02:40:00")
+	if want := time.Unix(1500000000, 0); !m.Time().Equal(want) {
+		t.Errorf("expected %s in UTC, got %s", want, m.Time())
+	}
+
+	p = &Timestamp{Field: "ts", Format: "2006-01-02 15:04:05", Timezone: "Europe/Paris"}
+	m = applyTimestamp(p, "2017-07-14 04:40:00")
+	if want := time.Unix(1500000000, 0); !m.Time().Equal(want) {
+		t.Errorf("expected %s in Europe/Paris, got %s", want, m.Time())
+	}
+
+	// a layout with a zone ignores the timezone
+	p = &Timestamp{Field: "ts", Format: time.RFC3339, Timezone: "Europe/Paris"}
+	m = applyTimestamp(p, "2017-07-14T02:40:00Z")
+	if want := time.Unix(1500000000, 0); !m.Time().Equal(want) {
+		t.Errorf("expected %s from RFC3339, got %s", want, m.Time())
+	}
+}
+
+func TestTimestampInvalid(t *testing.T) {
+	tests := []struct {
+		p     *Timestamp
+		value interface{}
+	}{
+		{&Timestamp{Field: "ts", Format: "unix"}, "yesterday"},
+		{&Timestamp{Field: "ts", Format: "unix"}, true},
+		{&Timestamp{Field: "ts", Format: "2006-01-02"}, int64(1500000000)},
+		{&Timestamp{Field: "ts", Format: "2006-01-02"}, "14/07/2017"},
+	}
+	for _, tt := range tests {
+		var m Metric
+		captureLog(func() {
+			m = applyTimestamp(tt.p, tt.value)
+		})
+		if !m.Time().Equal(time.Unix(1, 0)) || m.Fields()["ts"] != tt.value {
+			t.Errorf("%s %v: expected the metric to be unchanged, got %s",
+				tt.p.Format, tt.value, m)
+		}
+	}
+}
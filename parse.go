@@ -7,8 +7,19 @@ import (
 // Parse returns an AST representation of TOML.
 // The toplevel is represented by a table.
 func Parse(data []byte) (*Table, error) {
+	return parse(data, false)
+}
+
+// ParseStrict is the same as Parse, but also rejects a table defined twice,
+// ie, two [inputs.cpu] headers, which Parse merges into one table.
+func ParseStrict(data []byte) (*Table, error) {
+	return parse(data, true)
+}
+
+func parse(data []byte, strict bool) (*Table, error) {
 	d := &parseState{p: &tomlParser{Buffer: string(data)}}
 	d.init()
+	d.p.toml.strict = strict
 
 	if err := d.parse(); err != nil {
 		return nil, err
@@ -29,13 +40,32 @@ func (d *parseState) init() {
 func (d *parseState) parse() error {
 	if err := d.p.Parse(); err != nil {
 		if err, ok := err.(*parseError); ok {
-			return fmt.Errorf("toml: line %d: parse error", err.Line())
+			line, column, text := err.Position()
+			return fmt.Errorf("toml: line %d, column %d: parse error\n    %s\n    %s^",
+				line, column, text, caretIndent(text, column))
 		}
 		return err
 	}
 	return d.execute()
 }
 
+// caretIndent returns the whitespace that puts a caret under the given column
+// of text, keeping its tabs so that the caret lines up.
+func caretIndent(text string, column int) string {
+	indent := make([]rune, 0, column)
+	for i, c := range []rune(text) {
+		if i >= column-1 {
+			break
+		}
+		if c == '\t' {
+			indent = append(indent, '\t')
+		} else {
+			indent = append(indent, ' ')
+		}
+	}
+	return string(indent)
+}
+
 func (d *parseState) execute() (err error) {
 	defer func() {
 		e := recover()
@@ -1917,6 +1917,13 @@ func (p *tomlParser) Init() {
 									if !_rules[rulewsnl]() {
 										goto l88
 									}
+									for {
+										position136, tokenIndex136, depth136 := position, tokenIndex, depth
+										if !_rules[rulecomment]() || !_rules[rulenewline]() || !_rules[rulewsnl]() {
+											position, tokenIndex, depth = position136, tokenIndex136, depth136
+											break
+										}
+									}
 									{
 										position137 := position
 										depth++
@@ -1952,26 +1959,20 @@ func (p *tomlParser) Init() {
 												position, tokenIndex, depth = position141, tokenIndex141, depth141
 											}
 										l142:
-											{
+											for {
 												position144, tokenIndex144, depth144 := position, tokenIndex, depth
+												_rules[rulews]()
 												{
 													position146, tokenIndex146, depth146 := position, tokenIndex, depth
 													if !_rules[rulecomment]() {
-														goto l146
+														position, tokenIndex, depth = position146, tokenIndex146, depth146
 													}
-													goto l147
-												l146:
-													position, tokenIndex, depth = position146, tokenIndex146, depth146
 												}
-											l147:
-												if !_rules[rulenewline]() {
-													goto l144
+												if !_rules[rulenewline]() || !_rules[rulewsnl]() {
+													position, tokenIndex, depth = position144, tokenIndex144, depth144
+													break
 												}
-												goto l145
-											l144:
-												position, tokenIndex, depth = position144, tokenIndex144, depth144
 											}
-										l145:
 											goto l138
 										l139:
 											position, tokenIndex, depth = position139, tokenIndex139, depth139
@@ -3005,9 +3006,9 @@ func (p *tomlParser) Init() {
 		},
 		/* 55 digitQuad <- <(digitDual digitDual)> */
 		nil,
-		/* 56 array <- <('[' Action22 wsnl arrayValues wsnl ']')> */
+		/* 56 array <- <('[' Action22 wsnl (comment newline wsnl)* arrayValues wsnl ']')> */
 		nil,
-		/* 57 arrayValues <- <(val Action23 arraySep? (comment? newline)?)*> */
+		/* 57 arrayValues <- <(val Action23 arraySep? (ws comment? newline wsnl)*)*> */
 		nil,
 		/* 58 arraySep <- <(ws ',' wsnl)> */
 		nil,
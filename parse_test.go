@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDuplicateKey(t *testing.T) {
+	config := `[agent]
+  interval = "10s"
+  interval = "20s"
+`
+	for _, parse := range []func([]byte) (*Table, error){Parse, ParseStrict} {
+		_, err := parse([]byte(config))
+		if err == nil || !strings.Contains(err.Error(), "interval") {
+			t.Errorf("expected an error for the duplicate agent key, got %v", err)
+		}
+	}
+
+	_, err := Parse([]byte("[agent]\n  interval = \"10s\"\n[agent]\n  debug = true\n"))
+	if err == nil {
+		t.Error("expected an error for a repeated [agent] table")
+	}
+}
+
+func TestParseStrictRepeatedTable(t *testing.T) {
+	config := []byte(`[inputs.cpu]
+  percpu = true
+
+[inputs.cpu]
+  totalcpu = true
+`)
+	tbl, err := Parse(config)
+	if err != nil {
+		t.Fatalf("expected the tables to be merged, got %s", err)
+	}
+	cpu := tbl.Fields["inputs"].(*Table).Fields["cpu"].(*Table)
+	if len(cpu.Fields) != 2 {
+		t.Errorf("expected the merged table to have 2 keys, got %d", len(cpu.Fields))
+	}
+
+	_, err = ParseStrict(config)
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("expected an error naming the line of the first table, got %v", err)
+	}
+
+	// the same sub-table under two entries of an array of tables is not a
+	// repeated table
+	_, err = ParseStrict([]byte(`[[inputs.exec]]
+  commands = ["echo 1"]
+  [inputs.exec.tags]
+    a = "1"
+
+[[inputs.exec]]
+  commands = ["echo 2"]
+  [inputs.exec.tags]
+    a = "2"
+`))
+	if err != nil {
+		t.Errorf("expected the tags of each exec to be accepted, got %s", err)
+	}
+}
+
+func TestStrictTOMLConfig(t *testing.T) {
+	config := `[agent]
+  omit_hostname = true
+[agent.static_fields]
+  a = 1
+[agent.static_fields]
+  b = 2
+`
+	c := NewConfig()
+	if err := loadConfigString(t, c, config); err != nil {
+		t.Errorf("expected the repeated table to be merged, got %s", err)
+	} else if len(c.Agent.StaticFields) != 2 {
+		t.Errorf("expected the merged static fields, got %v", c.Agent.StaticFields)
+	}
+	c = NewConfig()
+	c.StrictTOML = true
+	if err := loadConfigString(t, c, config); err == nil {
+		t.Error("expected an error for the repeated table in strict mode")
+	}
+}
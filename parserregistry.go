@@ -2,6 +2,9 @@ package main
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
+	"time"
 )
 
 // ParserInput is an interface for input plugins that are able to parse
@@ -15,12 +18,14 @@ type ParserInput interface {
 type Parser interface {
 	// Parse takes a byte buffer separated by newlines
 	// ie, `cpu.usage.idle 90\ncpu.usage.busy 10`
-	// and parses it into telegraf metrics
+	// and parses it into telegraf metrics. An empty or whitespace-only
+	// buffer gives no metrics and no error.
 	Parse(buf []byte) ([]Metric, error)
 
 	// ParseLine takes a single string metric
 	// ie, "cpu.usage.idle 90"
-	// and parses it into a telegraf metric.
+	// and parses it into a telegraf metric. A blank line gives a nil metric
+	// and no error.
 	ParseLine(line string) (Metric, error)
 
 	// SetDefaultTags tells the parser to add all of the given tags
@@ -32,18 +37,35 @@ type Parser interface {
 // Config is a struct that covers the data types needed for all parser types,
 // and can be used to instantiate _any_ of the parsers.
 type ParserConfig struct {
-	// Dataformat can be one of: json, influx, graphite, value, nagios
+	// Dataformat can be one of: json, influx, graphite, value, nagios,
+	// prometheus, multi, keyvalue, logfmt, kstat, opentsdb
 	DataFormat string
 
+	// DataFormats only applies to multi, it is the ordered list of data
+	// formats that each line is tried with.
+	DataFormats []string
+	// MultiStrict only applies to multi, it makes a line that no data format
+	// accepts an error instead of skipping it.
+	MultiStrict bool
+
 	// Separator only applied to Graphite data.
 	Separator string
 	// Templates only apply to Graphite data.
 	Templates []string
 
-	// TagKeys only apply to JSON data
+	// TagKeys only apply to JSON, keyvalue and logfmt data
 	TagKeys []string
+
+	// KeyValuePairDelimiter and KeyValueSeparator only apply to keyvalue,
+	// they separate the pairs of a line, and the key of a pair from its
+	// value.
+	KeyValuePairDelimiter string
+	KeyValueSeparator     string
 	// MetricName applies to JSON & value. This will be the name of the measurement.
 	MetricName string
+	// TimestampUnits only applies to JSON, it is the unit of the timestamp
+	// of the metrics written by the json serializer, 1s by default.
+	TimestampUnits time.Duration
 
 	// Authentication file for collectd
 	CollectdAuthFile string
@@ -55,8 +77,52 @@ type ParserConfig struct {
 	// DataType only applies to value, this will be the type to parse value to
 	DataType string
 
+	// DurationUnit only applies to value with the "duration" DataType. Parsed
+	// durations are stored as an integer count of this unit (default 1s).
+	DurationUnit time.Duration
+
+	// DecimalSeparator only applies to value, for numbers written with a
+	// decimal separator other than ".", ie "3,14".
+	DecimalSeparator string
+	// ThousandsSeparator only applies to value, it is stripped from numbers
+	// before they are parsed.
+	ThousandsSeparator string
+	// StringFieldRegex only applies to value with the "string" DataType. When
+	// set, the value is its first capture group instead of the whole buffer.
+	StringFieldRegex string
+	// ValueFieldName only applies to value, it is the key of the parsed
+	// field, "value" by default.
+	ValueFieldName string
+	// FieldSeparator only applies to value, it splits the buffer into
+	// fields, the last of which is the value. Defaults to any whitespace.
+	FieldSeparator string
+	// StrictSingleValue only applies to value, it makes a buffer of more
+	// than one field an error instead of keeping the last one.
+	StrictSingleValue bool
+	// UniqueTimestamps only applies to value, it makes the time of each
+	// metric strictly later than the previous one's.
+	UniqueTimestamps bool
+	// MaxLineSize only applies to value. Lines longer than this many bytes
+	// are skipped, 0 means no limit.
+	MaxLineSize int
+	// KeepRaw only applies to value, it adds the original buffer as the
+	// RawField string field, "raw" by default.
+	KeepRaw  bool
+	RawField string
+
+	// SkipLines applies to every data format, it is the number of lines
+	// discarded at the start of each buffer, ie, a header.
+	SkipLines int
+
+	// NameCase applies to every data format, it is "lower" or "upper" to
+	// change the case of the measurement names, "none" or empty to keep it.
+	NameCase string
+
 	// DefaultTags are the default tags that will be added to all parsed metrics.
 	DefaultTags map[string]string
+	// DefaultTagsByMetric only applies to value, it holds extra default tags
+	// by metric name.
+	DefaultTagsByMetric map[string]map[string]string
 }
 
 // NewParser returns a Parser interface based on the given config.
@@ -67,17 +133,57 @@ func NewParser(config *ParserConfig) (Parser, error) {
 	case "json":
 		parser, err = NewJSONParser(config.MetricName,
 			config.TagKeys, config.DefaultTags)
+		if err == nil {
+			parser.(*JSONParser).TimestampUnits = config.TimestampUnits
+		}
 	case "value":
-		parser, err = NewValueParser(config.MetricName,
-			config.DataType, config.DefaultTags)
+		parser, err = newValueParser(config)
 	case "influx":
 		parser, err = NewInfluxParser()
+	case "prometheus":
+		parser, err = NewPrometheusParser(config.DefaultTags)
+	case "keyvalue":
+		parser, err = NewKeyValueParser(config)
+	case "logfmt":
+		parser, err = NewLogfmtParser(config)
+	case "kstat":
+		parser, err = NewKstatParser(config.DefaultTags)
+	case "opentsdb":
+		parser, err = NewOpenTSDBParser(config.DefaultTags)
+	case "multi":
+		parser, err = NewMultiParser(config)
 	default:
 		err = fmt.Errorf("Invalid data format: %s", config.DataFormat)
 	}
+	if err == nil && config.SkipLines > 0 {
+		parser = &SkipLinesParser{Parser: parser, Skip: config.SkipLines}
+	}
+	if err == nil {
+		parser, err = newNameCaseParser(parser, config.NameCase)
+	}
 	return parser, err
 }
 
+// uniqueTimestamps reports whether parser, or a parser it wraps, makes the
+// time of each metric unique, see unique_timestamps.
+func uniqueTimestamps(parser Parser) bool {
+	switch p := parser.(type) {
+	case *ValueParser:
+		return p.UniqueTimestamps
+	case *SkipLinesParser:
+		return uniqueTimestamps(p.Parser)
+	case *NameCaseParser:
+		return uniqueTimestamps(p.Parser)
+	case *MultiParser:
+		for _, parser := range p.Parsers {
+			if uniqueTimestamps(parser) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func NewJSONParser(
 	metricName string,
 	tagKeys []string,
@@ -91,18 +197,112 @@ func NewJSONParser(
 	return parser, nil
 }
 
+func NewKeyValueParser(config *ParserConfig) (Parser, error) {
+	if config.KeyValueSeparator != "" &&
+		config.KeyValueSeparator == config.KeyValuePairDelimiter {
+		return nil, fmt.Errorf("keyvalue_separator and keyvalue_pair_delimiter cannot both be %q",
+			config.KeyValueSeparator)
+	}
+	return &KeyValueParser{
+		MetricName:    config.MetricName,
+		PairDelimiter: config.KeyValuePairDelimiter,
+		Separator:     config.KeyValueSeparator,
+		TagKeys:       config.TagKeys,
+		DefaultTags:   config.DefaultTags,
+	}, nil
+}
+
+// NewLogfmtParser returns a parser of logfmt lines, ie,
+// `level=info msg="request done" duration=12 cached`, which are key=value
+// pairs separated by spaces, with bare keys as true boolean fields.
+func NewLogfmtParser(config *ParserConfig) (Parser, error) {
+	return &KeyValueParser{
+		MetricName:    config.MetricName,
+		PairDelimiter: " ",
+		Separator:     "=",
+		TagKeys:       config.TagKeys,
+		DefaultTags:   config.DefaultTags,
+		BareKeys:      true,
+	}, nil
+}
+
+func NewKstatParser(defaultTags map[string]string) (Parser, error) {
+	return &KstatParser{DefaultTags: defaultTags}, nil
+}
+
+func NewOpenTSDBParser(defaultTags map[string]string) (Parser, error) {
+	return &OpenTSDBParser{DefaultTags: defaultTags}, nil
+}
+
 func NewInfluxParser() (Parser, error) {
 	return &InfluxParser{}, nil
 }
 
+func NewPrometheusParser(defaultTags map[string]string) (Parser, error) {
+	return &PrometheusParser{DefaultTags: defaultTags}, nil
+}
+
 func NewValueParser(
 	metricName string,
 	dataType string,
 	defaultTags map[string]string,
 ) (Parser, error) {
-	return &ValueParser{
+	return newValueParser(&ParserConfig{
 		MetricName:  metricName,
 		DataType:    dataType,
 		DefaultTags: defaultTags,
+	})
+}
+
+// newValueParser builds a ValueParser from every value-related option of
+// the given config.
+func newValueParser(config *ParserConfig) (Parser, error) {
+	if !sliceContains(config.DataType, valueDataTypes) {
+		return nil, unsupportedDataTypeError(config.DataType)
+	}
+
+	if sep := config.FieldSeparator; sep != "" &&
+		(sep == config.DecimalSeparator || sep == config.ThousandsSeparator) {
+		return nil, fmt.Errorf("field_separator %q cannot also be a decimal or thousands separator",
+			sep)
+	}
+
+	var stringFieldRegex *regexp.Regexp
+	if config.StringFieldRegex != "" {
+		var err error
+		stringFieldRegex, err = regexp.Compile(config.StringFieldRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string_field_regex: %s", err)
+		}
+		if stringFieldRegex.NumSubexp() < 1 {
+			return nil, fmt.Errorf("string_field_regex %q has no capture group",
+				config.StringFieldRegex)
+		}
+	}
+
+	return &ValueParser{
+		MetricName:   config.MetricName,
+		DataType:     config.DataType,
+		DefaultTags:  config.DefaultTags,
+		DurationUnit: config.DurationUnit,
+
+		DecimalSeparator:   config.DecimalSeparator,
+		ThousandsSeparator: config.ThousandsSeparator,
+		StringFieldRegex:   stringFieldRegex,
+		MaxLineSize:        config.MaxLineSize,
+		FieldSeparator:     config.FieldSeparator,
+		StrictSingleValue:  config.StrictSingleValue,
+		UniqueTimestamps:   config.UniqueTimestamps,
+		FieldName:          config.ValueFieldName,
+		KeepRaw:            config.KeepRaw,
+		RawField:           config.RawField,
+
+		DefaultTagsByMetric: config.DefaultTagsByMetric,
 	}, nil
 }
+
+// blankLine reports whether a line holds nothing but whitespace, which the
+// parsers skip without error.
+func blankLine(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
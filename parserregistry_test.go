@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParsersSkipBlankInput(t *testing.T) {
+	formats := []string{"influx", "json", "value", "prometheus", "keyvalue",
+		"logfmt", "kstat", "opentsdb"}
+	blanks := []string{"", " ", "\n", "\n\n", " \t \n  \n", "\r\n"}
+
+	for _, format := range formats {
+		parser, err := NewParser(&ParserConfig{
+			DataFormat: format,
+			MetricName: "blank",
+			DataType:   "integer",
+		})
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		for _, blank := range blanks {
+			metrics, err := parser.Parse([]byte(blank))
+			if err != nil {
+				t.Errorf("%s: Parse(%q) returned error %s", format, blank, err)
+			}
+			if len(metrics) != 0 {
+				t.Errorf("%s: Parse(%q) returned %d metrics", format, blank,
+					len(metrics))
+			}
+
+			m, err := parser.ParseLine(blank)
+			if err != nil {
+				t.Errorf("%s: ParseLine(%q) returned error %s", format, blank, err)
+			}
+			if m != nil {
+				t.Errorf("%s: ParseLine(%q) returned %v", format, blank, m)
+			}
+		}
+	}
+}
+
+func TestInfluxParserSkipsBlankLines(t *testing.T) {
+	parser, _ := NewInfluxParser()
+	metrics, err := parser.Parse([]byte("a x=1\n   \n\t\nb x=2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 2 || metrics[0].Name() != "a" || metrics[1].Name() != "b" {
+		t.Errorf("expected metrics a and b, got %v", metrics)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrometheusParser parses the Prometheus text exposition format. Every
+// metric family becomes a measurement, with one metric per label set.
+// Counters, gauges and untyped metrics have a single "counter", "gauge" or
+// "value" field. Summaries have "sum", "count" and one field per quantile,
+// ie, "0.5", and histograms "sum", "count" and one field per bucket bound,
+// ie, "0.1" or "+Inf".
+type PrometheusParser struct {
+	DefaultTags map[string]string
+}
+
+// promSample is a single sample line, ie, `name{label="v"} 1.5 1500000000000`.
+type promSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+	time   time.Time
+}
+
+func (p *PrometheusParser) Parse(buf []byte) ([]Metric, error) {
+	now := time.Now()
+	types := make(map[string]string)
+
+	// samples are grouped into metrics by family, labels and time
+	var order []string
+	groups := make(map[string]*promGroup)
+
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line[0] == '#' {
+			// "# TYPE name type", other comments and HELP are ignored
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		s, err := parsePromSample(line, now)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineno, err)
+		}
+		family, typ, field := promField(s, types)
+		if field == "" {
+			continue
+		}
+		delete(s.labels, "le")
+		delete(s.labels, "quantile")
+
+		key := family + promLabelKey(s.labels) + strconv.FormatInt(s.time.UnixNano(), 10)
+		g, ok := groups[key]
+		if !ok {
+			g = &promGroup{
+				name:   family,
+				typ:    typ,
+				tags:   s.labels,
+				fields: make(map[string]interface{}),
+				time:   s.time,
+			}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.fields[field] = s.value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	metrics := make([]Metric, 0, len(order))
+	for _, key := range order {
+		g := groups[key]
+		for k, v := range p.DefaultTags {
+			if _, ok := g.tags[k]; !ok {
+				g.tags[k] = v
+			}
+		}
+
+		var mType ValueType
+		switch g.typ {
+		case "counter":
+			mType = Counter
+		case "gauge":
+			mType = Gauge
+		case "summary":
+			mType = Summary
+		case "histogram":
+			mType = Histogram
+		default:
+			mType = Untyped
+		}
+
+		if !dropNonFinite(g.name, g.fields) {
+			continue
+		}
+		m, err := New(g.name, g.tags, g.fields, g.time, mType)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+func (p *PrometheusParser) ParseLine(line string) (Metric, error) {
+	if blankLine(line) {
+		return nil, nil
+	}
+	metrics, err := p.Parse([]byte(line + "\n"))
+	if err != nil {
+		return nil, err
+	}
+	if len(metrics) < 1 {
+		return nil, fmt.Errorf("Can not parse the line: %s, for data format: prometheus ", line)
+	}
+	return metrics[0], nil
+}
+
+func (p *PrometheusParser) SetDefaultTags(tags map[string]string) {
+	p.DefaultTags = tags
+}
+
+type promGroup struct {
+	name   string
+	typ    string
+	tags   map[string]string
+	fields map[string]interface{}
+	time   time.Time
+}
+
+// promField returns the family, its type and the field name of a sample.
+// The _sum, _count and _bucket samples belong to the summary or histogram
+// family they are suffixed to.
+func promField(s *promSample, types map[string]string) (string, string, string) {
+	for _, suffix := range []string{"_sum", "_count", "_bucket"} {
+		if !strings.HasSuffix(s.name, suffix) {
+			continue
+		}
+		base := strings.TrimSuffix(s.name, suffix)
+		typ := types[base]
+		if typ != "summary" && typ != "histogram" {
+			continue
+		}
+		if suffix == "_bucket" {
+			if typ != "histogram" {
+				return base, typ, ""
+			}
+			return base, typ, s.labels["le"]
+		}
+		return base, typ, suffix[1:]
+	}
+
+	typ := types[s.name]
+	switch typ {
+	case "counter", "gauge":
+		return s.name, typ, typ
+	case "summary":
+		return s.name, typ, s.labels["quantile"]
+	}
+	return s.name, typ, "value"
+}
+
+// promLabelKey returns a key identifying a label set.
+func promLabelKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "{%s=%q}", k, labels[k])
+	}
+	return buf.String()
+}
+
+// parsePromSample parses `name{label="value",...} value [timestamp]`, the
+// timestamp being in milliseconds.
+func parsePromSample(line string, now time.Time) (*promSample, error) {
+	s := &promSample{labels: make(map[string]string), time: now}
+
+	i := strings.IndexAny(line, "{ \t")
+	if i < 0 {
+		return nil, fmt.Errorf("missing value: %q", line)
+	}
+	s.name = line[:i]
+	if s.name == "" {
+		return nil, fmt.Errorf("missing metric name: %q", line)
+	}
+	rest := line[i:]
+
+	if rest[0] == '{' {
+		n, err := parsePromLabels(rest, s.labels)
+		if err != nil {
+			return nil, err
+		}
+		rest = rest[n:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return nil, fmt.Errorf("expected a value and an optional timestamp: %q", line)
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", fields[0])
+	}
+	s.value = v
+
+	if len(fields) == 2 {
+		ms, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", fields[1])
+		}
+		s.time = time.Unix(0, ms*int64(time.Millisecond))
+	}
+	return s, nil
+}
+
+// parsePromLabels parses the label set at the start of s into labels and
+// returns its length, including the braces.
+func parsePromLabels(s string, labels map[string]string) (int, error) {
+	i := 1
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return 0, fmt.Errorf("unterminated label set: %q", s)
+		}
+		if s[i] == '}' {
+			return i + 1, nil
+		}
+
+		eq := strings.IndexByte(s[i:], '=')
+		if eq < 0 {
+			return 0, fmt.Errorf("invalid label: %q", s[i:])
+		}
+		name := strings.TrimSpace(s[i : i+eq])
+		i += eq + 1
+		if i >= len(s) || s[i] != '"' {
+			return 0, fmt.Errorf("label %s value is not quoted", name)
+		}
+		i++
+
+		var value []byte
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value = append(value, '\n')
+				default:
+					value = append(value, s[i])
+				}
+				continue
+			}
+			value = append(value, s[i])
+		}
+		if i >= len(s) {
+			return 0, fmt.Errorf("unterminated label value of %s", name)
+		}
+		i++
+		labels[name] = string(value)
+	}
+}
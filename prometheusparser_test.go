@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const prometheusExposition = `# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+
+# HELP zfs_arc_size The size of the ARC.
+# TYPE zfs_arc_size gauge
+zfs_arc_size{pool="rpool"} 4.294967296e+09
+
+# a comment
+load_average 0.73
+
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 0.045
+rpc_duration_seconds{quantile="0.99"} 0.25
+rpc_duration_seconds_sum 17.5
+rpc_duration_seconds_count 210
+`
+
+func TestPrometheusParser(t *testing.T) {
+	p := &PrometheusParser{DefaultTags: map[string]string{"source": "node"}}
+	metrics, err := p.Parse([]byte(prometheusExposition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stamp := time.Unix(1395066363, 0)
+	want := []struct {
+		name   string
+		typ    ValueType
+		tags   map[string]string
+		fields map[string]interface{}
+	}{
+		{"http_requests_total", Counter,
+			map[string]string{"method": "post", "code": "200", "source": "node"},
+			map[string]interface{}{"counter": 1027.0}},
+		{"http_requests_total", Counter,
+			map[string]string{"method": "post", "code": "400", "source": "node"},
+			map[string]interface{}{"counter": 3.0}},
+		{"zfs_arc_size", Gauge,
+			map[string]string{"pool": "rpool", "source": "node"},
+			map[string]interface{}{"gauge": 4294967296.0}},
+		{"load_average", Untyped,
+			map[string]string{"source": "node"},
+			map[string]interface{}{"value": 0.73}},
+		{"rpc_duration_seconds", Summary,
+			map[string]string{"source": "node"},
+			map[string]interface{}{"0.5": 0.045, "0.99": 0.25, "sum": 17.5,
+				"count": 210.0}},
+	}
+	if len(metrics) != len(want) {
+		t.Fatalf("expected %d metrics, got %d: %v", len(want), len(metrics), metrics)
+	}
+	for i, w := range want {
+		m := metrics[i]
+		if m.Name() != w.name || m.Type() != w.typ {
+			t.Errorf("metric %d: expected %s of type %d, got %s of type %d",
+				i, w.name, w.typ, m.Name(), m.Type())
+		}
+		if !reflect.DeepEqual(m.Tags(), w.tags) {
+			t.Errorf("metric %d: expected the tags %v, got %v", i, w.tags, m.Tags())
+		}
+		if !reflect.DeepEqual(m.Fields(), w.fields) {
+			t.Errorf("metric %d: expected the fields %v, got %v", i, w.fields, m.Fields())
+		}
+	}
+	if !metrics[0].Time().Equal(stamp) {
+		t.Errorf("expected the timestamp %s, got %s", stamp, metrics[0].Time())
+	}
+
+	if _, err := p.Parse([]byte("http_requests_total{method=post} 1\n")); err == nil {
+		t.Error("expected an error for an unquoted label value")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -24,7 +25,7 @@ type Serializer interface {
 // Config is a struct that covers the data types needed for all serializer types,
 // and can be used to instantiate _any_ of the serializers.
 type SerializerConfig struct {
-	// Dataformat can be one of: influx, graphite, or json
+	// Dataformat can be one of: influx, graphite, json, or msgpack
 	DataFormat string
 
 	// Prefix to add to all measurements, only supports Graphite
@@ -34,6 +35,12 @@ type SerializerConfig struct {
 	// only supports Graphite
 	Template string
 
+	// GraphiteSeparator joins the segments of Graphite paths, and
+	// GraphiteReplacement replaces the characters of tag values that would
+	// corrupt them, only supports Graphite
+	GraphiteSeparator   string
+	GraphiteReplacement string
+
 	// Timestamp units to use for JSON formatted output
 	TimestampUnits time.Duration
 }
@@ -47,6 +54,10 @@ func NewSerializer(config *SerializerConfig) (Serializer, error) {
 		serializer, err = NewInfluxSerializer()
 	case "json":
 		serializer, err = NewJsonSerializer(config.TimestampUnits)
+	case "msgpack":
+		serializer, err = NewMsgpackSerializer()
+	case "graphite":
+		serializer, err = NewGraphiteSerializer(config)
 	default:
 		err = fmt.Errorf("Invalid data format: %s", config.DataFormat)
 	}
@@ -60,3 +71,25 @@ func NewJsonSerializer(timestampUnits time.Duration) (Serializer, error) {
 func NewInfluxSerializer() (Serializer, error) {
 	return &InfluxSerializer{}, nil
 }
+
+func NewGraphiteSerializer(config *SerializerConfig) (Serializer, error) {
+	if strings.ContainsAny(config.GraphiteReplacement, graphiteIllegal+" ") {
+		return nil, fmt.Errorf("graphite_replacement %q would itself corrupt the path",
+			config.GraphiteReplacement)
+	}
+	if config.GraphiteReplacement != "" &&
+		config.GraphiteReplacement == config.GraphiteSeparator {
+		return nil, fmt.Errorf("graphite_replacement cannot be the graphite_separator %q",
+			config.GraphiteSeparator)
+	}
+	return &GraphiteSerializer{
+		Prefix:      config.Prefix,
+		Template:    config.Template,
+		Separator:   config.GraphiteSeparator,
+		Replacement: config.GraphiteReplacement,
+	}, nil
+}
+
+func NewMsgpackSerializer() (Serializer, error) {
+	return &MsgpackSerializer{}, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"time"
+)
+
+type RunningAggregator struct {
+	a      Aggregator
+	Config *AggregatorConfig
+
+	metrics chan Metric
+
+	periodStart time.Time
+	periodEnd   time.Time
+	truncation  time.Duration
+
+	// clock times the periods, the Clock of the agent.
+	clock Clock
+}
+
+func NewRunningAggregator(
+	a Aggregator,
+	conf *AggregatorConfig,
+) *RunningAggregator {
+	return &RunningAggregator{
+		a:       a,
+		Config:  conf,
+		metrics: make(chan Metric, 100),
+		clock:   RealClock,
+	}
+}
+
+// AggregatorConfig containing configuration parameters for the running
+// aggregator plugin.
+type AggregatorConfig struct {
+	Name string
+
+	DropOriginal      bool
+	NameOverride      string
+	MeasurementPrefix string
+	MeasurementSuffix string
+	Tags              map[string]string
+
+	Period time.Duration
+	Delay  time.Duration
+	// AlignPeriod aligns the periods to wall-clock boundaries, ie, a 1m
+	// period always covers :00 to :59.
+	AlignPeriod bool
+}
+
+func (r *RunningAggregator) Name() string {
+	return "aggregators." + r.Config.Name
+}
+
+func (r *RunningAggregator) MakeMetric(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	mType ValueType,
+	t time.Time,
+) Metric {
+	m := makemetric(
+		measurement,
+		fields,
+		tags,
+		r.Config.NameOverride,
+		r.Config.MeasurementPrefix,
+		r.Config.MeasurementSuffix,
+		r.Config.Tags,
+		nil,
+		false,
+		mType,
+		t,
+	)
+
+	if m != nil {
+		m.SetAggregate(true)
+	}
+
+	return m
+}
+
+// Add applies the given metric to the aggregator.
+// Add returns true if the original metric should be dropped.
+func (r *RunningAggregator) Add(in Metric) bool {
+	// skip aggregate metrics
+	if in.IsAggregate() {
+		return false
+	}
+
+	r.metrics <- in
+	return r.Config.DropOriginal
+}
+
+func (r *RunningAggregator) add(in Metric) {
+	r.a.Add(in)
+}
+
+func (r *RunningAggregator) push(acc Accumulator) {
+	r.a.Push(acc)
+}
+
+func (r *RunningAggregator) reset() {
+	r.a.Reset()
+}
+
+// startPeriod sets up the first aggregation period for an aggregator started
+// at now.
+func (r *RunningAggregator) startPeriod(now time.Time) {
+	if r.Config.AlignPeriod {
+		r.periodStart = now.Truncate(r.Config.Period)
+		r.truncation = 0
+	} else {
+		r.periodStart = now.Truncate(time.Second)
+		r.truncation = now.Sub(r.periodStart)
+	}
+	r.periodEnd = r.periodStart.Add(r.Config.Period)
+}
+
+// flushTime returns when the current period is pushed, which is also the
+// latest timestamp accepted into it.
+func (r *RunningAggregator) flushTime() time.Time {
+	return r.periodEnd.Add(r.truncation).Add(r.Config.Delay)
+}
+
+// Run runs the running aggregator, listens for incoming metrics, and waits
+// for period ticks to tell it when to push and reset the aggregator.
+func (r *RunningAggregator) Run(
+	acc Accumulator,
+	shutdown chan struct{},
+) {
+	// The start of the period is truncated to the nearest second.
+	//
+	// Every metric then gets it's timestamp checked and is dropped if it
+	// is not within:
+	//
+	//   start < t < end + truncation + delay
+	//
+	// So if we start at now = 00:00.2 with a 10s period and 0.3s delay:
+	//   now = 00:00.2
+	//   start = 00:00
+	//   truncation = 00:00.2
+	//   end = 00:10
+	// 1st interval: 00:00 - 00:10.5
+	// 2nd interval: 00:10 - 00:20.5
+	// etc.
+	//
+	// With align_period the start is truncated to the period instead, so
+	// that the first push happens at the next period boundary (+ delay).
+	//
+	now := r.clock.Now()
+	r.startPeriod(now)
+	periodC := r.clock.After(r.flushTime().Sub(now))
+
+	for {
+		select {
+		case <-shutdown:
+			if len(r.metrics) > 0 {
+				// wait until metrics are flushed before exiting
+				continue
+			}
+			return
+		case m := <-r.metrics:
+			if m.Time().Before(r.periodStart) ||
+				m.Time().After(r.flushTime()) {
+				// the metric is outside the current aggregation period, so
+				// skip it.
+				continue
+			}
+			r.add(m)
+		case <-periodC:
+			r.periodStart = r.periodEnd
+			r.periodEnd = r.periodStart.Add(r.Config.Period)
+			r.push(acc)
+			r.reset()
+			periodC = r.clock.After(r.flushTime().Sub(r.clock.Now()))
+		}
+	}
+}
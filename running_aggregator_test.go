@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// countAggregator counts the metrics added in each period.
+type countAggregator struct {
+	count int64
+}
+
+func (_ *countAggregator) SampleConfig() string { return "" }
+func (_ *countAggregator) Description() string  { return "" }
+func (c *countAggregator) Add(in Metric)        { c.count++ }
+func (c *countAggregator) Reset()               { c.count = 0 }
+func (c *countAggregator) Push(acc Accumulator) {
+	acc.AddFields("count", map[string]interface{}{"count": c.count}, nil)
+}
+
+func TestRunningAggregatorPeriodClock(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	clock := NewMockClock(start)
+	ra := NewRunningAggregator(&countAggregator{},
+		&AggregatorConfig{Name: "count", Period: 10 * time.Second})
+	ra.clock = clock
+
+	metricC := make(chan Metric, 10)
+	acc := NewAccumulator(ra, metricC)
+	acc.clock = clock
+	shutdown := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		ra.Run(acc, shutdown)
+		close(done)
+	}()
+	defer func() {
+		close(shutdown)
+		<-done
+	}()
+
+	waitFor := func(cond func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for _, ts := range []time.Duration{time.Second, 5 * time.Second, 11 * time.Second} {
+		m, _ := New("cpu", nil, map[string]interface{}{"usage": 1.0}, start.Add(ts))
+		ra.Add(m)
+	}
+	waitFor(func() bool { return clock.pending() == 1 && len(ra.metrics) == 0 })
+
+	// nothing is pushed before the end of the period
+	clock.Add(9 * time.Second)
+	select {
+	case m := <-metricC:
+		t.Fatalf("unexpected push %v", m)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clock.Add(time.Second)
+	select {
+	case m := <-metricC:
+		if n := m.Fields()["count"]; n != int64(2) {
+			t.Errorf("expected the 2 metrics of the period, got %v", n)
+		}
+		if !m.Time().Equal(start.Add(10 * time.Second)) {
+			t.Errorf("expected the push to be timestamped by the clock, got %s",
+				m.Time())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a push at the end of the period")
+	}
+}
+
+func TestRunningAggregatorAlignPeriod(t *testing.T) {
+	// 12:00:37.5
+	start := time.Date(2017, 7, 14, 12, 0, 37, 500000000, time.UTC)
+	tests := []struct {
+		period      time.Duration
+		delay       time.Duration
+		align       bool
+		periodStart time.Time
+		flush       time.Time
+	}{
+		{
+			period:      time.Minute,
+			align:       true,
+			periodStart: time.Date(2017, 7, 14, 12, 0, 0, 0, time.UTC),
+			flush:       time.Date(2017, 7, 14, 12, 1, 0, 0, time.UTC),
+		},
+		{
+			period:      10 * time.Second,
+			delay:       time.Second,
+			align:       true,
+			periodStart: time.Date(2017, 7, 14, 12, 0, 30, 0, time.UTC),
+			flush:       time.Date(2017, 7, 14, 12, 0, 41, 0, time.UTC),
+		},
+		{
+			// unaligned periods start at the second the aggregator started,
+			// and flush a period after it
+			period:      time.Minute,
+			periodStart: time.Date(2017, 7, 14, 12, 0, 37, 0, time.UTC),
+			flush:       time.Date(2017, 7, 14, 12, 1, 37, 500000000, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		ra := NewRunningAggregator(&countAggregator{}, &AggregatorConfig{
+			Name:        "count",
+			Period:      tt.period,
+			Delay:       tt.delay,
+			AlignPeriod: tt.align,
+		})
+		ra.startPeriod(start)
+		if !ra.periodStart.Equal(tt.periodStart) {
+			t.Errorf("%s aligned %v: expected the period to start at %s, got %s",
+				tt.period, tt.align, tt.periodStart, ra.periodStart)
+		}
+		if flush := ra.flushTime(); !flush.Equal(tt.flush) {
+			t.Errorf("%s aligned %v: expected a flush at %s, got %s",
+				tt.period, tt.align, tt.flush, flush)
+		}
+	}
+}
@@ -13,6 +13,8 @@ type RunningInput struct {
 
 	trace       bool
 	defaultTags map[string]string
+	// cache holds the last metric of each series, with cache_last
+	cache *lastValueCache
 
 	MetricsGathered Stat
 }
@@ -21,7 +23,7 @@ func NewRunningInput(
 	input Input,
 	config *InputConfig,
 ) *RunningInput {
-	return &RunningInput{
+	r := &RunningInput{
 		Input:  input,
 		Config: config,
 		MetricsGathered: Register(
@@ -30,6 +32,10 @@ func NewRunningInput(
 			map[string]string{"input": config.Name},
 		),
 	}
+	if config.CacheLast {
+		r.cache = newLastValueCache(config.CacheTTL)
+	}
+	return r
 }
 
 // InputConfig containing a name, interval, and filter
@@ -40,6 +46,54 @@ type InputConfig struct {
 	MeasurementSuffix string
 	Tags              map[string]string
 	Interval          time.Duration
+
+	// Window, if set, restricts gathering to a time of day.
+	Window *TimeWindow
+
+	// TagPass, if set, keeps only the metrics with a tag matching one of
+	// its filters, and TagDrop drops those with a tag matching one of its
+	// filters. Both are evaluated after the global tags are applied.
+	TagPass []TagFilter
+	TagDrop []TagFilter
+
+	// CacheLast emits the last metric of a series again, with the time of
+	// the gather, when a gather leaves the series out. CacheTTL bounds how
+	// long after it was last gathered, forever if 0.
+	CacheLast bool
+	CacheTTL  time.Duration
+
+	// hash identifies the settings of the input, see ConfigDiff.
+	hash uint64
+}
+
+// TimeWindow is a daily time range, as offsets from midnight in local time.
+// A window whose end is before its start wraps past midnight.
+type TimeWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Contains reports whether the time of day of t is within the window. The
+// start is inclusive and the end exclusive; a window that starts and ends at
+// the same time covers the whole day.
+func (w *TimeWindow) Contains(t time.Time) bool {
+	hour, min, sec := t.Clock()
+	offset := time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute +
+		time.Duration(sec)*time.Second
+
+	switch {
+	case w.Start == w.End:
+		return true
+	case w.Start < w.End:
+		return offset >= w.Start && offset < w.End
+	default:
+		return offset >= w.Start || offset < w.End
+	}
+}
+
+// InWindow reports whether the input may be gathered at t.
+func (r *RunningInput) InWindow(t time.Time) bool {
+	return r.Config.Window == nil || r.Config.Window.Contains(t)
 }
 
 // MakeMetric either returns a metric, or returns nil if the metric doesn't
@@ -64,9 +118,16 @@ func (r *RunningInput) MakeMetric(
 		mType,
 		t,
 	)
+	if m != nil && !r.Config.ShouldTagsPass(m.Tags()) {
+		return nil
+	}
+
+	if r.cache != nil && m != nil {
+		r.cache.add(m)
+	}
 
 	if r.trace && m != nil {
-		fmt.Print("> " + m.String())
+		fmt.Print("> " + m.SerializeLineProtocol())
 	}
 
 	r.MetricsGathered.Incr(1)
@@ -74,6 +135,18 @@ func (r *RunningInput) MakeMetric(
 	return m
 }
 
+// ShouldTagsPass reports whether a metric with tags passes the tagpass and
+// tagdrop of the input. The tags must be final, the global ones included, so
+// that the outcome does not depend on where a tag was set.
+func (c *InputConfig) ShouldTagsPass(tags map[string]string) bool {
+	if len(c.TagPass) > 0 && !matchTagFilters(c.TagPass, tags) {
+		return false
+	}
+	if len(c.TagDrop) > 0 && matchTagFilters(c.TagDrop, tags) {
+		return false
+	}
+	return true
+}
 
 func (r *RunningInput) Name() string {
 	return "inputs." + r.Config.Name
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// lastValueCache holds the last metric of each series of an input, see
+// cache_last, to emit it again when a gather leaves the series out.
+type lastValueCache struct {
+	// ttl is how long a series is held after it was last gathered, forever
+	// if 0.
+	ttl time.Duration
+
+	last map[uint64]*cachedMetric
+	// gathered are the metrics of the current gather, by series
+	gathered map[uint64]Metric
+	sync.Mutex
+}
+
+type cachedMetric struct {
+	metric Metric
+	seen   time.Time
+}
+
+func newLastValueCache(ttl time.Duration) *lastValueCache {
+	return &lastValueCache{
+		ttl:      ttl,
+		last:     make(map[uint64]*cachedMetric),
+		gathered: make(map[uint64]Metric),
+	}
+}
+
+// add records a metric of the current gather, a copy of it since the agent
+// goes on processing the metric. An input may add metrics from several
+// goroutines.
+func (c *lastValueCache) add(m Metric) {
+	c.Lock()
+	c.gathered[m.HashID()] = m.Copy()
+	c.Unlock()
+}
+
+// endGather ends the current gather at now, and returns the held metrics of
+// the series it left out, to be emitted again with the time t. The series
+// that were last gathered more than ttl ago are forgotten.
+func (c *lastValueCache) endGather(now, t time.Time) []Metric {
+	c.Lock()
+	defer c.Unlock()
+
+	var held []Metric
+	for id, cm := range c.last {
+		if _, ok := c.gathered[id]; ok {
+			continue
+		}
+		if c.ttl > 0 && now.Sub(cm.seen) > c.ttl {
+			delete(c.last, id)
+			continue
+		}
+		old := cm.metric
+		m, err := New(old.Name(), old.Tags(), old.Fields(), t, old.Type())
+		if err != nil {
+			log.Printf("E! Unable to emit the last value of metric [%s]: %s",
+				old.Name(), err)
+			continue
+		}
+		held = append(held, m)
+	}
+	for id, m := range c.gathered {
+		c.last[id] = &cachedMetric{metric: m, seen: now}
+	}
+	c.gathered = make(map[uint64]Metric)
+	return held
+}
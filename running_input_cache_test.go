@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// scriptInput adds a metric for each of the devices of its current gather,
+// valued with the number of the gather.
+type scriptInput struct {
+	gathers [][]string
+	n       int
+}
+
+func (_ *scriptInput) SampleConfig() string { return "" }
+func (_ *scriptInput) Description() string  { return "An input of scripted gathers" }
+func (s *scriptInput) Gather(acc Accumulator) error {
+	for _, device := range s.gathers[s.n] {
+		acc.AddFields("io", map[string]interface{}{"value": s.n},
+			map[string]string{"device": device})
+	}
+	s.n++
+	return nil
+}
+
+// cachedGather is a series of a gather, its device, value and time.
+type cachedGather struct {
+	device string
+	value  interface{}
+	time   time.Time
+}
+
+func TestCacheLast(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	clock := NewMockClock(start)
+	a := &Agent{Config: NewConfig(), clock: clock}
+
+	in := &scriptInput{gathers: [][]string{{"a", "b"}, {"a"}, {"a"}, {"b"}}}
+	ri := NewRunningInput(in, &InputConfig{
+		Name:      "cache_test",
+		CacheLast: true,
+		CacheTTL:  90 * time.Second,
+	})
+
+	gather := func() []cachedGather {
+		metricC := make(chan Metric, 10)
+		a.gatherWithTimeout(make(chan struct{}), ri, a.newAccumulator(ri, metricC), time.Minute)
+		close(metricC)
+		got := map[string]cachedGather{}
+		for m := range metricC {
+			device := m.Tags()["device"]
+			got[device] = cachedGather{device, m.Fields()["value"], m.Time()}
+		}
+		var sorted []cachedGather
+		for _, device := range []string{"a", "b"} {
+			if g, ok := got[device]; ok {
+				sorted = append(sorted, g)
+			}
+		}
+		return sorted
+	}
+
+	t1, t2, t3 := start.Add(time.Minute), start.Add(2*time.Minute), start.Add(3*time.Minute)
+	steps := []struct {
+		want     []cachedGather
+		gathered int64
+	}{
+		{[]cachedGather{{"a", int64(0), start}, {"b", int64(0), start}}, 2},
+		// b is skipped, its last value is emitted again with the time of
+		// the gather, and is not counted as gathered
+		{[]cachedGather{{"a", int64(1), t1}, {"b", int64(0), t1}}, 1},
+		// b was last gathered more than cache_ttl ago, it is forgotten
+		{[]cachedGather{{"a", int64(2), t2}}, 1},
+		{[]cachedGather{{"a", int64(2), t3}, {"b", int64(3), t3}}, 1},
+	}
+	for i, step := range steps {
+		if i > 0 {
+			clock.Add(time.Minute)
+		}
+		gathered := ri.MetricsGathered.Get()
+		if got := gather(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("gather %d: expected %v, got %v", i, step.want, got)
+		}
+		if n := ri.MetricsGathered.Get() - gathered; n != step.gathered {
+			t.Errorf("gather %d: expected %d gathered metrics, got %d", i, step.gathered, n)
+		}
+	}
+}
+
+func TestCacheLastDisabled(t *testing.T) {
+	a := &Agent{Config: NewConfig(), clock: NewMockClock(time.Unix(1500000000, 0))}
+	in := &scriptInput{gathers: [][]string{{"a", "b"}, {"a"}}}
+	ri := NewRunningInput(in, &InputConfig{Name: "cache_test"})
+
+	for i, want := range []int{2, 1} {
+		metricC := make(chan Metric, 10)
+		a.gatherWithTimeout(make(chan struct{}), ri, a.newAccumulator(ri, metricC), time.Minute)
+		if len(metricC) != want {
+			t.Errorf("gather %d: expected %d metrics, got %d", i, want, len(metricC))
+		}
+	}
+}
+
+func TestCacheLastConfig(t *testing.T) {
+	AddInput("slice_test", func() Input { return &sliceInput{} })
+	defer delete(Inputs, "slice_test")
+
+	c := loadTestConfig(t, `
+[[inputs.slice_test]]
+  cache_last = true
+  cache_ttl = "5m"
+`)
+	if cfg := c.Inputs[0].Config; !cfg.CacheLast || cfg.CacheTTL != 5*time.Minute {
+		t.Errorf("expected cache_last with a cache_ttl of 5m, got %v and %s",
+			cfg.CacheLast, cfg.CacheTTL)
+	}
+	if c.Inputs[0].cache == nil {
+		t.Error("expected the input to hold a cache")
+	}
+
+	for _, bad := range []string{`cache_last = "yes"`, `cache_ttl = 300`, `cache_ttl = "-1m"`} {
+		err := loadConfigString(t, NewConfig(), "[[inputs.slice_test]]\n  "+bad+"\n")
+		if err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
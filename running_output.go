@@ -1,8 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"log"
+	"sort"
 	"time"
 )
 
@@ -12,6 +15,9 @@ const (
 
 	// Default number of metrics kept. It should be a multiple of batch size.
 	DEFAULT_METRIC_BUFFER_LIMIT = 10000
+
+	// Default time a single write to an output may take.
+	DEFAULT_WRITE_TIMEOUT = 5 * time.Second
 )
 
 // RunningOutput contains the output configuration
@@ -21,19 +27,75 @@ type RunningOutput struct {
 	Config            *OutputConfig
 	MetricBufferLimit int
 	MetricBatchSize   int
+	// PreserveOrder sorts each batch by the gather order of its metrics
+	// before writing it, see preserve_order.
+	PreserveOrder bool
 
 	MetricsWritten Stat
+	MetricsDropped Stat
+	WriteErrors    Stat
 	BufferSize     Stat
 	BufferLimit    Stat
 	WriteTime      Stat
+	// BufferPeak is the largest number of metrics buffered since the start,
+	// or since the last ResetBufferHighWaterMark.
+	BufferPeak Stat
+
+	// bufferPeak backs BufferPeak, accessed atomically.
+	bufferPeak int64
 
 	metrics     *Buffer
 	failMetrics *Buffer
+	spill       *Spill
+
+	// blockWhenFull makes AddMetric wait for room in the buffer instead of
+	// dropping metrics, until stopped is closed.
+	blockWhenFull bool
+	stopped       chan struct{}
+	stopOnce      sync.Once
+
+	// pending receives the result of a write that timed out, and is nil when
+	// no write is still running.
+	pending chan error
+
+	// disconnected is set while the output has yet to connect, its metrics
+	// are buffered and the connection is retried before each write.
+	disconnected bool
+
+	// breaker pauses the writes of an output that keeps failing, nil when
+	// breaker_threshold is not set.
+	breaker *outputBreaker
+
+	// flushMu serializes the flushes of the buffer, by the agent and on
+	// demand.
+	flushMu sync.Mutex
 
 	// Guards against concurrent calls to the Output as described in #3009
 	sync.Mutex
 }
 
+// RunningOutputs sorts outputs by their order.
+type RunningOutputs []*RunningOutput
+
+func (ro RunningOutputs) Len() int           { return len(ro) }
+func (ro RunningOutputs) Swap(i, j int)      { ro[i], ro[j] = ro[j], ro[i] }
+func (ro RunningOutputs) Less(i, j int) bool { return ro[i].Config.Order < ro[j].Config.Order }
+
+// outputsByLine sorts the outputs of a single config file in the order they
+// are declared.
+type outputsByLine []*RunningOutput
+
+func (ro outputsByLine) Len() int           { return len(ro) }
+func (ro outputsByLine) Swap(i, j int)      { ro[i], ro[j] = ro[j], ro[i] }
+func (ro outputsByLine) Less(i, j int) bool { return ro[i].Config.line < ro[j].Config.line }
+
+// bySequence sorts metrics by their gather order.
+type bySequence []Metric
+
+func (s bySequence) Len() int           { return len(s) }
+func (s bySequence) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s bySequence) Less(i, j int) bool { return s[i].Sequence() < s[j].Sequence() }
+
 func NewRunningOutput(
 	name string,
 	output Output,
@@ -55,11 +117,22 @@ func NewRunningOutput(
 		Config:            conf,
 		MetricBufferLimit: bufferLimit,
 		MetricBatchSize:   batchSize,
+		stopped:           make(chan struct{}),
 		MetricsWritten: Register(
 			"write",
 			"metrics_written",
 			map[string]string{"output": name},
 		),
+		MetricsDropped: Register(
+			"write",
+			"metrics_dropped",
+			map[string]string{"output": name},
+		),
+		WriteErrors: Register(
+			"write",
+			"write_errors",
+			map[string]string{"output": name},
+		),
 		BufferSize: Register(
 			"write",
 			"buffer_size",
@@ -70,18 +143,56 @@ func NewRunningOutput(
 			"buffer_limit",
 			map[string]string{"output": name},
 		),
+		BufferPeak: Register(
+			"write",
+			"buffer_high_water_mark",
+			map[string]string{"output": name},
+		),
 		WriteTime: RegisterTiming(
 			"write",
 			"write_time_ns",
 			map[string]string{"output": name},
 		),
 	}
+	ro.breaker = newOutputBreaker(name, conf.BreakerThreshold,
+		conf.BreakerBackoff, conf.BreakerMaxBackoff)
 	ro.BufferLimit.Incr(int64(ro.MetricBufferLimit))
+	ro.metrics.SetDroppedStat(ro.MetricsDropped)
+	ro.failMetrics.SetDroppedStat(ro.MetricsDropped)
 	return ro
 }
 
 // Write writes all cached points to this output.
 func (ro *RunningOutput) Write() error {
+	ro.flushMu.Lock()
+	defer ro.flushMu.Unlock()
+	return ro.flushBuffer()
+}
+
+// Flush writes the whole buffer of the output, a batch at a time, until it
+// is empty or a write fails. Write, as the agent calls it on each flush
+// interval, writes the failed metrics and a single batch of new ones.
+func (ro *RunningOutput) Flush() error {
+	ro.flushMu.Lock()
+	defer ro.flushMu.Unlock()
+
+	// bounded by the metrics buffered at the start, for inputs that keep
+	// the buffer from ever being empty
+	batches := (ro.failMetrics.Len()+ro.metrics.Len())/ro.MetricBatchSize + 1
+	for i := 0; i < batches; i++ {
+		if err := ro.flushBuffer(); err != nil {
+			return err
+		}
+		if ro.failMetrics.IsEmpty() && ro.metrics.IsEmpty() {
+			return nil
+		}
+	}
+	return nil
+}
+
+// flushBuffer writes the failed metrics and a batch of the new ones.
+// flushMu must be held.
+func (ro *RunningOutput) flushBuffer() error {
 	nFails, nMetrics := ro.failMetrics.Len(), ro.metrics.Len()
 	ro.BufferSize.Set(int64(nFails + nMetrics))
 	log.Printf("D! Output [%s] buffer fullness: %d / %d metrics. ",
@@ -106,7 +217,7 @@ func (ro *RunningOutput) Write() error {
 				err = ro.write(batch)
 			}
 			if err != nil {
-				ro.failMetrics.Add(batch...)
+				err = ro.retain(batch, err)
 			}
 		}
 	}
@@ -119,34 +230,298 @@ func (ro *RunningOutput) Write() error {
 	}
 
 	if err != nil {
+		if err = ro.retain(batch, err); err != nil {
+			return err
+		}
+	}
+
+	// the output is healthy again, so replay a segment of the metrics that
+	// were spilled to disk while it was down.
+	if ro.spill != nil && ro.failMetrics.IsEmpty() {
+		return ro.replaySpill()
+	}
+	return nil
+}
+
+// retain keeps the batch of a failed write in the buffer for a retry and
+// returns err, unless the output classified the error as not retryable, in
+// which case the batch is dropped and nil is returned. Of a batch that was
+// partly written, only the metrics left to retry are kept.
+func (ro *RunningOutput) retain(batch []Metric, err error) error {
+	if pe, ok := err.(*partialWriteError); ok {
+		if pe.dropped > 0 {
+			log.Printf("E! Output [%s] dropping %d metrics, the error is not "+
+				"retryable: %s", ro.Name, pe.dropped, pe.err)
+			ro.MetricsDropped.Incr(int64(pe.dropped))
+		}
+		if len(pe.retry) == 0 {
+			return nil
+		}
+		batch = pe.retry
+	}
+	if IsRetryable(err) {
 		ro.failMetrics.Add(batch...)
+		ro.observeBufferSize()
 		return err
 	}
+	log.Printf("E! Output [%s] dropping %d metrics, the error is not "+
+		"retryable: %s", ro.Name, len(batch), err)
+	ro.MetricsDropped.Incr(int64(len(batch)))
 	return nil
 }
 
-func (ro *RunningOutput) write(metrics []Metric) error {
+// observeBufferSize raises the high-water mark of the buffer to its current
+// size, if it is larger.
+func (ro *RunningOutput) observeBufferSize() {
+	size := int64(ro.failMetrics.Len() + ro.metrics.Len())
+	for {
+		peak := atomic.LoadInt64(&ro.bufferPeak)
+		if size <= peak {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&ro.bufferPeak, peak, size) {
+			ro.BufferPeak.Set(size)
+			return
+		}
+	}
+}
+
+// BufferHighWaterMark returns the largest number of metrics the output has
+// buffered since the start, or since the last ResetBufferHighWaterMark. It
+// is a guide to sizing metric_buffer_limit.
+func (ro *RunningOutput) BufferHighWaterMark() int {
+	return int(atomic.LoadInt64(&ro.bufferPeak))
+}
+
+// ResetBufferHighWaterMark restarts the high-water mark from the current
+// size of the buffer.
+func (ro *RunningOutput) ResetBufferHighWaterMark() {
+	size := int64(ro.failMetrics.Len() + ro.metrics.Len())
+	atomic.StoreInt64(&ro.bufferPeak, size)
+	ro.BufferPeak.Set(size)
+}
+
+// SetOverflowPolicy sets what happens to new metrics when the buffer of the
+// output is full, see the Overflow* constants.
+func (ro *RunningOutput) SetOverflowPolicy(policy string) {
+	ro.blockWhenFull = policy == OverflowBlock
+	ro.failMetrics.SetOverflowPolicy(policy)
+}
+
+// waitForRoom blocks until the buffer of the output can take another metric,
+// retrying the write every second while the output is failing, or once its
+// circuit breaker is to let writes through again. This applies backpressure
+// all the way back to the inputs, until the output is stopped.
+func (ro *RunningOutput) waitForRoom() {
+	warned := false
+	for ro.failMetrics.Len()+ro.metrics.Len() >= ro.MetricBufferLimit {
+		err := ro.Write()
+		if err == nil {
+			continue
+		}
+		if !warned {
+			log.Printf("W! Output [%s] buffer is full, blocking until "+
+				"writes succeed: %s", ro.Name, err)
+			warned = true
+		}
+		wait := time.Second
+		ro.Lock()
+		if retry, open := ro.breaker.retryIn(); open {
+			wait = retry
+		}
+		ro.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ro.stopped:
+			timer.Stop()
+			log.Printf("W! Output [%s] stopped with a full buffer, no longer "+
+				"blocking", ro.Name)
+			return
+		}
+	}
+}
+
+// Stop releases the inputs blocked on the full buffer of the output, see
+// waitForRoom, on shutdown. The metrics added afterwards overflow the buffer
+// as with drop_oldest.
+func (ro *RunningOutput) Stop() {
+	ro.stopOnce.Do(func() {
+		close(ro.stopped)
+	})
+}
+
+// isStopped reports whether Stop has been called.
+func (ro *RunningOutput) isStopped() bool {
+	select {
+	case <-ro.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetDisconnected marks an output whose first connection failed. Its metrics
+// are kept in the buffer, and the connection is retried before each write
+// until it succeeds.
+func (ro *RunningOutput) SetDisconnected() {
+	ro.Lock()
+	ro.disconnected = true
+	ro.Unlock()
+}
+
+// EnableSpill makes the output spill the metrics that overflow its buffer to
+// dir, using at most maxSize bytes of disk.
+func (ro *RunningOutput) EnableSpill(dir string, maxSize int64) error {
+	spill, err := NewSpill(dir, maxSize)
+	if err != nil {
+		return err
+	}
+	spill.SetDroppedStat(ro.MetricsDropped)
+	ro.spill = spill
+	ro.failMetrics.SetSpill(spill)
+	return nil
+}
+
+func (ro *RunningOutput) replaySpill() error {
+	metrics, err := ro.spill.Pop()
+	if err != nil {
+		log.Printf("E! Output [%s] could not read spilled metrics: %s",
+			ro.Name, err)
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	log.Printf("D! Output [%s] replaying %d spilled metrics",
+		ro.Name, len(metrics))
+	for len(metrics) > 0 {
+		n := min(len(metrics), ro.MetricBatchSize)
+		batch := metrics[:n]
+		metrics = metrics[n:]
+		if err := ro.write(batch); err != nil {
+			if err = ro.retain(batch, err); err != nil {
+				ro.failMetrics.Add(metrics...)
+				ro.observeBufferSize()
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ro *RunningOutput) write(metrics []Metric) (err error) {
 	nMetrics := len(metrics)
 	if nMetrics == 0 {
 		return nil
 	}
 	ro.Lock()
 	defer ro.Unlock()
+	if err = ro.breaker.allow(); err != nil {
+		return err
+	}
+	defer func() { ro.breaker.record(err) }()
+	if ro.PreserveOrder {
+		sort.Stable(bySequence(metrics))
+	}
+	if ro.disconnected {
+		if err := ro.Output.Connect(); err != nil {
+			ro.WriteErrors.Incr(1)
+			return fmt.Errorf("not connected: %s", err)
+		}
+		log.Printf("I! Output [%s] connected", ro.Name)
+		ro.disconnected = false
+	}
+	if ro.pending != nil {
+		select {
+		case <-ro.pending:
+			ro.pending = nil
+		default:
+			ro.WriteErrors.Incr(1)
+			return fmt.Errorf("a previous write that timed out is still running")
+		}
+	}
+
 	start := time.Now()
-	err := ro.Output.Write(metrics)
+	err = ro.writeWithTimeout(metrics)
 	elapsed := time.Since(start)
 	if err == nil {
 		log.Printf("D! Output [%s] wrote batch of %d metrics in %s\n",
 			ro.Name, nMetrics, elapsed)
 		ro.MetricsWritten.Incr(int64(nMetrics))
 		ro.WriteTime.Incr(elapsed.Nanoseconds())
+	} else {
+		ro.WriteErrors.Incr(1)
+		if pe, ok := err.(*partialWriteError); ok {
+			ro.MetricsWritten.Incr(int64(nMetrics - len(pe.retry) - pe.dropped))
+		}
 	}
 	return err
 }
 
+// writeWithTimeout writes metrics to the output, giving up after the
+// configured timeout. The write keeps running in the background, and no
+// other write is started until it returns. ro must be locked.
+func (ro *RunningOutput) writeWithTimeout(metrics []Metric) error {
+	timeout := ro.Config.Timeout
+	if timeout <= 0 {
+		return ro.Output.Write(metrics)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ro.Output.Write(metrics)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		ro.pending = done
+		return fmt.Errorf("write timed out after %s", timeout)
+	}
+}
+
 // OutputConfig containing name and filter
 type OutputConfig struct {
 	Name string
+
+	// Order sets the position of the output among the others, lowest first.
+	// Outputs with the same order are written concurrently.
+	Order int64
+	// line is the line of the output's table in its config file, it keeps
+	// outputs with the same order in declaration order.
+	line int
+	// hash identifies the settings of the output, see ConfigDiff.
+	hash uint64
+
+	// Timeout is how long a write may take before it is failed, 0 means no
+	// timeout.
+	Timeout time.Duration
+
+	// Precision truncates the timestamps of the metrics written to this
+	// output, 0 leaves them untouched.
+	Precision time.Duration
+
+	// SpillDir, when set, is the directory the metrics that overflow the
+	// buffer are written to, instead of being dropped.
+	SpillDir string
+	// SpillMaxSize is the maximum disk usage of SpillDir in bytes.
+	SpillMaxSize int64
+
+	// MetricBufferLimit, when positive, overrides the metric_buffer_limit
+	// of the agent for this output.
+	MetricBufferLimit int
+
+	// BreakerThreshold, when positive, is the number of consecutive failed
+	// writes that opens the circuit breaker of the output. The breaker stays
+	// open for BreakerBackoff, then twice as long after each failed try, up
+	// to BreakerMaxBackoff.
+	BreakerThreshold  int
+	BreakerBackoff    time.Duration
+	BreakerMaxBackoff time.Duration
 }
 
 // AddMetric adds a metric to the output. This function can also write cached
@@ -156,12 +531,30 @@ func (ro *RunningOutput) AddMetric(m Metric) {
 		return
 	}
 
+	if p := ro.Config.Precision; p > 0 && m.UnixNano()%int64(p) != 0 {
+		truncated, err := New(m.Name(), m.Tags(), m.Fields(),
+			m.Time().Truncate(p), m.Type())
+		if err != nil {
+			log.Printf("E! Output [%s] could not truncate metric: %s",
+				ro.Name, err)
+			return
+		}
+		truncated.SetAggregate(m.IsAggregate())
+		truncated.SetSequence(m.Sequence())
+		m = truncated
+	}
+
+	if ro.blockWhenFull && !ro.isStopped() {
+		ro.waitForRoom()
+	}
+
 	ro.metrics.Add(m)
+	ro.observeBufferSize()
 	if ro.metrics.Len() == ro.MetricBatchSize {
 		batch := ro.metrics.Batch(ro.MetricBatchSize)
 		err := ro.write(batch)
 		if err != nil {
-			ro.failMetrics.Add(batch...)
+			ro.retain(batch, err)
 		}
 	}
 }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// The states of the circuit breaker of an output, as reported by its
+// write/breaker_state stat.
+const (
+	// BreakerClosed lets every write through.
+	BreakerClosed = 0
+	// BreakerOpen fails the writes without trying them, until its backoff
+	// is over.
+	BreakerOpen = 1
+	// BreakerHalfOpen tries a write once the backoff is over, which closes
+	// the breaker if it succeeds and opens it again, for twice as long,
+	// if it fails.
+	BreakerHalfOpen = 2
+)
+
+// Defaults of breaker_backoff and breaker_max_backoff.
+const (
+	DEFAULT_BREAKER_BACKOFF     = 30 * time.Second
+	DEFAULT_BREAKER_MAX_BACKOFF = 10 * time.Minute
+)
+
+// outputBreaker stops an output that keeps failing from being written on
+// every flush, see breaker_threshold. It opens after threshold consecutive
+// failed writes, for backoff, and then for twice as long after each failed
+// try, up to maxBackoff. The metrics are kept in the buffer of the output
+// meanwhile. It is used under the lock of the output.
+type outputBreaker struct {
+	name       string
+	threshold  int
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	state    int
+	failures int
+	// wait is how long the breaker was last opened for, until when.
+	wait  time.Duration
+	until time.Time
+
+	stateStat Stat
+	// now is the source of time, a seam for tests.
+	now func() time.Time
+}
+
+// newOutputBreaker returns the breaker of the output name, nil when
+// threshold is 0, which disables it.
+func newOutputBreaker(name string, threshold int, backoff, maxBackoff time.Duration) *outputBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	if backoff <= 0 {
+		backoff = DEFAULT_BREAKER_BACKOFF
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DEFAULT_BREAKER_MAX_BACKOFF
+	}
+	if maxBackoff < backoff {
+		maxBackoff = backoff
+	}
+	return &outputBreaker{
+		name:       name,
+		threshold:  threshold,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+		stateStat: Register(
+			"write",
+			"breaker_state",
+			map[string]string{"output": name},
+		),
+		now: time.Now,
+	}
+}
+
+// breakerOpenError is the error of a write that the breaker did not let
+// through.
+type breakerOpenError struct {
+	retry time.Duration
+}
+
+func (e *breakerOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open, retrying in %s", e.retry)
+}
+
+// isBreakerOpen reports whether err is that of a write the breaker did not
+// let through.
+func isBreakerOpen(err error) bool {
+	_, ok := err.(*breakerOpenError)
+	return ok
+}
+
+// allow returns an error when the breaker is open, and turns it half-open
+// once its backoff is over.
+func (b *outputBreaker) allow() error {
+	if b == nil || b.state != BreakerOpen {
+		return nil
+	}
+	now := b.now()
+	if now.Before(b.until) {
+		return &breakerOpenError{retry: b.until.Sub(now)}
+	}
+	b.setState(BreakerHalfOpen)
+	return nil
+}
+
+// retryIn returns how long the breaker stays open, and whether it is.
+func (b *outputBreaker) retryIn() (time.Duration, bool) {
+	if b == nil || b.state != BreakerOpen {
+		return 0, false
+	}
+	return b.until.Sub(b.now()), true
+}
+
+// record updates the breaker with the result of a write it let through.
+// Only the retryable errors count as failures: an output that rejects a
+// batch is not broken, so a try that ends with any other error closes a
+// half-open breaker, as a success does.
+func (b *outputBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	if err == nil || !IsRetryable(err) {
+		if b.state != BreakerClosed {
+			log.Printf("I! Output [%s] is writing again, closing its circuit breaker",
+				b.name)
+		}
+		b.failures = 0
+		b.wait = 0
+		b.setState(BreakerClosed)
+		return
+	}
+
+	b.failures++
+	switch {
+	case b.state == BreakerHalfOpen:
+		b.open(b.wait * 2)
+	case b.failures >= b.threshold:
+		b.open(b.backoff)
+	}
+}
+
+// open opens the breaker for wait, at most maxBackoff.
+func (b *outputBreaker) open(wait time.Duration) {
+	if wait > b.maxBackoff {
+		wait = b.maxBackoff
+	}
+	b.wait = wait
+	b.until = b.now().Add(wait)
+	b.setState(BreakerOpen)
+	log.Printf("W! Output [%s] failed %d consecutive writes, opening its circuit "+
+		"breaker for %s", b.name, b.failures, wait)
+}
+
+func (b *outputBreaker) setState(state int) {
+	b.state = state
+	b.stateStat.Set(int64(state))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputBreakerBackoff(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	b := newOutputBreaker("mock", 2, 10*time.Second, time.Minute)
+	b.now = func() time.Time { return now }
+	down := errors.New("output down")
+
+	try := func(err error) error {
+		if err := b.allow(); err != nil {
+			return err
+		}
+		b.record(err)
+		return nil
+	}
+	expect := func(step string, state int, wait time.Duration) {
+		if b.state != state || b.wait != wait {
+			t.Fatalf("%s: expected state %d for %s, got %d for %s", step,
+				state, wait, b.state, b.wait)
+		}
+	}
+
+	try(down)
+	expect("first failure", BreakerClosed, 0)
+	try(down)
+	expect("threshold", BreakerOpen, 10*time.Second)
+	if err := try(nil); !isBreakerOpen(err) {
+		t.Fatalf("expected the write to be refused, got %v", err)
+	}
+
+	now = now.Add(10 * time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatal(err)
+	}
+	expect("backoff over", BreakerHalfOpen, 10*time.Second)
+	b.record(down)
+	expect("failed try", BreakerOpen, 20*time.Second)
+
+	now = now.Add(15 * time.Second)
+	if err := try(nil); !isBreakerOpen(err) {
+		t.Fatalf("expected the write to be refused, got %v", err)
+	}
+	now = now.Add(5 * time.Second)
+	try(nil)
+	expect("successful try", BreakerClosed, 0)
+	if b.failures != 0 {
+		t.Errorf("expected the failures reset, got %d", b.failures)
+	}
+}
+
+func TestOutputBreakerClosesOnFatalError(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	b := newOutputBreaker("mock", 1, time.Second, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.record(errors.New("output down"))
+	now = now.Add(time.Second)
+	if err := b.allow(); err != nil || b.state != BreakerHalfOpen {
+		t.Fatalf("expected the breaker half-open, got %d %v", b.state, err)
+	}
+	// the output answered, rejecting the batch
+	b.record(NewFatalWriteError(errors.New("bad request")))
+	if b.state != BreakerClosed {
+		t.Errorf("expected the breaker closed, got %d", b.state)
+	}
+}
+
+func TestBuildOutputBreakerTypes(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{`breaker_threshold = 5
+		  breaker_backoff = "30s"
+		  breaker_max_backoff = "10m"`, ""},
+		{`breaker_threshold = "5"`, "breaker_threshold must be an integer"},
+		{`breaker_threshold = -1`, "invalid breaker_threshold"},
+		{`breaker_backoff = 30`, "breaker_backoff must be a duration"},
+		{`breaker_max_backoff = 600`, "breaker_max_backoff must be a duration"},
+		{`breaker_backoff = "soon"`, "invalid breaker_backoff"},
+	}
+	for _, tt := range tests {
+		tbl, err := parseContents([]byte(tt.config), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		oc, err := buildOutput("mock", tbl)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %s", tt.config, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: expected the error %q, got %v", tt.config, tt.err, err)
+		case tt.err == "" && (oc.BreakerThreshold != 5 ||
+			oc.BreakerBackoff != 30*time.Second ||
+			oc.BreakerMaxBackoff != 10*time.Minute):
+			t.Errorf("%s: unexpected settings %+v", tt.config, oc)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockOutput records the metrics written to it, and fails the writes while
+// fail is set.
+type mockOutput struct {
+	sync.Mutex
+	fail    bool
+	writes  int
+	metrics []Metric
+}
+
+func (m *mockOutput) Connect() error       { return nil }
+func (m *mockOutput) Close() error         { return nil }
+func (m *mockOutput) Description() string  { return "" }
+func (m *mockOutput) SampleConfig() string { return "" }
+
+func (m *mockOutput) Write(metrics []Metric) error {
+	m.Lock()
+	defer m.Unlock()
+	m.writes++
+	if m.fail {
+		return errors.New("output down")
+	}
+	m.metrics = append(m.metrics, metrics...)
+	return nil
+}
+
+func (m *mockOutput) setFail(fail bool) {
+	m.Lock()
+	m.fail = fail
+	m.Unlock()
+}
+
+func (m *mockOutput) written() int {
+	m.Lock()
+	defer m.Unlock()
+	return len(m.metrics)
+}
+
+// addBlocked adds a metric to ro in the background, the channel is closed
+// once AddMetric returns.
+func addBlocked(ro *RunningOutput, m Metric) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		ro.AddMetric(m)
+		close(done)
+	}()
+	return done
+}
+
+func TestRunningOutputBlockReleasedOnStop(t *testing.T) {
+	out := &mockOutput{fail: true}
+	ro := NewRunningOutput("mock", out, &OutputConfig{Name: "mock"}, 10, 2)
+	ro.SetOverflowPolicy(OverflowBlock)
+	metrics := testMetrics(t, "a", "b", "c")
+	ro.AddMetric(metrics[0])
+	ro.AddMetric(metrics[1])
+
+	done := addBlocked(ro, metrics[2])
+	select {
+	case <-done:
+		t.Fatal("expected AddMetric to block on the full buffer")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ro.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AddMetric still blocked after Stop")
+	}
+}
+
+func TestRunningOutputBlockWaitsForBreaker(t *testing.T) {
+	out := &mockOutput{fail: true}
+	ro := NewRunningOutput("mock", out, &OutputConfig{Name: "mock"}, 10, 2)
+	ro.SetOverflowPolicy(OverflowBlock)
+	ro.breaker = newOutputBreaker("mock", 1, 50*time.Millisecond, time.Second)
+	metrics := testMetrics(t, "a", "b", "c")
+	ro.AddMetric(metrics[0])
+	ro.AddMetric(metrics[1])
+
+	// the first write fails and opens the breaker, the output is up again
+	// by the time it lets a write through
+	done := addBlocked(ro, metrics[2])
+	time.Sleep(10 * time.Millisecond)
+	out.setFail(false)
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		ro.Stop()
+		t.Fatal("expected AddMetric to return once the breaker let a write through")
+	}
+	if n := out.written(); n != 2 {
+		t.Errorf("expected 2 metrics written, got %d", n)
+	}
+}
+
+func TestRunningOutputPreserveOrder(t *testing.T) {
+	const inputs, perInput = 4, 100
+	var wg sync.WaitGroup
+	chans := make([]chan Metric, inputs)
+	for i := range chans {
+		chans[i] = make(chan Metric, perInput)
+		wg.Add(1)
+		go func(metricC chan Metric) {
+			defer wg.Done()
+			acc := NewAccumulator(NewRunningInput(&serviceInput{},
+				&InputConfig{Name: "order"}), metricC)
+			acc.sequenced = true
+			for n := 0; n < perInput; n++ {
+				acc.AddFields("order", map[string]interface{}{"n": int64(n)}, nil)
+			}
+			close(metricC)
+		}(chans[i])
+	}
+	wg.Wait()
+
+	// the buffer receives the metrics of each input in turn, reversed
+	var metrics []Metric
+	for _, metricC := range chans {
+		for m := range metricC {
+			metrics = append([]Metric{m.Copy()}, metrics...)
+		}
+	}
+	out := &mockOutput{}
+	ro := NewRunningOutput("mock", out, &OutputConfig{Name: "mock"},
+		inputs*perInput, inputs*perInput)
+	ro.PreserveOrder = true
+	for _, m := range metrics {
+		ro.AddMetric(m)
+	}
+	if err := ro.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.metrics) != inputs*perInput {
+		t.Fatalf("expected %d metrics, got %d", inputs*perInput, len(out.metrics))
+	}
+	for i, m := range out.metrics {
+		if seq := m.Sequence(); seq == 0 || i > 0 && seq <= out.metrics[i-1].Sequence() {
+			t.Fatalf("metric %d: out of order sequence %d", i, seq)
+		}
+	}
+}
+
+// slowOutput is a mockOutput whose writes wait for release to be closed.
+type slowOutput struct {
+	mockOutput
+	release chan struct{}
+}
+
+func (s *slowOutput) Write(metrics []Metric) error {
+	<-s.release
+	return s.mockOutput.Write(metrics)
+}
+
+func TestRunningOutputWriteTimeout(t *testing.T) {
+	out := &slowOutput{release: make(chan struct{})}
+	ro := NewRunningOutput("slow", out,
+		&OutputConfig{Name: "slow", Timeout: 20 * time.Millisecond}, 10, 100)
+	m, _ := New("cpu", nil, map[string]interface{}{"usage": 1.0}, time.Now())
+	ro.AddMetric(m)
+
+	start := time.Now()
+	if err := ro.Write(); err == nil {
+		t.Fatal("expected the slow write to time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the write to give up after its timeout, took %s", elapsed)
+	}
+	// no other write is started while the slow one runs
+	if err := ro.Write(); err == nil {
+		t.Fatal("expected a write to fail while the timed out one is running")
+	}
+
+	close(out.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for out.written() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the slow write never completed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// the metric of the timed out write was kept, and is retried
+	if err := ro.Write(); err != nil {
+		t.Fatalf("expected the write to succeed once the output recovered, got %s", err)
+	}
+	if n := out.written(); n != 2 {
+		t.Errorf("expected the metric to be retried, got %d writes", n)
+	}
+}
+
+func TestRunningOutputBufferHighWaterMark(t *testing.T) {
+	out := &mockOutput{fail: true}
+	ro := NewRunningOutput("peak", out, &OutputConfig{Name: "peak"}, 100, 1000)
+	add := func(n int) {
+		for i := 0; i < n; i++ {
+			m, _ := New("cpu", nil, map[string]interface{}{"n": int64(i)}, time.Now())
+			ro.AddMetric(m)
+		}
+	}
+	check := func(when string, want int) {
+		if peak := ro.BufferHighWaterMark(); peak != want {
+			t.Errorf("%s: expected a high-water mark of %d, got %d", when, want, peak)
+		}
+		if peak := ro.BufferPeak.Get(); peak != int64(want) {
+			t.Errorf("%s: expected the buffer_peak stat at %d, got %d", when, want, peak)
+		}
+	}
+
+	check("empty", 0)
+	add(5)
+	check("filled", 5)
+	// the failed batch is retained, the buffer is as full as before
+	if err := ro.Write(); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	check("failed write", 5)
+
+	out.setFail(false)
+	if err := ro.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if out.written() != 5 {
+		t.Fatalf("expected the buffer to be drained, got %d written", out.written())
+	}
+	check("drained", 5)
+	add(3)
+	check("refilled below the peak", 5)
+
+	ro.ResetBufferHighWaterMark()
+	check("reset", 3)
+	add(4)
+	check("refilled after the reset", 7)
+}
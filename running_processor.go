@@ -0,0 +1,119 @@
+package main
+
+import (
+	"log"
+	"runtime"
+	"sync"
+)
+
+// The on_panic settings of the processors.
+const (
+	// ProcessorPanicPass passes the metrics on as the processor that
+	// panicked left them, it may have changed some of them.
+	ProcessorPanicPass = "pass"
+	// ProcessorPanicPassOriginal passes them on as they were given to the
+	// processor, at the cost of a copy of every metric on every call.
+	ProcessorPanicPassOriginal = "pass_original"
+	// ProcessorPanicDrop drops them.
+	ProcessorPanicDrop = "drop"
+)
+
+type RunningProcessor struct {
+	Name string
+
+	sync.Mutex
+	Processor Processor
+	Config    *ProcessorConfig
+
+	// Panics counts the calls to the processor that panicked, it is
+	// registered on the first one.
+	Panics Stat
+}
+
+type RunningProcessors []*RunningProcessor
+
+func (rp RunningProcessors) Len() int           { return len(rp) }
+func (rp RunningProcessors) Swap(i, j int)      { rp[i], rp[j] = rp[j], rp[i] }
+func (rp RunningProcessors) Less(i, j int) bool { return rp[i].Config.Order < rp[j].Config.Order }
+
+// processorsByLine sorts the processors of a single config file in the order
+// they are declared.
+type processorsByLine []*RunningProcessor
+
+func (rp processorsByLine) Len() int           { return len(rp) }
+func (rp processorsByLine) Swap(i, j int)      { rp[i], rp[j] = rp[j], rp[i] }
+func (rp processorsByLine) Less(i, j int) bool { return rp[i].Config.line < rp[j].Config.line }
+
+// ProcessorConfig containing a name and order
+type ProcessorConfig struct {
+	Name  string
+	Order int64
+
+	// OnPanic is what happens to the metrics of a call to the processor
+	// that panics, see the ProcessorPanic* constants.
+	OnPanic string
+
+	// orderSet is set when the order is given in the config rather than
+	// defaulted to 0.
+	orderSet bool
+	// line is the line of the processor's table in its config file, it keeps
+	// processors with the same order in declaration order.
+	line int
+}
+
+// Apply runs the processor on the metrics. When it panics, the metrics are
+// passed on or dropped, according to on_panic, rather than lost along with
+// the agent.
+func (rp *RunningProcessor) Apply(in ...Metric) (out []Metric) {
+	rp.Lock()
+	defer rp.Unlock()
+
+	// the processor may change the metrics in place before panicking, only
+	// pass_original pays for a copy to pass on
+	orig := in
+	switch rp.Config.OnPanic {
+	case ProcessorPanicDrop:
+		orig = nil
+	case ProcessorPanicPassOriginal:
+		orig = make([]Metric, len(in))
+		for i, m := range in {
+			orig[i] = m.Copy()
+			orig[i].SetAggregate(m.IsAggregate())
+		}
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			rp.recovered(err)
+			out = orig
+		}
+	}()
+	return rp.Processor.Apply(in...)
+}
+
+// recovered logs the first panic of the processor with its stack, and counts
+// every panic.
+func (rp *RunningProcessor) recovered(err interface{}) {
+	if rp.Panics == nil {
+		rp.Panics = Register("processor", "panics",
+			map[string]string{"processor": rp.Name})
+		trace := make([]byte, 2048)
+		trace = trace[:runtime.Stack(trace, false)]
+		log.Printf("E! Processor [%s] panicked, its metrics are %s and "+
+			"further panics are only logged in debug: %s, Stack:\n%s\n",
+			rp.Name, onPanicVerb(rp.Config.OnPanic), err, trace)
+	} else {
+		log.Printf("D! Processor [%s] panicked: %s", rp.Name, err)
+	}
+	rp.Panics.Incr(1)
+}
+
+func onPanicVerb(onPanic string) string {
+	switch onPanic {
+	case ProcessorPanicDrop:
+		return "dropped"
+	case ProcessorPanicPassOriginal:
+		return "passed on unmodified"
+	}
+	return "passed on"
+}
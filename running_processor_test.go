@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+// panicProcessor changes the metrics it is given, then panics.
+type panicProcessor struct{}
+
+func (p *panicProcessor) SampleConfig() string { return "" }
+func (p *panicProcessor) Description() string  { return "" }
+
+func (p *panicProcessor) Apply(in ...Metric) []Metric {
+	for _, m := range in {
+		m.AddField("changed", true)
+	}
+	panic("boom")
+}
+
+func TestRunningProcessorOnPanic(t *testing.T) {
+	tests := []struct {
+		onPanic string
+		n       int
+		changed bool
+	}{
+		{ProcessorPanicPass, 2, true},
+		{ProcessorPanicPassOriginal, 2, false},
+		{ProcessorPanicDrop, 0, false},
+	}
+	for _, tt := range tests {
+		rp := &RunningProcessor{
+			Name:      "panic_" + tt.onPanic,
+			Processor: &panicProcessor{},
+			Config:    &ProcessorConfig{Name: "panic", OnPanic: tt.onPanic},
+		}
+		out := rp.Apply(testMetrics(t, "a", "b")...)
+		if len(out) != tt.n {
+			t.Errorf("%s: expected %d metrics, got %d", tt.onPanic, tt.n, len(out))
+			continue
+		}
+		for _, m := range out {
+			if _, ok := m.Fields()["changed"]; ok != tt.changed {
+				t.Errorf("%s: expected changed %v, got %v", tt.onPanic,
+					tt.changed, m.Fields())
+			}
+		}
+		if n := rp.Panics.Get(); n != 1 {
+			t.Errorf("%s: expected 1 panic counted, got %d", tt.onPanic, n)
+		}
+	}
+}
@@ -114,7 +114,7 @@ func Metrics() []Metric {
 		}
 	}
 	registry.mu.Unlock()
-	return metrics
+	return metrics[:i]
 }
 
 type rgstry struct {
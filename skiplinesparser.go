@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+)
+
+// SkipLinesParser discards the first Skip lines of every buffer, ie, the
+// column names or banner that a command prints before its data, and parses
+// the rest with Parser. ParseLine, which is given a single line, is left to
+// Parser.
+type SkipLinesParser struct {
+	Parser
+	Skip int
+}
+
+func (p *SkipLinesParser) Parse(buf []byte) ([]Metric, error) {
+	for n := 0; n < p.Skip && len(buf) > 0; n++ {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			buf = nil
+			break
+		}
+		buf = buf[i+1:]
+	}
+	if len(buf) == 0 {
+		return []Metric{}, nil
+	}
+	return p.Parser.Parse(buf)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSkipLinesParser(t *testing.T) {
+	parser, err := NewParser(&ParserConfig{DataFormat: "influx", SkipLines: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		in    string
+		names []string
+	}{
+		{"NAME VALUE\n---- -----\ncpu value=1 0\nmem value=2 0\n", []string{"cpu", "mem"}},
+		{"NAME VALUE\n---- -----\n", nil},
+		{"NAME VALUE\n---- -----", nil},
+		{"NAME VALUE", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		metrics, err := parser.Parse([]byte(tt.in))
+		if err != nil {
+			t.Errorf("Parse(%q) returned error %s", tt.in, err)
+			continue
+		}
+		if len(metrics) != len(tt.names) {
+			t.Errorf("Parse(%q): expected %d metrics, got %d", tt.in,
+				len(tt.names), len(metrics))
+			continue
+		}
+		for n, m := range metrics {
+			if m.Name() != tt.names[n] {
+				t.Errorf("Parse(%q): expected metric %s, got %s", tt.in,
+					tt.names[n], m.Name())
+			}
+		}
+	}
+
+	// ParseLine is given a single line, that is never a header
+	m, err := parser.ParseLine("cpu value=1 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.Name() != "cpu" {
+		t.Errorf("expected ParseLine to parse cpu, got %v", m)
+	}
+}
+
+func TestSkipLinesConfig(t *testing.T) {
+	err := loadConfigString(t, NewConfig(), `
+[[inputs.exec]]
+  commands = ["true"]
+  data_format = "influx"
+  skip_lines = -1
+`)
+	if err == nil {
+		t.Error("expected a negative skip_lines to be an error")
+	}
+}
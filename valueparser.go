@@ -3,57 +3,318 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"log"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 )
 
 type ValueParser struct {
+	// LinesSkipped counts the lines skipped for exceeding MaxLineSize. It
+	// is updated atomically, as parsers are shared by the gathers, and is
+	// first for its 64-bit alignment on 32-bit platforms.
+	LinesSkipped int64
+
 	MetricName  string
 	DataType    string
 	DefaultTags map[string]string
+	// DefaultTagsByMetric holds extra default tags by metric name, they are
+	// merged into DefaultTags for the metrics of that name and take
+	// precedence over them.
+	DefaultTagsByMetric map[string]map[string]string
+
+	// FieldName is the key of the parsed field, defaults to "value".
+	FieldName string
+
+	// KeepRaw, when set, adds the buffer as it was read, untrimmed, as a
+	// string field, to help diagnose parsing issues.
+	KeepRaw bool
+	// RawField is the key of the raw field, defaults to "raw".
+	RawField string
+
+	// Clock timestamps the parsed metrics, defaults to RealClock.
+	Clock Clock
+
+	// DurationUnit is the unit that "duration" values are counted in,
+	// defaults to seconds.
+	DurationUnit time.Duration
+
+	// DecimalSeparator is the decimal separator of numbers, defaults to ".".
+	DecimalSeparator string
+	// ThousandsSeparator, when set, is removed from numbers before parsing.
+	ThousandsSeparator string
+
+	// StringFieldRegex, when set, extracts the value of the "string" data
+	// type from the buffer as its first capture group.
+	StringFieldRegex *regexp.Regexp
+
+	// FieldSeparator splits the buffer into fields, of which the last is
+	// the value, defaults to any whitespace.
+	FieldSeparator string
+	// StrictSingleValue makes a buffer of more than one field an error,
+	// rather than keeping its last field, to catch malformed command
+	// output. It does not apply to the "string" data type.
+	StrictSingleValue bool
+
+	// MaxLineSize, when positive, is the length in bytes above which a line
+	// of the buffer is skipped, so that a runaway command printing a huge
+	// line does not exhaust memory.
+	MaxLineSize int
+
+	// UniqueTimestamps makes the time of each metric strictly later than
+	// that of the previous one, advancing it by a nanosecond when the clock
+	// has not, so that metrics parsed in a burst are separate points of
+	// their series rather than overwriting each other in InfluxDB.
+	UniqueTimestamps bool
+	lastTimeMu       sync.Mutex
+	lastTime         time.Time
+}
+
+// uniqueTime returns t, or the nanosecond after the time of the previous
+// metric if t is not later.
+func (v *ValueParser) uniqueTime(t time.Time) time.Time {
+	v.lastTimeMu.Lock()
+	defer v.lastTimeMu.Unlock()
+	if !t.After(v.lastTime) {
+		t = v.lastTime.Add(time.Nanosecond)
+	}
+	v.lastTime = t
+	return t
+}
+
+// SkippedLines returns the number of lines skipped for exceeding
+// MaxLineSize so far.
+func (v *ValueParser) SkippedLines() int64 {
+	return atomic.LoadInt64(&v.LinesSkipped)
+}
+
+// dropLongLines returns buf without the lines longer than MaxLineSize.
+func (v *ValueParser) dropLongLines(buf []byte) []byte {
+	if v.MaxLineSize <= 0 || len(buf) <= v.MaxLineSize {
+		return buf
+	}
+
+	kept := make([]byte, 0, v.MaxLineSize)
+	for len(buf) > 0 {
+		line := buf
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+			line = buf[:i+1]
+		}
+		buf = buf[len(line):]
+
+		if len(bytes.TrimRight(line, "\r\n")) > v.MaxLineSize {
+			skipped := atomic.AddInt64(&v.LinesSkipped, 1)
+			log.Printf("W! Measurement [%s] skipping line of %d bytes, longer than "+
+				"max_line_size %d (%d lines skipped)",
+				v.MetricName, len(line), v.MaxLineSize, skipped)
+			continue
+		}
+		kept = append(kept, line...)
+	}
+	return kept
+}
+
+// splitFields splits s into its non-empty fields, around FieldSeparator or
+// whitespace.
+func (v *ValueParser) splitFields(s string) []string {
+	if v.FieldSeparator == "" {
+		return strings.Fields(s)
+	}
+	var fields []string
+	for _, f := range strings.Split(s, v.FieldSeparator) {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// normalizeNumber strips the thousands separator from a number and replaces
+// its decimal separator with a ".", so that strconv can parse it.
+func (v *ValueParser) normalizeNumber(s string) string {
+	if v.ThousandsSeparator != "" {
+		s = strings.Replace(s, v.ThousandsSeparator, "", -1)
+	}
+	if v.DecimalSeparator != "" && v.DecimalSeparator != "." {
+		s = strings.Replace(s, v.DecimalSeparator, ".", -1)
+	}
+	return s
 }
 
 func (v *ValueParser) Parse(buf []byte) ([]Metric, error) {
+	metric, _, err := v.ParseWithType(buf)
+	if err != nil {
+		return nil, err
+	}
+	if metric == nil {
+		return []Metric{}, nil
+	}
+	return []Metric{metric}, nil
+}
+
+// ParseWithType is the same as Parse, but also returns the name of the type
+// that the value was parsed as: "int", "float", "string", "bool" or
+// "duration". This is mostly useful with the "auto" data type, which picks the
+// first of int, float and bool that the value parses as, or string otherwise.
+// The metric is nil if the buffer holds no value.
+func (v *ValueParser) ParseWithType(buf []byte) (Metric, string, error) {
+	raw := buf
+	buf = v.dropLongLines(buf)
 	vStr := string(bytes.TrimSpace(bytes.Trim(buf, "\x00")))
 
 	// unless it's a string, separate out any fields in the buffer,
-	// ignore anything but the last.
-	if v.DataType != "string" {
-		values := strings.Fields(vStr)
+	// ignore anything but the last. The common buffer of a single value,
+	// without interior whitespace, is its own last field, and is not split
+	// so as not to allocate the fields on every line of a high rate input.
+	if vStr == "" && v.DataType != "string" {
+		return nil, "", nil
+	}
+	if v.DataType != "string" &&
+		(v.FieldSeparator != "" || strings.IndexFunc(vStr, unicode.IsSpace) >= 0) {
+		values := v.splitFields(vStr)
 		if len(values) < 1 {
-			return []Metric{}, nil
+			return nil, "", nil
+		}
+		if v.StrictSingleValue && len(values) > 1 {
+			return nil, "", fmt.Errorf("expected a single value, got %d: %q",
+				len(values), vStr)
 		}
-		vStr = string(values[len(values)-1])
+		vStr = values[len(values)-1]
 	}
 
 	var value interface{}
+	var valueType string
 	var err error
 	switch v.DataType {
 	case "", "int", "integer":
-		value, err = strconv.Atoi(vStr)
+		valueType = "int"
+		value, err = strconv.Atoi(v.normalizeNumber(vStr))
 	case "float", "long":
-		value, err = strconv.ParseFloat(vStr, 64)
+		valueType = "float"
+		value, err = strconv.ParseFloat(v.normalizeNumber(vStr), 64)
 	case "str", "string":
+		valueType = "string"
 		value = vStr
+		if v.StringFieldRegex != nil {
+			match := v.StringFieldRegex.FindStringSubmatch(vStr)
+			if match == nil {
+				err = fmt.Errorf("value %q does not match string_field_regex", vStr)
+			} else {
+				value = match[1]
+			}
+		}
 	case "bool", "boolean":
+		valueType = "bool"
 		value, err = strconv.ParseBool(vStr)
+	case "duration":
+		valueType = "duration"
+		var d time.Duration
+		d, err = parseDuration(vStr)
+		unit := v.DurationUnit
+		if unit <= 0 {
+			unit = time.Second
+		}
+		value = int64(d / unit)
+	case "auto":
+		value, valueType = v.inferValue(vStr)
+	default:
+		return nil, "", unsupportedDataTypeError(v.DataType)
 	}
 	if err != nil {
-		return nil, err
+		return nil, valueType, err
 	}
 
-	fields := map[string]interface{}{"value": value}
-	metric, err := New(v.MetricName, v.DefaultTags,
-		fields, time.Now().UTC())
+	fieldName := v.FieldName
+	if fieldName == "" {
+		fieldName = "value"
+	}
+	fields := map[string]interface{}{fieldName: value}
+	if v.KeepRaw {
+		rawField := v.RawField
+		if rawField == "" {
+			rawField = "raw"
+		}
+		fields[rawField] = string(raw)
+	}
+	if !dropNonFinite(v.MetricName, fields) {
+		return nil, valueType, nil
+	}
+	clock := v.Clock
+	if clock == nil {
+		clock = RealClock
+	}
+	now := clock.Now().UTC()
+	if v.UniqueTimestamps {
+		now = v.uniqueTime(now)
+	}
+	metric, err := New(v.MetricName, v.defaultTags(v.MetricName),
+		fields, now)
 	if err != nil {
-		return nil, err
+		return nil, valueType, err
 	}
 
-	return []Metric{metric}, nil
+	return metric, valueType, nil
+}
+
+// valueDataTypes are the data types that the value parser accepts, aliases
+// included.
+var valueDataTypes = []string{"", "int", "integer", "float", "long", "str",
+	"string", "bool", "boolean", "duration", "auto"}
+
+// unsupportedDataTypeError is the error of a data type that the value parser
+// does not know, so that it is not parsed into a nil field.
+func unsupportedDataTypeError(dataType string) error {
+	return fmt.Errorf("unsupported data_type %q for data format value, "+
+		"must be one of integer, float, string, boolean, duration or auto",
+		dataType)
+}
+
+// defaultTags returns the default tags of the metrics called name.
+func (v *ValueParser) defaultTags(name string) map[string]string {
+	extra, ok := v.DefaultTagsByMetric[name]
+	if !ok {
+		return v.DefaultTags
+	}
+	tags := make(map[string]string, len(v.DefaultTags)+len(extra))
+	for k, val := range v.DefaultTags {
+		tags[k] = val
+	}
+	for k, val := range extra {
+		tags[k] = val
+	}
+	return tags
+}
+
+// inferValue parses s as the first of int, float and bool that it is valid
+// for, falling back to a string.
+func (v *ValueParser) inferValue(s string) (interface{}, string) {
+	return inferValue(s, v.normalizeNumber(s))
+}
+
+// inferValue parses s as the first of int, float and bool that it is valid
+// for, falling back to a string, and returns the name of that type. The
+// numbers are parsed from n, which is s with its separators normalized.
+func inferValue(s, n string) (interface{}, string) {
+	if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+		return i, "int"
+	}
+	if f, err := strconv.ParseFloat(n, 64); err == nil {
+		return f, "float"
+	}
+	if b, err := strconv.ParseBool(s); err == nil {
+		return b, "bool"
+	}
+	return s, "string"
 }
 
 func (v *ValueParser) ParseLine(line string) (Metric, error) {
+	if blankLine(line) {
+		return nil, nil
+	}
 	metrics, err := v.Parse([]byte(line))
 
 	if err != nil {
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValueParserCountsSkippedLinesConcurrently(t *testing.T) {
+	v := &ValueParser{MetricName: "exec", DataType: "integer", MaxLineSize: 8}
+	buf := []byte(strings.Repeat("9", 20) + "\n42\n")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := v.Parse(buf); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := v.SkippedLines(); n != 80 {
+		t.Errorf("expected 80 skipped lines, got %d", n)
+	}
+}
+
+// TestValueParserFastPathParity checks that a buffer of a single value,
+// which is not split, parses the same as when it is the last of several
+// fields, split with strings.Fields.
+func TestValueParserFastPathParity(t *testing.T) {
+	buffers := []string{"123456\n", "42", "12\x00\x00", "-7\r\n", "1,234",
+		"3.5", "1e3", "true", "abc", "NaN", "+Inf", "1m30s", "0x10",
+		"99999999999999999999"}
+	for _, dataType := range []string{"integer", "float", "boolean", "duration", "auto"} {
+		for _, buf := range buffers {
+			v := &ValueParser{MetricName: "exec", DataType: dataType,
+				ThousandsSeparator: ","}
+			fast, fastType, fastErr := v.ParseWithType([]byte(buf))
+			split, splitType, splitErr := v.ParseWithType([]byte("first second " + buf))
+
+			name := fmt.Sprintf("%s %q", dataType, buf)
+			if (fastErr != nil) != (splitErr != nil) || fastType != splitType {
+				t.Errorf("%s: got %s %v and %s %v", name, fastType, fastErr,
+					splitType, splitErr)
+				continue
+			}
+			if (fast == nil) != (split == nil) {
+				t.Errorf("%s: got %v and %v", name, fast, split)
+				continue
+			}
+			if fast != nil && !reflect.DeepEqual(fast.Fields(), split.Fields()) {
+				t.Errorf("%s: got %v and %v", name, fast.Fields(), split.Fields())
+			}
+		}
+	}
+}
+
+func BenchmarkValueParserSingleValue(b *testing.B) {
+	v := &ValueParser{MetricName: "exec", DataType: "integer"}
+	buf := []byte("123456\n")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v.Parse(buf)
+	}
+}
+
+func BenchmarkValueParserFields(b *testing.B) {
+	v := &ValueParser{MetricName: "exec", DataType: "integer"}
+	buf := []byte("used 123456\n")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v.Parse(buf)
+	}
+}
+
+func TestValueParserDefaultTagsByMetric(t *testing.T) {
+	byMetric := map[string]map[string]string{
+		"disk": {"unit": "bytes", "dc": "west"},
+		"load": {"unit": "ratio"},
+	}
+	tests := []struct {
+		name string
+		tags map[string]string
+	}{
+		{"disk", map[string]string{"dc": "west", "host": "web1", "unit": "bytes"}},
+		{"load", map[string]string{"dc": "east", "host": "web1", "unit": "ratio"}},
+		{"cpu", map[string]string{"dc": "east", "host": "web1"}},
+	}
+	for _, tt := range tests {
+		v := &ValueParser{
+			MetricName:          tt.name,
+			DataType:            "integer",
+			DefaultTags:         map[string]string{"host": "web1", "dc": "east"},
+			DefaultTagsByMetric: byMetric,
+		}
+		m, err := v.ParseLine("42")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m.Tags(), tt.tags) {
+			t.Errorf("%s: expected the tags %v, got %v", tt.name, tt.tags, m.Tags())
+		}
+	}
+}
+
+func TestValueParserDuration(t *testing.T) {
+	tests := []struct {
+		buf  string
+		unit time.Duration
+		want int64
+	}{
+		{"90s", 0, 90},
+		{"1h23m", 0, 4980},
+		{"1h23m", time.Minute, 83},
+		{"1500ms", time.Millisecond, 1500},
+		{"45", 0, 45},
+	}
+	for _, tt := range tests {
+		v := &ValueParser{MetricName: "uptime", DataType: "duration",
+			DurationUnit: tt.unit}
+		m, err := v.ParseLine(tt.buf)
+		if err != nil {
+			t.Errorf("%s: %s", tt.buf, err)
+			continue
+		}
+		if got := m.Fields()["value"]; got != tt.want {
+			t.Errorf("%s in %s: expected %d, got %v", tt.buf, tt.unit, tt.want, got)
+		}
+	}
+
+	v := &ValueParser{MetricName: "uptime", DataType: "duration"}
+	if m, err := v.ParseLine("1h23x"); err == nil {
+		t.Errorf("expected an error for an invalid duration, got %v", m)
+	}
+}
+
+func TestValueParserNormalizeNumber(t *testing.T) {
+	tests := []struct {
+		decimal, thousands string
+		dataType           string
+		buf                string
+		want               interface{}
+	}{
+		{",", "", "float", "3,14", 3.14},
+		{",", ".", "float", "1.234.567,89", 1234567.89},
+		{",", ".", "integer", "1.234.567", int64(1234567)},
+		{"", ",", "integer", "1,234,567", int64(1234567)},
+		{"", ",", "float", "1,234.5", 1234.5},
+		{"", "", "float", "1234.5", 1234.5},
+		{".", "", "float", "3.14", 3.14},
+		{",", ".", "auto", "2,5", 2.5},
+	}
+	for _, tt := range tests {
+		v := &ValueParser{MetricName: "exec", DataType: tt.dataType,
+			DecimalSeparator: tt.decimal, ThousandsSeparator: tt.thousands}
+		m, err := v.ParseLine(tt.buf)
+		if err != nil {
+			t.Errorf("%s: %s", tt.buf, err)
+			continue
+		}
+		if got := m.Fields()["value"]; got != tt.want {
+			t.Errorf("%s with %q and %q: expected %v, got %v", tt.buf, tt.decimal,
+				tt.thousands, tt.want, got)
+		}
+	}
+
+	// with a comma decimal separator, a dotted number is not a float
+	v := &ValueParser{MetricName: "exec", DataType: "float", DecimalSeparator: ","}
+	if m, err := v.ParseLine("1.234,5"); err == nil {
+		t.Errorf("expected an error, got %v", m)
+	}
+}
+
+func TestValueParserReportsType(t *testing.T) {
+	tests := []struct {
+		dataType string
+		buf      string
+		want     string
+		value    interface{}
+	}{
+		{"auto", "42", "int", int64(42)},
+		{"auto", "-4.5", "float", -4.5},
+		{"auto", "1e3", "float", 1000.0},
+		{"auto", "true", "bool", true},
+		{"auto", "up", "string", "up"},
+		{"integer", "7", "int", int64(7)},
+		{"float", "7", "float", 7.0},
+		{"boolean", "false", "bool", false},
+		{"string", "7", "string", "7"},
+		{"duration", "2m", "duration", int64(120)},
+	}
+	for _, tt := range tests {
+		v := &ValueParser{MetricName: "exec", DataType: tt.dataType}
+		m, valueType, err := v.ParseWithType([]byte(tt.buf))
+		if err != nil {
+			t.Errorf("%s %q: %s", tt.dataType, tt.buf, err)
+			continue
+		}
+		if valueType != tt.want || m.Fields()["value"] != tt.value {
+			t.Errorf("%s %q: expected %s %v, got %s %v", tt.dataType, tt.buf,
+				tt.want, tt.value, valueType, m.Fields()["value"])
+		}
+	}
+
+	// the type that failed to parse is reported with the error
+	v := &ValueParser{MetricName: "exec", DataType: "integer"}
+	if _, valueType, err := v.ParseWithType([]byte("x")); err == nil || valueType != "int" {
+		t.Errorf("expected an int error, got %s %v", valueType, err)
+	}
+}
+
+func TestValueParserStringFieldRegex(t *testing.T) {
+	buf := "state: online since 10:00\n"
+	tests := []struct {
+		regex string
+		want  interface{}
+		err   bool
+	}{
+		{"", "state: online since 10:00", false},
+		{`state: (\w+)`, "online", false},
+		{`status: (\w+)`, nil, true},
+	}
+	for _, tt := range tests {
+		parser, err := NewParser(&ParserConfig{DataFormat: "value",
+			MetricName: "svc", DataType: "string", StringFieldRegex: tt.regex})
+		if err != nil {
+			t.Fatal(err)
+		}
+		metrics, err := parser.Parse([]byte(buf))
+		if (err != nil) != tt.err {
+			t.Errorf("%q: unexpected error %v", tt.regex, err)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+		if got := metrics[0].Fields()["value"]; got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.regex, tt.want, got)
+		}
+	}
+
+	for _, regex := range []string{`state: \w+`, `(`} {
+		_, err := NewParser(&ParserConfig{DataFormat: "value",
+			MetricName: "svc", DataType: "string", StringFieldRegex: regex})
+		if err == nil {
+			t.Errorf("%q: expected an error", regex)
+		}
+	}
+}
+
+func TestValueParserFieldName(t *testing.T) {
+	for _, tt := range []struct{ name, want string }{
+		{"", "value"},
+		{"temperature", "temperature"},
+	} {
+		v := &ValueParser{MetricName: "sensor", DataType: "float", FieldName: tt.name}
+		m, err := v.ParseLine("21.5")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{tt.want: 21.5}
+		if !reflect.DeepEqual(m.Fields(), want) {
+			t.Errorf("%q: expected %v, got %v", tt.name, want, m.Fields())
+		}
+	}
+}
+
+func TestValueParserKeepRaw(t *testing.T) {
+	buf := "  used 42 \r\n"
+	for _, tt := range []struct{ field, want string }{
+		{"", "raw"},
+		{"output", "output"},
+	} {
+		v := &ValueParser{MetricName: "exec", DataType: "integer", KeepRaw: true,
+			RawField: tt.field}
+		metrics, err := v.Parse([]byte(buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{"value": int64(42), tt.want: buf}
+		if !reflect.DeepEqual(metrics[0].Fields(), want) {
+			t.Errorf("%q: expected %v, got %v", tt.field, want, metrics[0].Fields())
+		}
+	}
+
+	v := &ValueParser{MetricName: "exec", DataType: "integer"}
+	m, err := v.ParseLine("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Fields()["raw"]; ok {
+		t.Error("expected no raw field without keep_raw")
+	}
+}
+
+func TestValueParserUnsupportedDataType(t *testing.T) {
+	v := &ValueParser{MetricName: "exec", DataType: "decimal"}
+	for _, buf := range []string{"42", "used 42", "x"} {
+		metrics, err := v.Parse([]byte(buf))
+		if err == nil {
+			t.Errorf("%q: expected an error", buf)
+		}
+		if len(metrics) != 0 {
+			t.Errorf("%q: expected no metric, got %v", buf, metrics)
+		}
+		if m, err := v.ParseLine(buf); err == nil || m != nil {
+			t.Errorf("%q: expected an error and no metric, got %v %v", buf, m, err)
+		}
+	}
+
+	_, err := NewParser(&ParserConfig{DataFormat: "value", MetricName: "exec",
+		DataType: "decimal"})
+	if err == nil {
+		t.Error("expected the parser of an unsupported data type to be an error")
+	}
+}
+
+func TestValueParserFieldSeparator(t *testing.T) {
+	tests := []struct {
+		separator string
+		buf       string
+		want      int64
+	}{
+		{",", "disk0,reads,42", 42},
+		{",", "disk0, reads , 42 \n", 42},
+		{"\t", "disk0\treads\t42", 42},
+		{"\t", "disk 0\tread count\t42", 42},
+		{"", "disk0 reads\t42", 42},
+	}
+	for _, tt := range tests {
+		v := &ValueParser{MetricName: "exec", DataType: "integer",
+			FieldSeparator: tt.separator}
+		m, err := v.ParseLine(tt.buf)
+		if err != nil {
+			t.Errorf("%q: %s", tt.buf, err)
+			continue
+		}
+		if got := m.Fields()["value"]; got != tt.want {
+			t.Errorf("%q split on %q: expected %d, got %v", tt.buf, tt.separator,
+				tt.want, got)
+		}
+	}
+
+	// the fields of another separator are not split
+	v := &ValueParser{MetricName: "exec", DataType: "integer", FieldSeparator: ","}
+	if m, err := v.ParseLine("disk0\t42"); err == nil {
+		t.Errorf("expected an error, got %v", m)
+	}
+}
+
+func TestValueParserStrictSingleValue(t *testing.T) {
+	tests := []struct {
+		strict   bool
+		dataType string
+		buf      string
+		want     interface{}
+		err      bool
+	}{
+		{true, "integer", "42\n", int64(42), false},
+		{true, "integer", "used 42", nil, true},
+		{true, "integer", "1 2 3", nil, true},
+		{false, "integer", "used 42", int64(42), false},
+		// strings are not split
+		{true, "string", "up since monday", "up since monday", false},
+	}
+	for _, tt := range tests {
+		v := &ValueParser{MetricName: "exec", DataType: tt.dataType,
+			StrictSingleValue: tt.strict}
+		metrics, err := v.Parse([]byte(tt.buf))
+		if (err != nil) != tt.err {
+			t.Errorf("%q strict %v: unexpected error %v", tt.buf, tt.strict, err)
+			continue
+		}
+		if tt.err {
+			if len(metrics) != 0 {
+				t.Errorf("%q strict %v: expected no metric, got %v", tt.buf,
+					tt.strict, metrics)
+			}
+			continue
+		}
+		if got := metrics[0].Fields()["value"]; got != tt.want {
+			t.Errorf("%q strict %v: expected %v, got %v", tt.buf, tt.strict,
+				tt.want, got)
+		}
+	}
+}